@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"github.com/piotrostr/moon/base58"
+)
+
+// hexAddresses renders addresses as hex instead of base58 on the console
+// and in sink records, for comparing against raw frames.
+var hexAddresses bool
+
+func formatAddress(addr [32]byte) string {
+	if hexAddresses {
+		return hex.EncodeToString(addr[:])
+	}
+	return base58.Encode(addr[:])
+}
+
+// displayAddress renders an address kept as base58 text, as in tombstones
+// and trade orders, the way formatAddress does. Text that is not an
+// address is returned as it is.
+func displayAddress(s string) string {
+	addr, err := decodeAddress(s)
+	if err != nil {
+		return s
+	}
+	return formatAddress(addr)
+}
+
+// decodeAddress parses a base58 Solana address into its 32 raw bytes. It
+// also takes the 64 hex digits -hex-addresses prints, which base58 text
+// of 32 bytes is never long enough to be.
+func decodeAddress(s string) ([32]byte, error) {
+	var addr [32]byte
+	if len(s) == 2*len(addr) {
+		if _, err := hex.Decode(addr[:], []byte(s)); err == nil {
+			return addr, nil
+		}
+	}
+	data, err := base58.Decode(s)
+	if err != nil {
+		return addr, err
+	}
+	if len(data) != 32 {
+		return addr, errors.New("address must decode to 32 bytes")
+	}
+	copy(addr[:], data)
+	return addr, nil
+}
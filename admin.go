@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Admin reconfigures a running instance without restarting the stream:
+// which events reach each sink, pausing and resuming sinks, reconnecting
+// streams and the console log level. run serves it on the unix socket
+// given by -admin-socket, for `moon ctl`.
+type Admin struct {
+	pipelines []*Pipeline
+	streams   []*Stream
+
+	// serializes filter edits, which read and replace a sink's filter
+	mu sync.Mutex
+}
+
+func NewAdmin(pipelines []*Pipeline, streams []*Stream) *Admin {
+	return &Admin{pipelines: pipelines, streams: streams}
+}
+
+// SinkStatus is a sink as the admin API lists it. Paused is only set by
+// the admin API, not by the breaker after failed deliveries.
+type SinkStatus struct {
+	Name      string       `json:"name"`
+	Paused    bool         `json:"paused"`
+	Disabled  bool         `json:"disabled"`
+	Filter    FilterConfig `json:"filter"`
+	Queued    int          `json:"queued"`
+	Delivered int64        `json:"delivered"`
+	Failed    int64        `json:"failed"`
+	Dropped   int64        `json:"dropped"`
+}
+
+func (a *Admin) Sinks() []SinkStatus {
+	sinks := make([]SinkStatus, len(a.pipelines))
+	for i, p := range a.pipelines {
+		sinks[i] = SinkStatus{
+			Name:      p.Name(),
+			Paused:    p.held.Load(),
+			Disabled:  p.disabled.Load(),
+			Filter:    p.Filter(),
+			Queued:    len(p.queue),
+			Delivered: p.delivered.Load(),
+			Failed:    p.failed.Load(),
+			Dropped:   p.dropped.Load(),
+		}
+	}
+	return sinks
+}
+
+func (a *Admin) sink(name string) (*Pipeline, error) {
+	for _, p := range a.pipelines {
+		if p.Name() == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("no sink named %q", name)
+}
+
+// EditFilter adds events and excluded events to the sink's filter, or
+// removes them with remove.
+func (a *Admin) EditFilter(name string, events, excluded []string, remove bool) (FilterConfig, error) {
+	p, err := a.sink(name)
+	if err != nil {
+		return FilterConfig{}, err
+	}
+	known := make(map[string]bool)
+	for _, e := range schemaEvents() {
+		known[e.name] = true
+	}
+	for _, event := range append(slices.Clone(events), excluded...) {
+		if !known[event] {
+			return FilterConfig{}, fmt.Errorf("unknown event %q", event)
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	filter := p.Filter()
+	filter.Events = editEvents(filter.Events, events, remove)
+	filter.ExcludeEvents = editEvents(filter.ExcludeEvents, excluded, remove)
+	p.SetFilter(filter)
+	return filter, nil
+}
+
+// editEvents returns a copy of list with events added or removed; the
+// old list may still be in use matching events.
+func editEvents(list, events []string, remove bool) []string {
+	edited := slices.Clone(list)
+	for _, event := range events {
+		i := slices.Index(edited, event)
+		switch {
+		case remove && i >= 0:
+			edited = slices.Delete(edited, i, i+1)
+		case !remove && i < 0:
+			edited = append(edited, event)
+		}
+	}
+	return edited
+}
+
+// Reconnect drops the connection of stream conn, or of every stream when
+// conn is negative.
+func (a *Admin) Reconnect(conn int) error {
+	if conn >= len(a.streams) {
+		return fmt.Errorf("no connection %d, have %d", conn, len(a.streams))
+	}
+	for _, stream := range a.streams {
+		if conn < 0 || stream.ID == conn {
+			stream.Reconnect()
+		}
+	}
+	return nil
+}
+
+// RegisterAdmin mounts the admin API:
+//
+//	GET    /admin/sinks                                  sinks and their filters
+//	POST   /admin/sinks/{name}/pause                     hold back deliveries in the outbox
+//	POST   /admin/sinks/{name}/resume                    deliver again
+//	POST   /admin/sinks/{name}/filter?event=..&exclude=..  add to the filter
+//	DELETE /admin/sinks/{name}/filter?event=..&exclude=..  remove from it
+//	POST   /admin/reconnect?conn=0                       reconnect one or all streams
+//	GET    /admin/log-level                              console log level
+//	PUT    /admin/log-level?level=debug                  set it
+func RegisterAdmin(server *Server, admin *Admin) {
+	server.HandleJSON("GET /admin/sinks", func(r *http.Request) (any, error) {
+		return admin.Sinks(), nil
+	})
+	resume := func(p *Pipeline) error { p.Resume(); return nil }
+	for action, apply := range map[string]func(*Pipeline) error{"pause": (*Pipeline).Pause, "resume": resume} {
+		server.HandleJSON("POST /admin/sinks/{name}/"+action, func(r *http.Request) (any, error) {
+			p, err := admin.sink(r.PathValue("name"))
+			if err != nil {
+				return nil, err
+			}
+			if err := apply(p); err != nil {
+				return nil, err
+			}
+			return admin.Sinks(), nil
+		})
+	}
+	editFilter := func(remove bool) func(r *http.Request) (any, error) {
+		return func(r *http.Request) (any, error) {
+			query := r.URL.Query()
+			if len(query["event"]) == 0 && len(query["exclude"]) == 0 {
+				return nil, errors.New("filter edit needs event or exclude")
+			}
+			return admin.EditFilter(r.PathValue("name"), query["event"], query["exclude"], remove)
+		}
+	}
+	server.HandleJSON("POST /admin/sinks/{name}/filter", editFilter(false))
+	server.HandleJSON("DELETE /admin/sinks/{name}/filter", editFilter(true))
+	server.HandleJSON("POST /admin/reconnect", func(r *http.Request) (any, error) {
+		conn := -1
+		if s := r.URL.Query().Get("conn"); s != "" {
+			var err error
+			if conn, err = strconv.Atoi(s); err != nil || conn < 0 {
+				return nil, fmt.Errorf("invalid conn %q", s)
+			}
+		}
+		if err := admin.Reconnect(conn); err != nil {
+			return nil, err
+		}
+		return map[string]int{"conn": conn}, nil
+	})
+	server.HandleJSON("GET /admin/log-level", func(r *http.Request) (any, error) {
+		return map[string]string{"level": verbosityName()}, nil
+	})
+	server.HandleJSON("PUT /admin/log-level", func(r *http.Request) (any, error) {
+		if err := setVerbosity(r.URL.Query().Get("level")); err != nil {
+			return nil, err
+		}
+		return map[string]string{"level": verbosityName()}, nil
+	})
+}
+
+const ctlUsage = `usage: moon ctl [-socket path] <command>
+
+  sinks                                  list sinks, their filters and counters
+  pause <sink>, resume <sink>            hold back or resume a sink's deliveries (needs an outbox)
+  filter <sink> add|remove <event>...    edit the events a sink is sent
+  filter <sink> exclude|include <event>... edit the events a sink is not sent
+  reconnect [conn]                       reconnect one or all streams
+  log-level [quiet|normal|verbose|debug] show or set the console log level`
+
+// runCtl implements `moon ctl`, which talks to a running instance over
+// its admin socket.
+func runCtl(args []string) error {
+	fs := flag.NewFlagSet("ctl", flag.ExitOnError)
+	socket := fs.String("socket", "moon.sock", "admin socket of the running instance (its -admin-socket)")
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) == 0 {
+		return errors.New(ctlUsage)
+	}
+
+	method, path, query := http.MethodGet, "", url.Values{}
+	switch cmd := args[0]; {
+	case cmd == "sinks" && len(args) == 1:
+		path = "/admin/sinks"
+	case (cmd == "pause" || cmd == "resume") && len(args) == 2:
+		method, path = http.MethodPost, "/admin/sinks/"+url.PathEscape(args[1])+"/"+cmd
+	case cmd == "filter" && len(args) >= 4:
+		path = "/admin/sinks/" + url.PathEscape(args[1]) + "/filter"
+		key := "event"
+		switch args[2] {
+		case "add":
+			method = http.MethodPost
+		case "remove":
+			method = http.MethodDelete
+		case "exclude":
+			method, key = http.MethodPost, "exclude"
+		case "include":
+			method, key = http.MethodDelete, "exclude"
+		default:
+			return errors.New(ctlUsage)
+		}
+		query[key] = args[3:]
+	case cmd == "reconnect" && len(args) <= 2:
+		method, path = http.MethodPost, "/admin/reconnect"
+		if len(args) == 2 {
+			query.Set("conn", args[1])
+		}
+	case cmd == "log-level" && len(args) == 1:
+		path = "/admin/log-level"
+	case cmd == "log-level" && len(args) == 2:
+		method, path = http.MethodPut, "/admin/log-level"
+		query.Set("level", args[1])
+	default:
+		return errors.New(ctlUsage)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", *socket)
+		},
+	}}
+	req, err := http.NewRequest(method, "http://moon"+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ctl request error (is moon running with -admin-socket %s?): %v", *socket, err)
+	}
+	defer resp.Body.Close()
+	var result any
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("ctl response error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := result.(map[string]any)
+		message, _ := body["error"].(string)
+		return fmt.Errorf("ctl request failed: %s %s", resp.Status, message)
+	}
+	out, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(console, string(out))
+	return nil
+}
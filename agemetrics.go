@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Ages at which AgeMetrics checkpoints every pair. The leaderboards rank
+// volume at 5 minutes and the price multiple at 15 minutes.
+var checkpointAges = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour}
+
+const (
+	leaderboardVolumeAge   = 5 * time.Minute
+	leaderboardMultipleAge = 15 * time.Minute
+)
+
+// AgeCheckpointEvent is a pair's volume and price multiple as it reaches
+// a fixed age, so launches seen at different times compare like for like.
+// Ages count from discovery; the feed's volume is a rolling 24h figure, so
+// early on it is the volume since launch.
+type AgeCheckpointEvent struct {
+	sourced
+	PairAddress [32]byte
+	TokenSymbol string
+	Age         time.Duration
+	Volume      float64
+	Price       float64
+	Multiple    float64
+	At          time.Time
+	Block       uint32
+}
+
+func (e *AgeCheckpointEvent) EventName() string { return "age_checkpoint" }
+
+// AgeMetrics publishes an AgeCheckpointEvent the first time a pair updates
+// at or after each checkpoint age. A checkpoint whose first update comes
+// more than half its age late is skipped rather than reported with data
+// from a different moment.
+type AgeMetrics struct {
+	ages  []time.Duration
+	store *PairStore
+	bus   *EventBus
+
+	mu      sync.Mutex
+	reached map[[32]byte]int
+}
+
+func NewAgeMetrics(ages []time.Duration, store *PairStore, bus *EventBus) *AgeMetrics {
+	return &AgeMetrics{ages: ages, store: store, bus: bus, reached: make(map[[32]byte]int)}
+}
+
+func (m *AgeMetrics) Observe(event Event) {
+	switch e := event.(type) {
+	case *PairUpdatedEvent:
+		m.observe(e)
+	case *PairDeadEvent:
+		if addr, err := decodeAddress(e.Tombstone.PairAddress); err == nil {
+			m.mu.Lock()
+			delete(m.reached, addr)
+			m.mu.Unlock()
+		}
+	}
+}
+
+func (m *AgeMetrics) observe(e *PairUpdatedEvent) {
+	tracked, ok := m.store.Get(e.Pair.PairAddress)
+	if !ok {
+		return
+	}
+	age := e.At.Sub(tracked.FirstSeen)
+
+	m.mu.Lock()
+	next := m.reached[e.Pair.PairAddress]
+	var due []time.Duration
+	for next < len(m.ages) && age >= m.ages[next] {
+		if age < m.ages[next]*3/2 {
+			due = append(due, m.ages[next])
+		}
+		next++
+	}
+	m.reached[e.Pair.PairAddress] = next
+	m.mu.Unlock()
+
+	for _, checkpoint := range due {
+		var multiple float64
+		if tracked.InitialPrice > 0 {
+			multiple = e.Pair.Price / tracked.InitialPrice
+		}
+		m.bus.Publish(&AgeCheckpointEvent{
+			sourced:     e.sourced,
+			PairAddress: e.Pair.PairAddress,
+			TokenSymbol: e.Pair.TokenSymbol,
+			Age:         checkpoint,
+			Volume:      e.Pair.Volume,
+			Price:       e.Pair.Price,
+			Multiple:    multiple,
+			At:          e.At,
+			Block:       e.Block,
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const (
+	// recentAlerts is how many alerts are kept for listing and acknowledging.
+	recentAlerts = 200
+	// alertIDBlock IDs are reserved on disk at a time, so numbering carries
+	// on after a restart without a write per alert.
+	alertIDBlock = 100
+	// ackRetention is how long an ack suppresses its rule for the pair.
+	ackRetention = 7 * 24 * time.Hour
+)
+
+// Mute silences alerts for a pair, a rule (alert kind) or both until
+// Until. An empty Pair or Rule matches any.
+type Mute struct {
+	Pair  string    `json:"pair,omitempty"`
+	Rule  string    `json:"rule,omitempty"`
+	Until time.Time `json:"until"`
+}
+
+func (m Mute) matches(alert *AlertEvent) bool {
+	return (m.Pair == "" || m.Pair == alert.PairAddress) && (m.Rule == "" || m.Rule == alert.Kind)
+}
+
+// Ack records that someone saw an alert. Further alerts of the same rule
+// for the same pair are suppressed until the ack is cleared or is older
+// than ackRetention.
+type Ack struct {
+	AlertID int       `json:"alertId"`
+	Pair    string    `json:"pair,omitempty"`
+	Rule    string    `json:"rule"`
+	By      string    `json:"by,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+type alertState struct {
+	// NextID is the last alert ID reserved; IDs after a restart start
+	// above it.
+	NextID int    `json:"nextId"`
+	Mutes  []Mute `json:"mutes"`
+	Acks   []Ack  `json:"acks"`
+}
+
+// AlertControl numbers alerts and drops muted and acknowledged ones before
+// they reach sinks or the console. Its state is saved to path on every
+// change so mutes survive restarts.
+type AlertControl struct {
+	path string
+
+	mu     sync.Mutex
+	state  alertState
+	lastID int
+	recent []AlertEvent
+}
+
+func NewAlertControl(path string) (*AlertControl, error) {
+	c := &AlertControl{path: path}
+	if path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read alert state: %v", err)
+	}
+	if err := json.Unmarshal(data, &c.state); err != nil {
+		return nil, fmt.Errorf("parse alert state %s: %v", path, err)
+	}
+	c.lastID = c.state.NextID
+	return c, nil
+}
+
+// Filter is an EventBus filter.
+func (c *AlertControl) Filter(event Event) bool {
+	alert, ok := event.(*AlertEvent)
+	if !ok {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastID++
+	alert.ID = c.lastID
+	if c.lastID > c.state.NextID {
+		c.state.NextID = c.lastID + alertIDBlock - 1
+		if err := c.save(); err != nil {
+			color.Red("Error saving alert state: %v", err)
+		}
+	}
+	if c.suppressed(alert) {
+		return false
+	}
+	c.recent = append(c.recent, *alert)
+	if len(c.recent) > recentAlerts {
+		c.recent = c.recent[len(c.recent)-recentAlerts:]
+	}
+	return true
+}
+
+func (c *AlertControl) suppressed(alert *AlertEvent) bool {
+	for _, mute := range c.state.Mutes {
+		if mute.matches(alert) && alert.At.Before(mute.Until) {
+			return true
+		}
+	}
+	for _, ack := range c.state.Acks {
+		if ack.Rule == alert.Kind && ack.Pair == alert.PairAddress && alert.At.Before(ack.At.Add(ackRetention)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mute silences pair and/or rule for d.
+func (c *AlertControl) Mute(pair, rule string, d time.Duration) (Mute, error) {
+	if pair == "" && rule == "" {
+		return Mute{}, errors.New("mute needs a pair or a rule")
+	}
+	if d <= 0 {
+		return Mute{}, errors.New("mute duration must be positive")
+	}
+	mute := Mute{Pair: pair, Rule: rule, Until: time.Now().Add(d)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.Mutes = append(c.active(), mute)
+	return mute, c.save()
+}
+
+// Unmute removes mutes for exactly pair and rule.
+func (c *AlertControl) Unmute(pair, rule string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kept := c.state.Mutes[:0]
+	for _, mute := range c.active() {
+		if mute.Pair != pair || mute.Rule != rule {
+			kept = append(kept, mute)
+		}
+	}
+	c.state.Mutes = kept
+	return c.save()
+}
+
+// active drops expired mutes and returns the rest.
+func (c *AlertControl) active() []Mute {
+	now := time.Now()
+	active := c.state.Mutes[:0]
+	for _, mute := range c.state.Mutes {
+		if now.Before(mute.Until) {
+			active = append(active, mute)
+		}
+	}
+	return active
+}
+
+// Acknowledge acks a recent alert by ID.
+func (c *AlertControl) Acknowledge(id int, by string) (Ack, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, alert := range c.recent {
+		if alert.ID == id {
+			ack := Ack{AlertID: id, Pair: alert.PairAddress, Rule: alert.Kind, By: by, At: time.Now()}
+			c.state.Acks = append(c.current(), ack)
+			return ack, c.save()
+		}
+	}
+	return Ack{}, fmt.Errorf("no recent alert %d", id)
+}
+
+// Unacknowledge clears the ack for an alert so its rule can fire again.
+func (c *AlertControl) Unacknowledge(id int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kept := c.state.Acks[:0]
+	for _, ack := range c.current() {
+		if ack.AlertID != id {
+			kept = append(kept, ack)
+		}
+	}
+	c.state.Acks = kept
+	return c.save()
+}
+
+// Recent returns recent alerts, newest first.
+func (c *AlertControl) Recent() []AlertEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	alerts := make([]AlertEvent, len(c.recent))
+	for i, alert := range c.recent {
+		alerts[len(alerts)-1-i] = alert
+	}
+	return alerts
+}
+
+func (c *AlertControl) Mutes() []Mute {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Mute(nil), c.active()...)
+}
+
+func (c *AlertControl) Acks() []Ack {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Ack(nil), c.current()...)
+}
+
+// current drops acks past retention and returns the rest.
+func (c *AlertControl) current() []Ack {
+	cutoff := time.Now().Add(-ackRetention)
+	current := c.state.Acks[:0]
+	for _, ack := range c.state.Acks {
+		if ack.At.After(cutoff) {
+			current = append(current, ack)
+		}
+	}
+	c.state.Acks = current
+	return current
+}
+
+func (c *AlertControl) save() error {
+	if c.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(c.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path, data, 0o644)
+}
+
+// RegisterAlertControl mounts the alert API:
+//
+//	GET    /alerts                           recent alerts
+//	POST   /alerts/{id}/ack?by=name          acknowledge
+//	DELETE /alerts/{id}/ack                  clear an ack
+//	GET    /mutes                            active mutes
+//	POST   /mutes?pair=..&rule=..&minutes=30 mute
+//	DELETE /mutes?pair=..&rule=..            unmute
+func RegisterAlertControl(server *Server, control *AlertControl) {
+	server.HandleJSON("GET /alerts", func(r *http.Request) (any, error) {
+		return control.Recent(), nil
+	})
+	server.HandleJSON("POST /alerts/{id}/ack", func(r *http.Request) (any, error) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid alert id: %v", err)
+		}
+		return control.Acknowledge(id, r.URL.Query().Get("by"))
+	})
+	server.HandleJSON("DELETE /alerts/{id}/ack", func(r *http.Request) (any, error) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid alert id: %v", err)
+		}
+		if err := control.Unacknowledge(id); err != nil {
+			return nil, err
+		}
+		return control.Acks(), nil
+	})
+	server.HandleJSON("GET /mutes", func(r *http.Request) (any, error) {
+		return control.Mutes(), nil
+	})
+	server.HandleJSON("POST /mutes", func(r *http.Request) (any, error) {
+		query := r.URL.Query()
+		minutes, err := strconv.Atoi(query.Get("minutes"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid minutes: %v", err)
+		}
+		return control.Mute(query.Get("pair"), query.Get("rule"), time.Duration(minutes)*time.Minute)
+	})
+	server.HandleJSON("DELETE /mutes", func(r *http.Request) (any, error) {
+		query := r.URL.Query()
+		if err := control.Unmute(query.Get("pair"), query.Get("rule")); err != nil {
+			return nil, err
+		}
+		return control.Mutes(), nil
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type AnomalyDetectedEvent struct {
+	sourced
+	PairAddress [32]byte
+	TokenSymbol string
+	Metric      string
+	Value       float64
+	Mean        float64
+	StdDev      float64
+	ZScore      float64
+	At          time.Time
+}
+
+func (e *AnomalyDetectedEvent) EventName() string { return "anomaly_detected" }
+
+type AnomalyConfig struct {
+	// Alpha is the EWMA smoothing factor; higher reacts faster.
+	Alpha float64
+	// Threshold is the absolute z-score that counts as an anomaly.
+	Threshold float64
+	// Warmup is the number of samples before a series can flag anything.
+	Warmup int
+}
+
+func DefaultAnomalyConfig() AnomalyConfig {
+	return AnomalyConfig{
+		Alpha:     0.1,
+		Threshold: 4,
+		Warmup:    20,
+	}
+}
+
+// ewma tracks an exponentially weighted mean and variance.
+type ewma struct {
+	mean     float64
+	variance float64
+	samples  int
+}
+
+// observe returns the z-score of x against the state before x is folded in.
+func (e *ewma) observe(x, alpha float64) float64 {
+	if e.samples == 0 {
+		e.mean = x
+		e.samples++
+		return 0
+	}
+
+	var z float64
+	if std := math.Sqrt(e.variance); std > 0 {
+		z = (x - e.mean) / std
+	}
+
+	diff := x - e.mean
+	incr := alpha * diff
+	e.mean += incr
+	e.variance = (1 - alpha) * (e.variance + diff*incr)
+	e.samples++
+
+	return z
+}
+
+type pairSeries struct {
+	lastPrice  float64
+	lastVolume float64
+	returns    ewma
+	volume     ewma
+}
+
+// AnomalyDetector flags price moves and volume changes that are abnormal
+// relative to each pair's own recent history.
+type AnomalyDetector struct {
+	config AnomalyConfig
+	bus    *EventBus
+
+	mu     sync.Mutex
+	series map[[32]byte]*pairSeries
+}
+
+func NewAnomalyDetector(config AnomalyConfig, bus *EventBus) *AnomalyDetector {
+	return &AnomalyDetector{
+		config: config,
+		bus:    bus,
+		series: make(map[[32]byte]*pairSeries),
+	}
+}
+
+func (d *AnomalyDetector) Observe(event Event) {
+	switch e := event.(type) {
+	case *PairUpdatedEvent:
+		d.observe(e.Pair, e.At, e.sourced)
+	case *PairDeadEvent:
+		d.mu.Lock()
+		if addr, err := decodeAddress(e.Tombstone.PairAddress); err == nil {
+			delete(d.series, addr)
+		}
+		d.mu.Unlock()
+	}
+}
+
+func (d *AnomalyDetector) observe(pair PairData, at time.Time, source sourced) {
+	d.mu.Lock()
+	s, ok := d.series[pair.PairAddress]
+	if !ok {
+		s = &pairSeries{lastPrice: pair.Price, lastVolume: pair.Volume}
+		d.series[pair.PairAddress] = s
+		d.mu.Unlock()
+		return
+	}
+
+	var anomalies []*AnomalyDetectedEvent
+	if s.lastPrice > 0 && pair.Price > 0 {
+		if a := d.check(&s.returns, "price_return", math.Log(pair.Price/s.lastPrice), pair, at); a != nil {
+			anomalies = append(anomalies, a)
+		}
+	}
+	if delta := pair.Volume - s.lastVolume; delta >= 0 {
+		if a := d.check(&s.volume, "volume_delta", delta, pair, at); a != nil {
+			anomalies = append(anomalies, a)
+		}
+	}
+	s.lastPrice = pair.Price
+	s.lastVolume = pair.Volume
+	d.mu.Unlock()
+
+	for _, a := range anomalies {
+		a.sourced = source
+		d.bus.Publish(a)
+	}
+}
+
+func (d *AnomalyDetector) check(series *ewma, metric string, x float64, pair PairData, at time.Time) *AnomalyDetectedEvent {
+	mean, variance, warm := series.mean, series.variance, series.samples >= d.config.Warmup
+	z := series.observe(x, d.config.Alpha)
+	if !warm || math.Abs(z) < d.config.Threshold {
+		return nil
+	}
+
+	return &AnomalyDetectedEvent{
+		PairAddress: pair.PairAddress,
+		TokenSymbol: pair.TokenSymbol,
+		Metric:      metric,
+		Value:       x,
+		Mean:        mean,
+		StdDev:      math.Sqrt(variance),
+		ZScore:      z,
+		At:          at,
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !lite
+
+package main
+
+import (
+	"cmp"
+	"crypto/tls"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// autocertTLS gets and renews certificates for c.Autocert from Let's
+// Encrypt, keeping them in c.CacheDir.
+func autocertTLS(c *TLSConfig) (*tls.Config, error) {
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(c.Autocert...),
+		Cache:      autocert.DirCache(cmp.Or(c.CacheDir, "autocert")),
+		Email:      c.Email,
+	}
+	return manager.TLSConfig(), nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/piotrostr/moon/base58"
+)
+
+const (
+	dexscreenerPairsURL  = "https://api.dexscreener.com/latest/dex/pairs/solana/"
+	dexscreenerTokensURL = "https://api.dexscreener.com/latest/dex/tokens/"
+)
+
+// the REST endpoint accepts at most this many comma separated addresses
+const restPairsBatchSize = 30
+
+type RESTPair struct {
+	ChainID     string `json:"chainId"`
+	DexID       string `json:"dexId"`
+	PairAddress string `json:"pairAddress"`
+	BaseToken   struct {
+		Address string `json:"address"`
+		Name    string `json:"name"`
+		Symbol  string `json:"symbol"`
+	} `json:"baseToken"`
+	QuoteToken struct {
+		Symbol string `json:"symbol"`
+	} `json:"quoteToken"`
+	PriceUsd string `json:"priceUsd"`
+	Volume   struct {
+		H24 float64 `json:"h24"`
+	} `json:"volume"`
+	Info struct {
+		ImageURL string `json:"imageUrl"`
+	} `json:"info"`
+}
+
+type BackfillCompletedEvent struct {
+	Gap   *GapDetectedEvent
+	Pairs []RESTPair
+}
+
+func (e *BackfillCompletedEvent) EventName() string { return "backfill_completed" }
+func (e *BackfillCompletedEvent) Source() string    { return SourceREST }
+
+// RESTBackfiller refreshes the state of known pairs from the dexscreener REST
+// API after a gap. The REST API only serves current state, so this recovers
+// where pairs ended up rather than every update inside the gap.
+type RESTBackfiller struct {
+	client *http.Client
+	known  func() [][32]byte
+}
+
+func NewRESTBackfiller(known func() [][32]byte) *RESTBackfiller {
+	return &RESTBackfiller{
+		client: &http.Client{Timeout: 15 * time.Second},
+		known:  known,
+	}
+}
+
+func (b *RESTBackfiller) Backfill(ctx context.Context, gap *GapDetectedEvent) (*BackfillCompletedEvent, error) {
+	addresses := b.known()
+	result := &BackfillCompletedEvent{Gap: gap}
+
+	for start := 0; start < len(addresses); start += restPairsBatchSize {
+		batch := addresses[start:min(start+restPairsBatchSize, len(addresses))]
+		pairs, err := b.fetch(ctx, batch)
+		if err != nil {
+			return result, err
+		}
+		result.Pairs = append(result.Pairs, pairs...)
+	}
+
+	return result, nil
+}
+
+func (b *RESTBackfiller) fetch(ctx context.Context, addresses [][32]byte) ([]RESTPair, error) {
+	encoded := make([]string, len(addresses))
+	for i, addr := range addresses {
+		encoded[i] = base58.Encode(addr[:])
+	}
+	return fetchRESTPairs(ctx, b.client, encoded)
+}
+
+// fetchRESTPairs looks up at most restPairsBatchSize base58 pair addresses.
+func fetchRESTPairs(ctx context.Context, client *http.Client, addresses []string) ([]RESTPair, error) {
+	return getRESTPairs(ctx, client, dexscreenerPairsURL+strings.Join(addresses, ","))
+}
+
+// fetchRESTTokenPairs looks up the pairs of at most restPairsBatchSize
+// token mints, on every chain.
+func fetchRESTTokenPairs(ctx context.Context, client *http.Client, mints []string) ([]RESTPair, error) {
+	return getRESTPairs(ctx, client, dexscreenerTokensURL+strings.Join(mints, ","))
+}
+
+func getRESTPairs(ctx context.Context, client *http.Client, url string) ([]RESTPair, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("dexscreener request error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("dexscreener request failed: %s", resp.Status)
+	}
+
+	var body struct {
+		Pairs []RESTPair `json:"pairs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("dexscreener decode error: %v", err)
+	}
+
+	return body.Pairs, nil
+}
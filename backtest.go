@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Tick is one recorded pair update. Recordings are the JSON lines a file
+// sink writes for pair_updated events.
+type Tick struct {
+	Event       string    `json:"event"`
+	PairAddress string    `json:"pairAddress"`
+	TokenSymbol string    `json:"tokenSymbol"`
+	Price       float64   `json:"price"`
+	Volume      float64   `json:"volume"`
+	At          time.Time `json:"at"`
+	// ServerBlock is the feed's block when the update arrived; older
+	// recordings lack it.
+	ServerBlock uint32 `json:"serverBlock,omitempty"`
+}
+
+// tickBefore orders by the feed's block where both ticks have one, so a
+// local clock step during recording does not reorder history.
+func tickBefore(a, b Tick) bool {
+	if a.ServerBlock != 0 && b.ServerBlock != 0 && a.ServerBlock != b.ServerBlock {
+		return a.ServerBlock < b.ServerBlock
+	}
+	return a.At.Before(b.At)
+}
+
+// PairHistory is a pair's recorded ticks in time order.
+type PairHistory struct {
+	PairAddress string
+	TokenSymbol string
+	Ticks       []Tick
+}
+
+func (h PairHistory) FirstSeen() time.Time { return h.Ticks[0].At }
+
+// LoadHistories reads recorded pair updates from path, ignoring other
+// events, and returns one history per pair ordered by first sighting.
+func LoadHistories(path string) ([]PairHistory, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open recording: %v", err)
+	}
+	defer file.Close()
+
+	byPair := make(map[string]*PairHistory)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var tick Tick
+		if err := json.Unmarshal(scanner.Bytes(), &tick); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		if (tick.Event != "" && tick.Event != "pair_updated") || tick.PairAddress == "" || tick.Price <= 0 {
+			continue
+		}
+		h, ok := byPair[tick.PairAddress]
+		if !ok {
+			h = &PairHistory{PairAddress: tick.PairAddress, TokenSymbol: tick.TokenSymbol}
+			byPair[tick.PairAddress] = h
+		}
+		h.Ticks = append(h.Ticks, tick)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	histories := make([]PairHistory, 0, len(byPair))
+	for _, h := range byPair {
+		sort.SliceStable(h.Ticks, func(i, j int) bool { return tickBefore(h.Ticks[i], h.Ticks[j]) })
+		histories = append(histories, *h)
+	}
+	sort.Slice(histories, func(i, j int) bool { return histories[i].FirstSeen().Before(histories[j].FirstSeen()) })
+	return histories, nil
+}
+
+// StrategyParams is the simple launch strategy the backtester replays:
+// buy the first update at least EntryDelay after discovery with 24h volume
+// of at least MinVolume, then exit on TakeProfit or StopLoss percent, or
+// at the last recorded price.
+type StrategyParams struct {
+	MinVolume  float64       `json:"minVolume"`
+	EntryDelay time.Duration `json:"entryDelay"`
+	TakeProfit float64       `json:"takeProfit"`
+	StopLoss   float64       `json:"stopLoss"`
+}
+
+func (p StrategyParams) String() string {
+	return fmt.Sprintf("volume>=%g delay=%s tp=%g%% sl=%g%%", p.MinVolume, p.EntryDelay, p.TakeProfit, p.StopLoss)
+}
+
+func (p StrategyParams) exits() []ExitRule {
+	var exits []ExitRule
+	if p.TakeProfit > 0 {
+		exits = append(exits, ExitRule{Kind: "take_profit", Percent: p.TakeProfit})
+	}
+	if p.StopLoss > 0 {
+		exits = append(exits, ExitRule{Kind: "stop_loss", Percent: p.StopLoss})
+	}
+	return exits
+}
+
+type BacktestTrade struct {
+	PairAddress string    `json:"pairAddress"`
+	TokenSymbol string    `json:"tokenSymbol"`
+	EntryAt     time.Time `json:"entryAt"`
+	ExitAt      time.Time `json:"exitAt"`
+	EntryPrice  float64   `json:"entryPrice"`
+	ExitPrice   float64   `json:"exitPrice"`
+	ExitRule    string    `json:"exitRule"`
+	Return      float64   `json:"return"`
+}
+
+// BacktestResult measures returns per unit staked on every trade.
+type BacktestResult struct {
+	Params      StrategyParams  `json:"params"`
+	Trades      []BacktestTrade `json:"trades"`
+	TotalReturn float64         `json:"totalReturn"`
+	HitRate     float64         `json:"hitRate"`
+	MaxDrawdown float64         `json:"maxDrawdown"`
+}
+
+func Backtest(histories []PairHistory, params StrategyParams) BacktestResult {
+	result := BacktestResult{Params: params}
+	exits := params.exits()
+
+	for _, h := range histories {
+		trade, ok := backtestPair(h, params, exits)
+		if ok {
+			result.Trades = append(result.Trades, trade)
+		}
+	}
+	sort.Slice(result.Trades, func(i, j int) bool { return result.Trades[i].ExitAt.Before(result.Trades[j].ExitAt) })
+
+	var wins int
+	var equity, peak float64
+	for _, trade := range result.Trades {
+		if trade.Return > 0 {
+			wins++
+		}
+		equity += trade.Return
+		peak = max(peak, equity)
+		result.MaxDrawdown = max(result.MaxDrawdown, peak-equity)
+	}
+	result.TotalReturn = equity
+	if len(result.Trades) > 0 {
+		result.HitRate = float64(wins) / float64(len(result.Trades))
+	}
+	return result
+}
+
+func backtestPair(h PairHistory, params StrategyParams, exits []ExitRule) (BacktestTrade, bool) {
+	first := h.FirstSeen()
+	entry := -1
+	for i, tick := range h.Ticks {
+		if tick.At.Sub(first) >= params.EntryDelay && tick.Volume >= params.MinVolume {
+			entry = i
+			break
+		}
+	}
+	if entry < 0 || entry == len(h.Ticks)-1 {
+		return BacktestTrade{}, false
+	}
+
+	trade := BacktestTrade{
+		PairAddress: h.PairAddress,
+		TokenSymbol: h.TokenSymbol,
+		EntryAt:     h.Ticks[entry].At,
+		EntryPrice:  h.Ticks[entry].Price,
+	}
+	peak := trade.EntryPrice
+	last := h.Ticks[len(h.Ticks)-1]
+	trade.ExitAt, trade.ExitPrice, trade.ExitRule = last.At, last.Price, "end_of_data"
+
+ticks:
+	for _, tick := range h.Ticks[entry+1:] {
+		peak = max(peak, tick.Price)
+		for _, rule := range exits {
+			if rule.Triggered(tick.Price, trade.EntryPrice, peak) {
+				trade.ExitAt, trade.ExitPrice, trade.ExitRule = tick.At, tick.Price, rule.String()
+				break ticks
+			}
+		}
+	}
+	trade.Return = trade.ExitPrice/trade.EntryPrice - 1
+	return trade, true
+}
+
+func printBacktest(result BacktestResult) {
+	color.Blue("Backtest %s", result.Params)
+	printRow := color.Green
+	if result.TotalReturn < 0 {
+		printRow = color.Red
+	}
+	printRow("  trades=%d hit=%.1f%% total=%+.2f units max drawdown=%.2f units",
+		len(result.Trades), result.HitRate*100, result.TotalReturn, result.MaxDrawdown)
+}
+
+// runBacktest implements `moon backtest`, replaying one parameter set over
+// a recording.
+func runBacktest(args []string) error {
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	path := fs.String("data", "pairs.jsonl", "recorded pair_updated events (file sink output)")
+	minVolume := fs.Float64("min-volume", 0, "minimum 24h volume at entry")
+	entryDelay := fs.Duration("entry-delay", 0, "minimum pair age at entry")
+	takeProfit := fs.Float64("take-profit", 100, "take profit percent (0 to disable)")
+	stopLoss := fs.Float64("stop-loss", 50, "stop loss percent (0 to disable)")
+	verbose := fs.Bool("trades", false, "print every trade")
+	simulations := fs.Int("simulations", 10000, "Monte Carlo paths (0 to skip)")
+	mcTrades := fs.Int("mc-trades", 0, "trades per Monte Carlo path (default: as many as the backtest)")
+	stake := fs.Float64("stake", 5, "percent of bankroll staked per trade in the simulation")
+	ruin := fs.Float64("ruin", 50, "bankroll percent counted as ruin")
+	seed := fs.Uint64("seed", 1, "Monte Carlo random seed")
+	fs.Parse(args)
+
+	histories, err := LoadHistories(*path)
+	if err != nil {
+		return err
+	}
+	if len(histories) == 0 {
+		return errors.New("recording has no pair updates")
+	}
+
+	result := Backtest(histories, StrategyParams{
+		MinVolume:  *minVolume,
+		EntryDelay: *entryDelay,
+		TakeProfit: *takeProfit,
+		StopLoss:   *stopLoss,
+	})
+	if *verbose {
+		for _, t := range result.Trades {
+			color.White("  %s %-10s %g -> %g %+.1f%% (%s)", t.EntryAt.Format(time.RFC3339), t.TokenSymbol,
+				t.EntryPrice, t.ExitPrice, t.Return*100, t.ExitRule)
+		}
+	}
+	printBacktest(result)
+
+	if *simulations > 0 && len(result.Trades) > 0 {
+		trades := *mcTrades
+		if trades <= 0 {
+			trades = len(result.Trades)
+		}
+		printMonteCarlo(MonteCarlo(tradeReturns(result.Trades), MonteCarloConfig{
+			Simulations:  *simulations,
+			Trades:       trades,
+			StakePercent: *stake,
+			RuinPercent:  *ruin,
+			Seed:         *seed,
+		}))
+	}
+	return nil
+}
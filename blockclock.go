@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Solana's target slot time, used until the cadence has been measured.
+const defaultSlotDuration = 400 * time.Millisecond
+
+// BlockClock maps local time to block numbers using LatestBlockHash
+// messages, extrapolating between them with the measured block cadence.
+type BlockClock struct {
+	mu           sync.RWMutex
+	block        uint32
+	at           time.Time
+	slotDuration time.Duration
+}
+
+func NewBlockClock() *BlockClock {
+	return &BlockClock{slotDuration: defaultSlotDuration}
+}
+
+func (c *BlockClock) Observe(block uint32, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if block <= c.block {
+		return
+	}
+	if c.block != 0 {
+		measured := at.Sub(c.at) / time.Duration(block-c.block)
+		if measured > 0 {
+			// smooth so a single delayed message does not skew the estimate
+			c.slotDuration = (c.slotDuration*9 + measured) / 10
+		}
+	}
+	c.block = block
+	c.at = at
+}
+
+// BlockAt estimates the block being produced at t, or 0 before the first
+// LatestBlockHash message.
+func (c *BlockClock) BlockAt(t time.Time) uint32 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.block == 0 {
+		return 0
+	}
+	elapsed := t.Sub(c.at)
+	if elapsed <= 0 {
+		return c.block
+	}
+	return c.block + uint32(elapsed/c.slotDuration)
+}
+
+// Latest is the last block announced by the feed and when it arrived,
+// without extrapolation; it only moves when the server says so.
+func (c *BlockClock) Latest() (uint32, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.block, c.at
+}
+
+func (c *BlockClock) SlotDuration() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.slotDuration
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	candleInterval = time.Minute
+	// one day of 1m candles per pair
+	maxCandlesPerPair = 1440
+)
+
+type Candle struct {
+	Time   time.Time `json:"time"`
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Volume float64   `json:"volume"`
+}
+
+type pairCandles struct {
+	symbol     string
+	candles    []Candle
+	lastVolume float64
+}
+
+// CandleStore builds 1m OHLCV candles from pair updates, bucketed by
+// clock. The stream only carries a rolling 24h volume, so candle volume is
+// the positive change in that figure and is approximate.
+type CandleStore struct {
+	mu    sync.RWMutex
+	clock Clock
+	pairs map[[32]byte]*pairCandles
+}
+
+func NewCandleStore(clock Clock) *CandleStore {
+	return &CandleStore{clock: clock, pairs: make(map[[32]byte]*pairCandles)}
+}
+
+func (s *CandleStore) Observe(event Event) {
+	if e, ok := event.(*PairUpdatedEvent); ok {
+		s.Add(e.Pair, s.clock.Now())
+	}
+}
+
+// Now is the time on the store's clock, which queries default to.
+func (s *CandleStore) Now() time.Time { return s.clock.Now() }
+
+func (s *CandleStore) Add(pair PairData, at time.Time) {
+	bucket := at.Truncate(candleInterval)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pc, ok := s.pairs[pair.PairAddress]
+	if !ok {
+		pc = &pairCandles{lastVolume: pair.Volume}
+		s.pairs[pair.PairAddress] = pc
+	}
+	pc.symbol = pair.TokenSymbol
+
+	volume := pair.Volume - pc.lastVolume
+	if volume < 0 {
+		volume = 0
+	}
+	pc.lastVolume = pair.Volume
+
+	if n := len(pc.candles); n > 0 && pc.candles[n-1].Time.Equal(bucket) {
+		c := &pc.candles[n-1]
+		c.High = max(c.High, pair.Price)
+		c.Low = min(c.Low, pair.Price)
+		c.Close = pair.Price
+		c.Volume += volume
+		return
+	}
+
+	pc.candles = append(pc.candles, Candle{
+		Time:   bucket,
+		Open:   pair.Price,
+		High:   pair.Price,
+		Low:    pair.Price,
+		Close:  pair.Price,
+		Volume: volume,
+	})
+	if len(pc.candles) > maxCandlesPerPair {
+		pc.candles = pc.candles[len(pc.candles)-maxCandlesPerPair:]
+	}
+}
+
+// Range returns candles for addr in [from, to), aggregated to resolution.
+func (s *CandleStore) Range(addr [32]byte, resolution time.Duration, from, to time.Time) []Candle {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pc, ok := s.pairs[addr]
+	if !ok {
+		return nil
+	}
+
+	var out []Candle
+	for _, c := range pc.candles {
+		if c.Time.Before(from) || !c.Time.Before(to) {
+			continue
+		}
+		bucket := c.Time.Truncate(resolution)
+		if n := len(out); n > 0 && out[n-1].Time.Equal(bucket) {
+			last := &out[n-1]
+			last.High = max(last.High, c.High)
+			last.Low = min(last.Low, c.Low)
+			last.Close = c.Close
+			last.Volume += c.Volume
+			continue
+		}
+		c.Time = bucket
+		out = append(out, c)
+	}
+	return out
+}
+
+// Symbols returns the token symbol of every pair with candles.
+func (s *CandleStore) Symbols() map[[32]byte]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	symbols := make(map[[32]byte]string, len(s.pairs))
+	for addr, pc := range s.pairs {
+		symbols[addr] = pc.symbol
+	}
+	return symbols
+}
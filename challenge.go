@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/piotrostr/moon/stream"
+)
+
+// ChallengeConfig clears Cloudflare challenges on the feed handshake with
+// cookies from outside moon. Command runs an external solver, such as a
+// FlareSolverr client script, with the URL as its last argument; CookieFile
+// is read instead, so a solver running on its own can keep it fresh. Both
+// produce a clearance document:
+//
+//	{"cookies": {"cf_clearance": "..."}, "userAgent": "Mozilla/5.0 ..."}
+//
+// The user agent must be the one the cookies were issued to.
+type ChallengeConfig struct {
+	Command    []string `json:"command,omitempty"`
+	CookieFile string   `json:"cookieFile,omitempty"`
+	// Timeout bounds one run of Command; the default is two minutes.
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+func (c *ChallengeConfig) Validate() error {
+	if (len(c.Command) == 0) == (c.CookieFile == "") {
+		return errors.New("challenge needs exactly one of command or cookieFile")
+	}
+	if c.Timeout < 0 {
+		return errors.New("challenge timeout must not be negative")
+	}
+	return nil
+}
+
+// clearanceDocument is what solvers write.
+type clearanceDocument struct {
+	Cookies   map[string]string `json:"cookies"`
+	UserAgent string            `json:"userAgent"`
+}
+
+func parseClearance(data []byte) (*stream.Clearance, error) {
+	var doc clearanceDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse clearance: %v", err)
+	}
+	names := make([]string, 0, len(doc.Cookies))
+	for name := range doc.Cookies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	clearance := &stream.Clearance{UserAgent: doc.UserAgent}
+	for _, name := range names {
+		clearance.Cookies = append(clearance.Cookies, &http.Cookie{Name: name, Value: doc.Cookies[name]})
+	}
+	return clearance, nil
+}
+
+// Solver returns the challenge solver for the stream, or nil without a
+// config.
+func (c *ChallengeConfig) Solver() stream.ChallengeSolver {
+	if c == nil {
+		return nil
+	}
+	if c.CookieFile != "" {
+		return stream.ChallengeSolverFunc(func(ctx context.Context, url string, challenge *stream.ChallengeError) (*stream.Clearance, error) {
+			data, err := os.ReadFile(c.CookieFile)
+			if err != nil {
+				return nil, err
+			}
+			return parseClearance(data)
+		})
+	}
+	return stream.ChallengeSolverFunc(func(ctx context.Context, url string, challenge *stream.ChallengeError) (*stream.Clearance, error) {
+		timeout := time.Duration(c.Timeout)
+		if timeout == 0 {
+			timeout = 2 * time.Minute
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, c.Command[0], append(c.Command[1:], url)...)
+		cmd.Env = append(os.Environ(), "MOON_CHALLENGE_STATUS="+strconv.Itoa(challenge.Status), "MOON_CHALLENGE_RAY="+challenge.RayID)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", c.Command[0], err)
+		}
+		return parseClearance(out)
+	})
+}
+
+// Clearance is the clearance to start with: the cookie file's, if it
+// exists, so a restart does not need a fresh challenge first.
+func (c *ChallengeConfig) Clearance() *stream.Clearance {
+	if c == nil || c.CookieFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.CookieFile)
+	if err != nil {
+		return nil
+	}
+	clearance, err := parseClearance(data)
+	if err != nil {
+		return nil
+	}
+	return clearance
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// ChaosConfig degrades the feed on purpose so alerting and execution can be
+// checked against a lagging, lossy, flapping source.
+type ChaosConfig struct {
+	Latency time.Duration
+	// Jitter adds up to this much extra latency per frame, at random.
+	Jitter   time.Duration
+	DropRate float64
+	// DisconnectRate is the chance per frame that a connection goes silent
+	// for Outage, as if it had dropped.
+	DisconnectRate float64
+	Outage         time.Duration
+}
+
+func (c ChaosConfig) Enabled() bool {
+	return c.Latency > 0 || c.Jitter > 0 || c.DropRate > 0 || c.DisconnectRate > 0
+}
+
+// Chaos sits between the streams and the pipeline.
+type Chaos struct {
+	config ChaosConfig
+	rng    *rand.Rand
+	// down maps a connection to the end of its simulated outage
+	down map[int]time.Time
+}
+
+func NewChaos(config ChaosConfig, seed uint64) *Chaos {
+	return &Chaos{
+		config: config,
+		rng:    rand.New(rand.NewPCG(seed, seed)),
+		down:   make(map[int]time.Time),
+	}
+}
+
+// delayedFrame is a frame held back until at.
+type delayedFrame struct {
+	frame Frame
+	at    time.Time
+}
+
+// Pipe forwards frames from in to out until ctx is done, delaying, dropping
+// and cutting them off per the config. Simulated disconnects are reported
+// on errs like real connection errors. Delayed frames wait in a queue for
+// their arrival time plus delay, so the delay adds latency without
+// limiting throughput, and frames leave in the order they came.
+func (c *Chaos) Pipe(ctx context.Context, in <-chan Frame, out chan<- Frame, errs chan<- error) {
+	var queue []delayedFrame
+	defer func() {
+		for _, d := range queue {
+			d.frame.Release()
+		}
+	}()
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		// only offer the head to out once it is due, and otherwise wake
+		// up when it will be
+		var send chan<- Frame
+		var head Frame
+		var due <-chan time.Time
+		if len(queue) > 0 {
+			if wait := time.Until(queue[0].at); wait <= 0 {
+				send, head = out, queue[0].frame
+			} else {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(wait)
+				due = timer.C
+			}
+		}
+
+		var frame Frame
+		select {
+		case frame = <-in:
+		case send <- head:
+			queue[0] = delayedFrame{}
+			queue = queue[1:]
+			continue
+		case <-due:
+			continue
+		case <-ctx.Done():
+			return
+		}
+
+		now := time.Now()
+		if until, ok := c.down[frame.ConnID]; ok {
+			if now.Before(until) {
+				frame.Release()
+				continue
+			}
+			delete(c.down, frame.ConnID)
+			color.Yellow("[chaos] conn %d back after simulated outage", frame.ConnID)
+		}
+		if c.config.DisconnectRate > 0 && c.rng.Float64() < c.config.DisconnectRate {
+			c.down[frame.ConnID] = now.Add(c.config.Outage)
+			frame.Release()
+			select {
+			case errs <- fmt.Errorf("[chaos] conn %d: simulated disconnect for %v", frame.ConnID, c.config.Outage):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		if c.config.DropRate > 0 && c.rng.Float64() < c.config.DropRate {
+			frame.Release()
+			continue
+		}
+
+		delay := c.config.Latency
+		if c.config.Jitter > 0 {
+			delay += time.Duration(c.rng.Int64N(int64(c.config.Jitter)))
+		}
+		at := now.Add(delay)
+		if n := len(queue); n > 0 && at.Before(queue[n-1].at) {
+			// jitter must not reorder frames
+			at = queue[n-1].at
+		}
+		queue = append(queue, delayedFrame{frame: frame, at: at})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// PairComparison is one column of `moon compare`, built from a pair's
+// stored snapshots. The feed carries neither liquidity nor holders, so
+// market cap at discovery stands in for initial liquidity.
+type PairComparison struct {
+	PairAddress      string    `json:"pairAddress"`
+	TokenSymbol      string    `json:"tokenSymbol"`
+	FirstSeen        time.Time `json:"firstSeen"`
+	Snapshots        int       `json:"snapshots"`
+	InitialPrice     float64   `json:"initialPrice"`
+	InitialMarketCap float64   `json:"initialMarketCap"`
+	Price            float64   `json:"price"`
+	Multiple         float64   `json:"multiple"`
+	PeakMultiple     float64   `json:"peakMultiple"`
+	Volume           float64   `json:"volume"`
+	// TimeToVolume maps each volume threshold to the age in seconds at
+	// which the pair first reached it; unreached thresholds are absent.
+	TimeToVolume map[string]float64 `json:"timeToVolume"`
+}
+
+// loadSnapshots reads the snapshots of the given pairs from every tier
+// file in dir, oldest first.
+func loadSnapshots(dir string, pairs []string) (map[string][]Snapshot, error) {
+	wanted := make(map[string]bool)
+	for _, pair := range pairs {
+		wanted[pair] = true
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+
+	history := make(map[string][]Snapshot)
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var snapshot Snapshot
+			if err := json.Unmarshal(scanner.Bytes(), &snapshot); err != nil || !wanted[snapshot.PairAddress] {
+				continue
+			}
+			history[snapshot.PairAddress] = append(history[snapshot.PairAddress], snapshot)
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("read %s: %v", path, err)
+		}
+	}
+	for _, snapshots := range history {
+		sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].At.Before(snapshots[j].At) })
+	}
+	return history, nil
+}
+
+// ComparePairs summarizes each pair's history, in the order given; pairs
+// without snapshots are left out.
+func ComparePairs(history map[string][]Snapshot, pairs []string, supply float64, volumes []float64) []PairComparison {
+	var comparisons []PairComparison
+	for _, pair := range pairs {
+		snapshots := history[pair]
+		if len(snapshots) == 0 {
+			continue
+		}
+		first, last := snapshots[0], snapshots[len(snapshots)-1]
+		c := PairComparison{
+			PairAddress:      pair,
+			TokenSymbol:      last.TokenSymbol,
+			FirstSeen:        first.At.Add(-time.Duration(first.Age * float64(time.Second))),
+			Snapshots:        len(snapshots),
+			InitialPrice:     first.Price,
+			InitialMarketCap: first.Price * supply,
+			Price:            last.Price,
+			Volume:           last.Volume,
+			TimeToVolume:     make(map[string]float64),
+		}
+		for _, s := range snapshots {
+			if first.Price > 0 {
+				c.PeakMultiple = max(c.PeakMultiple, s.Price/first.Price)
+			}
+			for _, v := range volumes {
+				key := strconv.FormatFloat(v, 'g', -1, 64)
+				if _, ok := c.TimeToVolume[key]; !ok && s.Volume >= v {
+					c.TimeToVolume[key] = s.Age
+				}
+			}
+		}
+		if first.Price > 0 {
+			c.Multiple = last.Price / first.Price
+		}
+		comparisons = append(comparisons, c)
+	}
+	return comparisons
+}
+
+func parseVolumes(s string) ([]float64, error) {
+	var volumes []float64
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid volume threshold %q: %v", field, err)
+		}
+		volumes = append(volumes, v)
+	}
+	return volumes, nil
+}
+
+const defaultCompareVolumes = "10000,50000,100000"
+
+// HandleCompare serves /compare?pairs=a,b&volumes=10000,50000 from the
+// snapshots in dir.
+func HandleCompare(dir string, supply float64) func(r *http.Request) (any, error) {
+	return func(r *http.Request) (any, error) {
+		query := r.URL.Query()
+		pairs := strings.Split(query.Get("pairs"), ",")
+		if query.Get("pairs") == "" {
+			return nil, errors.New("pairs is required")
+		}
+		volumes, err := parseVolumes(cmp.Or(query.Get("volumes"), defaultCompareVolumes))
+		if err != nil {
+			return nil, err
+		}
+		history, err := loadSnapshots(dir, pairs)
+		if err != nil {
+			return nil, err
+		}
+		return ComparePairs(history, pairs, supply, volumes), nil
+	}
+}
+
+// runCompare implements `moon compare addr1 addr2 ...`, reading the
+// snapshot directory directly.
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	dir := fs.String("snapshots", "snapshots", "snapshot directory written by the stream")
+	volumeList := fs.String("volumes", defaultCompareVolumes, "comma-separated volume thresholds to time")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		return errors.New("usage: moon compare [flags] pairAddress...")
+	}
+
+	volumes, err := parseVolumes(*volumeList)
+	if err != nil {
+		return err
+	}
+	pairs := fs.Args()
+	history, err := loadSnapshots(*dir, pairs)
+	if err != nil {
+		return err
+	}
+	comparisons := ComparePairs(history, pairs, DefaultLifecycleConfig().TokenSupply, volumes)
+	for _, pair := range pairs {
+		if len(history[pair]) == 0 {
+			color.Yellow("No snapshots for %s", pair)
+		}
+	}
+	if len(comparisons) == 0 {
+		return errors.New("nothing to compare")
+	}
+	printComparisons(comparisons, volumes)
+	return nil
+}
+
+func printComparisons(comparisons []PairComparison, volumes []float64) {
+	// plain numbers: colored ones would break the column widths
+	en := numberLocales["en"]
+	row := func(label string, cell func(c PairComparison) string) {
+		fmt.Fprintf(console, "%-20s", label)
+		for _, c := range comparisons {
+			fmt.Fprintf(console, " %-16s", cell(c))
+		}
+		fmt.Fprintln(console)
+	}
+
+	fmt.Fprintf(console, "%-20s", "")
+	for _, c := range comparisons {
+		color.New(color.FgBlue).Printf(" %-16s", c.TokenSymbol)
+	}
+	fmt.Fprintln(console)
+	row("pair", func(c PairComparison) string { return c.PairAddress[:min(16, len(c.PairAddress))] })
+	row("first seen", func(c PairComparison) string { return c.FirstSeen.UTC().Format("01-02 15:04:05") })
+	row("snapshots", func(c PairComparison) string { return strconv.Itoa(c.Snapshots) })
+	row("initial mcap", func(c PairComparison) string { return en.USD(c.InitialMarketCap) })
+	row("initial price", func(c PairComparison) string { return en.Price(c.InitialPrice) })
+	row("price", func(c PairComparison) string { return en.Price(c.Price) })
+	row("multiple", func(c PairComparison) string { return fmt.Sprintf("%.2fx", c.Multiple) })
+	row("peak multiple", func(c PairComparison) string { return fmt.Sprintf("%.2fx", c.PeakMultiple) })
+	row("volume", func(c PairComparison) string { return en.USD(c.Volume) })
+	for _, v := range volumes {
+		key := strconv.FormatFloat(v, 'g', -1, 64)
+		row("time to "+en.USD(v), func(c PairComparison) string {
+			age, ok := c.TimeToVolume[key]
+			if !ok {
+				return "-"
+			}
+			return time.Duration(age * float64(time.Second)).Round(time.Second).String()
+		})
+	}
+}
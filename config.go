@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Config is the optional JSON config file passed with -config. Flags cover
+// the stream itself; the file holds structured settings like sinks.
+// Credentials should be written as secret references such as
+// ${env:WEBHOOK_URL} rather than inline values.
+type Config struct {
+	Sinks    []SinkConfig    `json:"sinks"`
+	Executor *ExecutorConfig `json:"executor,omitempty"`
+	Trading  *TradingConfig  `json:"trading,omitempty"`
+	Rules    []RuleConfig    `json:"rules,omitempty"`
+	Telegram *TelegramConfig `json:"telegram,omitempty"`
+	// Holders samples the holder count of launched tokens.
+	Holders *HolderConfig `json:"holders,omitempty"`
+	// HTTP adds token auth and TLS to the -http server.
+	HTTP *HTTPConfig `json:"http,omitempty"`
+	// Subscription sets the stream filters; flags override it.
+	Subscription *SubscriptionConfig `json:"subscription,omitempty"`
+	// Challenge clears Cloudflare challenges on the feed handshake.
+	Challenge *ChallengeConfig `json:"challenge,omitempty"`
+	// Costs prices buy signals and drops those whose costs dominate.
+	Costs *CostConfig `json:"costs,omitempty"`
+	// Retention bounds stored snapshots and tombstones.
+	Retention RetentionConfig `json:"retention"`
+	// Locale picks the number separators in alert messages: en (default),
+	// de, es, fr or ru.
+	Locale string `json:"locale,omitempty"`
+	// Locales is a directory of <language>.json alert catalogs adding to
+	// the built-in en, pl and zh ones, for sinks and the Telegram bot with
+	// a language set.
+	Locales string `json:"locales,omitempty"`
+}
+
+// Duration is a time.Duration written as a string like "90s" in config.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"90s\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func LoadConfig(path string) (*Config, error) {
+	if path == "" {
+		return &Config{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %v", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse config %s: %v", path, err)
+	}
+
+	for i := range config.Sinks {
+		sink := &config.Sinks[i]
+		if err := sink.expandSecrets(); err != nil {
+			return nil, fmt.Errorf("sink %d (%s): %v", i, sink.Name, err)
+		}
+		if err := sink.Validate(); err != nil {
+			return nil, fmt.Errorf("sink %d (%s): %v", i, sink.Name, err)
+		}
+	}
+
+	if config.Executor != nil {
+		if err := config.Executor.expandSecrets(); err != nil {
+			return nil, fmt.Errorf("executor: %v", err)
+		}
+		if err := config.Executor.Validate(); err != nil {
+			return nil, fmt.Errorf("executor: %v", err)
+		}
+	}
+
+	if config.Telegram != nil {
+		if err := config.Telegram.expandSecrets(); err != nil {
+			return nil, fmt.Errorf("telegram: %v", err)
+		}
+		if err := config.Telegram.Validate(); err != nil {
+			return nil, fmt.Errorf("telegram: %v", err)
+		}
+	}
+
+	if config.Holders != nil {
+		if err := config.Holders.expandSecrets(); err != nil {
+			return nil, fmt.Errorf("holders: %v", err)
+		}
+		config.Holders.setDefaults()
+		if err := config.Holders.Validate(); err != nil {
+			return nil, fmt.Errorf("holders: %v", err)
+		}
+	}
+
+	if config.HTTP != nil {
+		if err := config.HTTP.expandSecrets(); err != nil {
+			return nil, fmt.Errorf("http: %v", err)
+		}
+		if err := config.HTTP.Validate(); err != nil {
+			return nil, fmt.Errorf("http: %v", err)
+		}
+	}
+
+	if config.Subscription != nil {
+		if err := config.Subscription.Validate(); err != nil {
+			return nil, fmt.Errorf("subscription: %v", err)
+		}
+	}
+
+	if config.Challenge != nil {
+		if err := config.Challenge.Validate(); err != nil {
+			return nil, fmt.Errorf("challenge: %v", err)
+		}
+	}
+
+	if config.Costs != nil {
+		if err := config.Costs.Validate(); err != nil {
+			return nil, fmt.Errorf("costs: %v", err)
+		}
+	}
+
+	if _, err := lookupLocale(config.Locale); err != nil {
+		return nil, err
+	}
+	if _, err := config.Localizer(nil); err != nil {
+		return nil, err
+	}
+	for _, rule := range config.Rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Trading != nil {
+		if err := config.Trading.Validate(); err != nil {
+			return nil, fmt.Errorf("trading: %v", err)
+		}
+		if config.Trading.Mode == "live" && config.Executor == nil {
+			return nil, errors.New("trading: live mode requires an executor section")
+		}
+	}
+
+	return &config, nil
+}
+
+// NumberLocale is the validated Locale.
+func (c *Config) NumberLocale() NumberLocale {
+	locale, _ := lookupLocale(c.Locale)
+	return locale
+}
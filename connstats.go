@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/piotrostr/moon/stream"
+)
+
+const (
+	// connStatsInterval is how often connection rates are sampled.
+	connStatsInterval = 10 * time.Second
+	// throughputBaselineWindow sets how slowly the baseline follows the
+	// observed throughput.
+	throughputBaselineWindow = 30 * time.Minute
+	// throughputLowSlowdown slows the baseline further while throughput is
+	// low, so a short throttle barely moves it but a lasting change in the
+	// feed still becomes the new normal within a few hours.
+	throughputLowSlowdown = 10
+	// throughputWarmup samples are needed before the baseline is trusted.
+	throughputWarmup = 30
+	// throughputLowSamples in a row below the baseline raise the warning.
+	throughputLowSamples = 3
+)
+
+// ConnStatus is a connection's totals with its current rates.
+type ConnStatus struct {
+	stream.ConnStats
+	FramesPerSecond  float64 `json:"framesPerSecond"`
+	BytesPerSecond   float64 `json:"bytesPerSecond"`
+	CompressionRatio float64 `json:"compressionRatio"`
+	// Baseline is the usual payload bytes per second, 0 while warming up.
+	Baseline  float64 `json:"baseline"`
+	Throttled bool    `json:"throttled"`
+}
+
+type connState struct {
+	ConnStatus
+	sampledAt time.Time
+	samples   int
+	lowFor    int
+}
+
+// ConnMonitor samples the streams' traffic and warns when a connection's
+// throughput drops below threshold times its baseline, which is often the
+// first sign of the feed silently throttling it. The baseline is a slow
+// moving average that moves ten times slower while throughput is low.
+type ConnMonitor struct {
+	streams   []*Stream
+	bus       *EventBus
+	threshold float64
+
+	mu    sync.Mutex
+	conns []connState
+}
+
+// NewConnMonitor warns below threshold times the baseline; 0 disables
+// the warning but keeps the stats.
+func NewConnMonitor(streams []*Stream, bus *EventBus, threshold float64) *ConnMonitor {
+	return &ConnMonitor{streams: streams, bus: bus, threshold: threshold, conns: make([]connState, len(streams))}
+}
+
+// Sample updates the rates from the streams' counters.
+func (m *ConnMonitor) Sample(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, s := range m.streams {
+		stats := s.Stats()
+		c := &m.conns[i]
+		prev, prevAt := c.ConnStats, c.sampledAt
+		c.ConnStats, c.sampledAt = stats, now
+		c.CompressionRatio = stats.CompressionRatio()
+		// a reconnect or a disconnected interval says nothing about throttling
+		if prevAt.IsZero() || !stats.Connected || stats.Connects != prev.Connects || stats.ConnectedAt.After(prevAt) {
+			c.FramesPerSecond, c.BytesPerSecond, c.lowFor = 0, 0, 0
+			continue
+		}
+		elapsed := now.Sub(prevAt).Seconds()
+		c.FramesPerSecond = float64(stats.Frames-prev.Frames) / elapsed
+		c.BytesPerSecond = float64(stats.PayloadBytes-prev.PayloadBytes) / elapsed
+		m.observe(c, now)
+	}
+}
+
+func (m *ConnMonitor) observe(c *connState, now time.Time) {
+	c.samples++
+	if c.samples == 1 {
+		c.Baseline = c.BytesPerSecond
+	}
+	low := c.samples > throughputWarmup && m.threshold > 0 && c.BytesPerSecond < m.threshold*c.Baseline
+	alpha := float64(connStatsInterval) / float64(throughputBaselineWindow)
+	if low {
+		alpha /= throughputLowSlowdown
+	}
+	baseline := c.Baseline
+	c.Baseline += alpha * (c.BytesPerSecond - c.Baseline)
+	if !low {
+		c.lowFor = 0
+		if c.Throttled {
+			c.Throttled = false
+			color.Green("[conn %d] Throughput back to %s/s", c.ID, formatBytes(c.BytesPerSecond))
+		}
+		return
+	}
+	if c.lowFor++; c.lowFor == throughputLowSamples {
+		c.Throttled = true
+		m.bus.Publish(&AlertEvent{
+			Kind: "throughput",
+			Message: fmt.Sprintf("conn %d receives %s/s, %.0f%% of its %s/s baseline; the feed may be throttling it",
+				c.ID, formatBytes(c.BytesPerSecond), c.BytesPerSecond/baseline*100, formatBytes(baseline)),
+			At: now,
+		})
+	}
+}
+
+func (m *ConnMonitor) Status() []ConnStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := make([]ConnStatus, len(m.conns))
+	for i, c := range m.conns {
+		status[i] = c.ConnStatus
+		// totals are current even between samples
+		status[i].ConnStats = m.streams[i].Stats()
+		status[i].CompressionRatio = status[i].ConnStats.CompressionRatio()
+		if c.samples <= throughputWarmup {
+			status[i].Baseline = 0
+		}
+	}
+	return status
+}
+
+// HandleStatus serves GET /status.
+func (m *ConnMonitor) HandleStatus(r *http.Request) (any, error) {
+	return map[string]any{"connections": m.Status()}, nil
+}
+
+func registerConnMetrics(metrics *Metrics, monitor *ConnMonitor) {
+	for i, s := range monitor.streams {
+		label := fmt.Sprintf("{conn=\"%d\"}", s.ID)
+		field := func(value func(ConnStatus) float64) func() float64 {
+			return func() float64 { return value(monitor.Status()[i]) }
+		}
+		metrics.Gauge("moon_conn_connected"+label, "Whether the connection is open.",
+			field(func(c ConnStatus) float64 { return boolGauge(c.Connected) }))
+		metrics.Counter("moon_conn_connects_total"+label, "Connections opened, including reconnects.",
+			field(func(c ConnStatus) float64 { return float64(c.Connects) }))
+		metrics.Counter("moon_conn_frames_total"+label, "Frames received.",
+			field(func(c ConnStatus) float64 { return float64(c.Frames) }))
+		metrics.Counter("moon_conn_payload_bytes_total"+label, "Frame bytes received after decompression.",
+			field(func(c ConnStatus) float64 { return float64(c.PayloadBytes) }))
+		metrics.Counter("moon_conn_wire_bytes_total"+label, "Bytes read off the socket, with TLS and compression applied.",
+			field(func(c ConnStatus) float64 { return float64(c.WireBytes) }))
+		metrics.Gauge("moon_conn_frames_per_second"+label, "Frames per second over the last sample.",
+			field(func(c ConnStatus) float64 { return c.FramesPerSecond }))
+		metrics.Gauge("moon_conn_bytes_per_second"+label, "Payload bytes per second over the last sample.",
+			field(func(c ConnStatus) float64 { return c.BytesPerSecond }))
+		metrics.Gauge("moon_conn_compression_ratio"+label, "Payload bytes per wire byte.",
+			field(func(c ConnStatus) float64 { return c.CompressionRatio }))
+		metrics.Gauge("moon_conn_throughput_baseline"+label, "Usual payload bytes per second (0 while warming up).",
+			field(func(c ConnStatus) float64 { return c.Baseline }))
+		metrics.Gauge("moon_conn_throttled"+label, "Whether throughput is below the warning threshold.",
+			field(func(c ConnStatus) float64 { return boolGauge(c.Throttled) }))
+	}
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. 12.3 KiB.
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
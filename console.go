@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// With colors off (NO_COLOR or -no-color) the output is usually going to a
+// log collector, so events are printed as single logfmt lines instead of
+// the interactive wording.
+
+// stripNoColor removes -no-color from args, wherever it appears, and
+// disables colors. fatih/color already honors NO_COLOR.
+func stripNoColor(args []string) []string {
+	kept := args[:0:0]
+	for _, arg := range args {
+		if arg == "-no-color" || arg == "--no-color" {
+			color.NoColor = true
+			continue
+		}
+		kept = append(kept, arg)
+	}
+	return kept
+}
+
+func printPlainEvent(event Event) {
+	record := eventRecord(event)
+	delete(record, "event")
+	fmt.Fprintln(console, logfmt(time.Now(), event.EventName(), record))
+}
+
+// logfmt renders key=value pairs after the time and event, keys sorted so
+// lines of one event type line up.
+func logfmt(at time.Time, event string, record Record) string {
+	keys := make([]string, 0, len(record))
+	for key := range record {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("time=" + at.UTC().Format(time.RFC3339Nano) + " event=" + event)
+	for _, key := range keys {
+		b.WriteString(" " + key + "=" + logfmtValue(record[key]))
+	}
+	return b.String()
+}
+
+func logfmtValue(v any) string {
+	var s string
+	switch v := v.(type) {
+	case float64:
+		s = strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		s = v
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " \"=\t\n\r") || !strconv.CanBackquote(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
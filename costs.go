@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// ataRentLamports is the rent-exempt minimum of a 165-byte token
+	// account, paid on the first buy of a mint. moon does not close token
+	// accounts, so it is not recovered.
+	ataRentLamports = 2_039_280
+	// baseFeeLamports is the network fee per signature.
+	baseFeeLamports = 5_000
+	// defaultComputeUnits prices the priority fee when the executor sets
+	// no compute unit limit.
+	defaultComputeUnits = 200_000
+	defaultSwapFeeBps   = 100
+)
+
+// CostConfig prices a buy signal's round trip: the token account rent,
+// the dex fee on entry and exit, the price impact of both swaps, and the
+// network and priority fees of both transactions.
+type CostConfig struct {
+	// SOL is the position size signals are costed at; it defaults to the
+	// trading sizing's sol.
+	SOL        float64 `json:"sol,omitempty"`
+	SwapFeeBps float64 `json:"swapFeeBps,omitempty"`
+	// PriorityFeeLamports per transaction defaults to the executor's
+	// static price times its compute unit limit.
+	PriorityFeeLamports uint64 `json:"priorityFeeLamports,omitempty"`
+	// LiquiditySOL is the SOL side of the pool the swaps go through, for
+	// price impact. The feed carries no reserves, so one figure stands for
+	// every pair; 0 leaves impact out.
+	LiquiditySOL float64 `json:"liquiditySol,omitempty"`
+	// MaxBreakeven drops signals that need a larger price multiple than
+	// this to break even, e.g. 1.1 for 10% (0 keeps all).
+	MaxBreakeven float64 `json:"maxBreakeven,omitempty"`
+}
+
+func (c CostConfig) Validate() error {
+	if c.SOL < 0 {
+		return errors.New("sol must not be negative")
+	}
+	if c.LiquiditySOL < 0 {
+		return errors.New("liquiditySol must not be negative")
+	}
+	if c.SwapFeeBps < 0 || c.SwapFeeBps >= 10_000 {
+		return errors.New("swapFeeBps must be in [0, 10000)")
+	}
+	if c.MaxBreakeven != 0 && c.MaxBreakeven <= 1 {
+		return errors.New("maxBreakeven must be above 1")
+	}
+	return nil
+}
+
+// CostEstimate is what buying SOL worth and selling it again is expected
+// to cost, in lamports.
+type CostEstimate struct {
+	SOL         float64 `json:"sizeSol"`
+	ATARent     uint64  `json:"ataRentLamports"`
+	SwapFees    uint64  `json:"swapFeeLamports"`
+	NetworkFees uint64  `json:"networkFeeLamports"`
+	PriceImpact uint64  `json:"priceImpactLamports"`
+	Total       uint64  `json:"costLamports"`
+	// Breakeven is the price multiple at which selling returns the
+	// position and every cost.
+	Breakeven float64 `json:"breakeven"`
+}
+
+// CostModel estimates signal costs. A nil model estimates nothing.
+type CostModel struct {
+	config CostConfig
+}
+
+// CostModel builds the model from the costs section, falling back to the
+// trading and executor sections for the size and priority fee.
+func (c *Config) CostModel() *CostModel {
+	var config CostConfig
+	if c.Costs != nil {
+		config = *c.Costs
+	}
+	if config.SOL == 0 && c.Trading != nil {
+		config.SOL = c.Trading.Sizing.SOL
+	}
+	if config.SwapFeeBps == 0 {
+		config.SwapFeeBps = defaultSwapFeeBps
+	}
+	if config.PriorityFeeLamports == 0 && c.Executor != nil {
+		units := uint64(c.Executor.ComputeUnitLimit)
+		if units == 0 {
+			units = defaultComputeUnits
+		}
+		config.PriorityFeeLamports = c.Executor.PriorityFee.MicroLamports * units / 1_000_000
+	}
+	return &CostModel{config: config}
+}
+
+// Estimate costs a round trip of lamports; zero lamports uses the
+// configured size. Price impact is that of a constant product pool with
+// LiquiditySOL on its SOL side: a swap of s loses s²/(R+s) against the
+// spot price, once on entry and once on exit. It reports false when there
+// is no size to cost.
+func (m *CostModel) Estimate(lamports uint64) (CostEstimate, bool) {
+	if m == nil {
+		return CostEstimate{}, false
+	}
+	if lamports == 0 {
+		lamports = uint64(m.config.SOL * lamportsPerSOL)
+	}
+	if lamports == 0 {
+		return CostEstimate{}, false
+	}
+
+	size := float64(lamports)
+	rate := m.config.SwapFeeBps / 10_000
+	// the exit fee is charged on the tokens the entry fee left, at the
+	// breakeven price
+	networkFees := 2 * (baseFeeLamports + m.config.PriorityFeeLamports)
+	var impact float64
+	if reserve := m.config.LiquiditySOL * lamportsPerSOL; reserve > 0 {
+		impact = 2 * size * size / (reserve + size)
+	}
+	fixed := float64(ataRentLamports+networkFees) + impact
+	breakeven := (size + fixed) / (size * (1 - rate) * (1 - rate))
+	swapFees := size*rate + size*(1-rate)*breakeven*rate
+
+	estimate := CostEstimate{
+		SOL:         size / lamportsPerSOL,
+		ATARent:     ataRentLamports,
+		SwapFees:    uint64(swapFees),
+		NetworkFees: networkFees,
+		PriceImpact: uint64(impact),
+		Breakeven:   breakeven,
+	}
+	estimate.Total = estimate.ATARent + estimate.SwapFees + estimate.NetworkFees + estimate.PriceImpact
+	return estimate, true
+}
+
+// Check returns why estimate is too expensive to act on, or nil.
+func (m *CostModel) Check(estimate CostEstimate) error {
+	if m == nil || m.config.MaxBreakeven == 0 || estimate.Breakeven <= m.config.MaxBreakeven {
+		return nil
+	}
+	return fmt.Errorf("costs of %.4f SOL on %.4f SOL need a %.2fx move to break even (max %.2fx)",
+		float64(estimate.Total)/lamportsPerSOL, estimate.SOL, estimate.Breakeven, m.config.MaxBreakeven)
+}
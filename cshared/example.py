@@ -0,0 +1,26 @@
+"""Decode dexscreener frames from Python through libmoon.so.
+
+    go build -buildmode=c-shared -o libmoon.so ./cshared
+    python3 cshared/example.py 0022...   # hex-encoded frame
+"""
+import ctypes
+import json
+import sys
+
+lib = ctypes.CDLL("./libmoon.so")
+lib.moon_decode.argtypes = [ctypes.c_char_p, ctypes.c_int]
+lib.moon_decode.restype = ctypes.c_void_p
+lib.moon_free.argtypes = [ctypes.c_void_p]
+
+
+def decode(frame: bytes) -> dict:
+    ptr = lib.moon_decode(frame, len(frame))
+    try:
+        return json.loads(ctypes.string_at(ptr).decode())
+    finally:
+        lib.moon_free(ptr)
+
+
+if __name__ == "__main__":
+    for arg in sys.argv[1:]:
+        print(json.dumps(decode(bytes.fromhex(arg)), indent=2))
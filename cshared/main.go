@@ -0,0 +1,90 @@
+//go:build cgo
+
+// Command cshared exports the protocol decoder over a C ABI. Build it with
+//
+//	go build -buildmode=c-shared -o libmoon.so ./cshared
+//
+// which also writes libmoon.h. moon_decode returns a JSON document that the
+// caller must release with moon_free; see example.py.
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"unsafe"
+
+	"github.com/piotrostr/moon/base58"
+	"github.com/piotrostr/moon/protocol"
+)
+
+type decoded struct {
+	Type        string `json:"type,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Endpoint    string `json:"endpoint,omitempty"`
+	LatestBlock uint32 `json:"latestBlock,omitempty"`
+	Hash        string `json:"hash,omitempty"`
+	Content     string `json:"content,omitempty"`
+	Pairs       []pair `json:"pairs,omitempty"`
+}
+
+type pair struct {
+	PairAddress     string  `json:"pairAddress"`
+	TokenName       string  `json:"tokenName"`
+	TokenSymbol     string  `json:"tokenSymbol"`
+	BaseTokenSymbol string  `json:"baseTokenSymbol"`
+	Price           float64 `json:"price"`
+	Volume          float64 `json:"volume"`
+}
+
+//export moon_decode
+func moon_decode(data *C.char, length C.int) *C.char {
+	frame := C.GoBytes(unsafe.Pointer(data), length)
+	out, _ := json.Marshal(decode(frame))
+	return C.CString(string(out))
+}
+
+//export moon_free
+func moon_free(p *C.char) {
+	C.free(unsafe.Pointer(p))
+}
+
+func decode(frame []byte) decoded {
+	msg, err := protocol.Parse(frame)
+	if err != nil {
+		return decoded{Error: err.Error()}
+	}
+
+	switch m := msg.(type) {
+	case *protocol.LatestBlockHashMessage:
+		return decoded{
+			Type:        "latestBlockHash",
+			Version:     m.Version,
+			Endpoint:    m.Endpoint,
+			LatestBlock: m.LatestBlock,
+			Hash:        base58.Encode(m.Hash[:]),
+		}
+	case *protocol.PairsMessage:
+		result := decoded{Type: "pairs", Version: m.Version, Pairs: make([]pair, len(m.Pairs))}
+		for i, p := range m.Pairs {
+			result.Pairs[i] = pair{
+				PairAddress:     p.Address(),
+				TokenName:       p.TokenName,
+				TokenSymbol:     p.TokenSymbol,
+				BaseTokenSymbol: p.BaseTokenSymbol,
+				Price:           p.Price,
+				Volume:          p.Volume,
+			}
+		}
+		return result
+	case *protocol.PingMessage:
+		return decoded{Type: "ping", Content: m.Content}
+	}
+	return decoded{Error: "unsupported message"}
+}
+
+func main() {}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// maxDiffCells bounds the segment alignment table; larger frames are
+// compared byte by byte at equal offsets.
+const maxDiffCells = 4_000_000
+
+// runDiff implements `moon diff frameA frameB`. Frames are files holding
+// raw bytes or hex, or capture.jsonl:N for the Nth frame of a raw capture.
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	context := fs.Int("context", 16, "identical bytes shown around each difference")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("usage: moon diff [flags] frameA frameB")
+	}
+	if *context < 0 {
+		return fmt.Errorf("-context must not be negative, got %d", *context)
+	}
+
+	a, err := readFrame(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := readFrame(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	color.Blue("A: %d bytes, type 0x%02x   B: %d bytes, type 0x%02x", len(a), firstByte(a), len(b), firstByte(b))
+	if firstByte(a) != firstByte(b) {
+		color.Yellow("Frames have different message types")
+	}
+	if bytes.Equal(a, b) {
+		color.Green("Frames are identical")
+		return nil
+	}
+
+	printFrameDiff(alignFrames(a, b), *context)
+	return nil
+}
+
+func firstByte(frame []byte) byte {
+	if len(frame) == 0 {
+		return 0
+	}
+	return frame[0]
+}
+
+// readFrame loads a frame from a raw or hex file, or path:N of a capture.
+func readFrame(arg string) ([]byte, error) {
+	if path, line, ok := strings.Cut(arg, ".jsonl:"); ok {
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid capture line in %q", arg)
+		}
+		return readCapturedFrame(path+".jsonl", n)
+	}
+
+	data, err := os.ReadFile(arg)
+	if err != nil {
+		return nil, err
+	}
+	if decoded, err := hex.DecodeString(strings.Join(strings.Fields(string(data)), "")); err == nil && len(decoded) > 0 {
+		return decoded, nil
+	}
+	return data, nil
+}
+
+func readCapturedFrame(path string, n int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if line < n {
+			continue
+		}
+		var captured CapturedFrame
+		if err := json.Unmarshal(scanner.Bytes(), &captured); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		return captured.Data, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%s has fewer than %d frames", path, n)
+}
+
+// diffOp is one aligned stretch: equal bytes, or bytes only in A, only in
+// B, or replaced.
+type diffOp struct {
+	kind   byte // '=', '-', '+', '~'
+	a, b   []byte
+	aStart int
+	bStart int
+}
+
+// splitSegments cuts a frame after every NUL so that strings, which shift
+// everything after them when they change length, become units of
+// alignment.
+func splitSegments(frame []byte) [][]byte {
+	var segments [][]byte
+	for len(frame) > 0 {
+		end := bytes.IndexByte(frame, 0) + 1
+		if end == 0 {
+			end = len(frame)
+		}
+		segments = append(segments, frame[:end])
+		frame = frame[end:]
+	}
+	return segments
+}
+
+// alignFrames aligns the frames' segments by longest common subsequence
+// and pairs up the unmatched runs as replacements.
+func alignFrames(a, b []byte) []diffOp {
+	sa, sb := splitSegments(a), splitSegments(b)
+	if len(sa)*len(sb) > maxDiffCells {
+		return []diffOp{{kind: '~', a: a, b: b}}
+	}
+
+	// lcs[i][j] is the LCS length of sa[i:] and sb[j:]
+	lcs := make([][]int, len(sa)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(sb)+1)
+	}
+	for i := len(sa) - 1; i >= 0; i-- {
+		for j := len(sb) - 1; j >= 0; j-- {
+			if bytes.Equal(sa[i], sb[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	aOff, bOff := 0, 0
+	add := func(kind byte, x, y []byte) {
+		if n := len(ops); n > 0 && ops[n-1].kind == kind {
+			ops[n-1].a = append(ops[n-1].a, x...)
+			ops[n-1].b = append(ops[n-1].b, y...)
+		} else {
+			ops = append(ops, diffOp{kind: kind, a: append([]byte(nil), x...), b: append([]byte(nil), y...), aStart: aOff, bStart: bOff})
+		}
+		aOff += len(x)
+		bOff += len(y)
+	}
+
+	i, j := 0, 0
+	for i < len(sa) || j < len(sb) {
+		switch {
+		case i < len(sa) && j < len(sb) && bytes.Equal(sa[i], sb[j]):
+			add('=', sa[i], sb[j])
+			i, j = i+1, j+1
+		case i < len(sa) && j < len(sb) && lcs[i+1][j+1] == lcs[i][j]:
+			add('~', sa[i], sb[j])
+			i, j = i+1, j+1
+		case j < len(sb) && (i == len(sa) || lcs[i][j+1] >= lcs[i+1][j]):
+			add('+', nil, sb[j])
+			j++
+		default:
+			add('-', sa[i], nil)
+			i++
+		}
+	}
+	return ops
+}
+
+func printFrameDiff(ops []diffOp, context int) {
+	changed := color.New(color.FgYellow, color.Bold).SprintFunc()
+	removed := color.New(color.FgRed, color.Bold).SprintFunc()
+	added := color.New(color.FgGreen, color.Bold).SprintFunc()
+
+	for _, op := range ops {
+		switch op.kind {
+		case '=':
+			if len(op.a) > 2*context {
+				fmt.Fprintf(console, "  A@%-6d B@%-6d %s\n", op.aStart, op.bStart, hex.EncodeToString(op.a[:context]))
+				color.White("  ... %d identical bytes ...", len(op.a)-2*context)
+				end := len(op.a) - context
+				fmt.Fprintf(console, "  A@%-6d B@%-6d %s\n", op.aStart+end, op.bStart+end, hex.EncodeToString(op.a[end:]))
+			} else {
+				fmt.Fprintf(console, "  A@%-6d B@%-6d %s\n", op.aStart, op.bStart, hex.EncodeToString(op.a))
+			}
+		case '-':
+			fmt.Fprintf(console, "- A@%-6d          %s  %s\n", op.aStart, removed(hex.EncodeToString(op.a)), printable(op.a))
+		case '+':
+			fmt.Fprintf(console, "+          B@%-6d %s  %s\n", op.bStart, added(hex.EncodeToString(op.b)), printable(op.b))
+		case '~':
+			var ha, hb strings.Builder
+			for k := 0; k < max(len(op.a), len(op.b)); k++ {
+				switch {
+				case k >= len(op.a):
+					hb.WriteString(added(fmt.Sprintf("%02x", op.b[k])))
+				case k >= len(op.b):
+					ha.WriteString(removed(fmt.Sprintf("%02x", op.a[k])))
+				case op.a[k] != op.b[k]:
+					ha.WriteString(changed(fmt.Sprintf("%02x", op.a[k])))
+					hb.WriteString(changed(fmt.Sprintf("%02x", op.b[k])))
+				default:
+					ha.WriteString(fmt.Sprintf("%02x", op.a[k]))
+					hb.WriteString(fmt.Sprintf("%02x", op.b[k]))
+				}
+			}
+			fmt.Fprintf(console, "~ A@%-6d          %s  %s\n", op.aStart, ha.String(), printable(op.a))
+			fmt.Fprintf(console, "~          B@%-6d %s  %s\n", op.bStart, hb.String(), printable(op.b))
+		}
+	}
+}
+
+// printable renders bytes as ASCII with dots for non-printing bytes.
+func printable(data []byte) string {
+	out := make([]byte, len(data))
+	for i, c := range data {
+		if c >= 0x20 && c < 0x7f {
+			out[i] = c
+		} else {
+			out[i] = '.'
+		}
+	}
+	return string(out)
+}
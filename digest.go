@@ -0,0 +1,19 @@
+package main
+
+import (
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// printDigest prints the periodic summary; trades is nil when trading is
+// disabled.
+func printDigest(stats MarketStats, boards Leaderboards, trades []Attribution) {
+	color.Blue("==== Digest %s ====", time.Now().Format(time.RFC1123))
+	printMarketStats(stats)
+	printLeaderboards(boards)
+	if trades != nil {
+		color.Blue("Performance by strategy (%s):", boards.Window)
+		printAttribution(trades)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/piotrostr/moon/mockfeed"
+)
+
+// TestE2E serves the recording in testdata through the mock feed and runs
+// it through dial, parse, store, lifecycle and rules, without the network.
+func TestE2E(t *testing.T) {
+	frames, err := mockfeed.LoadFrames("testdata/frames.bin")
+	if err != nil {
+		t.Fatalf("load frames: %v", err)
+	}
+	config, err := LoadConfig("testdata/e2e.json")
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	verbosity.Store(verbosityQuiet)
+
+	tests := []struct {
+		name string
+		feed mockfeed.Config
+	}{
+		{"clean", mockfeed.Config{Interval: time.Millisecond}},
+		{"faults", mockfeed.Config{Interval: time.Millisecond, DisconnectEvery: 13, MalformedEvery: 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			result, err := e2e(ctx, frames, tt.feed, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, failure := range result.Failures(frames, 1) {
+				t.Error(failure)
+			}
+			if tt.feed.MalformedEvery > 0 && result.Stats.Malformed == 0 {
+				t.Error("the feed sent no malformed frames")
+			}
+			if tt.feed.DisconnectEvery > 0 && result.Stats.Disconnects == 0 {
+				t.Error("the feed never disconnected")
+			}
+		})
+	}
+}
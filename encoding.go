@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+type Encoder interface {
+	Encode(record Record) ([]byte, error)
+	ContentType() string
+}
+
+// NewEncoder returns the encoder for name. fields fixes the order of the
+// CSV payload columns, which follow the envelope's; without it they are
+// sorted by name.
+func NewEncoder(name string, fields []string) (Encoder, error) {
+	switch name {
+	case "", "json":
+		return jsonEncoder{}, nil
+	case "csv":
+		return csvEncoder{fields: fields}, nil
+	case "proto":
+		return protoEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding: %q", name)
+	}
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(record Record) ([]byte, error) { return json.Marshal(record) }
+func (jsonEncoder) ContentType() string                  { return "application/json" }
+
+type csvEncoder struct {
+	fields []string
+}
+
+// Encode writes the envelope's fields, if record is an envelope, and then
+// the payload's as one row.
+func (e csvEncoder) Encode(record Record) ([]byte, error) {
+	payload, enveloped := record["payload"].(Record)
+	if !enveloped {
+		payload = record
+	}
+	fields := e.fields
+	if len(fields) == 0 {
+		for field := range payload {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+	}
+
+	row := make([]string, 0, len(envelopeFields)+len(fields))
+	if enveloped {
+		for _, field := range envelopeFields {
+			row = append(row, csvValue(record[field]))
+		}
+	}
+	for _, field := range fields {
+		row = append(row, csvValue(payload[field]))
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(row)
+	w.Flush()
+	return bytes.TrimRight(buf.Bytes(), "\n"), w.Error()
+}
+
+func (csvEncoder) ContentType() string { return "text/csv" }
+
+func csvValue(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	default:
+		if f, ok := toFloat(v); ok {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		data, _ := json.Marshal(x)
+		return string(data)
+	}
+}
+
+// protoEncoder writes records as google.protobuf.Struct in wire format,
+// which any protobuf runtime can decode without a moon-specific schema.
+type protoEncoder struct{}
+
+func (protoEncoder) ContentType() string { return "application/x-protobuf" }
+
+func (protoEncoder) Encode(record Record) ([]byte, error) {
+	return appendProtoStruct(nil, record), nil
+}
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendProtoTag(b []byte, field, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wire))
+}
+
+func appendProtoBytes(b []byte, field int, data []byte) []byte {
+	b = appendProtoTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// Struct { map<string, Value> fields = 1; }
+func appendProtoStruct(b []byte, record map[string]any) []byte {
+	keys := make([]string, 0, len(record))
+	for key := range record {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var entry []byte
+		entry = appendProtoBytes(entry, 1, []byte(key))
+		entry = appendProtoBytes(entry, 2, appendProtoValue(nil, record[key]))
+		b = appendProtoBytes(b, 1, entry)
+	}
+	return b
+}
+
+// Value { oneof kind { NullValue null_value = 1; double number_value = 2;
+// string string_value = 3; bool bool_value = 4; Struct struct_value = 5;
+// ListValue list_value = 6; } }
+func appendProtoValue(b []byte, v any) []byte {
+	switch x := v.(type) {
+	case nil:
+		b = appendProtoTag(b, 1, wireVarint)
+		return binary.AppendUvarint(b, 0)
+	case string:
+		return appendProtoBytes(b, 3, []byte(x))
+	case bool:
+		b = appendProtoTag(b, 4, wireVarint)
+		if x {
+			return binary.AppendUvarint(b, 1)
+		}
+		return binary.AppendUvarint(b, 0)
+	case map[string]any:
+		return appendProtoBytes(b, 5, appendProtoStruct(nil, x))
+	case Record:
+		return appendProtoBytes(b, 5, appendProtoStruct(nil, x))
+	case []any:
+		var list []byte
+		for _, item := range x {
+			list = appendProtoBytes(list, 1, appendProtoValue(nil, item))
+		}
+		return appendProtoBytes(b, 6, list)
+	}
+
+	if f, ok := toFloat(v); ok {
+		b = appendProtoTag(b, 2, wireFixed64)
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(f))
+	}
+
+	// anything else goes through its JSON form
+	data, _ := json.Marshal(v)
+	var generic any
+	json.Unmarshal(data, &generic)
+	if _, ok := generic.(string); !ok && generic != nil {
+		return appendProtoValue(b, generic)
+	}
+	return appendProtoBytes(b, 3, data)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"cmp"
+	"time"
+)
+
+// EnvelopeVersion is the schemaVersion of sink records. It goes up when a
+// change to the envelope or to an event's payload would break consumers.
+const EnvelopeVersion = 1
+
+// Sources of the data behind an event.
+const (
+	SourceWebsocket = "websocket"
+	SourceREST      = "rest"
+	SourceReplay    = "replay"
+	// SourceRPC is for data read from a Solana RPC node, such as holder
+	// counts.
+	SourceRPC = "rpc"
+	// SourceInternal is for events moon raises on its own, such as pairs
+	// going dead on the reaper's sweep.
+	SourceInternal = "internal"
+)
+
+// sourcedEvent is implemented by events that know the source of their
+// data: a fixed one, or the one recorded by sourced.
+type sourcedEvent interface {
+	Source() string
+}
+
+// sourced is embedded in events made from feed data and records the source
+// of the input they were made from, so events derived from them, on any
+// goroutine, carry it along.
+type sourced struct{ source string }
+
+func (s sourced) Source() string { return cmp.Or(s.source, SourceInternal) }
+
+// from is the sourced value for events derived from event.
+func from(event Event) sourced { return sourced{sourceOf(event)} }
+
+// sourceOf is the source of event's data; events that do not say are
+// moon's own.
+func sourceOf(event Event) string {
+	if e, ok := event.(sourcedEvent); ok {
+		return e.Source()
+	}
+	return SourceInternal
+}
+
+// Origin is the chain and dex for the envelope. The feed does not say
+// which chain or dex a pair is on, so they are known only when the
+// subscription names a single one of each; otherwise they are left empty
+// rather than guessed.
+type Origin struct {
+	chain, dex string
+}
+
+func NewOrigin(sub Subscription) *Origin {
+	o := &Origin{}
+	if len(sub.ChainIDs) == 1 {
+		o.chain = sub.ChainIDs[0]
+	}
+	if len(sub.DexIDs) == 1 {
+		o.dex = sub.DexIDs[0]
+	}
+	return o
+}
+
+// Envelope wraps an event's record as sinks receive it.
+func (o *Origin) Envelope(source string, receivedAt time.Time, payload Record) Record {
+	envelope := Record{
+		"schemaVersion": EnvelopeVersion,
+		"source":        source,
+		"receivedAt":    receivedAt.UTC().Format(time.RFC3339Nano),
+		"chain":         "",
+		"dex":           "",
+		"payload":       payload,
+	}
+	if o != nil {
+		envelope["chain"], envelope["dex"] = o.chain, o.dex
+	}
+	return envelope
+}
+
+// envelopeFields are the envelope's keys other than payload, in order.
+var envelopeFields = []string{"schemaVersion", "source", "receivedAt", "chain", "dex"}
+
+// envelopePayload is the payload of a decoded envelope, or record itself
+// when the sink sends bare payloads.
+func envelopePayload(record map[string]any) map[string]any {
+	if payload, ok := record["payload"].(map[string]any); ok {
+		return payload
+	}
+	return record
+}
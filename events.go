@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Event is anything derived from the stream that consumers can react to.
+type Event interface {
+	EventName() string
+}
+
+// EventBus fans out published events to all subscribers synchronously.
+// Publish may be called from any goroutine.
+type EventBus struct {
+	mu       sync.Mutex
+	filters  []func(Event) bool
+	handlers []func(Event)
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+func (b *EventBus) Subscribe(handler func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Filter registers a check run before any handler; an event rejected by
+// a filter is not delivered at all.
+func (b *EventBus) Filter(filter func(Event) bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.filters = append(b.filters, filter)
+}
+
+// Publish is reentrant: handlers may publish further events.
+func (b *EventBus) Publish(event Event) {
+	b.mu.Lock()
+	filters, handlers := b.filters, b.handlers
+	b.mu.Unlock()
+
+	for _, filter := range filters {
+		if !filter(event) {
+			return
+		}
+	}
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// PairUpdatedEvent carries every pair update from the stream.
+type PairUpdatedEvent struct {
+	sourced
+	Pair  PairData
+	At    time.Time
+	Block uint32
+}
+
+func (e *PairUpdatedEvent) EventName() string { return "pair_updated" }
+
+func printEvent(event Event) {
+	// checkpoints come several per pair; show them only when asked
+	if _, ok := event.(*AgeCheckpointEvent); ok && verbosity.Load() < verbosityVerbose {
+		return
+	}
+	if color.NoColor {
+		if _, ok := event.(*PairUpdatedEvent); !ok {
+			printPlainEvent(event)
+		}
+		return
+	}
+
+	switch e := event.(type) {
+	case *PairUpdatedEvent:
+		// already printed as part of the Pairs message
+	case *GapDetectedEvent:
+		color.Magenta("Gap detected: blocks %d-%d missing (%d blocks)", e.From, e.To, e.Missing())
+	case *BackfillCompletedEvent:
+		color.Magenta("Backfill for blocks %d-%d refreshed %d pairs", e.Gap.From, e.Gap.To, len(e.Pairs))
+	case *PairTransitionEvent:
+		reason := e.Reason
+		if e.Preexisting {
+			reason += ", pre-existing"
+		}
+		color.Magenta("Pair %s (%s): %s -> %s (%s)", formatAddress(e.PairAddress), e.TokenSymbol, e.From, e.To, reason)
+	case *PairDeadEvent:
+		t := e.Tombstone
+		if t.Rugged {
+			color.Red("Rug detected: %s (%s) %s, peak=%s final=%s lifetime=%s", displayAddress(t.PairAddress), t.TokenSymbol, t.Reason, formatPrice(t.PeakPrice), formatPrice(t.FinalPrice), t.Lifetime.Round(time.Second))
+		} else {
+			color.Magenta("Pair dead: %s (%s) %s, peak=%s final=%s lifetime=%s", displayAddress(t.PairAddress), t.TokenSymbol, t.Reason, formatPrice(t.PeakPrice), formatPrice(t.FinalPrice), t.Lifetime.Round(time.Second))
+		}
+	case *AnomalyDetectedEvent:
+		color.Yellow("Anomaly: %s (%s) %s=%g z=%.1f (mean %g, stddev %g)", formatAddress(e.PairAddress), e.TokenSymbol, e.Metric, e.Value, e.ZScore, e.Mean, e.StdDev)
+	case *ExecutionConfirmedEvent:
+		x := e.Execution
+		color.Green("Execution confirmed: %s %s sig=%s slot=%d in=%d out=%d fee=%d µlamports/CU=%d attempts=%d",
+			x.Order.Side, x.Mint, x.Signature, x.Slot, x.FilledIn, x.FilledOut, x.Fee, x.UnitPrice, x.Attempts)
+	case *ExecutionFailedEvent:
+		color.Red("Execution failed: %s %s: %s", e.Order.Side, displayAddress(e.Order.PairAddress), e.Reason)
+	case *PositionOpenedEvent, *PositionClosedEvent:
+		printPositionEvent(event)
+	case *BuySignalEvent:
+		var costs string
+		if e.Costs != nil {
+			costs = fmt.Sprintf(", costs %.4f SOL on %g SOL, breakeven %.2fx", float64(e.Costs.Total)/lamportsPerSOL, e.Costs.SOL, e.Costs.Breakeven)
+		}
+		color.HiGreen("Buy signal [%s] %s (%s) at %s%s", e.Rule, e.TokenSymbol, displayAddress(e.PairAddress), formatPrice(e.Price), costs)
+	case *AgeCheckpointEvent:
+		color.Cyan("At %s: %s (%s) volume=%s multiple=%.2fx", e.Age, formatAddress(e.PairAddress), e.TokenSymbol, formatUSD(e.Volume), e.Multiple)
+	case *HolderSampledEvent:
+		color.Cyan("Holders: %s (%s) %d holders, %+.1f/h over %s", displayAddress(e.PairAddress), e.TokenSymbol, e.Holders, e.HolderGrowth, e.Window.Round(time.Second))
+	case *AlertEvent:
+		color.HiYellow("ALERT #%d [%s] %s%s", e.ID, e.Kind, e.Message, formatTags(e.Tags))
+	default:
+		color.Magenta("Event: %s", event.EventName())
+	}
+}
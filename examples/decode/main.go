@@ -0,0 +1,63 @@
+// Command decode parses hex-encoded frames, one per line on stdin, with
+// the protocol package and prints the pairs they contain.
+//
+//	echo 00... | go run ./examples/decode
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/piotrostr/moon/protocol"
+)
+
+// hexLines is a protocol.FrameReader over hex-encoded lines, trimmed of
+// surrounding whitespace. A line that is not valid hex makes ReadFrame
+// return the decoding error; it does not skip to the next line itself, main
+// logs the error and calls Next again. A read error on stdin exits.
+type hexLines struct {
+	scanner *bufio.Scanner
+}
+
+func (h hexLines) ReadFrame() ([]byte, error) {
+	if !h.scanner.Scan() {
+		if err := h.scanner.Err(); err != nil {
+			log.Fatal(err)
+		}
+		return nil, io.EOF
+	}
+	return hex.DecodeString(strings.TrimSpace(h.scanner.Text()))
+}
+
+func main() {
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	decoder := protocol.NewFrameDecoder(hexLines{scanner: scanner})
+
+	for {
+		msg, err := decoder.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Printf("decode error: %v", err)
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *protocol.PairsMessage:
+			for _, pair := range m.Pairs {
+				fmt.Printf("%-10s %-24s price=%g volume=%g\n", pair.TokenSymbol, pair.TokenName, pair.Price, pair.Volume)
+			}
+		case *protocol.LatestBlockHashMessage:
+			fmt.Printf("block %d (version %s)\n", m.LatestBlock, m.Version)
+		case *protocol.PingMessage:
+			fmt.Println("ping")
+		}
+	}
+}
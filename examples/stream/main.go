@@ -0,0 +1,51 @@
+// Command stream connects to the live pairs feed and prints new pairs as
+// they are discovered, using the stream, protocol and store packages.
+//
+//	go run ./examples/stream
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/piotrostr/moon/protocol"
+	"github.com/piotrostr/moon/store"
+	"github.com/piotrostr/moon/stream"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	pairs := store.NewPairStore()
+	s := &stream.Stream{
+		ID:              1,
+		Subscription:    stream.DefaultSubscription(),
+		Store:           pairs,
+		RecoveryTimeout: 30 * time.Second,
+		Logf:            log.Printf,
+	}
+
+	s.OnPairs(func(m *protocol.PairsMessage) {
+		for _, pair := range m.Pairs {
+			if pairs.Upsert(pair, time.Now(), 0) {
+				fmt.Printf("new pair %s %s (%s) at %g\n", pair.Address(), pair.TokenSymbol, pair.TokenName, pair.Price)
+			}
+		}
+	})
+	s.OnBlockHash(func(m *protocol.LatestBlockHashMessage) {
+		fmt.Printf("block %d\n", m.LatestBlock)
+	})
+	s.OnUnknown(func(frame []byte, err error) {
+		log.Printf("undecodable frame of %d bytes: %v", len(frame), err)
+	})
+
+	err := s.Serve(ctx, func(err error) { log.Printf("stream error: %v", err) })
+	if err != nil && ctx.Err() == nil {
+		log.Fatal(err)
+	}
+}
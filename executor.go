@@ -0,0 +1,449 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/piotrostr/moon/base58"
+)
+
+type Side int
+
+const (
+	Buy Side = iota
+	Sell
+)
+
+func (s Side) String() string {
+	if s == Buy {
+		return "buy"
+	}
+	return "sell"
+}
+
+// Order asks the executor to swap. Buys spend Amount lamports of SOL, sells
+// spend Amount base units of the pair's token.
+type Order struct {
+	PairAddress string
+	Side        Side
+	Amount      uint64
+	// PairAge is how long the pair has existed, zero if unknown.
+	PairAge time.Duration
+	Reason  string
+}
+
+type Execution struct {
+	Order       Order
+	Mint        string
+	Signature   string
+	UnitPrice   uint64
+	UnitLimit   uint32
+	QuotedIn    uint64
+	QuotedOut   uint64
+	QuotedMin   uint64
+	SubmittedAt time.Time
+	Attempts    int
+	Slot        uint64
+	Commitment  string
+	// FilledIn and FilledOut are the amounts actually swapped, in the same
+	// units as the quote; Fee is the network fee in lamports.
+	FilledIn  uint64
+	FilledOut uint64
+	Fee       uint64
+	// Estimated marks fills taken from the quote, the input and the
+	// least output it allowed, because the transaction could not be read.
+	Estimated bool
+}
+
+type ExecutionConfirmedEvent struct {
+	Execution Execution
+}
+
+func (e *ExecutionConfirmedEvent) EventName() string { return "execution_confirmed" }
+
+type ExecutionFailedEvent struct {
+	Order     Order
+	Execution *Execution
+	Reason    string
+}
+
+func (e *ExecutionFailedEvent) EventName() string { return "execution_failed" }
+
+// ConfirmationConfig controls how submitted transactions are tracked.
+type ConfirmationConfig struct {
+	// Commitment is processed, confirmed (default) or finalized.
+	Commitment   string   `json:"commitment,omitempty"`
+	PollInterval Duration `json:"pollInterval,omitempty"`
+	// MaxAttempts bounds rebuilds after the blockhash expires.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// FeeBump multiplies the priority fee on each rebuild.
+	FeeBump float64 `json:"feeBump,omitempty"`
+	// Timeout bounds how long one attempt waits for a status when the
+	// RPC node cannot report one, 2m by default.
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+func (c *ConfirmationConfig) setDefaults() {
+	if c.Commitment == "" {
+		c.Commitment = "confirmed"
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = Duration(2 * time.Second)
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 3
+	}
+	if c.FeeBump < 1 {
+		c.FeeBump = 1.5
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = Duration(2 * time.Minute)
+	}
+}
+
+type Executor interface {
+	Execute(ctx context.Context, order Order) (*Execution, error)
+}
+
+// TokenBalancer is an executor holding tokens on chain, which can tell
+// whether an entry interrupted by a shutdown landed.
+type TokenBalancer interface {
+	// TokenBalance is the wallet's balance of the pair's token.
+	TokenBalance(ctx context.Context, pairAddress string) (uint64, error)
+}
+
+type ExecutorConfig struct {
+	RPCURL           string             `json:"rpcUrl"`
+	Keypair          KeypairConfig      `json:"keypair"`
+	SlippageBps      int                `json:"slippageBps"`
+	PriorityFee      PriorityFeeConfig  `json:"priorityFee"`
+	ComputeUnitLimit uint32             `json:"computeUnitLimit,omitempty"`
+	Confirmation     ConfirmationConfig `json:"confirmation"`
+}
+
+func (c *ExecutorConfig) Validate() error {
+	if c.RPCURL == "" {
+		return errors.New("rpcUrl is required")
+	}
+	if c.Keypair.Path == "" {
+		return errors.New("keypair.path is required")
+	}
+	if _, ok := commitmentRank[c.Confirmation.Commitment]; !ok && c.Confirmation.Commitment != "" {
+		return fmt.Errorf("unknown commitment: %q", c.Confirmation.Commitment)
+	}
+	if c.SlippageBps < 0 || c.SlippageBps > 10_000 {
+		return errors.New("slippageBps must be between 0 and 10000")
+	}
+	return c.PriorityFee.Validate()
+}
+
+func (c *ExecutorConfig) expandSecrets() error {
+	var err error
+	c.RPCURL, err = secrets.Expand(c.RPCURL)
+	return err
+}
+
+// LiveExecutor swaps through Jupiter and submits signed transactions to a
+// Solana RPC node with the configured priority fee and compute unit limit.
+type LiveExecutor struct {
+	config  ExecutorConfig
+	rpc     *RPCClient
+	jupiter *JupiterClient
+	fees    FeeStrategy
+	key     ed25519.PrivateKey
+	owner   string
+	bus     *EventBus
+
+	mu    sync.Mutex
+	mints map[string]string
+	http  *http.Client
+}
+
+const defaultSlippageBps = 500
+
+// NewLiveExecutor unlocks the keypair and publishes execution outcomes on
+// bus, which may be nil.
+func NewLiveExecutor(config ExecutorConfig, bus *EventBus) (*LiveExecutor, error) {
+	if config.SlippageBps == 0 {
+		config.SlippageBps = defaultSlippageBps
+	}
+	config.Confirmation.setDefaults()
+
+	key, err := LoadKeypair(config.Keypair)
+	if err != nil {
+		return nil, err
+	}
+
+	rpc := NewRPCClient(config.RPCURL)
+	return &LiveExecutor{
+		config:  config,
+		rpc:     rpc,
+		jupiter: NewJupiterClient(),
+		fees:    NewFeeStrategy(config.PriorityFee, rpc),
+		key:     key,
+		owner:   base58.Encode(key.Public().(ed25519.PublicKey)),
+		bus:     bus,
+		mints:   make(map[string]string),
+		http:    &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Execute submits order and blocks until it lands at the configured
+// commitment or every attempt has expired. The signed transaction is
+// rebroadcast while its blockhash is valid; on expiry it is rebuilt with a
+// bumped priority fee. Outcomes are also published as events.
+func (e *LiveExecutor) Execute(ctx context.Context, order Order) (*Execution, error) {
+	execution, err := e.execute(ctx, order)
+	if err != nil {
+		e.publish(&ExecutionFailedEvent{Order: order, Execution: execution, Reason: err.Error()})
+		return execution, err
+	}
+	e.publish(&ExecutionConfirmedEvent{Execution: *execution})
+	return execution, nil
+}
+
+func (e *LiveExecutor) execute(ctx context.Context, order Order) (*Execution, error) {
+	mint, err := e.mint(ctx, order.PairAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	unitPrice, err := e.fees.UnitPrice(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	var execution *Execution
+	for attempt := 1; attempt <= e.config.Confirmation.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			unitPrice = bumpFee(unitPrice, e.config.Confirmation.FeeBump, e.config.PriorityFee.MaxMicroLamports)
+		}
+
+		var tx []byte
+		var lastValid uint64
+		execution, tx, lastValid, err = e.submit(ctx, order, mint, unitPrice)
+		if err != nil {
+			return execution, err
+		}
+		execution.Attempts = attempt
+
+		landed, err := e.confirm(ctx, execution, tx, lastValid)
+		if err != nil {
+			return execution, err
+		}
+		if landed {
+			e.fill(ctx, execution)
+			return execution, nil
+		}
+		color.Yellow("Transaction %s expired unconfirmed (attempt %d)", execution.Signature, attempt)
+	}
+
+	return execution, fmt.Errorf("not confirmed after %d attempts", e.config.Confirmation.MaxAttempts)
+}
+
+func (e *LiveExecutor) submit(ctx context.Context, order Order, mint string, unitPrice uint64) (*Execution, []byte, uint64, error) {
+	inputMint, outputMint := solMint, mint
+	if order.Side == Sell {
+		inputMint, outputMint = mint, solMint
+	}
+
+	quote, err := e.jupiter.Quote(ctx, inputMint, outputMint, order.Amount, e.config.SlippageBps)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	tx, lastValid, err := e.jupiter.SwapTransaction(ctx, quote, e.owner, unitPrice)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	if e.config.ComputeUnitLimit > 0 {
+		found, err := patchComputeBudget(tx, e.config.ComputeUnitLimit, unitPrice)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("patch compute budget: %v", err)
+		}
+		if !found {
+			return nil, nil, 0, errors.New("swap transaction has no compute unit limit instruction to override")
+		}
+	}
+	if err := signTransaction(tx, e.key); err != nil {
+		return nil, nil, 0, fmt.Errorf("sign: %v", err)
+	}
+
+	signature, err := e.rpc.SendTransaction(ctx, tx)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("send: %v", err)
+	}
+
+	execution := &Execution{
+		Order:       order,
+		Mint:        mint,
+		Signature:   signature,
+		UnitPrice:   unitPrice,
+		UnitLimit:   e.config.ComputeUnitLimit,
+		QuotedIn:    quote.InAmount,
+		QuotedOut:   quote.OutAmount,
+		QuotedMin:   quote.MinOut,
+		SubmittedAt: time.Now(),
+	}
+	return execution, tx, lastValid, nil
+}
+
+// confirm polls the signature, rebroadcasting tx, until it reaches the
+// configured commitment (true), fails on chain (error) or its blockhash
+// expires (false). Without a status for the confirmation timeout the
+// outcome is unknown, which is an error: rebuilding could buy twice.
+func (e *LiveExecutor) confirm(ctx context.Context, execution *Execution, tx []byte, lastValid uint64) (bool, error) {
+	target := commitmentRank[e.config.Confirmation.Commitment]
+	seen := ""
+	deadline := time.Now().Add(time.Duration(e.config.Confirmation.Timeout))
+
+	ticker := time.NewTicker(time.Duration(e.config.Confirmation.PollInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false, fmt.Errorf("confirming %s: %w", execution.Signature, ctx.Err())
+		case <-ticker.C:
+		}
+
+		statuses, err := e.rpc.SignatureStatuses(ctx, []string{execution.Signature})
+		if err != nil {
+			color.Red("Signature status error: %v", err)
+		} else if len(statuses) > 0 && statuses[0] != nil {
+			status := statuses[0]
+			if status.Err != nil {
+				return false, fmt.Errorf("transaction %s failed: %v", execution.Signature, status.Err)
+			}
+			if status.ConfirmationStatus != seen {
+				seen = status.ConfirmationStatus
+				color.Cyan("Transaction %s %s at slot %d", execution.Signature, seen, status.Slot)
+			}
+			execution.Slot = status.Slot
+			execution.Commitment = status.ConfirmationStatus
+			if commitmentRank[status.ConfirmationStatus] >= target {
+				return true, nil
+			}
+			deadline = time.Now().Add(time.Duration(e.config.Confirmation.Timeout))
+			continue
+		}
+
+		// not seen, or the status is unknown: an expired blockhash is only
+		// conclusive when the node says it has not seen the transaction
+		height, heightErr := e.rpc.BlockHeight(ctx)
+		if err == nil && heightErr == nil && lastValid > 0 && height > lastValid {
+			return false, nil
+		}
+		if time.Now().After(deadline) {
+			return false, fmt.Errorf("no status for %s within %s, outcome unknown", execution.Signature, time.Duration(e.config.Confirmation.Timeout))
+		}
+		if _, err := e.rpc.SendTransaction(ctx, tx); err != nil {
+			color.Red("Rebroadcast error: %v", err)
+		}
+	}
+}
+
+// Fill lookups retry this often, backing off from fillRetryDelay: nodes
+// behind the one that confirmed the transaction may not have it yet.
+const (
+	fillAttempts   = 5
+	fillRetryDelay = 500 * time.Millisecond
+)
+
+// fill records the actual amounts swapped from the confirmed transaction,
+// or the quoted ones if it cannot be read.
+func (e *LiveExecutor) fill(ctx context.Context, execution *Execution) {
+	var meta *TransactionMeta
+	var err error
+	delay := fillRetryDelay
+retry:
+	for attempt := 1; attempt <= fillAttempts; attempt++ {
+		if meta, err = e.rpc.TransactionMeta(ctx, execution.Signature); err == nil {
+			break
+		}
+		if attempt == fillAttempts {
+			break
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			err = ctx.Err()
+			break retry
+		}
+		delay *= 2
+	}
+	if err != nil {
+		color.Red("Fill lookup error for %s, using the quote: %v", execution.Signature, err)
+		execution.FilledIn, execution.FilledOut = execution.QuotedIn, cmp.Or(execution.QuotedMin, execution.QuotedOut)
+		execution.Estimated = true
+		return
+	}
+
+	tokens := meta.tokenDelta(e.owner, execution.Mint)
+	lamports := meta.lamportDelta()
+	execution.Fee = meta.Fee
+	if execution.Order.Side == Buy {
+		execution.FilledIn, execution.FilledOut = uint64(max(-lamports, 0)), uint64(max(tokens, 0))
+	} else {
+		execution.FilledIn, execution.FilledOut = uint64(max(-tokens, 0)), uint64(max(lamports, 0))
+	}
+}
+
+func (e *LiveExecutor) TokenBalance(ctx context.Context, pairAddress string) (uint64, error) {
+	mint, err := e.mint(ctx, pairAddress)
+	if err != nil {
+		return 0, err
+	}
+	return e.rpc.TokenBalance(ctx, e.owner, mint)
+}
+
+func (e *LiveExecutor) publish(event Event) {
+	if e.bus != nil {
+		e.bus.Publish(event)
+	}
+}
+
+func bumpFee(price uint64, factor float64, ceiling uint64) uint64 {
+	bumped := uint64(float64(max(price, 1)) * factor)
+	if ceiling > 0 && bumped > ceiling {
+		bumped = ceiling
+	}
+	return bumped
+}
+
+var commitmentRank = map[string]int{
+	"processed": 1,
+	"confirmed": 2,
+	"finalized": 3,
+}
+
+// mint resolves and caches the token mint of a pair via the REST API.
+func (e *LiveExecutor) mint(ctx context.Context, pairAddress string) (string, error) {
+	e.mu.Lock()
+	mint, ok := e.mints[pairAddress]
+	e.mu.Unlock()
+	if ok {
+		return mint, nil
+	}
+
+	pairs, err := fetchRESTPairs(ctx, e.http, []string{pairAddress})
+	if err != nil {
+		return "", err
+	}
+	if len(pairs) == 0 || pairs[0].BaseToken.Address == "" {
+		return "", fmt.Errorf("pair %s not found", pairAddress)
+	}
+
+	mint = pairs[0].BaseToken.Address
+	e.mu.Lock()
+	e.mints[pairAddress] = mint
+	e.mu.Unlock()
+	return mint, nil
+}
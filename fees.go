@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PriorityFeeConfig selects how much to bid per compute unit.
+//
+//	static      always MicroLamports
+//	percentile  the Percentile of recent fees paid for the pair's accounts
+//	launch      percentile, multiplied by LaunchMultiplier while the pair is
+//	            younger than LaunchWindow
+//
+// MicroLamports is also the floor for the dynamic strategies and
+// MaxMicroLamports caps every strategy.
+type PriorityFeeConfig struct {
+	Strategy         string   `json:"strategy"`
+	MicroLamports    uint64   `json:"microLamports"`
+	Percentile       float64  `json:"percentile,omitempty"`
+	LaunchWindow     Duration `json:"launchWindow,omitempty"`
+	LaunchMultiplier float64  `json:"launchMultiplier,omitempty"`
+	MaxMicroLamports uint64   `json:"maxMicroLamports,omitempty"`
+}
+
+func (c PriorityFeeConfig) Validate() error {
+	switch c.Strategy {
+	case "", "static":
+	case "percentile", "launch":
+		if c.Percentile <= 0 || c.Percentile > 100 {
+			return errors.New("priority fee percentile must be in (0, 100]")
+		}
+		if c.Strategy == "launch" && (c.LaunchWindow <= 0 || c.LaunchMultiplier < 1) {
+			return errors.New("launch priority fees need launchWindow and launchMultiplier >= 1")
+		}
+	default:
+		return fmt.Errorf("unknown priority fee strategy: %q", c.Strategy)
+	}
+	return nil
+}
+
+// FeeStrategy prices an order's compute units in micro-lamports.
+type FeeStrategy interface {
+	UnitPrice(ctx context.Context, order Order) (uint64, error)
+}
+
+func NewFeeStrategy(config PriorityFeeConfig, rpc *RPCClient) FeeStrategy {
+	var strategy FeeStrategy = staticFee{price: config.MicroLamports}
+	switch config.Strategy {
+	case "percentile":
+		strategy = &percentileFee{rpc: rpc, percentile: config.Percentile, floor: config.MicroLamports}
+	case "launch":
+		strategy = &launchFee{
+			base:       &percentileFee{rpc: rpc, percentile: config.Percentile, floor: config.MicroLamports},
+			window:     time.Duration(config.LaunchWindow),
+			multiplier: config.LaunchMultiplier,
+		}
+	}
+	return cappedFee{strategy: strategy, max: config.MaxMicroLamports}
+}
+
+type staticFee struct {
+	price uint64
+}
+
+func (f staticFee) UnitPrice(context.Context, Order) (uint64, error) { return f.price, nil }
+
+type percentileFee struct {
+	rpc        *RPCClient
+	percentile float64
+	floor      uint64
+}
+
+func (f *percentileFee) UnitPrice(ctx context.Context, order Order) (uint64, error) {
+	fees, err := f.rpc.RecentPrioritizationFees(ctx, []string{order.PairAddress})
+	if err != nil {
+		return 0, fmt.Errorf("recent fees: %v", err)
+	}
+	return max(percentileOf(fees, f.percentile), f.floor), nil
+}
+
+type launchFee struct {
+	base       FeeStrategy
+	window     time.Duration
+	multiplier float64
+}
+
+func (f *launchFee) UnitPrice(ctx context.Context, order Order) (uint64, error) {
+	price, err := f.base.UnitPrice(ctx, order)
+	if err != nil {
+		return 0, err
+	}
+	if order.PairAge > 0 && order.PairAge < f.window {
+		price = uint64(float64(price) * f.multiplier)
+	}
+	return price, nil
+}
+
+type cappedFee struct {
+	strategy FeeStrategy
+	max      uint64
+}
+
+func (f cappedFee) UnitPrice(ctx context.Context, order Order) (uint64, error) {
+	price, err := f.strategy.UnitPrice(ctx, order)
+	if err != nil {
+		return 0, err
+	}
+	if f.max > 0 && price > f.max {
+		price = f.max
+	}
+	return price, nil
+}
+
+func percentileOf(values []uint64, percentile float64) uint64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]uint64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	index := int(float64(len(sorted)-1) * percentile / 100)
+	return sorted[index]
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/fatih/color"
+)
+
+// NumberLocale holds the separators numbers are written with.
+type NumberLocale struct {
+	Group   string
+	Decimal string
+}
+
+var numberLocales = map[string]NumberLocale{
+	"en": {Group: ",", Decimal: "."},
+	"de": {Group: ".", Decimal: ","},
+	"es": {Group: ".", Decimal: ","},
+	"fr": {Group: " ", Decimal: ","},
+	"ru": {Group: " ", Decimal: ","},
+}
+
+func lookupLocale(name string) (NumberLocale, error) {
+	if name == "" {
+		return numberLocales["en"], nil
+	}
+	locale, ok := numberLocales[name]
+	if !ok {
+		return NumberLocale{}, fmt.Errorf("unknown locale %q", name)
+	}
+	return locale, nil
+}
+
+// Fixed writes v with the given decimals and grouped thousands.
+func (l NumberLocale) Fixed(v float64, decimals int) string {
+	return l.localize(strconv.FormatFloat(v, 'f', decimals, 64), true)
+}
+
+// localize swaps in the locale's separators in a strconv 'f' number.
+func (l NumberLocale) localize(s string, group bool) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if group {
+		var b strings.Builder
+		for i, digit := range whole {
+			if i > 0 && (len(whole)-i)%3 == 0 {
+				b.WriteString(l.Group)
+			}
+			b.WriteRune(digit)
+		}
+		whole = b.String()
+	}
+	if hasFrac {
+		return sign + whole + l.Decimal + frac
+	}
+	return sign + whole
+}
+
+// Sig rounds v to n significant digits without switching to exponents.
+func (l NumberLocale) Sig(v float64, n int) string {
+	if v == 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	decimals := n - 1 - int(math.Floor(math.Log10(math.Abs(v))))
+	if decimals < 0 {
+		scale := math.Pow10(-decimals)
+		return l.Fixed(math.Round(v/scale)*scale, 0)
+	}
+	return l.Fixed(v, decimals)
+}
+
+// Abbr shortens large numbers: 1234567 is 1.2M.
+func (l NumberLocale) Abbr(v float64) string {
+	units := []struct {
+		size   float64
+		suffix string
+	}{{1e12, "T"}, {1e9, "B"}, {1e6, "M"}, {1e3, "K"}}
+	for _, unit := range units {
+		if math.Abs(v) >= unit.size {
+			s := strconv.FormatFloat(v/unit.size, 'f', 1, 64)
+			return l.localize(strings.TrimSuffix(s, ".0"), false) + unit.suffix
+		}
+	}
+	if math.Abs(v) >= 1 {
+		return l.Sig(v, 3)
+	}
+	return l.Price(v)
+}
+
+// Price writes micro-cap prices in subscript-zero notation, counting the
+// zeros after the decimal point as in 0.0₅423 for 0.00000423, and others
+// to four significant digits.
+func (l NumberLocale) Price(v float64) string {
+	abs := math.Abs(v)
+	if abs == 0 || abs >= 0.001 {
+		return l.Sig(v, 4)
+	}
+	zeros := -int(math.Floor(math.Log10(abs))) - 1
+	digits := strconv.FormatFloat(abs*math.Pow10(zeros+3), 'f', 0, 64)
+	if len(digits) > 3 {
+		// rounding carried into another digit, e.g. 0.000009999
+		zeros, digits = zeros-1, digits[:3]
+	}
+	sign := ""
+	if v < 0 {
+		sign = "-"
+	}
+	return sign + "0" + l.Decimal + "0" + subscript(zeros) + strings.TrimRight(digits, "0")
+}
+
+func subscript(n int) string {
+	var b strings.Builder
+	for _, digit := range strconv.Itoa(n) {
+		b.WriteRune('₀' + digit - '0')
+	}
+	return b.String()
+}
+
+// USD abbreviates large amounts and keeps micro prices readable.
+func (l NumberLocale) USD(v float64) string {
+	if v < 0 {
+		return "-" + l.USD(-v)
+	}
+	switch {
+	case v > 0 && v < 1:
+		return "$" + l.Price(v)
+	case v < 1000:
+		return "$" + l.Fixed(v, 2)
+	default:
+		return "$" + l.Abbr(v)
+	}
+}
+
+// Percent writes a ratio as a signed percentage: 0.123 is +12.3%.
+func (l NumberLocale) Percent(v float64) string {
+	s := l.Fixed(v*100, 1)
+	if v > 0 {
+		s = "+" + s
+	}
+	return s + "%"
+}
+
+// templateFuncs are the formatting helpers available in alert message
+// templates. They accept any record value and print non-numbers as is.
+func templateFuncs(l NumberLocale) template.FuncMap {
+	numeric := func(format func(float64) string) func(any) string {
+		return func(v any) string {
+			if f, ok := toFloat(v); ok {
+				return format(f)
+			}
+			return fmt.Sprint(v)
+		}
+	}
+	return template.FuncMap{
+		"num":   numeric(func(v float64) string { return l.Fixed(v, 2) }),
+		"abbr":  numeric(l.Abbr),
+		"usd":   numeric(l.USD),
+		"pct":   numeric(l.Percent),
+		"price": numeric(l.Price),
+		"sig": func(v any, n int) string {
+			return numeric(func(f float64) string { return l.Sig(f, n) })(v)
+		},
+	}
+}
+
+// formatPrice and formatUSD render amounts for people: the console,
+// digests and leaderboards. With colors off the console is read by
+// machines, so they fall back to plain numbers.
+func formatPrice(v float64) string {
+	if color.NoColor {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return numberLocales["en"].USD(v)
+}
+
+func formatUSD(v float64) string {
+	if color.NoColor {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return numberLocales["en"].USD(v)
+}
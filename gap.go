@@ -0,0 +1,49 @@
+package main
+
+import "time"
+
+// GapDetectedEvent is emitted when consecutive LatestBlockHash messages are
+// further apart than the configured threshold, i.e. the feed likely skipped
+// updates for the blocks in [From, To].
+type GapDetectedEvent struct {
+	sourced
+	From       uint32
+	To         uint32
+	DetectedAt time.Time
+}
+
+func (e *GapDetectedEvent) EventName() string { return "gap_detected" }
+
+func (e *GapDetectedEvent) Missing() uint32 {
+	return e.To - e.From + 1
+}
+
+// GapDetector tracks the LatestBlock sequence. The server does not send
+// every block, so only jumps larger than threshold count as gaps.
+type GapDetector struct {
+	threshold uint32
+	lastBlock uint32
+}
+
+func NewGapDetector(threshold uint32) *GapDetector {
+	return &GapDetector{threshold: threshold}
+}
+
+func (g *GapDetector) Observe(block uint32) *GapDetectedEvent {
+	last := g.lastBlock
+	if block <= last {
+		return nil
+	}
+	g.lastBlock = block
+
+	if last == 0 || block-last <= g.threshold {
+		return nil
+	}
+
+	return &GapDetectedEvent{
+		sourced:    sourced{SourceWebsocket},
+		From:       last + 1,
+		To:         block - 1,
+		DetectedAt: time.Now(),
+	}
+}
@@ -0,0 +1,1062 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A small GraphQL executor: queries with variables, aliases, arguments,
+// nested selections, fragments and @skip/@include. Mutations,
+// subscriptions and introspection are not supported; the schema is served
+// as SDL instead.
+
+// gqlType is a scalar, an object or a list of another type.
+type gqlType struct {
+	Name   string
+	Of     *gqlType
+	Fields map[string]*gqlField
+	// order lists Fields as they are printed in the SDL.
+	order []string
+}
+
+func gqlList(of *gqlType) *gqlType { return &gqlType{Of: of} }
+
+var (
+	gqlString  = &gqlType{Name: "String"}
+	gqlInt     = &gqlType{Name: "Int"}
+	gqlFloat   = &gqlType{Name: "Float"}
+	gqlBoolean = &gqlType{Name: "Boolean"}
+)
+
+func (t *gqlType) String() string {
+	if t.Of != nil {
+		return "[" + t.Of.String() + "]"
+	}
+	return t.Name
+}
+
+// field adds a field; args are name and SDL type pairs.
+func (t *gqlType) field(name string, typ *gqlType, resolve gqlResolver, args ...string) {
+	if t.Fields == nil {
+		t.Fields = make(map[string]*gqlField)
+	}
+	f := &gqlField{Type: typ, Resolve: resolve}
+	for i := 0; i+1 < len(args); i += 2 {
+		f.Args = append(f.Args, [2]string{args[i], args[i+1]})
+	}
+	if _, ok := t.Fields[name]; !ok {
+		t.order = append(t.order, name)
+	}
+	t.Fields[name] = f
+}
+
+// gqlResolver returns a field's value for source. A nil resolver reads
+// the field from a Record source.
+type gqlResolver func(req *gqlRequest, source any, args gqlArgs) (any, error)
+
+type gqlField struct {
+	Type    *gqlType
+	Args    [][2]string
+	Resolve gqlResolver
+}
+
+// gqlRecordType derives an object type from the fields flatten writes for
+// t, so records and their schema cannot drift apart.
+func gqlRecordType(name string, t reflect.Type) *gqlType {
+	typ := &gqlType{Name: name}
+	gqlRecordFields(typ, t)
+	return typ
+}
+
+func gqlRecordFields(typ *gqlType, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		ft := field.Type
+		if field.Anonymous || (ft.Kind() == reflect.Struct && ft != timeType) ||
+			(ft.Kind() == reflect.Pointer && ft.Elem().Kind() == reflect.Struct) {
+			gqlRecordFields(typ, ft)
+			continue
+		}
+		name := recordFieldName(field)
+		if name == "-" {
+			continue
+		}
+		if scalar := gqlScalarFor(ft); scalar != nil {
+			typ.field(name, scalar, nil)
+		}
+	}
+}
+
+func gqlScalarFor(t reflect.Type) *gqlType {
+	switch {
+	case t == timeType, t == addressType:
+		return gqlString
+	case t == durationType:
+		return gqlFloat
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return gqlString
+	case reflect.Bool:
+		return gqlBoolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return gqlInt
+	case reflect.Float32, reflect.Float64:
+		return gqlFloat
+	case reflect.Slice:
+		if of := gqlScalarFor(t.Elem()); of != nil {
+			return gqlList(of)
+		}
+	}
+	return nil
+}
+
+// gqlSchema is the query root and the types reachable from it.
+type gqlSchema struct {
+	Query *gqlType
+}
+
+// SDL prints the schema in the GraphQL schema language.
+func (s *gqlSchema) SDL() string {
+	var b strings.Builder
+	seen := make(map[string]bool)
+	var print func(t *gqlType)
+	print = func(t *gqlType) {
+		for t.Of != nil {
+			t = t.Of
+		}
+		if t.Fields == nil || seen[t.Name] {
+			return
+		}
+		seen[t.Name] = true
+		fmt.Fprintf(&b, "type %s {\n", t.Name)
+		for _, name := range t.order {
+			f := t.Fields[name]
+			var args []string
+			for _, arg := range f.Args {
+				args = append(args, arg[0]+": "+arg[1])
+			}
+			if len(args) > 0 {
+				fmt.Fprintf(&b, "  %s(%s): %s\n", name, strings.Join(args, ", "), f.Type)
+			} else {
+				fmt.Fprintf(&b, "  %s: %s\n", name, f.Type)
+			}
+		}
+		b.WriteString("}\n\n")
+		for _, name := range t.order {
+			print(t.Fields[name].Type)
+		}
+	}
+	print(s.Query)
+	b.WriteString("input Condition {\n  field: String!\n  op: String!\n  value: Any\n}\n")
+	return b.String()
+}
+
+// gqlRequest is one query being executed. Resolvers use values to share
+// work, such as loading the snapshots of every listed pair at once.
+type gqlRequest struct {
+	vars      map[string]any
+	fragments map[string]*gqlFragment
+	errors    []gqlError
+	values    map[string]any
+}
+
+type gqlError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// gqlResponse is the body of a GraphQL response.
+type gqlResponse struct {
+	Data   any        `json:"data"`
+	Errors []gqlError `json:"errors,omitempty"`
+}
+
+// Execute runs the named operation, or the only one, of query.
+func (s *gqlSchema) Execute(query, operation string, vars map[string]any) gqlResponse {
+	doc, err := parseGraphQL(query)
+	if err != nil {
+		return gqlResponse{Errors: []gqlError{{Message: err.Error()}}}
+	}
+	var op *gqlOperation
+	for _, candidate := range doc.operations {
+		if operation == "" || candidate.name == operation {
+			if op != nil {
+				return gqlResponse{Errors: []gqlError{{Message: "operationName is required with several operations"}}}
+			}
+			op = candidate
+		}
+	}
+	if op == nil {
+		return gqlResponse{Errors: []gqlError{{Message: fmt.Sprintf("no operation named %q", operation)}}}
+	}
+	if op.kind != "query" {
+		return gqlResponse{Errors: []gqlError{{Message: op.kind + " operations are not supported"}}}
+	}
+
+	req := &gqlRequest{vars: make(map[string]any), fragments: doc.fragments, values: make(map[string]any)}
+	for _, def := range op.vars {
+		value, ok := vars[def.name]
+		if !ok && def.value != nil {
+			value, ok = def.value.resolve(nil), true
+		}
+		if !ok || value == nil {
+			if strings.HasSuffix(def.typ, "!") {
+				return gqlResponse{Errors: []gqlError{{Message: fmt.Sprintf("variable $%s of type %s is required", def.name, def.typ)}}}
+			}
+			continue
+		}
+		req.vars[def.name] = value
+	}
+	if req.validate(s.Query, op.selections, nil, make(map[string]bool)); len(req.errors) > 0 {
+		return gqlResponse{Errors: req.errors}
+	}
+	data := req.object(s.Query, nil, op.selections, nil)
+	return gqlResponse{Data: data, Errors: req.errors}
+}
+
+// validate checks selections against the schema before anything runs, so
+// a bad query fails once rather than once per list item.
+func (req *gqlRequest) validate(typ *gqlType, selections []gqlSelection, path []any, visiting map[string]bool) {
+	for _, sel := range selections {
+		switch {
+		case sel.spread != "":
+			fragment, ok := req.fragments[sel.spread]
+			if !ok {
+				req.fail(path, "unknown fragment %q", sel.spread)
+				continue
+			}
+			if visiting[sel.spread] {
+				req.fail(path, "fragment %q spreads itself", sel.spread)
+				continue
+			}
+			visiting[sel.spread] = true
+			req.validate(typ, fragment.selections, path, visiting)
+			delete(visiting, sel.spread)
+			continue
+		case sel.inline:
+			req.validate(typ, sel.selections, path, visiting)
+			continue
+		}
+
+		fieldPath := append(path, cmp.Or(sel.alias, sel.name))
+		if sel.name == "__typename" {
+			continue
+		}
+		field, ok := typ.Fields[sel.name]
+		if !ok {
+			req.fail(fieldPath, "cannot query field %q on type %s", sel.name, typ.Name)
+			continue
+		}
+		for name := range sel.args {
+			if !slices.ContainsFunc(field.Args, func(a [2]string) bool { return a[0] == name }) {
+				req.fail(fieldPath, "unknown argument %q on field %q", name, sel.name)
+			}
+		}
+		inner := field.Type
+		for inner.Of != nil {
+			inner = inner.Of
+		}
+		switch {
+		case inner.Fields == nil && len(sel.selections) > 0:
+			req.fail(fieldPath, "field %q of type %s has no subfields", sel.name, field.Type)
+		case inner.Fields != nil && len(sel.selections) == 0:
+			req.fail(fieldPath, "field %q of type %s needs a selection of subfields", sel.name, field.Type)
+		case inner.Fields != nil:
+			req.validate(inner, sel.selections, fieldPath, visiting)
+		}
+	}
+}
+
+func (req *gqlRequest) fail(path []any, format string, args ...any) {
+	req.errors = append(req.errors, gqlError{Message: fmt.Sprintf(format, args...), Path: slices.Clone(path)})
+}
+
+// gqlObject keeps the selection order in the JSON output, as GraphQL
+// requires.
+type gqlObject []gqlEntry
+
+type gqlEntry struct {
+	key   string
+	value any
+}
+
+func (o gqlObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, entry := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(entry.key)
+		b.Write(key)
+		b.WriteByte(':')
+		value, err := json.Marshal(entry.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func (req *gqlRequest) object(typ *gqlType, source any, selections []gqlSelection, path []any) gqlObject {
+	var keys []string
+	fields := make(map[string][]gqlSelection)
+	req.collect(selections, &keys, fields, make(map[string]bool))
+
+	out := make(gqlObject, 0, len(keys))
+	for _, key := range keys {
+		merged := fields[key]
+		sel := merged[0]
+		fieldPath := append(path, key)
+		if sel.name == "__typename" {
+			out = append(out, gqlEntry{key, typ.Name})
+			continue
+		}
+		field := typ.Fields[sel.name]
+		args, err := req.args(field, sel)
+		if err != nil {
+			req.fail(fieldPath, "%v", err)
+			out = append(out, gqlEntry{key, nil})
+			continue
+		}
+		var value any
+		if field.Resolve != nil {
+			value, err = field.Resolve(req, source, args)
+		} else {
+			value = gqlDefaultResolve(source, sel.name)
+		}
+		if err != nil {
+			req.fail(fieldPath, "%v", err)
+			out = append(out, gqlEntry{key, nil})
+			continue
+		}
+		var sub []gqlSelection
+		for _, s := range merged {
+			sub = append(sub, s.selections...)
+		}
+		out = append(out, gqlEntry{key, req.complete(field.Type, value, sub, fieldPath)})
+	}
+	return out
+}
+
+// collect flattens fragments and directives into fields by response key.
+func (req *gqlRequest) collect(selections []gqlSelection, keys *[]string, fields map[string][]gqlSelection, visited map[string]bool) {
+	for _, sel := range selections {
+		if !req.included(sel) {
+			continue
+		}
+		switch {
+		case sel.spread != "":
+			fragment, ok := req.fragments[sel.spread]
+			if !ok || visited[sel.spread] {
+				continue
+			}
+			visited[sel.spread] = true
+			req.collect(fragment.selections, keys, fields, visited)
+		case sel.inline:
+			req.collect(sel.selections, keys, fields, visited)
+		default:
+			key := sel.alias
+			if key == "" {
+				key = sel.name
+			}
+			if _, ok := fields[key]; !ok {
+				*keys = append(*keys, key)
+			}
+			fields[key] = append(fields[key], sel)
+		}
+	}
+}
+
+func (req *gqlRequest) included(sel gqlSelection) bool {
+	for _, d := range sel.directives {
+		arg, ok := d.args["if"]
+		if !ok {
+			continue
+		}
+		cond, _ := arg.resolve(req.vars).(bool)
+		if (d.name == "skip" && cond) || (d.name == "include" && !cond) {
+			return false
+		}
+	}
+	return true
+}
+
+func (req *gqlRequest) args(field *gqlField, sel gqlSelection) (gqlArgs, error) {
+	args := make(gqlArgs, len(sel.args))
+	for name, value := range sel.args {
+		args[name] = value.resolve(req.vars)
+	}
+	for _, arg := range field.Args {
+		if strings.HasSuffix(arg[1], "!") && args[arg[0]] == nil {
+			return nil, fmt.Errorf("argument %q of field %q is required", arg[0], sel.name)
+		}
+	}
+	return args, nil
+}
+
+func (req *gqlRequest) complete(typ *gqlType, value any, selections []gqlSelection, path []any) any {
+	if value == nil {
+		return nil
+	}
+	v := reflect.ValueOf(value)
+	if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil() {
+		return nil
+	}
+	switch {
+	case typ.Of != nil && typ.Of.Fields == nil:
+		// a list of scalars is returned as is
+		return value
+	case typ.Of != nil:
+		if v.Kind() != reflect.Slice {
+			req.fail(path, "expected a list for %s", typ)
+			return nil
+		}
+		items := make([]any, v.Len())
+		for i := range items {
+			items[i] = req.complete(typ.Of, v.Index(i).Interface(), selections, append(path, i))
+		}
+		return items
+	case typ.Fields != nil:
+		return req.object(typ, value, selections, path)
+	default:
+		return value
+	}
+}
+
+func gqlDefaultResolve(source any, name string) any {
+	switch s := source.(type) {
+	case Record:
+		return s[name]
+	case interface{ gqlRecord() Record }:
+		return s.gqlRecord()[name]
+	}
+	return nil
+}
+
+// gqlArgs are a field's arguments with variables substituted; numbers
+// from variables arrive as float64 and from literals as int or float64.
+type gqlArgs map[string]any
+
+func (a gqlArgs) String(name, def string) (string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return def, nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("argument %q must be a string", name)
+	}
+}
+
+func (a gqlArgs) Int(name string, def int) (int, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return def, nil
+	case int:
+		return v, nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("argument %q must be an integer", name)
+}
+
+func (a gqlArgs) Bool(name string, def bool) (bool, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return def, nil
+	case bool:
+		return v, nil
+	default:
+		return false, fmt.Errorf("argument %q must be a boolean", name)
+	}
+}
+
+// Conditions reads a list of {field, op, value} objects, the same
+// conditions rules use.
+func (a gqlArgs) Conditions(name string) ([]Condition, error) {
+	value := a[name]
+	if value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]any)
+	if !ok {
+		list = []any{value}
+	}
+	conditions := make([]Condition, 0, len(list))
+	for _, item := range list {
+		object, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("argument %q must be a list of conditions", name)
+		}
+		field, _ := object["field"].(string)
+		op, _ := object["op"].(string)
+		c := Condition{Field: field, Op: op, Value: object["value"]}
+		if err := c.Validate(); err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions, nil
+}
+
+// Parsing.
+
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+type gqlOperation struct {
+	kind, name string
+	vars       []gqlVarDef
+	selections []gqlSelection
+}
+
+type gqlVarDef struct {
+	name, typ string
+	value     gqlValue
+}
+
+type gqlFragment struct {
+	selections []gqlSelection
+}
+
+// gqlSelection is a field, a fragment spread or an inline fragment.
+type gqlSelection struct {
+	alias, name string
+	args        map[string]gqlValue
+	directives  []gqlDirective
+	selections  []gqlSelection
+	spread      string
+	inline      bool
+}
+
+type gqlDirective struct {
+	name string
+	args map[string]gqlValue
+}
+
+// gqlValue is a literal; variables are resolved at execution.
+type gqlValue interface {
+	resolve(vars map[string]any) any
+}
+
+type gqlLiteral struct{ v any }
+
+func (l gqlLiteral) resolve(map[string]any) any { return l.v }
+
+type gqlVariable string
+
+func (v gqlVariable) resolve(vars map[string]any) any { return vars[string(v)] }
+
+type gqlListValue []gqlValue
+
+func (l gqlListValue) resolve(vars map[string]any) any {
+	out := make([]any, len(l))
+	for i, v := range l {
+		out[i] = v.resolve(vars)
+	}
+	return out
+}
+
+type gqlObjectValue map[string]gqlValue
+
+func (o gqlObjectValue) resolve(vars map[string]any) any {
+	out := make(map[string]any, len(o))
+	for k, v := range o {
+		out[k] = v.resolve(vars)
+	}
+	return out
+}
+
+// gqlMaxDepth bounds the nesting of selection sets, values and types, so
+// a hostile query cannot exhaust the stack.
+const gqlMaxDepth = 64
+
+type gqlParser struct {
+	src   string
+	pos   int
+	depth int
+}
+
+func parseGraphQL(src string) (*gqlDocument, error) {
+	p := &gqlParser{src: src}
+	doc := &gqlDocument{fragments: make(map[string]*gqlFragment)}
+	for p.skip(); p.pos < len(p.src); p.skip() {
+		if err := p.definition(doc); err != nil {
+			return nil, err
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, errors.New("query has no operation")
+	}
+	return doc, nil
+}
+
+func (p *gqlParser) errorf(format string, args ...any) error {
+	line := 1 + strings.Count(p.src[:p.pos], "\n")
+	return fmt.Errorf("syntax error at line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skip passes whitespace, commas and comments.
+func (p *gqlParser) skip() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case strings.HasPrefix(p.src[p.pos:], "\uFEFF"):
+			p.pos += len("\uFEFF")
+		default:
+			return
+		}
+	}
+}
+
+// enter goes one level deeper, failing past gqlMaxDepth; callers that
+// entered defer leave.
+func (p *gqlParser) enter() error {
+	if p.depth >= gqlMaxDepth {
+		return p.errorf("nested deeper than %d levels", gqlMaxDepth)
+	}
+	p.depth++
+	return nil
+}
+
+func (p *gqlParser) leave() { p.depth-- }
+
+func (p *gqlParser) peek(s string) bool {
+	p.skip()
+	return strings.HasPrefix(p.src[p.pos:], s)
+}
+
+func (p *gqlParser) accept(s string) bool {
+	if p.peek(s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *gqlParser) expect(s string) error {
+	if !p.accept(s) {
+		return p.errorf("expected %q", s)
+	}
+	return nil
+}
+
+func isNameStart(c byte) bool { return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isNameChar(c byte) bool  { return isNameStart(c) || c >= '0' && c <= '9' }
+
+func (p *gqlParser) name() (string, error) {
+	p.skip()
+	start := p.pos
+	if p.pos < len(p.src) && isNameStart(p.src[p.pos]) {
+		for p.pos < len(p.src) && isNameChar(p.src[p.pos]) {
+			p.pos++
+		}
+	}
+	if start == p.pos {
+		return "", p.errorf("expected a name")
+	}
+	return p.src[start:p.pos], nil
+}
+
+func (p *gqlParser) definition(doc *gqlDocument) error {
+	if p.peek("{") {
+		selections, err := p.selectionSet()
+		if err != nil {
+			return err
+		}
+		doc.operations = append(doc.operations, &gqlOperation{kind: "query", selections: selections})
+		return nil
+	}
+	keyword, err := p.name()
+	if err != nil {
+		return err
+	}
+	switch keyword {
+	case "query", "mutation", "subscription":
+		op := &gqlOperation{kind: keyword}
+		if !p.peek("(") && !p.peek("{") && !p.peek("@") {
+			if op.name, err = p.name(); err != nil {
+				return err
+			}
+		}
+		if op.vars, err = p.varDefs(); err != nil {
+			return err
+		}
+		if _, err := p.directives(); err != nil {
+			return err
+		}
+		if op.selections, err = p.selectionSet(); err != nil {
+			return err
+		}
+		doc.operations = append(doc.operations, op)
+	case "fragment":
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		if on, err := p.name(); err != nil || on != "on" {
+			return p.errorf("expected \"on\" after fragment %s", name)
+		}
+		if _, err := p.name(); err != nil {
+			return err
+		}
+		if _, err := p.directives(); err != nil {
+			return err
+		}
+		selections, err := p.selectionSet()
+		if err != nil {
+			return err
+		}
+		doc.fragments[name] = &gqlFragment{selections: selections}
+	default:
+		return p.errorf("unexpected %q", keyword)
+	}
+	return nil
+}
+
+func (p *gqlParser) varDefs() ([]gqlVarDef, error) {
+	if !p.accept("(") {
+		return nil, nil
+	}
+	var defs []gqlVarDef
+	for !p.accept(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		typ, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		def := gqlVarDef{name: name, typ: typ}
+		if p.accept("=") {
+			if def.value, err = p.value(true); err != nil {
+				return nil, err
+			}
+		}
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
+
+func (p *gqlParser) typeRef() (string, error) {
+	if err := p.enter(); err != nil {
+		return "", err
+	}
+	defer p.leave()
+	var typ string
+	if p.accept("[") {
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if p.accept("!") {
+		typ += "!"
+	}
+	return typ, nil
+}
+
+func (p *gqlParser) selectionSet() ([]gqlSelection, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var selections []gqlSelection
+	for !p.accept("}") {
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("unterminated selection set")
+		}
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+	if len(selections) == 0 {
+		return nil, p.errorf("empty selection set")
+	}
+	return selections, nil
+}
+
+func (p *gqlParser) selection() (sel gqlSelection, err error) {
+	if p.accept("...") {
+		// type conditions are not checked, every object type is concrete
+		if !p.peek("{") && !p.peek("@") {
+			if sel.spread, err = p.name(); err != nil {
+				return sel, err
+			}
+			if sel.spread != "on" {
+				sel.directives, err = p.directives()
+				return sel, err
+			}
+			sel.spread = ""
+			if _, err := p.name(); err != nil {
+				return sel, err
+			}
+		}
+		sel.inline = true
+		if sel.directives, err = p.directives(); err != nil {
+			return sel, err
+		}
+		sel.selections, err = p.selectionSet()
+		return sel, err
+	}
+
+	if sel.name, err = p.name(); err != nil {
+		return sel, err
+	}
+	if p.accept(":") {
+		sel.alias = sel.name
+		if sel.name, err = p.name(); err != nil {
+			return sel, err
+		}
+	}
+	if sel.args, err = p.arguments(); err != nil {
+		return sel, err
+	}
+	if sel.directives, err = p.directives(); err != nil {
+		return sel, err
+	}
+	if p.peek("{") {
+		sel.selections, err = p.selectionSet()
+	}
+	return sel, err
+}
+
+func (p *gqlParser) arguments() (map[string]gqlValue, error) {
+	if !p.accept("(") {
+		return nil, nil
+	}
+	args := make(map[string]gqlValue)
+	for !p.accept(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.value(false); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+func (p *gqlParser) directives() ([]gqlDirective, error) {
+	var directives []gqlDirective
+	for p.accept("@") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if name != "skip" && name != "include" {
+			return nil, p.errorf("unknown directive @%s", name)
+		}
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, gqlDirective{name: name, args: args})
+	}
+	return directives, nil
+}
+
+func (p *gqlParser) value(constant bool) (gqlValue, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	p.skip()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("expected a value")
+	}
+	switch c := p.src[p.pos]; {
+	case c == '$':
+		if constant {
+			return nil, p.errorf("variables are not allowed here")
+		}
+		p.pos++
+		name, err := p.name()
+		return gqlVariable(name), err
+	case c == '"':
+		s, err := p.stringValue()
+		return gqlLiteral{s}, err
+	case c == '-' || c >= '0' && c <= '9':
+		return p.number()
+	case c == '[':
+		p.pos++
+		var list gqlListValue
+		for !p.accept("]") {
+			if p.pos >= len(p.src) {
+				return nil, p.errorf("unterminated list")
+			}
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case c == '{':
+		p.pos++
+		object := make(gqlObjectValue)
+		for !p.accept("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if object[name], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		return object, nil
+	default:
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "true":
+			return gqlLiteral{true}, nil
+		case "false":
+			return gqlLiteral{false}, nil
+		case "null":
+			return gqlLiteral{nil}, nil
+		}
+		// enum values are passed to resolvers as strings
+		return gqlLiteral{name}, nil
+	}
+}
+
+func (p *gqlParser) number() (gqlValue, error) {
+	start := p.pos
+	float := false
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '.' || c == 'e' || c == 'E' || c == '+' {
+			float = true
+		} else if c != '-' && (c < '0' || c > '9') {
+			break
+		}
+		p.pos++
+	}
+	text := p.src[start:p.pos]
+	if !float {
+		if n, err := strconv.Atoi(text); err == nil {
+			return gqlLiteral{n}, nil
+		}
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, p.errorf("invalid number %q", text)
+	}
+	return gqlLiteral{f}, nil
+}
+
+func (p *gqlParser) stringValue() (string, error) {
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := strings.Index(p.src[p.pos+3:], `"""`)
+		if end == -1 {
+			return "", p.errorf("unterminated block string")
+		}
+		s := p.src[p.pos+3 : p.pos+3+end]
+		p.pos += 6 + end
+		return strings.TrimSpace(s), nil
+	}
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return b.String(), nil
+		case c == '\n':
+			return "", p.errorf("unterminated string")
+		case c == '\\' && p.pos+1 < len(p.src):
+			escaped := p.src[p.pos+1]
+			p.pos += 2
+			switch escaped {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'u':
+				if p.pos+4 > len(p.src) {
+					return "", p.errorf("invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					return "", p.errorf("invalid unicode escape")
+				}
+				b.WriteRune(rune(r))
+				p.pos += 4
+			default:
+				b.WriteByte(escaped)
+			}
+		default:
+			r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			b.WriteRune(r)
+			p.pos += size
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/piotrostr/moon/base58"
+)
+
+const (
+	gqlDefaultLimit = 100
+	gqlMaxLimit     = 10_000
+)
+
+// gqlPair is a Pair source: its record, and the address nested fields
+// look up candles and snapshots by.
+type gqlPair struct {
+	record  Record
+	address [32]byte
+}
+
+func (p *gqlPair) gqlRecord() Record { return p.record }
+
+// NewGraphQL builds the schema over the store and the data kept beside
+// it. trader is nil without trading and snapshotDir empty without
+// snapshots; their fields then fail.
+func NewGraphQL(store *PairStore, notes *Notes, candles *CandleStore, trader *Trader, snapshotDir string) *gqlSchema {
+	snapshot := gqlRecordType("Snapshot", reflect.TypeOf(Snapshot{}))
+	candle := gqlRecordType("Candle", reflect.TypeOf(Candle{}))
+	trade := gqlRecordType("Trade", reflect.TypeOf(Position{}))
+	trade.field("pnl", gqlFloat, nil)
+
+	pairRecord := func(tracked TrackedPair, now time.Time) *gqlPair {
+		record := gqlRecordOf(tracked)
+		record["stale"] = priceStale(tracked.LastSeen, now)
+		if note, ok := notes.Get(base58.Encode(tracked.PairAddress[:])); ok {
+			record["tags"] = note.Tags
+			record["note"] = note.Note
+		}
+		return &gqlPair{record: record, address: tracked.PairAddress}
+	}
+
+	snapshots := func(req *gqlRequest, pair string, args gqlArgs) (any, error) {
+		if snapshotDir == "" {
+			return nil, errors.New("snapshots are disabled")
+		}
+		tier, err := args.String("tier", "")
+		if err != nil {
+			return nil, err
+		}
+		since, err := gqlTime(args, "since", time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		limit, err := gqlLimit(args)
+		if err != nil {
+			return nil, err
+		}
+		history, err := gqlSnapshots(req, snapshotDir, pair)
+		if err != nil {
+			return nil, err
+		}
+		var out []Record
+		for _, s := range history {
+			if (tier == "" || s.Tier == tier) && !s.At.Before(since) {
+				out = append(out, gqlRecordOf(s))
+			}
+		}
+		// the most recent ones
+		return out[max(0, len(out)-limit):], nil
+	}
+	candleRange := func(address [32]byte, args gqlArgs) (any, error) {
+		seconds, err := args.Int("resolution", int(candleInterval/time.Second))
+		if err != nil {
+			return nil, err
+		}
+		resolution := time.Duration(seconds) * time.Second
+		if resolution < candleInterval {
+			return nil, fmt.Errorf("resolution must be at least %d seconds", int(candleInterval/time.Second))
+		}
+		from, err := gqlTime(args, "from", time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		to, err := gqlTime(args, "to", candles.Now().Add(candleInterval))
+		if err != nil {
+			return nil, err
+		}
+		limit, err := gqlLimit(args)
+		if err != nil {
+			return nil, err
+		}
+		bars := candles.Range(address, resolution, from, to)
+		bars = bars[max(0, len(bars)-limit):]
+		out := make([]Record, len(bars))
+		for i, bar := range bars {
+			out[i] = gqlRecordOf(bar)
+		}
+		return out, nil
+	}
+	trades := func(pair string, args gqlArgs) (any, error) {
+		if trader == nil {
+			return nil, errors.New("trading is disabled")
+		}
+		status, err := args.String("status", "")
+		if err != nil {
+			return nil, err
+		}
+		where, err := args.Conditions("where")
+		if err != nil {
+			return nil, err
+		}
+		limit, err := gqlLimit(args)
+		if err != nil {
+			return nil, err
+		}
+		var out []Record
+		for _, position := range trader.Positions() {
+			if (pair != "" && position.PairAddress != pair) || (status != "" && string(position.Status) != status) {
+				continue
+			}
+			record := gqlRecordOf(position)
+			record["pnl"] = position.PnL()
+			if matchAll(where, record) {
+				out = append(out, record)
+			}
+		}
+		return out[max(0, len(out)-limit):], nil
+	}
+
+	pair := gqlRecordType("Pair", reflect.TypeOf(TrackedPair{}))
+	pair.field("stale", gqlBoolean, nil)
+	pair.field("tags", gqlList(gqlString), nil)
+	pair.field("note", gqlString, nil)
+	pair.field("snapshots", gqlList(snapshot), func(req *gqlRequest, source any, args gqlArgs) (any, error) {
+		return snapshots(req, base58.Encode(source.(*gqlPair).address[:]), args)
+	}, "tier", "String", "since", "String", "limit", "Int")
+	pair.field("candles", gqlList(candle), func(req *gqlRequest, source any, args gqlArgs) (any, error) {
+		return candleRange(source.(*gqlPair).address, args)
+	}, "resolution", "Int", "from", "String", "to", "String", "limit", "Int")
+	pair.field("trades", gqlList(trade), func(req *gqlRequest, source any, args gqlArgs) (any, error) {
+		return trades(base58.Encode(source.(*gqlPair).address[:]), args)
+	}, "status", "String", "where", "[Condition!]", "limit", "Int")
+
+	query := &gqlType{Name: "Query"}
+	query.field("pairs", gqlList(pair), func(req *gqlRequest, source any, args gqlArgs) (any, error) {
+		where, err := args.Conditions("where")
+		if err != nil {
+			return nil, err
+		}
+		tag, err := args.String("tag", "")
+		if err != nil {
+			return nil, err
+		}
+		orderBy, err := args.String("orderBy", "")
+		if err != nil {
+			return nil, err
+		}
+		desc, err := args.Bool("desc", false)
+		if err != nil {
+			return nil, err
+		}
+		limit, err := gqlLimit(args)
+		if err != nil {
+			return nil, err
+		}
+		offset, err := args.Int("offset", 0)
+		if err != nil || offset < 0 {
+			return nil, errors.New("offset must be a non-negative integer")
+		}
+
+		now := time.Now()
+		var pairs []*gqlPair
+		store.Iterate(func(tracked TrackedPair) bool {
+			p := pairRecord(tracked, now)
+			if matchAll(where, p.record) && (tag == "" || slices.Contains(recordTags(p.record), tag)) {
+				pairs = append(pairs, p)
+			}
+			return true
+		})
+		if orderBy != "" {
+			slices.SortStableFunc(pairs, func(a, b *gqlPair) int {
+				c := compareRecordField(a.record[orderBy], b.record[orderBy])
+				if desc {
+					return -c
+				}
+				return c
+			})
+		}
+		pairs = pairs[min(offset, len(pairs)):]
+		pairs = pairs[:min(limit, len(pairs))]
+
+		// nested snapshots are loaded for every listed pair in one pass
+		addresses := make([]string, len(pairs))
+		for i, p := range pairs {
+			addresses[i] = base58.Encode(p.address[:])
+		}
+		req.values["pairs"] = addresses
+		return pairs, nil
+	}, "where", "[Condition!]", "tag", "String", "orderBy", "String", "desc", "Boolean", "limit", "Int", "offset", "Int")
+	query.field("pair", pair, func(req *gqlRequest, source any, args gqlArgs) (any, error) {
+		address, err := gqlAddress(args)
+		if err != nil {
+			return nil, err
+		}
+		tracked, ok := store.Get(address)
+		if !ok {
+			return nil, nil
+		}
+		return pairRecord(tracked, time.Now()), nil
+	}, "address", "String!")
+	query.field("snapshots", gqlList(snapshot), func(req *gqlRequest, source any, args gqlArgs) (any, error) {
+		pair, err := args.String("pair", "")
+		if err != nil {
+			return nil, err
+		}
+		return snapshots(req, pair, args)
+	}, "pair", "String!", "tier", "String", "since", "String", "limit", "Int")
+	query.field("candles", gqlList(candle), func(req *gqlRequest, source any, args gqlArgs) (any, error) {
+		address, err := gqlAddress(args)
+		if err != nil {
+			return nil, err
+		}
+		return candleRange(address, args)
+	}, "pair", "String!", "resolution", "Int", "from", "String", "to", "String", "limit", "Int")
+	query.field("trades", gqlList(trade), func(req *gqlRequest, source any, args gqlArgs) (any, error) {
+		pair, err := args.String("pair", "")
+		if err != nil {
+			return nil, err
+		}
+		return trades(pair, args)
+	}, "pair", "String", "status", "String", "where", "[Condition!]", "limit", "Int")
+
+	return &gqlSchema{Query: query}
+}
+
+func gqlAddress(args gqlArgs) ([32]byte, error) {
+	s, _ := args["address"].(string)
+	if s == "" {
+		s, _ = args["pair"].(string)
+	}
+	address, err := decodeAddress(s)
+	if err != nil {
+		return address, fmt.Errorf("invalid pair address %q: %v", s, err)
+	}
+	return address, nil
+}
+
+func gqlLimit(args gqlArgs) (int, error) {
+	limit, err := args.Int("limit", gqlDefaultLimit)
+	if err != nil || limit < 0 || limit > gqlMaxLimit {
+		return 0, fmt.Errorf("limit must be an integer in [0, %d]", gqlMaxLimit)
+	}
+	return limit, nil
+}
+
+// gqlTime reads an RFC 3339 time.
+func gqlTime(args gqlArgs, name string, def time.Time) (time.Time, error) {
+	s, err := args.String(name, "")
+	if err != nil || s == "" {
+		return def, err
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return def, fmt.Errorf("argument %q must be an RFC 3339 time: %v", name, err)
+	}
+	return t, nil
+}
+
+// gqlSnapshots returns pair's snapshots, reading those of every pair the
+// request listed on the first call.
+func gqlSnapshots(req *gqlRequest, dir, pair string) ([]Snapshot, error) {
+	if cached, ok := req.values["snapshots"].(map[string][]Snapshot); ok {
+		if history, ok := cached[pair]; ok {
+			return history, nil
+		}
+	}
+	pairs := []string{pair}
+	if listed, ok := req.values["pairs"].([]string); ok && slices.Contains(listed, pair) {
+		pairs = listed
+	}
+	history, err := loadSnapshots(dir, pairs)
+	if err != nil {
+		return nil, err
+	}
+	// pairs without snapshots are cached empty, so they are not read again
+	for _, p := range pairs {
+		if _, ok := history[p]; !ok {
+			history[p] = nil
+		}
+	}
+	req.values["snapshots"] = history
+	return history[pair], nil
+}
+
+func gqlRecordOf(v any) Record {
+	record := Record{}
+	flatten(record, reflect.ValueOf(v))
+	return record
+}
+
+func recordTags(record Record) []string {
+	tags, _ := record["tags"].([]string)
+	return tags
+}
+
+// compareRecordField orders numbers numerically and everything else as
+// text; missing values sort first.
+func compareRecordField(a, b any) int {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return cmp.Compare(x, y)
+		}
+	}
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// gqlMaxBody bounds a POSTed query.
+const gqlMaxBody = 1 << 20
+
+// RegisterGraphQL serves queries at /graphql, POSTed as JSON or in GET
+// parameters, and the schema as SDL on a GET without a query. Only
+// queries are supported, so read tokens may POST too.
+func RegisterGraphQL(server *Server, schema *gqlSchema) {
+	server.HandleRead("/graphql", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query         string         `json:"query"`
+			OperationName string         `json:"operationName"`
+			Variables     map[string]any `json:"variables"`
+		}
+		switch r.Method {
+		case http.MethodGet:
+			query := r.URL.Query()
+			if query.Get("query") == "" {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				fmt.Fprint(w, schema.SDL())
+				return
+			}
+			body.Query, body.OperationName = query.Get("query"), query.Get("operationName")
+			if vars := query.Get("variables"); vars != "" {
+				if err := json.Unmarshal([]byte(vars), &body.Variables); err != nil {
+					writeJSON(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: "invalid variables: " + err.Error()}}})
+					return
+				}
+			}
+		case http.MethodPost:
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, gqlMaxBody)).Decode(&body); err != nil {
+				writeJSON(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: "invalid request: " + err.Error()}}})
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeJSON(w, http.StatusMethodNotAllowed, gqlResponse{Errors: []gqlError{{Message: "use GET or POST"}}})
+			return
+		}
+		writeJSON(w, http.StatusOK, schema.Execute(body.Query, body.OperationName, body.Variables))
+	}))
+}
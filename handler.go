@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/fatih/color"
+	"github.com/piotrostr/moon/protocol"
+)
+
+// Handler decodes frames, prints them and publishes derived events.
+type Handler struct {
+	bus       *EventBus
+	gaps      *GapDetector
+	clock     Clock
+	blocks    *BlockClock
+	store     *PairStore
+	lifecycle *LifecycleTracker
+	warnings  *DecodeWarnings
+	tracer    *Tracer
+	warmUp    *WarmUp
+}
+
+// NewHandler builds a handler stamping events with clock; warnings,
+// tracer and warmUp may be nil.
+func NewHandler(bus *EventBus, gaps *GapDetector, clock Clock, blocks *BlockClock, store *PairStore, lifecycle *LifecycleTracker, warnings *DecodeWarnings, tracer *Tracer, warmUp *WarmUp) *Handler {
+	return &Handler{bus: bus, gaps: gaps, clock: clock, blocks: blocks, store: store, lifecycle: lifecycle, warnings: warnings, tracer: tracer, warmUp: warmUp}
+}
+
+func (h *Handler) HandleFrame(frame Frame) error {
+	h.warmUp.Handling(frame.ConnID, frame.Seq == 0, h.clock.Now())
+	defer h.warmUp.Handled()
+	decode := h.tracer.Start("decode", h.tracer.Active())
+	parsedMessage, warnings, err := parseMessage(frame.Data)
+	if err == nil {
+		err = h.warnings.Check(warnings)
+	}
+	decode.SetAttr("warnings", len(warnings))
+	decode.SetError(err)
+	decode.SetAttr("message.type", fmt.Sprintf("%T", parsedMessage))
+	decode.End()
+	if err != nil {
+		return err
+	}
+
+	// enrichment: the store, lifecycle and every bus subscriber
+	handle := h.tracer.Start("handle", h.tracer.Active())
+	defer handle.End()
+
+	switch msg := parsedMessage.(type) {
+	case *LatestBlockHashMessage:
+		printLatestBlockHashMessage(msg)
+		h.blocks.Observe(msg.LatestBlock, h.clock.Now())
+		if gap := h.gaps.Observe(msg.LatestBlock); gap != nil {
+			h.bus.Publish(gap)
+		}
+	case *PairsMessage:
+		printPairsMessage(msg)
+		handle.SetAttr("pairs", len(msg.Pairs))
+		if err := protocol.CheckPairs(msg); err != nil {
+			// storing shifted fields would corrupt every tracked pair
+			handle.SetError(err)
+			return fmt.Errorf("%w, dropping %d pairs", err, len(msg.Pairs))
+		}
+		h.storePairs(msg, frame.Widened, SourceWebsocket)
+		h.warmUp.Pairs()
+	case *PingMessage:
+		printPingMessage(msg)
+	default:
+		color.Red("Received unknown message type: %T", msg)
+	}
+
+	return nil
+}
+
+func (h *Handler) storePairs(msg *PairsMessage, widened bool, source string) {
+	now := h.clock.Now()
+	block := h.blocks.BlockAt(now)
+	for _, pair := range msg.Pairs {
+		if widened {
+			if !h.store.Update(pair, now, block) {
+				continue
+			}
+		} else {
+			h.store.Upsert(pair, now, block)
+		}
+		h.bus.Publish(&PairUpdatedEvent{sourced: sourced{source}, Pair: pair, At: now, Block: block})
+		h.lifecycle.Observe(pair, now, source)
+	}
+}
+
+// StoreRESTPairs handles pairs fetched from the REST API like pairs from
+// the stream. Pairs without a usable address or price are skipped.
+func (h *Handler) StoreRESTPairs(pairs []RESTPair) {
+	msg := &PairsMessage{}
+	for _, p := range pairs {
+		addr, err := decodeAddress(p.PairAddress)
+		if err != nil {
+			continue
+		}
+		price, err := strconv.ParseFloat(p.PriceUsd, 64)
+		if err != nil || price <= 0 {
+			continue
+		}
+		msg.Pairs = append(msg.Pairs, PairData{
+			PairAddress:     addr,
+			TokenName:       p.BaseToken.Name,
+			TokenSymbol:     p.BaseToken.Symbol,
+			BaseTokenSymbol: p.QuoteToken.Symbol,
+			Price:           price,
+			Volume:          p.Volume.H24,
+		})
+	}
+	h.storePairs(msg, false, SourceREST)
+}
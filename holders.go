@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/piotrostr/moon/base58"
+)
+
+// HolderConfig samples the holder count of launched tokens from a Solana
+// RPC node. Counting scans the token programs' accounts, which public
+// nodes often refuse; use a node that allows getProgramAccounts.
+type HolderConfig struct {
+	RPCURL string `json:"rpcUrl"`
+	// Interval is the time between samples, 5m by default.
+	Interval Duration `json:"interval,omitempty"`
+	// Window is the span growth is measured over, 1h by default.
+	Window Duration `json:"window,omitempty"`
+	// Path is the JSON lines file samples are appended to, holders.jsonl
+	// by default.
+	Path string `json:"path,omitempty"`
+	// MaxPairs bounds the pairs sampled, and so the RPC calls made, per
+	// interval; 200 by default.
+	MaxPairs int `json:"maxPairs,omitempty"`
+}
+
+func (c *HolderConfig) setDefaults() {
+	if c.Interval <= 0 {
+		c.Interval = Duration(5 * time.Minute)
+	}
+	if c.Window <= 0 {
+		c.Window = Duration(time.Hour)
+	}
+	if c.Path == "" {
+		c.Path = "holders.jsonl"
+	}
+	if c.MaxPairs <= 0 {
+		c.MaxPairs = 200
+	}
+}
+
+// Validate expects setDefaults to have run.
+func (c *HolderConfig) Validate() error {
+	if c.RPCURL == "" {
+		return errors.New("rpcUrl is required")
+	}
+	if c.Window < c.Interval {
+		return errors.New("window must be at least one interval")
+	}
+	return nil
+}
+
+func (c *HolderConfig) expandSecrets() error {
+	var err error
+	c.RPCURL, err = secrets.Expand(c.RPCURL)
+	return err
+}
+
+// HolderSample is one holder count, as stored in the samples file.
+type HolderSample struct {
+	PairAddress string    `json:"pairAddress"`
+	Mint        string    `json:"mint"`
+	Holders     int       `json:"holders"`
+	At          time.Time `json:"at"`
+}
+
+// HolderSampledEvent carries a pair's holder count and its growth in
+// holders per hour over the configured window, or over the samples taken
+// so far when the pair is younger than that.
+type HolderSampledEvent struct {
+	PairAddress  string
+	TokenSymbol  string
+	Mint         string
+	Holders      int
+	HolderGrowth float64
+	// Window is the span HolderGrowth was measured over; zero on a pair's
+	// first sample.
+	Window time.Duration
+	At     time.Time
+}
+
+func (e *HolderSampledEvent) EventName() string { return "holders_sampled" }
+
+func (e *HolderSampledEvent) Source() string { return SourceRPC }
+
+// holderSeries is a tracked pair's samples, oldest first, trimmed to the
+// last one at or before the window's start and those after it.
+type holderSeries struct {
+	symbol  string
+	mint    string
+	samples []HolderSample
+}
+
+// growth is the change in holders per hour across the series.
+func (s *holderSeries) growth() (float64, time.Duration) {
+	first, last := s.samples[0], s.samples[len(s.samples)-1]
+	span := last.At.Sub(first.At)
+	if span <= 0 {
+		return 0, 0
+	}
+	return float64(last.Holders-first.Holders) / span.Hours(), span
+}
+
+// HolderTracker samples the holder count of pairs launched while it runs,
+// from discovery until they die, appends the samples to a file and
+// publishes each with its growth rate, for rules, sinks and the
+// leaderboards.
+type HolderTracker struct {
+	config HolderConfig
+	rpc    *RPCClient
+	client *http.Client
+	bus    *EventBus
+	file   *os.File
+
+	mu    sync.Mutex
+	pairs map[string]*holderSeries
+}
+
+func NewHolderTracker(config HolderConfig, bus *EventBus) (*HolderTracker, error) {
+	config.setDefaults()
+	file, err := os.OpenFile(config.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open holder samples: %v", err)
+	}
+	return &HolderTracker{
+		config: config,
+		rpc:    NewRPCClient(config.RPCURL),
+		client: &http.Client{Timeout: 15 * time.Second},
+		bus:    bus,
+		file:   file,
+		pairs:  make(map[string]*holderSeries),
+	}, nil
+}
+
+// Observe tracks launches, not pairs already listed when a connection
+// warms up, and forgets dead pairs.
+func (t *HolderTracker) Observe(event Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch e := event.(type) {
+	case *PairTransitionEvent:
+		if e.To != StateDiscovered || e.Preexisting || len(t.pairs) >= t.config.MaxPairs {
+			return
+		}
+		pair := base58.Encode(e.PairAddress[:])
+		if _, ok := t.pairs[pair]; !ok {
+			t.pairs[pair] = &holderSeries{symbol: e.TokenSymbol}
+		}
+	case *PairDeadEvent:
+		delete(t.pairs, e.Tombstone.PairAddress)
+	}
+}
+
+// Run samples every tracked pair each interval until ctx is done.
+func (t *HolderTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(t.config.Interval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if err := t.resolveMints(ctx); err != nil && ctx.Err() == nil {
+			color.Red("Holder mint lookup error: %v", err)
+		}
+		t.sample(ctx)
+	}
+}
+
+// resolveMints looks up the token mint of pairs tracked without one.
+func (t *HolderTracker) resolveMints(ctx context.Context) error {
+	t.mu.Lock()
+	var pending []string
+	for pair, series := range t.pairs {
+		if series.mint == "" {
+			pending = append(pending, pair)
+		}
+	}
+	t.mu.Unlock()
+
+	for len(pending) > 0 {
+		batch := pending[:min(restPairsBatchSize, len(pending))]
+		pending = pending[len(batch):]
+		pairs, err := fetchRESTPairs(ctx, t.client, batch)
+		if err != nil {
+			return err
+		}
+		t.mu.Lock()
+		for _, p := range pairs {
+			if series, ok := t.pairs[p.PairAddress]; ok && p.BaseToken.Address != "" {
+				series.mint = p.BaseToken.Address
+			}
+		}
+		t.mu.Unlock()
+	}
+	return nil
+}
+
+func (t *HolderTracker) sample(ctx context.Context) {
+	t.mu.Lock()
+	mints := make(map[string]string, len(t.pairs))
+	for pair, series := range t.pairs {
+		if series.mint != "" {
+			mints[pair] = series.mint
+		}
+	}
+	t.mu.Unlock()
+
+	failed := 0
+	var lastErr error
+	for pair, mint := range mints {
+		holders, err := t.rpc.TokenHolders(ctx, mint)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			failed++
+			lastErr = err
+			continue
+		}
+		if event := t.record(HolderSample{PairAddress: pair, Mint: mint, Holders: holders, At: time.Now()}); event != nil {
+			t.bus.Publish(event)
+		}
+	}
+	if failed > 0 {
+		color.Red("Holder count failed for %d of %d pairs: %v", failed, len(mints), lastErr)
+	}
+}
+
+// record adds sample to its pair's series and the samples file, and
+// returns the event to publish, or nil if the pair died meanwhile.
+func (t *HolderTracker) record(sample HolderSample) *HolderSampledEvent {
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	series, ok := t.pairs[sample.PairAddress]
+	if !ok {
+		return nil
+	}
+	if _, err := t.file.Write(append(data, '\n')); err != nil {
+		color.Red("Holder samples write error: %v", err)
+	}
+	series.samples = append(series.samples, sample)
+	cutoff := sample.At.Add(-time.Duration(t.config.Window))
+	for len(series.samples) > 1 && !series.samples[1].At.After(cutoff) {
+		series.samples = series.samples[1:]
+	}
+
+	growth, span := series.growth()
+	return &HolderSampledEvent{
+		PairAddress:  sample.PairAddress,
+		TokenSymbol:  series.symbol,
+		Mint:         sample.Mint,
+		Holders:      sample.Holders,
+		HolderGrowth: growth,
+		Window:       span,
+		At:           sample.At,
+	}
+}
+
+// HolderHistory is a pair's samples within the window, as served by
+// /holders/{pair}.
+type HolderHistory struct {
+	PairAddress  string         `json:"pairAddress"`
+	TokenSymbol  string         `json:"tokenSymbol"`
+	Mint         string         `json:"mint"`
+	HolderGrowth float64        `json:"holderGrowth"`
+	Samples      []HolderSample `json:"samples"`
+}
+
+// HandleHolders serves GET /holders/{pair}.
+func (t *HolderTracker) HandleHolders(r *http.Request) (any, error) {
+	pair := r.PathValue("pair")
+	if addr, err := decodeAddress(pair); err == nil {
+		pair = base58.Encode(addr[:])
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	series, ok := t.pairs[pair]
+	if !ok {
+		return nil, fmt.Errorf("pair %s is not tracked for holders", pair)
+	}
+	history := HolderHistory{
+		PairAddress: displayAddress(pair),
+		TokenSymbol: series.symbol,
+		Mint:        series.mint,
+		Samples:     append([]HolderSample{}, series.samples...),
+	}
+	if len(series.samples) > 0 {
+		history.HolderGrowth, _ = series.growth()
+	}
+	return history, nil
+}
+
+func (t *HolderTracker) Close() error {
+	return t.file.Close()
+}
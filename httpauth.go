@@ -0,0 +1,193 @@
+package main
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Token scopes: read tokens may call the endpoints that change nothing,
+// admin tokens every endpoint.
+const (
+	ScopeRead  = "read"
+	ScopeAdmin = "admin"
+)
+
+// minTokenLength keeps guessable tokens out of configs.
+const minTokenLength = 16
+
+// HTTPConfig secures the -http server so it can be exposed beyond
+// localhost. Without tokens every endpoint is open, as before, and the
+// admin API is left off the server.
+type HTTPConfig struct {
+	// Tokens are accepted as "Authorization: Bearer <token>".
+	Tokens []APIToken `json:"tokens,omitempty"`
+	TLS    *TLSConfig `json:"tls,omitempty"`
+}
+
+type APIToken struct {
+	// Name identifies the token in errors.
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	// Scope is read or admin.
+	Scope string `json:"scope"`
+}
+
+// TLSConfig serves HTTPS with a certificate from files, or with ones
+// obtained from Let's Encrypt for Autocert's host names. Autocert answers
+// the tls-alpn-01 challenge, so the server must be reachable on port 443
+// under those names.
+type TLSConfig struct {
+	CertFile string   `json:"certFile,omitempty"`
+	KeyFile  string   `json:"keyFile,omitempty"`
+	Autocert []string `json:"autocert,omitempty"`
+	// CacheDir keeps obtained certificates, autocert by default.
+	CacheDir string `json:"cacheDir,omitempty"`
+	// Email is given to Let's Encrypt for expiry notices.
+	Email string `json:"email,omitempty"`
+}
+
+func (c *HTTPConfig) expandSecrets() error {
+	for i := range c.Tokens {
+		var err error
+		if c.Tokens[i].Token, err = secrets.Expand(c.Tokens[i].Token); err != nil {
+			return fmt.Errorf("token %s: %v", c.Tokens[i].Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *HTTPConfig) Validate() error {
+	names := make(map[string]bool)
+	for _, token := range c.Tokens {
+		if token.Name == "" {
+			return errors.New("tokens need a name")
+		}
+		if names[token.Name] {
+			return fmt.Errorf("duplicate token name %q", token.Name)
+		}
+		names[token.Name] = true
+		if len(token.Token) < minTokenLength {
+			return fmt.Errorf("token %s is shorter than %d characters", token.Name, minTokenLength)
+		}
+		if token.Scope != ScopeRead && token.Scope != ScopeAdmin {
+			return fmt.Errorf("token %s: scope must be %s or %s", token.Name, ScopeRead, ScopeAdmin)
+		}
+	}
+	if c.TLS != nil {
+		if err := c.TLS.Validate(); err != nil {
+			return fmt.Errorf("tls: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *TLSConfig) Validate() error {
+	files := c.CertFile != "" || c.KeyFile != ""
+	switch {
+	case files && len(c.Autocert) > 0:
+		return errors.New("set either certFile and keyFile or autocert")
+	case files && (c.CertFile == "" || c.KeyFile == ""):
+		return errors.New("certFile and keyFile go together")
+	case !files && len(c.Autocert) == 0:
+		return errors.New("set certFile and keyFile or autocert")
+	}
+	return nil
+}
+
+// tlsConfig loads the certificate or sets up autocert.
+func (c *TLSConfig) tlsConfig() (*tls.Config, error) {
+	if len(c.Autocert) > 0 {
+		return autocertTLS(c)
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load certificate: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// endpointScope is the scope a request to an endpoint needs: admin for
+// the admin API and for methods that change state, read for the rest.
+// Patterns without a method take it from the request, so a handler
+// serving both GET and POST only reads for read tokens. Handlers
+// registered with HandleRead are read whatever the method.
+func endpointScope(pattern, method string) string {
+	patternMethod, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		patternMethod, path = "", pattern
+	}
+	if strings.HasPrefix(path, "/admin/") {
+		return ScopeAdmin
+	}
+	if patternMethod != "" {
+		method = patternMethod
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return ScopeRead
+	}
+	return ScopeAdmin
+}
+
+// tokenScope is the scope of the request's bearer token, or "" if it
+// has none or an unknown one.
+func (s *Server) tokenScope(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			return t.Scope
+		}
+	}
+	return ""
+}
+
+// authorize checks the token of every request against the scope of the
+// endpoint it is routed to.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := s.mux.Handler(r)
+		scope := s.tokenScope(r)
+		switch {
+		case scope == "":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="moon"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or unknown bearer token"})
+		case scope == ScopeRead && !s.readOnly[pattern] && endpointScope(pattern, r.Method) == ScopeAdmin:
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "this endpoint needs an admin token"})
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// tokenFlag registers -token on fs for commands calling a running
+// instance's API.
+func tokenFlag(fs *flag.FlagSet) *string {
+	return fs.String("token", "", "bearer token for a server with http tokens (default $MOON_TOKEN)")
+}
+
+// apiRequest calls a running instance with token, or $MOON_TOKEN, as the
+// bearer token. Bodies are JSON.
+func apiRequest(method, url, token string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token = cmp.Or(token, os.Getenv("MOON_TOKEN")); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return http.DefaultClient.Do(req)
+}
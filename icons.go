@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/piotrostr/moon/base58"
+)
+
+const (
+	// iconMaxBytes bounds a downloaded icon or metadata document.
+	iconMaxBytes = 1 << 20
+	// iconRetryAfter is how long a pair without an icon is left alone.
+	iconRetryAfter = time.Hour
+	iconBatchEvery = 2 * time.Second
+	iconIndexFile  = "index.json"
+)
+
+// iconEntry is a cached icon: Source is the public URL it came from, fit
+// for embeds in chat apps, and the image is stored as the pair's address.
+type iconEntry struct {
+	Source      string `json:"source"`
+	ContentType string `json:"contentType"`
+}
+
+// IconCache fetches token icons from the image URLs dexscreener lists for
+// pairs, following token metadata documents to their image, and keeps
+// them in a directory. Pairs are queued as they are discovered or
+// alerted on and looked up in batches in the background. Alerts get the
+// icon's source URL, and the images are served at /icons/{pair}.
+type IconCache struct {
+	dir    string
+	client *http.Client
+	// images fetches the URLs token creators put in their metadata, and
+	// only reaches public addresses over https
+	images *http.Client
+	queue  chan string
+
+	mu      sync.Mutex
+	icons   map[string]iconEntry
+	missing map[string]time.Time
+	queued  map[string]bool
+}
+
+// NewIconCache loads the icons cached in dir.
+func NewIconCache(dir string) (*IconCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create icon cache: %v", err)
+	}
+	c := &IconCache{
+		dir:     dir,
+		client:  &http.Client{Timeout: 15 * time.Second},
+		images:  newPublicClient(15 * time.Second),
+		queue:   make(chan string, 1024),
+		icons:   make(map[string]iconEntry),
+		missing: make(map[string]time.Time),
+		queued:  make(map[string]bool),
+	}
+	data, err := os.ReadFile(filepath.Join(dir, iconIndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read icon index: %v", err)
+	}
+	if err := json.Unmarshal(data, &c.icons); err != nil {
+		return nil, fmt.Errorf("parse icon index: %v", err)
+	}
+	return c, nil
+}
+
+// Observe queues discovered pairs and forgets dead ones.
+func (c *IconCache) Observe(event Event) {
+	switch e := event.(type) {
+	case *PairTransitionEvent:
+		if e.To == StateDiscovered {
+			c.request(base58.Encode(e.PairAddress[:]))
+		}
+	case *PairDeadEvent:
+		c.forget(e.Tombstone.PairAddress)
+	}
+}
+
+// Filter is an EventBus filter setting AlertEvent.IconURL, and queueing
+// the pair when its icon is not cached yet.
+func (c *IconCache) Filter(event Event) bool {
+	alert, ok := event.(*AlertEvent)
+	if !ok || alert.PairAddress == "" {
+		return true
+	}
+	c.mu.Lock()
+	entry, ok := c.icons[alert.PairAddress]
+	c.mu.Unlock()
+	if ok {
+		alert.IconURL = entry.Source
+	} else {
+		c.request(alert.PairAddress)
+	}
+	return true
+}
+
+func (c *IconCache) request(pair string) {
+	// pairs name cached files, so they must be addresses
+	if _, err := decodeAddress(pair); err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.icons[pair]; ok || c.queued[pair] || time.Since(c.missing[pair]) < iconRetryAfter {
+		return
+	}
+	select {
+	case c.queue <- pair:
+		c.queued[pair] = true
+	default:
+		// dropped; the pair is requested again on its next alert
+	}
+}
+
+func (c *IconCache) forget(pair string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.missing, pair)
+	if _, ok := c.icons[pair]; !ok {
+		return
+	}
+	delete(c.icons, pair)
+	os.Remove(filepath.Join(c.dir, pair))
+	if err := c.saveIndex(); err != nil {
+		color.Red("Icon cache error: %v", err)
+	}
+}
+
+// Run looks up queued pairs in batches until ctx is done.
+func (c *IconCache) Run(ctx context.Context) {
+	ticker := time.NewTicker(iconBatchEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		var batch []string
+	drain:
+		for len(batch) < restPairsBatchSize {
+			select {
+			case pair := <-c.queue:
+				batch = append(batch, pair)
+			default:
+				break drain
+			}
+		}
+		if len(batch) > 0 {
+			if err := c.fetch(ctx, batch); err != nil && ctx.Err() == nil {
+				color.Red("Icon fetch error: %v", err)
+			}
+		}
+	}
+}
+
+func (c *IconCache) fetch(ctx context.Context, batch []string) error {
+	defer func() {
+		c.mu.Lock()
+		for _, pair := range batch {
+			delete(c.queued, pair)
+		}
+		c.mu.Unlock()
+	}()
+
+	pairs, err := fetchRESTPairs(ctx, c.client, batch)
+	if err != nil {
+		return err
+	}
+	sources := make(map[string]string)
+	for _, p := range pairs {
+		if p.Info.ImageURL != "" {
+			sources[p.PairAddress] = p.Info.ImageURL
+		}
+	}
+
+	fetched := 0
+	for _, pair := range batch {
+		source, ok := sources[pair]
+		var entry iconEntry
+		if ok {
+			entry, err = c.download(ctx, pair, source)
+			if err != nil {
+				color.Yellow("No icon for %s: %v", pair, err)
+			}
+		}
+		c.mu.Lock()
+		if ok && err == nil {
+			c.icons[pair] = entry
+			delete(c.missing, pair)
+			fetched++
+		} else {
+			c.missing[pair] = time.Now()
+		}
+		c.mu.Unlock()
+	}
+	if fetched == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.saveIndex()
+}
+
+// download stores the image at source as pair. A JSON document is taken
+// to be token metadata and its image is fetched instead.
+func (c *IconCache) download(ctx context.Context, pair, source string) (iconEntry, error) {
+	data, err := c.get(ctx, source)
+	if err != nil {
+		return iconEntry{}, err
+	}
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		var metadata struct {
+			Image string `json:"image"`
+		}
+		if err := json.Unmarshal(data, &metadata); err != nil || metadata.Image == "" {
+			return iconEntry{}, fmt.Errorf("metadata at %s has no image", source)
+		}
+		source = metadata.Image
+		if data, err = c.get(ctx, source); err != nil {
+			return iconEntry{}, err
+		}
+	}
+
+	// served from our own origin, so only raster images
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return iconEntry{}, fmt.Errorf("%s is %s, not an image", source, contentType)
+	}
+	if err := os.WriteFile(filepath.Join(c.dir, pair), data, 0o644); err != nil {
+		return iconEntry{}, fmt.Errorf("write icon: %v", err)
+	}
+	return iconEntry{Source: source, ContentType: contentType}, nil
+}
+
+func (c *IconCache) get(ctx context.Context, url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("unsupported icon url %q, want https", url)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.images.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("icon request error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("icon request failed: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, iconMaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("icon read error: %v", err)
+	}
+	if len(data) > iconMaxBytes {
+		return nil, fmt.Errorf("icon at %s is over %d bytes", url, iconMaxBytes)
+	}
+	return data, nil
+}
+
+// newPublicClient returns a client for URLs from untrusted input. It
+// follows only https redirects, bypasses any proxy, and refuses to
+// connect to loopback, private, link-local and other non-public addresses,
+// checked after DNS resolution so a hostname cannot point it inward.
+func newPublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: publicAddressOnly}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			ForceAttemptHTTP2:   true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to %s url refused", req.URL.Scheme)
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// sharedAddressSpace is carrier-grade NAT, not reachable from outside.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddressOnly is a net.Dialer Control func refusing addresses that
+// are not on the public internet.
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("refusing to connect to non-public address %s", ip)
+	}
+	return nil
+}
+
+// saveIndex writes the index atomically. The caller holds c.mu.
+func (c *IconCache) saveIndex() error {
+	data, err := json.MarshalIndent(c.icons, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(c.dir, iconIndexFile)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("write icon index: %v", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// HandleIcon serves GET /icons/{pair}, queueing pairs it has no icon for.
+func (c *IconCache) HandleIcon(w http.ResponseWriter, r *http.Request) {
+	pair := r.PathValue("pair")
+	if _, err := decodeAddress(pair); err != nil {
+		http.Error(w, "invalid pair address", http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	entry, ok := c.icons[pair]
+	c.mu.Unlock()
+	if !ok {
+		c.request(pair)
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", entry.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeFile(w, r, filepath.Join(c.dir, pair))
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// runImport implements `moon import`, converting external history into the
+// pair_updated recording format the backtester reads, so backtests can
+// reach back before moon was running.
+//
+// Dexscreener REST exports are /latest/dex/pairs responses saved as JSON
+// or JSON lines; each response is one snapshot of its pairs, taken at its
+// "fetchedAt" field if present and otherwise at the file's modification
+// time. Birdeye CSVs are a price history for one token and need -pair.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "", "input format: dexscreener or birdeye (default: by extension, .csv is birdeye)")
+	out := fs.String("o", "recording.jsonl", "recording to append ticks to")
+	pair := fs.String("pair", "", "birdeye: pair address the history belongs to")
+	symbol := fs.String("symbol", "", "birdeye: token symbol")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("usage: moon import [flags] file...")
+	}
+
+	file, err := os.OpenFile(*out, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open recording: %v", err)
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	defer w.Flush()
+	encoder := json.NewEncoder(w)
+
+	total := 0
+	for _, path := range fs.Args() {
+		kind := *format
+		if kind == "" {
+			kind = "dexscreener"
+			if strings.EqualFold(filepath.Ext(path), ".csv") {
+				kind = "birdeye"
+			}
+		}
+
+		var ticks []Tick
+		switch kind {
+		case "dexscreener":
+			ticks, err = importDexscreener(path)
+		case "birdeye":
+			if *pair == "" {
+				return errors.New("birdeye imports need -pair")
+			}
+			ticks, err = importBirdeye(path, *pair, *symbol)
+		default:
+			return fmt.Errorf("unknown format: %q", kind)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+
+		for _, tick := range ticks {
+			if err := encoder.Encode(tick); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(console, "%s: %d ticks\n", path, len(ticks))
+		total += len(ticks)
+	}
+
+	color.Green("Imported %d ticks into %s", total, *out)
+	return nil
+}
+
+func importDexscreener(path string) ([]Tick, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ticks []Tick
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var response struct {
+			FetchedAt time.Time  `json:"fetchedAt"`
+			Pairs     []RESTPair `json:"pairs"`
+			// a single-pair lookup returns "pair" instead
+			Pair *RESTPair `json:"pair"`
+		}
+		if err := decoder.Decode(&response); err == io.EOF {
+			return ticks, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if response.Pair != nil {
+			response.Pairs = append(response.Pairs, *response.Pair)
+		}
+		at := response.FetchedAt
+		if at.IsZero() {
+			at = info.ModTime()
+		}
+		for _, pair := range response.Pairs {
+			price, err := strconv.ParseFloat(pair.PriceUsd, 64)
+			if err != nil || price <= 0 || pair.PairAddress == "" {
+				continue
+			}
+			ticks = append(ticks, Tick{
+				Event:       "pair_updated",
+				PairAddress: pair.PairAddress,
+				TokenSymbol: pair.BaseToken.Symbol,
+				Price:       price,
+				Volume:      pair.Volume.H24,
+				At:          at.UTC(),
+			})
+		}
+	}
+}
+
+// importBirdeye reads a price history CSV with a header. The time column
+// is unixTime, time or timestamp (unix seconds, or RFC 3339); price is
+// value, close or price. Volume is optional and per row; it is summed
+// over a trailing 24h to match the stream's rolling volume.
+func importBirdeye(path, pair, symbol string) ([]Tick, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %v", err)
+	}
+	column := func(names ...string) int {
+		for i, h := range header {
+			for _, name := range names {
+				if strings.EqualFold(strings.TrimSpace(h), name) {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+	timeCol := column("unixTime", "time", "timestamp")
+	priceCol := column("value", "close", "price", "c")
+	volumeCol := column("volume", "v", "volumeUSD")
+	if timeCol < 0 || priceCol < 0 {
+		return nil, fmt.Errorf("need time and price columns, got %v", header)
+	}
+
+	var ticks []Tick
+	var volumes []float64
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			rollVolume(ticks, volumes)
+			return ticks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		at, err := parseImportTime(record[timeCol])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		price, err := strconv.ParseFloat(record[priceCol], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid price: %v", line, err)
+		}
+		var volume float64
+		if volumeCol >= 0 && volumeCol < len(record) {
+			volume, _ = strconv.ParseFloat(record[volumeCol], 64)
+		}
+		volumes = append(volumes, volume)
+		ticks = append(ticks, Tick{
+			Event:       "pair_updated",
+			PairAddress: pair,
+			TokenSymbol: symbol,
+			Price:       price,
+			At:          at,
+		})
+	}
+}
+
+// rollVolume sets each tick's volume to the sum of volumes in the 24h up
+// to it. Ticks must be in time order, as exports are.
+func rollVolume(ticks []Tick, volumes []float64) {
+	start, sum := 0, 0.0
+	for i := range ticks {
+		sum += volumes[i]
+		for ticks[start].At.Before(ticks[i].At.Add(-24 * time.Hour)) {
+			sum -= volumes[start]
+			start++
+		}
+		ticks[i].Volume = sum
+	}
+}
+
+func parseImportTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if seconds > 1e12 {
+			// milliseconds
+			return time.UnixMilli(seconds).UTC(), nil
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MarketContext is the pair's state when a position was entered.
+type MarketContext struct {
+	Price  float64 `json:"price"`
+	Volume float64 `json:"volume"`
+	// PairAge is in seconds since the pair was first seen.
+	PairAge float64 `json:"pairAge"`
+	Block   uint32  `json:"block"`
+}
+
+// JournalEntry is one round trip, written when a position closes.
+type JournalEntry struct {
+	ID          int    `json:"id"`
+	PairAddress string `json:"pairAddress"`
+	TokenSymbol string `json:"tokenSymbol"`
+	Mode        string `json:"mode"`
+	// Reason is what opened the position, e.g. rule:<name> or api.
+	Reason   string `json:"reason"`
+	ExitRule string `json:"exitRule"`
+
+	EntryAt          time.Time `json:"entryAt"`
+	ExitAt           time.Time `json:"exitAt"`
+	EntryPrice       float64   `json:"entryPrice"`
+	ExitPrice        float64   `json:"exitPrice"`
+	CostLamports     uint64    `json:"costLamports"`
+	Tokens           uint64    `json:"tokens"`
+	ProceedsLamports uint64    `json:"proceedsLamports"`
+	FeeLamports      uint64    `json:"feeLamports"`
+	// Slippage is the fraction of quoted output lost on each fill.
+	EntrySlippage float64 `json:"entrySlippage"`
+	ExitSlippage  float64 `json:"exitSlippage"`
+	// PnLSOL and PnL are net of FeeLamports.
+	PnLSOL float64 `json:"pnlSol"`
+	PnL    float64 `json:"pnl"`
+
+	Context MarketContext `json:"context"`
+}
+
+func journalEntry(p Position) JournalEntry {
+	return JournalEntry{
+		ID:               p.ID,
+		PairAddress:      p.PairAddress,
+		TokenSymbol:      p.TokenSymbol,
+		Mode:             p.Mode,
+		Reason:           p.Reason,
+		ExitRule:         p.ExitRule,
+		EntryAt:          p.EntryAt,
+		ExitAt:           p.ExitAt,
+		EntryPrice:       p.EntryPrice,
+		ExitPrice:        p.ExitPrice,
+		CostLamports:     p.CostLamports,
+		Tokens:           p.Tokens,
+		ProceedsLamports: p.ProceedsLamports,
+		FeeLamports:      p.EntryFee + p.ExitFee,
+		EntrySlippage:    p.EntrySlippage,
+		ExitSlippage:     p.ExitSlippage,
+		PnLSOL:           float64(p.realizedLamports()) / lamportsPerSOL,
+		PnL:              p.PnL(),
+		Context:          p.EntryContext,
+	}
+}
+
+// slippage is how much of the quoted output a fill lost.
+func slippage(execution *Execution) float64 {
+	if execution.QuotedOut == 0 || execution.Estimated {
+		return 0
+	}
+	return (float64(execution.QuotedOut) - float64(execution.FilledOut)) / float64(execution.QuotedOut)
+}
+
+// TradeJournal appends journal entries as JSON lines to a file.
+type TradeJournal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func OpenTradeJournal(path string) (*TradeJournal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open trade journal: %v", err)
+	}
+	return &TradeJournal{file: file}, nil
+}
+
+func (j *TradeJournal) Write(entry JournalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.file.Write(append(data, '\n'))
+	return err
+}
+
+func (j *TradeJournal) Close() error {
+	return j.file.Close()
+}
+
+func ReadJournal(path string) ([]JournalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open trade journal: %v", err)
+	}
+	defer file.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+var journalColumns = []string{
+	"id", "pairAddress", "tokenSymbol", "mode", "reason", "exitRule",
+	"entryAt", "exitAt", "entryPrice", "exitPrice",
+	"costSol", "proceedsSol", "feeSol", "entrySlippage", "exitSlippage", "pnlSol", "pnl",
+	"entryVolume", "entryPairAge", "entryBlock",
+}
+
+func writeJournalCSV(w io.Writer, entries []JournalEntry) error {
+	sol := func(lamports uint64) string {
+		return strconv.FormatFloat(float64(lamports)/lamportsPerSOL, 'f', 9, 64)
+	}
+	num := func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+
+	cw := csv.NewWriter(w)
+	cw.Write(journalColumns)
+	for _, e := range entries {
+		cw.Write([]string{
+			strconv.Itoa(e.ID), e.PairAddress, e.TokenSymbol, e.Mode, e.Reason, e.ExitRule,
+			e.EntryAt.UTC().Format(time.RFC3339), e.ExitAt.UTC().Format(time.RFC3339),
+			num(e.EntryPrice), num(e.ExitPrice),
+			sol(e.CostLamports), sol(e.ProceedsLamports), sol(e.FeeLamports),
+			num(e.EntrySlippage), num(e.ExitSlippage), num(e.PnLSOL), num(e.PnL),
+			num(e.Context.Volume), num(e.Context.PairAge), strconv.FormatUint(uint64(e.Context.Block), 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// runJournal implements `moon journal export`.
+func runJournal(args []string) error {
+	if len(args) == 0 || args[0] != "export" {
+		return errors.New("usage: moon journal export [flags]")
+	}
+
+	fs := flag.NewFlagSet("journal export", flag.ExitOnError)
+	path := fs.String("journal", "trades.jsonl", "trade journal file")
+	format := fs.String("format", "csv", "output format: csv or json")
+	since := fs.String("since", "", "only trades closed on or after this date (YYYY-MM-DD)")
+	until := fs.String("until", "", "only trades closed before this date (YYYY-MM-DD)")
+	output := fs.String("o", "", "output file (default stdout)")
+	fs.Parse(args[1:])
+
+	entries, err := ReadJournal(*path)
+	if err != nil {
+		return err
+	}
+	entries, err = filterJournal(entries, *since, *until)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch *format {
+	case "csv":
+		return writeJournalCSV(w, entries)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if entries == nil {
+			entries = []JournalEntry{}
+		}
+		return enc.Encode(entries)
+	default:
+		return fmt.Errorf("unknown format: %q", *format)
+	}
+}
+
+func filterJournal(entries []JournalEntry, since, until string) ([]JournalEntry, error) {
+	var from, to time.Time
+	var err error
+	if since != "" {
+		if from, err = time.Parse(time.DateOnly, since); err != nil {
+			return nil, fmt.Errorf("invalid -since: %v", err)
+		}
+	}
+	if until != "" {
+		if to, err = time.Parse(time.DateOnly, until); err != nil {
+			return nil, fmt.Errorf("invalid -until: %v", err)
+		}
+	}
+
+	var filtered []JournalEntry
+	for _, e := range entries {
+		if !from.IsZero() && e.ExitAt.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !e.ExitAt.Before(to) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered, nil
+}
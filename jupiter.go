@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	jupiterAPI = "https://quote-api.jup.ag/v6"
+	solMint    = "So11111111111111111111111111111111111111112"
+)
+
+// JupiterClient builds swap transactions through the Jupiter aggregator,
+// which routes moonshot bonding curve and graduated pools alike.
+type JupiterClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewJupiterClient() *JupiterClient {
+	return &JupiterClient{baseURL: jupiterAPI, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type JupiterQuote struct {
+	Raw       json.RawMessage
+	InAmount  uint64
+	OutAmount uint64
+	// MinOut is the least the swap may return within the slippage.
+	MinOut uint64
+}
+
+func (j *JupiterClient) Quote(ctx context.Context, inputMint, outputMint string, amount uint64, slippageBps int) (*JupiterQuote, error) {
+	query := url.Values{}
+	query.Set("inputMint", inputMint)
+	query.Set("outputMint", outputMint)
+	query.Set("amount", strconv.FormatUint(amount, 10))
+	query.Set("slippageBps", strconv.Itoa(slippageBps))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.baseURL+"/quote?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("quote request error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("quote request failed: %s", resp.Status)
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("quote decode error: %v", err)
+	}
+	var amounts struct {
+		InAmount  string `json:"inAmount"`
+		OutAmount string `json:"outAmount"`
+		MinOut    string `json:"otherAmountThreshold"`
+	}
+	if err := json.Unmarshal(raw, &amounts); err != nil {
+		return nil, fmt.Errorf("quote decode error: %v", err)
+	}
+
+	quote := &JupiterQuote{Raw: raw}
+	quote.InAmount, _ = strconv.ParseUint(amounts.InAmount, 10, 64)
+	quote.OutAmount, _ = strconv.ParseUint(amounts.OutAmount, 10, 64)
+	quote.MinOut, _ = strconv.ParseUint(amounts.MinOut, 10, 64)
+	return quote, nil
+}
+
+// SwapTransaction returns an unsigned wire-format transaction for quote and
+// the last block height at which its blockhash is valid.
+func (j *JupiterClient) SwapTransaction(ctx context.Context, quote *JupiterQuote, user string, unitPrice uint64) ([]byte, uint64, error) {
+	body, err := json.Marshal(map[string]any{
+		"quoteResponse":                 quote.Raw,
+		"userPublicKey":                 user,
+		"wrapAndUnwrapSol":              true,
+		"dynamicComputeUnitLimit":       true,
+		"computeUnitPriceMicroLamports": unitPrice,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.baseURL+"/swap", bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("swap request error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("swap request failed: %s", resp.Status)
+	}
+
+	var result struct {
+		SwapTransaction      string `json:"swapTransaction"`
+		LastValidBlockHeight uint64 `json:"lastValidBlockHeight"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, fmt.Errorf("swap decode error: %v", err)
+	}
+	tx, err := base64.StdEncoding.DecodeString(result.SwapTransaction)
+	return tx, result.LastValidBlockHeight, err
+}
@@ -0,0 +1,286 @@
+//go:build !lite
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/piotrostr/moon/base58"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// EncryptedKeypair is moon's on-disk keypair format: the 64 byte Solana
+// secret key sealed with NaCl secretbox under an scrypt-derived key.
+type EncryptedKeypair struct {
+	Version    int    `json:"version"`
+	PublicKey  string `json:"publicKey"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+const (
+	keypairVersion = 1
+	scryptN        = 1 << 15
+	scryptR        = 8
+	scryptP        = 1
+	// scryptMaxMemory bounds the 128*N*R bytes scrypt takes for parameters
+	// read from a keypair file, which a crafted file could set to exhaust
+	// memory; it is 8 times what moon itself writes.
+	scryptMaxMemory = 256 << 20
+	scryptMaxP      = 16
+)
+
+// KeypairConfig points the executor at an encrypted keypair. The key itself
+// never appears in config; only where to find it and how to unlock it.
+type KeypairConfig struct {
+	Path string `json:"path"`
+	// Passphrase is "prompt" (default), "keychain", or a secret reference
+	// such as ${env:MOON_PASSPHRASE}.
+	Passphrase string `json:"passphrase,omitempty"`
+	// KeychainAccount names the OS keychain entry, default the key path.
+	KeychainAccount string `json:"keychainAccount,omitempty"`
+}
+
+func LoadKeypair(config KeypairConfig) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(config.Path)
+	if err != nil {
+		return nil, fmt.Errorf("read keypair: %v", err)
+	}
+
+	var encrypted EncryptedKeypair
+	if err := json.Unmarshal(data, &encrypted); err != nil {
+		return nil, fmt.Errorf("parse keypair %s: %v", config.Path, err)
+	}
+
+	passphrase, err := keypairPassphrase(config)
+	if err != nil {
+		return nil, err
+	}
+	return encrypted.Decrypt(passphrase)
+}
+
+func keypairPassphrase(config KeypairConfig) ([]byte, error) {
+	switch config.Passphrase {
+	case "", "prompt":
+		return promptPassphrase(fmt.Sprintf("Passphrase for %s: ", config.Path))
+	case "keychain":
+		account := config.KeychainAccount
+		if account == "" {
+			account = config.Path
+		}
+		return keychainPassphrase(account)
+	default:
+		passphrase, err := secrets.Expand(config.Passphrase)
+		return []byte(passphrase), err
+	}
+}
+
+func promptPassphrase(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, errors.New("passphrase prompt requires a terminal")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return passphrase, err
+}
+
+// keychainPassphrase reads the passphrase stored under service "moon" in the
+// macOS keychain or the freedesktop secret service.
+func keychainPassphrase(account string) ([]byte, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", "moon", "-a", account, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", "moon", "account", account)
+	default:
+		return nil, fmt.Errorf("keychain not supported on %s", runtime.GOOS)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("keychain lookup: %v", err)
+	}
+	return []byte(strings.TrimRight(string(out), "\n")), nil
+}
+
+func EncryptKeypair(key ed25519.PrivateKey, passphrase []byte) (*EncryptedKeypair, error) {
+	var salt [16]byte
+	var nonce [24]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+
+	secret, err := deriveKeypairKey(passphrase, salt[:], scryptN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+
+	public := key.Public().(ed25519.PublicKey)
+	return &EncryptedKeypair{
+		Version:    keypairVersion,
+		PublicKey:  base58.Encode(public),
+		N:          scryptN,
+		R:          scryptR,
+		P:          scryptP,
+		Salt:       base64.StdEncoding.EncodeToString(salt[:]),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce[:]),
+		Ciphertext: base64.StdEncoding.EncodeToString(secretbox.Seal(nil, key, &nonce, secret)),
+	}, nil
+}
+
+func (e *EncryptedKeypair) Decrypt(passphrase []byte) (ed25519.PrivateKey, error) {
+	if e.Version != keypairVersion {
+		return nil, fmt.Errorf("unsupported keypair version %d", e.Version)
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(e.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %v", err)
+	}
+	nonceBytes, err := base64.StdEncoding.DecodeString(e.Nonce)
+	if err != nil || len(nonceBytes) != 24 {
+		return nil, errors.New("invalid nonce")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(e.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext: %v", err)
+	}
+
+	if e.N < 2 || e.R < 1 || e.P < 1 || e.P > scryptMaxP || e.N > scryptMaxMemory/128/e.R {
+		return nil, fmt.Errorf("scrypt parameters n=%d r=%d p=%d are out of bounds", e.N, e.R, e.P)
+	}
+	secret, err := deriveKeypairKey(passphrase, salt, e.N, e.R, e.P)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], nonceBytes)
+	plain, ok := secretbox.Open(nil, ciphertext, &nonce, secret)
+	if !ok || len(plain) != ed25519.PrivateKeySize {
+		return nil, errors.New("wrong passphrase or corrupted keypair")
+	}
+	// the secret key's second half is its public key, but only the seed
+	// signs; check both against the key the file claims to hold
+	key := ed25519.NewKeyFromSeed(plain[:ed25519.SeedSize])
+	if !bytes.Equal(key, plain) || base58.Encode(key.Public().(ed25519.PublicKey)) != e.PublicKey {
+		return nil, fmt.Errorf("keypair does not match its public key %s", e.PublicKey)
+	}
+	return key, nil
+}
+
+func deriveKeypairKey(passphrase, salt []byte, n, r, p int) (*[32]byte, error) {
+	derived, err := scrypt.Key(passphrase, salt, n, r, p, 32)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %v", err)
+	}
+	var key [32]byte
+	copy(key[:], derived)
+	return &key, nil
+}
+
+// readSolanaKeypair parses the JSON byte array written by solana-keygen.
+func readSolanaKeypair(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ints []int
+	if err := json.Unmarshal(data, &ints); err != nil {
+		return nil, fmt.Errorf("parse solana keypair: %v", err)
+	}
+	raw := make([]byte, len(ints))
+	for i, v := range ints {
+		raw[i] = byte(v)
+	}
+	if len(raw) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("solana keypair must be %d bytes, got %d", ed25519.PrivateKeySize, len(raw))
+	}
+	return ed25519.PrivateKey(raw), nil
+}
+
+// runKeypair implements `moon keypair encrypt|pubkey`.
+func runKeypair(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: moon keypair encrypt|pubkey [flags]")
+	}
+
+	switch args[0] {
+	case "encrypt":
+		fs := flag.NewFlagSet("keypair encrypt", flag.ExitOnError)
+		in := fs.String("in", "", "solana-keygen JSON keypair to encrypt")
+		out := fs.String("out", "keypair.enc.json", "encrypted keypair output path")
+		fs.Parse(args[1:])
+
+		key, err := readSolanaKeypair(*in)
+		if err != nil {
+			return err
+		}
+		passphrase, err := promptPassphrase("New passphrase: ")
+		if err != nil {
+			return err
+		}
+		confirm, err := promptPassphrase("Repeat passphrase: ")
+		if err != nil {
+			return err
+		}
+		if string(passphrase) != string(confirm) {
+			return errors.New("passphrases do not match")
+		}
+
+		encrypted, err := EncryptKeypair(key, passphrase)
+		if err != nil {
+			return err
+		}
+		data, _ := json.MarshalIndent(encrypted, "", "  ")
+		if err := os.WriteFile(*out, data, 0o600); err != nil {
+			return err
+		}
+		color.Green("Encrypted keypair %s written to %s", encrypted.PublicKey, *out)
+		color.Yellow("Remember to securely delete %s", *in)
+		return nil
+
+	case "pubkey":
+		fs := flag.NewFlagSet("keypair pubkey", flag.ExitOnError)
+		in := fs.String("in", "keypair.enc.json", "encrypted keypair")
+		fs.Parse(args[1:])
+
+		data, err := os.ReadFile(*in)
+		if err != nil {
+			return err
+		}
+		var encrypted EncryptedKeypair
+		if err := json.Unmarshal(data, &encrypted); err != nil {
+			return err
+		}
+		fmt.Fprintln(console, encrypted.PublicKey)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown keypair command: %q", args[0])
+	}
+}
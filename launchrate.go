@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/piotrostr/moon/base58"
+)
+
+const (
+	// launchRateRetention bounds how many hourly buckets are kept on disk.
+	launchRateRetention = 90 * 24 * time.Hour
+	// launchPairRetention bounds how long a counted pair is remembered, so
+	// it is not counted again when the feed lists it after a restart and
+	// can still be moved to its dex once the REST API names it. The feed
+	// lists new pairs for well under a day.
+	launchPairRetention = 48 * time.Hour
+)
+
+// LaunchBucket counts the pairs discovered in one hour on one dex and chain.
+type LaunchBucket struct {
+	Hour     time.Time `json:"hour"`
+	Chain    string    `json:"chain"`
+	Dex      string    `json:"dex"`
+	Launches int       `json:"launches"`
+}
+
+// launchedPair is a counted pair and the bucket it was counted in.
+type launchedPair struct {
+	PairAddress string    `json:"pairAddress"`
+	Hour        time.Time `json:"hour"`
+	Chain       string    `json:"chain"`
+	Dex         string    `json:"dex"`
+}
+
+// launchRateFile is the format of the launch rate file since schema 2.
+type launchRateFile struct {
+	Buckets []LaunchBucket `json:"buckets"`
+	Pairs   []launchedPair `json:"pairs"`
+}
+
+type launchKey struct {
+	hour       int64
+	chain, dex string
+}
+
+// LaunchRates keeps an hourly launch-rate series per dex and chain and
+// persists it so days can be compared across restarts. The feed does not
+// say which dex or chain a pair is on, so a launch is first counted under
+// the subscription's chain and dex, empty unless it names exactly one, and
+// moved to the pair's own once a REST backfill reports them.
+type LaunchRates struct {
+	path       string
+	chain, dex string
+
+	mu      sync.Mutex
+	buckets map[launchKey]int
+	pairs   map[[32]byte]launchKey
+	dirty   bool
+}
+
+func NewLaunchRates(path string, origin *Origin) (*LaunchRates, error) {
+	r := &LaunchRates{
+		path:    path,
+		chain:   origin.chain,
+		dex:     origin.dex,
+		buckets: make(map[launchKey]int),
+		pairs:   make(map[[32]byte]launchKey),
+	}
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read launch rates: %v", err)
+	}
+	var file launchRateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse launch rates %s: %v", path, err)
+	}
+	for _, b := range file.Buckets {
+		r.buckets[launchKey{hour: b.Hour.Unix(), chain: b.Chain, dex: b.Dex}] = b.Launches
+	}
+	for _, p := range file.Pairs {
+		addr, err := decodeAddress(p.PairAddress)
+		if err != nil {
+			return nil, fmt.Errorf("parse launch rates %s: pair %q: %v", path, p.PairAddress, err)
+		}
+		r.pairs[addr] = launchKey{hour: p.Hour.Unix(), chain: p.Chain, dex: p.Dex}
+	}
+	return r, nil
+}
+
+func (r *LaunchRates) Observe(event Event) {
+	switch e := event.(type) {
+	case *PairTransitionEvent:
+		if e.To != StateDiscovered || e.Preexisting {
+			return
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if _, ok := r.pairs[e.PairAddress]; ok {
+			return
+		}
+		key := launchKey{hour: e.At.Truncate(time.Hour).Unix(), chain: r.chain, dex: r.dex}
+		r.pairs[e.PairAddress] = key
+		r.buckets[key]++
+		r.dirty = true
+	case *BackfillCompletedEvent:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for _, pair := range e.Pairs {
+			addr, err := decodeAddress(pair.PairAddress)
+			if err != nil {
+				continue
+			}
+			key, ok := r.pairs[addr]
+			if !ok || (key.chain == pair.ChainID && key.dex == pair.DexID) {
+				continue
+			}
+			if r.buckets[key]--; r.buckets[key] <= 0 {
+				delete(r.buckets, key)
+			}
+			key.chain, key.dex = pair.ChainID, pair.DexID
+			r.pairs[addr] = key
+			r.buckets[key]++
+			r.dirty = true
+		}
+	}
+}
+
+// Series returns buckets from since on, oldest first, optionally limited
+// to one chain or dex.
+func (r *LaunchRates) Series(since time.Time, chain, dex string) []LaunchBucket {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	series := []LaunchBucket{}
+	for key, launches := range r.buckets {
+		hour := time.Unix(key.hour, 0).UTC()
+		if hour.Before(since.Truncate(time.Hour)) || (chain != "" && key.chain != chain) || (dex != "" && key.dex != dex) {
+			continue
+		}
+		series = append(series, LaunchBucket{Hour: hour, Chain: key.chain, Dex: key.dex, Launches: launches})
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if !series[i].Hour.Equal(series[j].Hour) {
+			return series[i].Hour.Before(series[j].Hour)
+		}
+		return series[i].Chain+series[i].Dex < series[j].Chain+series[j].Dex
+	})
+	return series
+}
+
+// Save prunes buckets and pairs past retention and writes the series if
+// it changed.
+func (r *LaunchRates) Save(now time.Time) error {
+	r.mu.Lock()
+	cutoff := now.Add(-launchRateRetention).Unix()
+	for key := range r.buckets {
+		if key.hour < cutoff {
+			delete(r.buckets, key)
+			r.dirty = true
+		}
+	}
+	pairCutoff := now.Add(-launchPairRetention).Unix()
+	file := launchRateFile{Pairs: []launchedPair{}}
+	for addr, key := range r.pairs {
+		if key.hour < pairCutoff {
+			delete(r.pairs, addr)
+			r.dirty = true
+			continue
+		}
+		file.Pairs = append(file.Pairs, launchedPair{
+			PairAddress: base58.Encode(addr[:]),
+			Hour:        time.Unix(key.hour, 0).UTC(),
+			Chain:       key.chain,
+			Dex:         key.dex,
+		})
+	}
+	dirty := r.dirty
+	r.dirty = false
+	r.mu.Unlock()
+
+	if r.path == "" || !dirty {
+		return nil
+	}
+	sort.Slice(file.Pairs, func(i, j int) bool { return file.Pairs[i].PairAddress < file.Pairs[j].PairAddress })
+	file.Buckets = r.Series(time.Time{}, "", "")
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.path, data, 0o644)
+}
+
+// HandleLaunchRates serves GET /launch-rates?since=72h&chain=solana&dex=moonshot.
+func (r *LaunchRates) HandleLaunchRates(req *http.Request) (any, error) {
+	since := 24 * time.Hour
+	if s := req.URL.Query().Get("since"); s != "" {
+		var err error
+		if since, err = time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("invalid since: %v", err)
+		}
+	}
+	query := req.URL.Query()
+	return r.Series(time.Now().Add(-since), query.Get("chain"), query.Get("dex")), nil
+}
+
+func registerLaunchRateMetrics(metrics *Metrics, rates *LaunchRates) {
+	label := fmt.Sprintf("{chain=%q,dex=%q}", rates.chain, rates.dex)
+	count := func(since time.Duration) func() float64 {
+		return func() float64 {
+			total := 0
+			for _, b := range rates.Series(time.Now().Add(-since), rates.chain, rates.dex) {
+				total += b.Launches
+			}
+			return float64(total)
+		}
+	}
+	metrics.Gauge("moon_launches_current_hour"+label, "Pairs discovered in the current hour.", count(0))
+	metrics.Gauge("moon_launches_last_24h"+label, "Pairs discovered in the last 24 hourly buckets.", count(23*time.Hour))
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/piotrostr/moon/base58"
+)
+
+type LeaderboardEntry struct {
+	PairAddress  string        `json:"pairAddress"`
+	TokenSymbol  string        `json:"tokenSymbol"`
+	At           time.Time     `json:"at"`
+	Block        uint32        `json:"block,omitempty"`
+	Blocks       uint32        `json:"blocks,omitempty"`
+	Multiple     float64       `json:"multiple,omitempty"`
+	Duration     time.Duration `json:"duration,omitempty"`
+	PeakMcap     float64       `json:"peakMarketCap,omitempty"`
+	Volume       float64       `json:"volume,omitempty"`
+	Drawdown     float64       `json:"drawdown,omitempty"`
+	Holders      int           `json:"holders,omitempty"`
+	HolderGrowth float64       `json:"holderGrowth,omitempty"`
+	// Stale marks a price older than -stale-price.
+	Stale bool     `json:"stale,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+type Leaderboards struct {
+	Window             time.Duration      `json:"window"`
+	TopGainers         []LeaderboardEntry `json:"topGainers"`
+	FastestGraduations []LeaderboardEntry `json:"fastestGraduations"`
+	BiggestRugs        []LeaderboardEntry `json:"biggestRugs"`
+	// VolumeAt5m and MultipleAt15m rank launches at the same age.
+	VolumeAt5m    []LeaderboardEntry `json:"volumeAt5m"`
+	MultipleAt15m []LeaderboardEntry `json:"multipleAt15m"`
+	// HolderGrowth ranks pairs by holders gained per hour at their last
+	// sample, when holder tracking is on.
+	HolderGrowth []LeaderboardEntry `json:"holderGrowth"`
+}
+
+// Leaderboard ranks launches: gainers since launch from the live store,
+// graduations and rugs from lifecycle events, and volume and multiple at
+// a fixed age from age checkpoints, and holder growth from the latest
+// holder sample of each live pair.
+type Leaderboard struct {
+	supply float64
+	store  *PairStore
+	notes  *Notes
+
+	mu          sync.Mutex
+	graduations []LeaderboardEntry
+	rugs        []LeaderboardEntry
+	volumes     []LeaderboardEntry
+	multiples   []LeaderboardEntry
+	holders     map[string]LeaderboardEntry
+}
+
+// events older than this are dropped regardless of the queried window
+const leaderboardRetention = 7 * 24 * time.Hour
+
+// NewLeaderboard tags entries from notes, which may be nil.
+func NewLeaderboard(supply float64, store *PairStore, notes *Notes) *Leaderboard {
+	return &Leaderboard{supply: supply, store: store, notes: notes, holders: make(map[string]LeaderboardEntry)}
+}
+
+func (l *Leaderboard) Observe(event Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch e := event.(type) {
+	case *PairTransitionEvent:
+		if e.To != StateGraduated {
+			return
+		}
+		tracked, ok := l.store.Get(e.PairAddress)
+		if !ok {
+			return
+		}
+		l.graduations = append(l.graduations, LeaderboardEntry{
+			PairAddress: base58.Encode(e.PairAddress[:]),
+			TokenSymbol: e.TokenSymbol,
+			At:          e.At,
+			Block:       e.Block,
+			Blocks:      blocksBetween(tracked.FirstSeenBlock, e.Block),
+			Duration:    e.At.Sub(tracked.FirstSeen),
+		})
+	case *PairDeadEvent:
+		t := e.Tombstone
+		delete(l.holders, t.PairAddress)
+		if !t.Rugged {
+			return
+		}
+		l.rugs = append(l.rugs, LeaderboardEntry{
+			PairAddress: t.PairAddress,
+			TokenSymbol: t.TokenSymbol,
+			At:          t.DiedAt,
+			Block:       t.LastBlock,
+			Blocks:      t.LifeBlocks,
+			Duration:    t.Lifetime,
+			PeakMcap:    t.PeakPrice * l.supply,
+			Drawdown:    t.Drawdown,
+		})
+	case *AgeCheckpointEvent:
+		entry := LeaderboardEntry{
+			PairAddress: base58.Encode(e.PairAddress[:]),
+			TokenSymbol: e.TokenSymbol,
+			At:          e.At,
+			Block:       e.Block,
+			Duration:    e.Age,
+		}
+		switch e.Age {
+		case leaderboardVolumeAge:
+			entry.Volume = e.Volume
+			l.volumes = append(l.volumes, entry)
+		case leaderboardMultipleAge:
+			entry.Multiple = e.Multiple
+			l.multiples = append(l.multiples, entry)
+		}
+	case *HolderSampledEvent:
+		l.holders[e.PairAddress] = LeaderboardEntry{
+			PairAddress:  e.PairAddress,
+			TokenSymbol:  e.TokenSymbol,
+			At:           e.At,
+			Duration:     e.Window,
+			Holders:      e.Holders,
+			HolderGrowth: e.HolderGrowth,
+		}
+	}
+}
+
+func (l *Leaderboard) Compute(window time.Duration, limit int, now time.Time) Leaderboards {
+	cutoff := now.Add(-window)
+	boards := Leaderboards{Window: window}
+
+	l.store.Iterate(func(tracked TrackedPair) bool {
+		if tracked.FirstSeen.Before(cutoff) || tracked.InitialPrice <= 0 {
+			return true
+		}
+		boards.TopGainers = append(boards.TopGainers, LeaderboardEntry{
+			PairAddress: base58.Encode(tracked.PairAddress[:]),
+			TokenSymbol: tracked.TokenSymbol,
+			At:          tracked.FirstSeen,
+			Block:       tracked.FirstSeenBlock,
+			Blocks:      blocksBetween(tracked.FirstSeenBlock, tracked.LastSeenBlock),
+			Multiple:    tracked.Price / tracked.InitialPrice,
+			Duration:    now.Sub(tracked.FirstSeen),
+			Stale:       priceStale(tracked.LastSeen, now),
+		})
+		return true
+	})
+	sort.Slice(boards.TopGainers, func(i, j int) bool {
+		return boards.TopGainers[i].Multiple > boards.TopGainers[j].Multiple
+	})
+
+	l.mu.Lock()
+	retained := now.Add(-leaderboardRetention)
+	l.graduations = dropBefore(l.graduations, retained)
+	l.rugs = dropBefore(l.rugs, retained)
+	l.volumes = dropBefore(l.volumes, retained)
+	l.multiples = dropBefore(l.multiples, retained)
+	boards.FastestGraduations = append(boards.FastestGraduations, since(l.graduations, cutoff)...)
+	boards.BiggestRugs = append(boards.BiggestRugs, since(l.rugs, cutoff)...)
+	boards.VolumeAt5m = append(boards.VolumeAt5m, since(l.volumes, cutoff)...)
+	boards.MultipleAt15m = append(boards.MultipleAt15m, since(l.multiples, cutoff)...)
+	for _, entry := range l.holders {
+		if !entry.At.Before(cutoff) && entry.Duration > 0 {
+			boards.HolderGrowth = append(boards.HolderGrowth, entry)
+		}
+	}
+	l.mu.Unlock()
+
+	sort.Slice(boards.FastestGraduations, func(i, j int) bool {
+		return boards.FastestGraduations[i].Duration < boards.FastestGraduations[j].Duration
+	})
+	sort.Slice(boards.BiggestRugs, func(i, j int) bool {
+		return boards.BiggestRugs[i].PeakMcap > boards.BiggestRugs[j].PeakMcap
+	})
+	sort.Slice(boards.VolumeAt5m, func(i, j int) bool {
+		return boards.VolumeAt5m[i].Volume > boards.VolumeAt5m[j].Volume
+	})
+	sort.Slice(boards.MultipleAt15m, func(i, j int) bool {
+		return boards.MultipleAt15m[i].Multiple > boards.MultipleAt15m[j].Multiple
+	})
+	sort.Slice(boards.HolderGrowth, func(i, j int) bool {
+		return boards.HolderGrowth[i].HolderGrowth > boards.HolderGrowth[j].HolderGrowth
+	})
+
+	boards.TopGainers = boards.TopGainers[:min(limit, len(boards.TopGainers))]
+	boards.FastestGraduations = boards.FastestGraduations[:min(limit, len(boards.FastestGraduations))]
+	boards.BiggestRugs = boards.BiggestRugs[:min(limit, len(boards.BiggestRugs))]
+	boards.VolumeAt5m = boards.VolumeAt5m[:min(limit, len(boards.VolumeAt5m))]
+	boards.MultipleAt15m = boards.MultipleAt15m[:min(limit, len(boards.MultipleAt15m))]
+	boards.HolderGrowth = boards.HolderGrowth[:min(limit, len(boards.HolderGrowth))]
+
+	for _, entries := range [][]LeaderboardEntry{boards.TopGainers, boards.FastestGraduations, boards.BiggestRugs, boards.VolumeAt5m, boards.MultipleAt15m, boards.HolderGrowth} {
+		for i := range entries {
+			if note, ok := l.notes.Get(entries[i].PairAddress); ok {
+				entries[i].Tags = note.Tags
+			}
+			entries[i].PairAddress = displayAddress(entries[i].PairAddress)
+		}
+	}
+	return boards
+}
+
+// HandleTop serves GET /top?window=24h&limit=10.
+func (l *Leaderboard) HandleTop(r *http.Request) (any, error) {
+	window, limit, err := parseTopQuery(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	return l.Compute(window, limit, time.Now()), nil
+}
+
+func parseTopQuery(query url.Values) (time.Duration, int, error) {
+	window := 24 * time.Hour
+	limit := 10
+
+	if v := query.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid window: %v", err)
+		}
+		window = d
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid limit: %q", v)
+		}
+		limit = n
+	}
+
+	return window, limit, nil
+}
+
+func blocksBetween(from, to uint32) uint32 {
+	if from == 0 || to < from {
+		return 0
+	}
+	return to - from
+}
+
+func dropBefore(entries []LeaderboardEntry, cutoff time.Time) []LeaderboardEntry {
+	for len(entries) > 0 && entries[0].At.Before(cutoff) {
+		entries = entries[1:]
+	}
+	return entries
+}
+
+func since(entries []LeaderboardEntry, cutoff time.Time) []LeaderboardEntry {
+	i := sort.Search(len(entries), func(i int) bool { return !entries[i].At.Before(cutoff) })
+	return entries[i:]
+}
+
+func printLeaderboards(boards Leaderboards) {
+	color.Green("Top gainers since launch (%s):", boards.Window)
+	stale := color.New(color.FgHiBlack)
+	for i, e := range boards.TopGainers {
+		if e.Stale {
+			stale.Printf("  %2d. %-10s %8.2fx  age %-10s %s%s (stale)\n", i+1, e.TokenSymbol, e.Multiple, e.Duration.Round(time.Second), e.PairAddress, formatTags(e.Tags))
+			continue
+		}
+		color.Green("  %2d. %-10s %8.2fx  age %-10s %s%s", i+1, e.TokenSymbol, e.Multiple, e.Duration.Round(time.Second), e.PairAddress, formatTags(e.Tags))
+	}
+	color.Cyan("Fastest graduations (%s):", boards.Window)
+	for i, e := range boards.FastestGraduations {
+		color.Cyan("  %2d. %-10s %-10s %s%s", i+1, e.TokenSymbol, e.Duration.Round(time.Second), e.PairAddress, formatTags(e.Tags))
+	}
+	color.Red("Biggest rugs (%s):", boards.Window)
+	for i, e := range boards.BiggestRugs {
+		color.Red("  %2d. %-10s peak mcap %-12s -%.0f%%  %s%s", i+1, e.TokenSymbol, formatUSD(e.PeakMcap), e.Drawdown*100, e.PairAddress, formatTags(e.Tags))
+	}
+	color.Yellow("Volume at %s (%s):", leaderboardVolumeAge, boards.Window)
+	for i, e := range boards.VolumeAt5m {
+		color.Yellow("  %2d. %-10s %-12s %s%s", i+1, e.TokenSymbol, formatUSD(e.Volume), e.PairAddress, formatTags(e.Tags))
+	}
+	color.Yellow("Multiple at %s (%s):", leaderboardMultipleAge, boards.Window)
+	for i, e := range boards.MultipleAt15m {
+		color.Yellow("  %2d. %-10s %8.2fx  %s%s", i+1, e.TokenSymbol, e.Multiple, e.PairAddress, formatTags(e.Tags))
+	}
+	if len(boards.HolderGrowth) > 0 {
+		color.Cyan("Holder growth (%s):", boards.Window)
+		for i, e := range boards.HolderGrowth {
+			color.Cyan("  %2d. %-10s %+8.1f/h  %6d holders  %s%s", i+1, e.TokenSymbol, e.HolderGrowth, e.Holders, e.PairAddress, formatTags(e.Tags))
+		}
+	}
+}
+
+// runTop implements `moon top`, querying the REST API of a running instance.
+func runTop(args []string) error {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:8080", "base URL of a running moon instance")
+	token := tokenFlag(fs)
+	window := fs.Duration("window", 24*time.Hour, "leaderboard window")
+	limit := fs.Int("limit", 10, "entries per leaderboard")
+	fs.Parse(args)
+
+	query := url.Values{}
+	query.Set("window", window.String())
+	query.Set("limit", strconv.Itoa(*limit))
+
+	resp, err := apiRequest(http.MethodGet, *server+"/top?"+query.Encode(), *token, nil)
+	if err != nil {
+		return fmt.Errorf("top request error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("top request failed: %s", resp.Status)
+	}
+
+	var boards Leaderboards
+	if err := json.NewDecoder(resp.Body).Decode(&boards); err != nil {
+		return fmt.Errorf("top decode error: %v", err)
+	}
+
+	printLeaderboards(boards)
+	return nil
+}
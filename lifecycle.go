@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type PairState int
+
+const (
+	StateDiscovered PairState = iota
+	StateBonding
+	StateGraduating
+	StateGraduated
+	StateMigrated
+	StateDead
+)
+
+func (s PairState) String() string {
+	switch s {
+	case StateDiscovered:
+		return "discovered"
+	case StateBonding:
+		return "bonding"
+	case StateGraduating:
+		return "graduating"
+	case StateGraduated:
+		return "graduated"
+	case StateMigrated:
+		return "migrated"
+	case StateDead:
+		return "dead"
+	default:
+		return fmt.Sprintf("PairState(%d)", int(s))
+	}
+}
+
+// canTransition allows moving forward through the lifecycle, dropping back
+// from graduating to bonding when the market cap retreats, and dying from
+// any live state. Dead is terminal.
+func canTransition(from, to PairState) bool {
+	if from == StateDead || from == to {
+		return false
+	}
+	if to > from {
+		return true
+	}
+	return from == StateGraduating && to == StateBonding
+}
+
+type PairTransitionEvent struct {
+	sourced
+	PairAddress [32]byte
+	TokenSymbol string
+	From        PairState
+	To          PairState
+	Reason      string
+	// Preexisting marks a discovery made during a connection's warm-up,
+	// of a pair that was already listed rather than newly launched.
+	Preexisting bool
+	At          time.Time
+	Block       uint32
+}
+
+func (e *PairTransitionEvent) EventName() string { return "pair_" + e.To.String() }
+
+// OnTransition subscribes handler to transitions into the given state.
+func OnTransition(bus *EventBus, to PairState, handler func(*PairTransitionEvent)) {
+	bus.Subscribe(func(event Event) {
+		if e, ok := event.(*PairTransitionEvent); ok && e.To == to {
+			handler(e)
+		}
+	})
+}
+
+type LifecycleConfig struct {
+	// TokenSupply converts price to market cap; moonshot mints a fixed supply.
+	TokenSupply float64
+	// GraduationMarketCap is the market cap at which the bonding curve completes.
+	GraduationMarketCap float64
+	// GraduatingRatio of GraduationMarketCap marks a pair as about to graduate.
+	GraduatingRatio float64
+}
+
+func DefaultLifecycleConfig() LifecycleConfig {
+	return LifecycleConfig{
+		TokenSupply:         1e9,
+		GraduationMarketCap: 400_000,
+		GraduatingRatio:     0.9,
+	}
+}
+
+// LifecycleTracker derives each pair's lifecycle state from stream updates
+// and publishes a PairTransitionEvent on every state change.
+type LifecycleTracker struct {
+	config LifecycleConfig
+	bus    *EventBus
+	clock  *BlockClock
+
+	mu     sync.Mutex
+	states map[[32]byte]PairState
+}
+
+func NewLifecycleTracker(config LifecycleConfig, bus *EventBus, clock *BlockClock) *LifecycleTracker {
+	return &LifecycleTracker{
+		config: config,
+		bus:    bus,
+		clock:  clock,
+		states: make(map[[32]byte]PairState),
+	}
+}
+
+func (t *LifecycleTracker) State(addr [32]byte) (PairState, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.states[addr]
+	return state, ok
+}
+
+// Observe feeds a pair update from source into the state machine.
+func (t *LifecycleTracker) Observe(pair PairData, now time.Time, source string) {
+	t.mu.Lock()
+	current, known := t.states[pair.PairAddress]
+	t.mu.Unlock()
+
+	if !known {
+		t.mu.Lock()
+		t.states[pair.PairAddress] = StateDiscovered
+		t.mu.Unlock()
+		t.publish(pair, StateDiscovered, StateDiscovered, "first seen on stream", now, source)
+		current = StateDiscovered
+	}
+
+	marketCap := pair.Price * t.config.TokenSupply
+	target := StateBonding
+	switch {
+	case marketCap >= t.config.GraduationMarketCap:
+		target = StateGraduated
+	case marketCap >= t.config.GraduationMarketCap*t.config.GraduatingRatio:
+		target = StateGraduating
+	}
+
+	// the first sighting only establishes the pair; bonding starts with the
+	// next update unless the market cap already says otherwise
+	if (!known && target == StateBonding) || !canTransition(current, target) {
+		return
+	}
+
+	t.transition(pair, target, fmt.Sprintf("market cap %.0f", marketCap), now, source)
+}
+
+// Transition moves a pair to state to, for signals that do not come from
+// price updates (e.g. migration detected via REST, dead pair detection).
+func (t *LifecycleTracker) Transition(pair PairData, to PairState, reason string, now time.Time) error {
+	return t.transition(pair, to, reason, now, SourceInternal)
+}
+
+func (t *LifecycleTracker) transition(pair PairData, to PairState, reason string, now time.Time, source string) error {
+	t.mu.Lock()
+	from, ok := t.states[pair.PairAddress]
+	if !ok {
+		t.mu.Unlock()
+		return fmt.Errorf("pair %s is not tracked", formatAddress(pair.PairAddress))
+	}
+	if !canTransition(from, to) {
+		t.mu.Unlock()
+		return fmt.Errorf("invalid transition %s -> %s", from, to)
+	}
+	t.states[pair.PairAddress] = to
+	t.mu.Unlock()
+
+	t.publish(pair, from, to, reason, now, source)
+	return nil
+}
+
+// Forget drops lifecycle state for an evicted pair.
+func (t *LifecycleTracker) Forget(addr [32]byte) {
+	t.mu.Lock()
+	delete(t.states, addr)
+	t.mu.Unlock()
+}
+
+func (t *LifecycleTracker) publish(pair PairData, from, to PairState, reason string, now time.Time, source string) {
+	t.bus.Publish(&PairTransitionEvent{
+		sourced:     sourced{source},
+		PairAddress: pair.PairAddress,
+		TokenSymbol: pair.TokenSymbol,
+		From:        from,
+		To:          to,
+		Reason:      reason,
+		At:          now,
+		Block:       t.clock.BlockAt(now),
+	})
+}
@@ -0,0 +1,87 @@
+//go:build lite
+
+// The lite build (go build -tags lite) leaves out the Telegram bot, OTLP
+// tracing, encrypted keypairs and TLS autocert, and with them
+// golang.org/x/crypto and golang.org/x/term, for small cross-compiled
+// binaries. Paper trading
+// still works; live trading fails at startup because it cannot load a key.
+
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+var errLite = errors.New("not available in the lite build")
+
+type TelegramConfig struct {
+	Token    string  `json:"token"`
+	ChatID   int64   `json:"chatId"`
+	Language string  `json:"language,omitempty"`
+	Traders  []int64 `json:"traders,omitempty"`
+	Outbox   string  `json:"outbox,omitempty"`
+}
+
+func (c TelegramConfig) Validate() error { return fmt.Errorf("telegram: %v", errLite) }
+
+func (c *TelegramConfig) expandSecrets() error { return nil }
+
+type TelegramBot struct{}
+
+func NewTelegramBot(config TelegramConfig, locale NumberLocale, store *PairStore, leaderboard *Leaderboard, trader *Trader, alerts *AlertControl, notes *Notes) (*TelegramBot, error) {
+	return &TelegramBot{}, nil
+}
+
+func (b *TelegramBot) Observe(event Event) {}
+
+func (b *TelegramBot) Run(ctx context.Context) {}
+
+type SpanContext struct{}
+
+type Span struct{}
+
+func (s *Span) SetAttr(key string, value any) {}
+
+func (s *Span) SetError(err error) {}
+
+func (s *Span) End() {}
+
+type Tracer struct{}
+
+func NewTracer(endpoint string, sample float64) *Tracer { return nil }
+
+func (t *Tracer) StartFrame(name string) *Span { return nil }
+
+func (t *Tracer) Start(name string, parent SpanContext) *Span { return nil }
+
+func (t *Tracer) Activate(span *Span) func() { return func() {} }
+
+func (t *Tracer) Active() SpanContext { return SpanContext{} }
+
+func (t *Tracer) ExportMetrics(metrics *Metrics) {}
+
+func (t *Tracer) Run() {}
+
+func (t *Tracer) Close() {}
+
+func registerTracerMetrics(metrics *Metrics, tracer *Tracer) {}
+
+type KeypairConfig struct {
+	Path            string `json:"path"`
+	Passphrase      string `json:"passphrase,omitempty"`
+	KeychainAccount string `json:"keychainAccount,omitempty"`
+}
+
+func LoadKeypair(config KeypairConfig) (ed25519.PrivateKey, error) {
+	return nil, fmt.Errorf("keypair: %v", errLite)
+}
+
+func runKeypair(args []string) error { return fmt.Errorf("moon keypair: %v", errLite) }
+
+func autocertTLS(c *TLSConfig) (*tls.Config, error) {
+	return nil, fmt.Errorf("tls autocert: %v", errLite)
+}
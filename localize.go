@@ -0,0 +1,249 @@
+package main
+
+import (
+	"cmp"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+//go:embed locales/*.json
+var builtinLocales embed.FS
+
+// Catalog is one language's alert templates, read from <language>.json.
+// An alert is rendered with its kind's template from Alerts, falling back
+// to Rule for alerts raised by rules and to Default for the rest. The
+// templates see the alert's fields, the fields of the event it was raised
+// on, and every stored field of its pair.
+type Catalog struct {
+	Numbers NumberLocale      `json:"numbers"`
+	Rule    string            `json:"rule,omitempty"`
+	Default string            `json:"default,omitempty"`
+	Alerts  map[string]string `json:"alerts,omitempty"`
+}
+
+// merge overlays the non-empty parts of other on c.
+func (c *Catalog) merge(other Catalog) {
+	if other.Numbers.Group != "" {
+		c.Numbers.Group = other.Numbers.Group
+	}
+	if other.Numbers.Decimal != "" {
+		c.Numbers.Decimal = other.Numbers.Decimal
+	}
+	if other.Rule != "" {
+		c.Rule = other.Rule
+	}
+	if other.Default != "" {
+		c.Default = other.Default
+	}
+	if c.Alerts == nil {
+		c.Alerts = make(map[string]string)
+	}
+	maps.Copy(c.Alerts, other.Alerts)
+}
+
+// LoadCatalogs reads the built-in en, pl and zh catalogs and then every
+// <language>.json in dir, which adds languages or overrides templates of
+// built-in ones. dir may be empty.
+func LoadCatalogs(dir string) (map[string]Catalog, error) {
+	catalogs := make(map[string]Catalog)
+	builtin, _ := builtinLocales.ReadDir("locales")
+	for _, entry := range builtin {
+		data, err := builtinLocales.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if err := addCatalog(catalogs, entry.Name(), data); err != nil {
+			return nil, err
+		}
+	}
+	if dir == "" {
+		return catalogs, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no <language>.json files in %s", dir)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read locale: %v", err)
+		}
+		if err := addCatalog(catalogs, path, data); err != nil {
+			return nil, err
+		}
+	}
+	return catalogs, nil
+}
+
+func addCatalog(catalogs map[string]Catalog, path string, data []byte) error {
+	var catalog Catalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return fmt.Errorf("parse locale %s: %v", path, err)
+	}
+	language := strings.TrimSuffix(filepath.Base(path), ".json")
+	merged, ok := catalogs[language]
+	if !ok {
+		merged.Numbers = numberLocales["en"]
+	}
+	merged.merge(catalog)
+	catalogs[language] = merged
+	return nil
+}
+
+// localeTemplates is a catalog with its templates parsed.
+type localeTemplates struct {
+	rule, fallback *template.Template
+	alerts         map[string]*template.Template
+}
+
+func parseCatalog(language string, catalog Catalog) (*localeTemplates, error) {
+	funcs := templateFuncs(catalog.Numbers)
+	parse := func(name, text string) (*template.Template, error) {
+		if text == "" {
+			return nil, nil
+		}
+		tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("locale %s: %v", language, err)
+		}
+		return tmpl, nil
+	}
+
+	parsed := &localeTemplates{alerts: make(map[string]*template.Template)}
+	var err error
+	if parsed.rule, err = parse("rule", catalog.Rule); err != nil {
+		return nil, err
+	}
+	if parsed.fallback, err = parse("default", catalog.Default); err != nil {
+		return nil, err
+	}
+	for kind, text := range catalog.Alerts {
+		if parsed.alerts[kind], err = parse(kind, text); err != nil {
+			return nil, err
+		}
+	}
+	return parsed, nil
+}
+
+// Localizer renders every alert in each language sinks and the Telegram
+// bot ask for, and with each sink's own template, before they see it.
+type Localizer struct {
+	languages map[string]*localeTemplates
+	store     *PairStore
+}
+
+// Localizer loads the catalogs for the languages the config uses; it is
+// nil when none is set. store may be nil.
+func (c *Config) Localizer(store *PairStore) (*Localizer, error) {
+	var languages []string
+	templated := false
+	for _, sink := range c.Sinks {
+		if sink.Language != "" {
+			languages = append(languages, sink.Language)
+		}
+		templated = templated || sink.Template != ""
+	}
+	if c.Telegram != nil && c.Telegram.Language != "" {
+		languages = append(languages, c.Telegram.Language)
+	}
+	if len(languages) == 0 && !templated {
+		return nil, nil
+	}
+
+	catalogs, err := LoadCatalogs(c.Locales)
+	if err != nil {
+		return nil, err
+	}
+	l := &Localizer{languages: make(map[string]*localeTemplates), store: store}
+	for _, language := range languages {
+		catalog, ok := catalogs[language]
+		if !ok {
+			var known []string
+			for name := range catalogs {
+				known = append(known, name)
+			}
+			slices.Sort(known)
+			return nil, fmt.Errorf("unknown language %q, have %s", language, strings.Join(known, ", "))
+		}
+		if l.languages[language], err = parseCatalog(language, catalog); err != nil {
+			return nil, err
+		}
+	}
+	for _, sink := range c.Sinks {
+		if sink.Template == "" {
+			continue
+		}
+		catalog := catalogs[cmp.Or(sink.Language, "en")]
+		tmpl, err := template.New(sink.sinkName()).Funcs(templateFuncs(catalog.Numbers)).Parse(sink.Template)
+		if err != nil {
+			return nil, fmt.Errorf("sink %s template: %v", sink.sinkName(), err)
+		}
+		l.languages[sink.templateKey()] = &localeTemplates{rule: tmpl, fallback: tmpl, alerts: map[string]*template.Template{}}
+	}
+	return l, nil
+}
+
+// templateKey is where alert messages rendered with the sink's template
+// are kept in AlertEvent.Messages, next to the languages.
+func (c SinkConfig) templateKey() string {
+	return "sink:" + c.sinkName()
+}
+
+// Filter is an EventBus filter filling in AlertEvent.Messages. It should
+// run after the notes filter, so templates see tags and notes.
+func (l *Localizer) Filter(event Event) bool {
+	alert, ok := event.(*AlertEvent)
+	if !ok {
+		return true
+	}
+
+	vars := Record{}
+	if addr, err := decodeAddress(alert.PairAddress); err == nil && l.store != nil {
+		if tracked, ok := l.store.Get(addr); ok {
+			flatten(vars, reflect.ValueOf(tracked))
+		}
+	}
+	maps.Copy(vars, alert.Fields)
+	flatten(vars, reflect.ValueOf(alert))
+
+	alert.Messages = make(map[string]string, len(l.languages))
+	for language, templates := range l.languages {
+		tmpl := templates.alerts[alert.Kind]
+		if tmpl == nil && alert.Fields != nil {
+			tmpl = templates.rule
+		}
+		if tmpl == nil {
+			tmpl = templates.fallback
+		}
+		if tmpl == nil {
+			continue
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, vars); err != nil {
+			// the unlocalized message is better than a broken one
+			continue
+		}
+		alert.Messages[language] = b.String()
+	}
+	return true
+}
+
+// localizedMessage is alert's message in language, or its own message.
+func localizedMessage(alert *AlertEvent, language string) string {
+	if message, ok := alert.Messages[language]; ok && language != "" {
+		return message
+	}
+	return alert.Message
+}
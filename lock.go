@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrLocked is returned when another instance holds the lock.
+var ErrLocked = errors.New("another moon instance is running")
+
+// lockInfo is written into the lock file for the error message a second
+// instance prints.
+type lockInfo struct {
+	PID      int       `json:"pid"`
+	Instance string    `json:"instance,omitempty"`
+	Started  time.Time `json:"started"`
+}
+
+// InstanceLock is an advisory lock held for the life of the process. On
+// unix the OS releases it if moon crashes; elsewhere it is a file created
+// exclusively, taken over once the process that wrote it has exited.
+type InstanceLock struct {
+	path string
+	file *os.File
+}
+
+// AcquireLock takes the lock for instance in dir, the directory holding the
+// instance's state files (see stateDir).
+func AcquireLock(dir, instance string) (*InstanceLock, error) {
+	name := "moon.lock"
+	if instance != "" {
+		name = "moon-" + instance + ".lock"
+	}
+	path := filepath.Join(dir, name)
+
+	file, held, err := lockFile(path)
+	if err != nil && !held {
+		return nil, fmt.Errorf("open lock: %v", err)
+	}
+	if err != nil {
+		var holder lockInfo
+		if data, readErr := os.ReadFile(path); readErr == nil && json.Unmarshal(data, &holder) == nil && holder.PID != 0 {
+			return nil, fmt.Errorf("%w (pid %d, started %s, lock %s); stop it or run this one with a different -instance",
+				ErrLocked, holder.PID, holder.Started.Format(time.RFC3339), path)
+		}
+		return nil, fmt.Errorf("%w (lock %s): %v", ErrLocked, path, err)
+	}
+
+	data, _ := json.Marshal(lockInfo{PID: os.Getpid(), Instance: instance, Started: time.Now()})
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt(data, 0)
+	}
+	return &InstanceLock{path: path, file: file}, nil
+}
+
+func (l *InstanceLock) Release() error {
+	return unlockFile(l.file, l.path)
+}
+
+// stateDir is the directory of the schema version file, which sits with
+// the rest of an instance's state; the lock is kept beside it.
+func stateDir(versionPath string) string {
+	return filepath.Dir(versionPath)
+}
+
+// instanceFiles puts the default paths of state files in dir, beside the
+// schema version file, and suffixes them with the instance name, so
+// instances partitioned by stream config (-chains, -dexes, filters) do not
+// share state. Paths set explicitly are kept.
+func instanceFiles(fs *flag.FlagSet, dir, instance string, names ...string) {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil || set[name] || f.Value.String() == "" {
+			continue
+		}
+		path := f.Value.String()
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if instance != "" {
+			ext := filepath.Ext(path)
+			path = strings.TrimSuffix(path, ext) + "-" + instance + ext
+		}
+		f.Value.Set(path)
+	}
+}
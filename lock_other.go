@@ -0,0 +1,56 @@
+//go:build !unix
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// lockFile creates path exclusively where flock is unavailable. A lock
+// file left by a process that is no longer running is taken over; held
+// reports that its holder is alive or unknown.
+func lockFile(path string) (file *os.File, held bool, err error) {
+	for attempt := 0; ; attempt++ {
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o644)
+		if err == nil {
+			return file, false, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, false, err
+		}
+		var holder lockInfo
+		data, readErr := os.ReadFile(path)
+		if attempt > 0 || readErr != nil || json.Unmarshal(data, &holder) != nil ||
+			holder.PID == 0 || processAlive(holder.PID) {
+			return nil, true, err
+		}
+		os.Remove(path)
+	}
+}
+
+// unlockFile removes the file, since its existence is the lock.
+func unlockFile(file *os.File, path string) error {
+	err := file.Close()
+	if removeErr := os.Remove(path); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// processAlive reports whether pid may still be running. FindProcess fails
+// for a missing process on Windows and always succeeds elsewhere, so a
+// lock left by a crash there has to be removed by hand.
+func processAlive(pid int) bool {
+	if pid == os.Getpid() {
+		return true
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile opens path and flocks it; held reports that another process
+// has the lock.
+func lockFile(path string) (file *os.File, held bool, err error) {
+	file, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		return nil, true, err
+	}
+	return file, false, nil
+}
+
+// unlockFile leaves the file in place; removing it would race with an
+// instance locking it.
+func unlockFile(file *os.File, path string) error {
+	file.Truncate(0)
+	return file.Close()
+}
@@ -2,44 +2,52 @@
 package main
 
 import (
+	"os"
+
 	"github.com/fatih/color"
 )
 
-func main() {
-	messageChan := make(chan []byte)
-	errorChan := make(chan error)
-
-	go connectWebSocket(messageChan, errorChan)
-
-	for {
-		select {
-		case message := <-messageChan:
-			if err := handleMessage(message); err != nil {
-				color.Red("Error handling message: %v", err)
-			}
-		case err := <-errorChan:
-			color.Red("WebSocket error: %v", err)
-			return
-		}
-	}
+// commands are subcommands dispatched on the first argument; anything else
+// runs the stream.
+var commands = map[string]func(args []string) error{
+	"top":       runTop,
+	"query":     runQuery,
+	"keypair":   runKeypair,
+	"trade":     runTrade,
+	"journal":   runJournal,
+	"report":    runReport,
+	"backtest":  runBacktest,
+	"optimize":  runOptimize,
+	"diff":      runDiff,
+	"unknown":   runUnknown,
+	"mock":      runMock,
+	"e2e":       runE2E,
+	"prune":     runPrune,
+	"import":    runImport,
+	"validate":  runValidate,
+	"schema":    runSchema,
+	"alert":     runAlert,
+	"watch":     runWatch,
+	"compare":   runCompare,
+	"reprocess": runReprocess,
+	"ctl":       runCtl,
+	"tag":       runTag,
+	"migrate":   runMigrate,
 }
 
-func handleMessage(message []byte) error {
-	parsedMessage, err := parseMessage(message)
-	if err != nil {
-		return err
+func main() {
+	color.Output = redactingWriter{color.Output}
+	color.Error = redactingWriter{color.Error}
+	args := stripNoColor(os.Args[1:])
+	run := runStream
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			run, args = cmd, args[1:]
+		}
 	}
 
-	switch msg := parsedMessage.(type) {
-	case *LatestBlockHashMessage:
-		printLatestBlockHashMessage(msg)
-	case *PairsMessage:
-		printPairsMessage(msg)
-	case *PingMessage:
-		printPingMessage(msg)
-	default:
-		color.Red("Received unknown message type: %T", msg)
+	if err := run(args); err != nil {
+		color.Red("%v", err)
+		os.Exit(1)
 	}
-
-	return nil
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type gauge struct {
+	help  string
+	kind  string
+	value func() float64
+}
+
+// Metrics exposes gauges and counters in the Prometheus text exposition format.
+type Metrics struct {
+	mu     sync.Mutex
+	gauges map[string]gauge
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{gauges: make(map[string]gauge)}
+}
+
+func (m *Metrics) Gauge(name, help string, value func() float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[name] = gauge{help: help, kind: "gauge", value: value}
+}
+
+// Counter registers a monotonically increasing series; value must never go
+// down, or scrapers see a reset.
+func (m *Metrics) Counter(name, help string, value func() float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[name] = gauge{help: help, kind: "counter", value: value}
+}
+
+type series struct {
+	name, base, labels string
+	gauge
+}
+
+// snapshot returns every registered series sorted by metric and then by
+// labels, so series of one metric come out together.
+func (m *Metrics) snapshot() []series {
+	m.mu.Lock()
+	all := make([]series, 0, len(m.gauges))
+	for name, g := range m.gauges {
+		base, labels, _ := strings.Cut(name, "{")
+		all = append(all, series{name: name, base: base, labels: strings.TrimSuffix(labels, "}"), gauge: g})
+	}
+	m.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].base != all[j].base {
+			return all[i].base < all[j].base
+		}
+		return all[i].name < all[j].name
+	})
+	return all
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// names may carry labels, e.g. foo{sink="x"}; series of one metric share
+	// a single HELP and TYPE header
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	previous := ""
+	for _, s := range m.snapshot() {
+		if s.base != previous {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", s.base, s.help, s.base, s.kind)
+			previous = s.base
+		}
+		fmt.Fprintf(w, "%s %g\n", s.name, s.value())
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// StateFiles are the files moon keeps between runs; empty paths are not
+// kept. Snapshots is a directory of append-only data, which is not backed
+// up: a migration changing it must leave the old files in place.
+type StateFiles struct {
+	Tombstones  string
+	LaunchRates string
+	AlertState  string
+	Notes       string
+	Snapshots   string
+}
+
+func (s StateFiles) existing() []string {
+	var paths []string
+	for _, path := range []string{s.Tombstones, s.LaunchRates, s.AlertState, s.Notes, s.Snapshots} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Migration upgrades the state files from Version-1 to Version.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(files StateFiles) error
+}
+
+// migrations are applied in order. A change to the format of a state
+// file appends one; released migrations are never edited.
+var migrations = []Migration{
+	{Version: 1, Description: "record the schema version of existing state"},
+	{Version: 2, Description: "remember which pairs the launch rates counted", Up: launchRatesV2},
+}
+
+// launchRatesV2 wraps the launch rate buckets in an object beside the
+// counted pairs, which schema 1 did not keep.
+func launchRatesV2(files StateFiles) error {
+	if files.LaunchRates == "" {
+		return nil
+	}
+	data, err := os.ReadFile(files.LaunchRates)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	file := launchRateFile{Pairs: []launchedPair{}}
+	if err := json.Unmarshal(data, &file.Buckets); err != nil {
+		return fmt.Errorf("parse %s: %v", files.LaunchRates, err)
+	}
+	if data, err = json.Marshal(file); err != nil {
+		return err
+	}
+	return writeFileAtomic(files.LaunchRates, data, 0o644)
+}
+
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+type schemaVersion struct {
+	Version    int       `json:"version"`
+	MigratedAt time.Time `json:"migratedAt"`
+}
+
+// Migrator upgrades the state files to the schema this build writes,
+// backing them up first. The version is kept next to them in VersionPath;
+// state from before versioning is schema 0.
+type Migrator struct {
+	Files       StateFiles
+	VersionPath string
+	// BackupDir receives a copy of the state before migrating, empty to
+	// skip the backup. Only migrations that change files are backed up
+	// for, and only the last KeepBackups backups are kept, 3 by default.
+	BackupDir   string
+	KeepBackups int
+}
+
+// Version returns the schema of the state on disk. Without a version file
+// it is 0 if there is state and the latest if there is none.
+func (m *Migrator) Version() (int, error) {
+	data, err := os.ReadFile(m.VersionPath)
+	if errors.Is(err, os.ErrNotExist) {
+		if len(m.Files.existing()) > 0 {
+			return 0, nil
+		}
+		return latestSchemaVersion(), nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read schema version: %v", err)
+	}
+	var version schemaVersion
+	if err := json.Unmarshal(data, &version); err != nil {
+		return 0, fmt.Errorf("decode schema version %s: %v", m.VersionPath, err)
+	}
+	if version.Version > latestSchemaVersion() {
+		return 0, fmt.Errorf("state in %s is schema %d but this moon only knows up to %d; upgrade moon or restore a backup",
+			m.VersionPath, version.Version, latestSchemaVersion())
+	}
+	return version.Version, nil
+}
+
+// Pending returns the migrations the state still needs.
+func (m *Migrator) Pending() (int, []Migration, error) {
+	current, err := m.Version()
+	if err != nil {
+		return 0, nil, err
+	}
+	var pending []Migration
+	for _, migration := range migrations {
+		if migration.Version > current {
+			pending = append(pending, migration)
+		}
+	}
+	return current, pending, nil
+}
+
+// Migrate applies the pending migrations, recording the version after each
+// so a failed run resumes where it stopped. It returns the backup
+// directory, empty if nothing was backed up.
+func (m *Migrator) Migrate(now time.Time) ([]Migration, string, error) {
+	current, pending, err := m.Pending()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(pending) == 0 {
+		if _, err := os.Stat(m.VersionPath); errors.Is(err, os.ErrNotExist) {
+			return nil, "", m.setVersion(current, now)
+		}
+		return nil, "", nil
+	}
+
+	changes := false
+	for _, migration := range pending {
+		changes = changes || migration.Up != nil
+	}
+	var backup string
+	if m.BackupDir != "" && changes {
+		backup = filepath.Join(m.BackupDir, fmt.Sprintf("schema-%d-%s", current, now.UTC().Format("20060102T150405Z")))
+		if err := m.backup(backup); err != nil {
+			return nil, "", fmt.Errorf("back up state: %v", err)
+		}
+		if err := m.pruneBackups(); err != nil {
+			color.Red("Error pruning state backups: %v", err)
+		}
+	}
+
+	for i, migration := range pending {
+		if migration.Up != nil {
+			if err := migration.Up(m.Files); err != nil {
+				err = fmt.Errorf("migration %d (%s): %v", migration.Version, migration.Description, err)
+				if backup != "" {
+					err = fmt.Errorf("%v; the state before migrating is in %s", err, backup)
+				}
+				return pending[:i], backup, err
+			}
+		}
+		if err := m.setVersion(migration.Version, now); err != nil {
+			return pending[:i], backup, err
+		}
+	}
+	return pending, backup, nil
+}
+
+func (m *Migrator) setVersion(version int, now time.Time) error {
+	data, err := json.MarshalIndent(schemaVersion{Version: version, MigratedAt: now}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(m.VersionPath, data, 0o644); err != nil {
+		return fmt.Errorf("write schema version: %v", err)
+	}
+	return nil
+}
+
+func (m *Migrator) backup(dir string) error {
+	paths := m.Files.existing()
+	if _, err := os.Stat(m.VersionPath); err == nil {
+		paths = append(paths, m.VersionPath)
+	}
+	for _, path := range paths {
+		if path == m.Files.Snapshots {
+			continue
+		}
+		if err := copyPath(path, filepath.Join(dir, filepath.Base(path))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneBackups removes all but the newest KeepBackups backups.
+func (m *Migrator) pruneBackups() error {
+	keep := m.KeepBackups
+	if keep <= 0 {
+		keep = 3
+	}
+	entries, err := os.ReadDir(m.BackupDir)
+	if err != nil {
+		return err
+	}
+	// named schema-<version>-<time>, so newest by the time suffix
+	var backups []string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), "schema-") {
+			backups = append(backups, entry.Name())
+		}
+	}
+	suffix := func(name string) string { return name[strings.LastIndex(name, "-")+1:] }
+	sort.Slice(backups, func(i, j int) bool { return suffix(backups[i]) < suffix(backups[j]) })
+	for _, name := range backups[:max(len(backups)-keep, 0)] {
+		if err := os.RemoveAll(filepath.Join(m.BackupDir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyPath copies a file, or a directory recursively.
+func copyPath(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
+
+// migrateState migrates on startup, printing what was done.
+func migrateState(migrator *Migrator) error {
+	applied, backup, err := migrator.Migrate(time.Now())
+	if err != nil {
+		return err
+	}
+	if len(applied) > 0 {
+		color.Yellow("Migrated state to schema %d", applied[len(applied)-1].Version)
+		if backup != "" {
+			color.Yellow("Previous state backed up to %s", backup)
+		}
+	}
+	return nil
+}
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	var files StateFiles
+	fs.StringVar(&files.Tombstones, "tombstones", "tombstones.jsonl", "tombstone file")
+	fs.StringVar(&files.LaunchRates, "launch-rates", "launch-rates.json", "launch rate file")
+	fs.StringVar(&files.AlertState, "alert-state", "alerts.json", "alert state file")
+	fs.StringVar(&files.Notes, "notes", "notes.json", "notes file")
+	fs.StringVar(&files.Snapshots, "snapshots", "snapshots", "snapshot directory")
+	versionPath := fs.String("schema-version", "schema-version.json", "file recording the schema version of the state; state files left at their default paths are kept beside it")
+	backupDir := fs.String("backups", "backups", "directory the state is copied to before migrating (empty to skip)")
+	keepBackups := fs.Int("keep-backups", 3, "state backups to keep")
+	instance := fs.String("instance", "", "instance whose state to migrate")
+	status := fs.Bool("status", false, "only print the schema version and pending migrations")
+	fs.Parse(args)
+	instanceFiles(fs, stateDir(*versionPath), *instance, "tombstones", "launch-rates", "alert-state", "notes", "snapshots", "schema-version")
+
+	migrator := &Migrator{Files: files, VersionPath: *versionPath, BackupDir: *backupDir, KeepBackups: *keepBackups}
+	current, pending, err := migrator.Pending()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "Schema %d, latest %d\n", current, latestSchemaVersion())
+	for _, migration := range pending {
+		fmt.Fprintf(console, "  pending %d: %s\n", migration.Version, migration.Description)
+	}
+	if *status || len(pending) == 0 {
+		return nil
+	}
+
+	lock, err := AcquireLock(stateDir(*versionPath), *instance)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	applied, backup, err := migrator.Migrate(time.Now())
+	for _, migration := range applied {
+		fmt.Fprintf(console, "Applied %d: %s\n", migration.Version, migration.Description)
+	}
+	if err != nil {
+		return err
+	}
+	if backup != "" {
+		fmt.Fprintf(console, "Backup in %s\n", backup)
+	}
+	color.Green("State is at schema %d", latestSchemaVersion())
+	return nil
+}
@@ -0,0 +1,6 @@
+// Package mockfeed serves recorded frames over a websocket the way the
+// dexscreener pairs feed does, so a Stream can be pointed at it with
+// Subscription.Endpoint. It can drop the connection and corrupt frames on
+// a schedule to exercise reconnects and parse error handling, and put a
+// Cloudflare-style challenge in front of the handshake.
+package mockfeed
@@ -0,0 +1,202 @@
+package mockfeed
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/piotrostr/moon/protocol"
+)
+
+// Config controls how fixtures are served. Zero values disable each fault.
+type Config struct {
+	// Interval is the pause between frames.
+	Interval time.Duration
+	// DisconnectEvery drops the connection, without a close frame, after
+	// this many frames on it.
+	DisconnectEvery int
+	// MalformedEvery truncates every Nth frame served.
+	MalformedEvery int
+	// Loop starts over from the first frame once all have been served.
+	Loop bool
+	// Challenge answers handshakes without a cf_clearance=mock cookie with
+	// a Cloudflare-style challenge page.
+	Challenge bool
+}
+
+// Stats counts what the server has done so far.
+type Stats struct {
+	Connections int
+	Served      int
+	Malformed   int
+	Disconnects int
+}
+
+// Server serves the same frame sequence to every client; the position is
+// shared, so a client that reconnects resumes where it was dropped.
+type Server struct {
+	frames [][]byte
+	config Config
+
+	mu     sync.Mutex
+	next   int
+	stats  Stats
+	done   chan struct{}
+	closed bool
+	http   *httptest.Server
+}
+
+func NewServer(frames [][]byte, config Config) *Server {
+	return &Server{frames: frames, config: config, done: make(chan struct{})}
+}
+
+// LoadFrames reads a length-prefixed recording, as written by moon -record.
+func LoadFrames(path string) ([][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var frames [][]byte
+	decoder := protocol.NewDecoder(file)
+	for {
+		_, err := decoder.Next()
+		frame := decoder.Frame()
+		if frame == nil {
+			if errors.Is(err, io.EOF) {
+				return frames, nil
+			}
+			return nil, err
+		}
+		frames = append(frames, frame)
+	}
+}
+
+// Start listens on a local port until Close.
+func (s *Server) Start() {
+	s.http = httptest.NewServer(s)
+}
+
+// URL is the websocket endpoint of a started server.
+func (s *Server) URL() string {
+	return "ws" + strings.TrimPrefix(s.http.URL, "http")
+}
+
+func (s *Server) Close() {
+	if s.http != nil {
+		s.http.CloseClientConnections()
+		s.http.Close()
+	}
+}
+
+// Done is closed once every frame has been served, unless Loop is set.
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// compression is used only when the client offers it, as with the real feed
+var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }, EnableCompression: true}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.config.Challenge {
+		if cookie, err := r.Cookie("cf_clearance"); err != nil || cookie.Value != "mock" {
+			w.Header().Set("Server", "cloudflare")
+			w.Header().Set("Cf-Ray", "mock-ray")
+			w.Header().Set("Cf-Mitigated", "challenge")
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "<html><title>Just a moment...</title><script src=\"/cdn-cgi/challenge-platform/\"></script></html>")
+			return
+		}
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	s.mu.Lock()
+	s.stats.Connections++
+	s.mu.Unlock()
+
+	sent := 0
+	for {
+		if s.config.DisconnectEvery > 0 && sent == s.config.DisconnectEvery && s.disconnect() {
+			return
+		}
+		frame, ok := s.take()
+		if !ok {
+			// keep the connection open like an idle feed until the client leaves
+			conn.ReadMessage()
+			return
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+			return
+		}
+		sent++
+		if s.config.Interval > 0 {
+			time.Sleep(s.config.Interval)
+		}
+	}
+}
+
+// disconnect reports whether to drop a connection, which is pointless
+// once the recording is exhausted.
+func (s *Server) disconnect() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next == len(s.frames) && !s.config.Loop {
+		return false
+	}
+	s.stats.Disconnects++
+	return true
+}
+
+// take returns the next frame to serve, corrupting it when due.
+func (s *Server) take() ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next == len(s.frames) {
+		if !s.config.Loop || len(s.frames) == 0 {
+			if !s.closed {
+				s.closed = true
+				close(s.done)
+			}
+			return nil, false
+		}
+		s.next = 0
+	}
+	frame := s.frames[s.next]
+	s.next++
+	s.stats.Served++
+
+	if s.config.MalformedEvery > 0 && s.stats.Served%s.config.MalformedEvery == 0 {
+		s.stats.Malformed++
+		return Malform(frame), true
+	}
+	return frame, true
+}
+
+// Malform truncates frame so that it no longer parses. Frames too short
+// to break that way, like pings, become an unknown message type.
+func Malform(frame []byte) []byte {
+	truncated := frame[:len(frame)/2]
+	if _, err := protocol.Parse(truncated); err == nil {
+		return []byte{0xff}
+	}
+	return truncated
+}
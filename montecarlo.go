@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math/rand/v2"
+	"sort"
+
+	"github.com/fatih/color"
+)
+
+// MonteCarloConfig resamples backtest trade returns into simulated
+// sequences. Each trade stakes StakePercent of the current bankroll; a
+// path is ruined once the bankroll falls to RuinPercent of its start.
+type MonteCarloConfig struct {
+	Simulations  int
+	Trades       int
+	StakePercent float64
+	RuinPercent  float64
+	Seed         uint64
+}
+
+// MonteCarloResult holds bankroll multiples and drawdown fractions at the
+// 5th, 50th and 95th percentiles over all paths.
+type MonteCarloResult struct {
+	Config       MonteCarloConfig
+	Survival     float64
+	FinalP5      float64
+	FinalP50     float64
+	FinalP95     float64
+	DrawdownP50  float64
+	DrawdownP95  float64
+	ProfitChance float64
+}
+
+func MonteCarlo(returns []float64, config MonteCarloConfig) MonteCarloResult {
+	result := MonteCarloResult{Config: config}
+	if len(returns) == 0 || config.Simulations <= 0 {
+		return result
+	}
+	trades := config.Trades
+	if trades <= 0 {
+		trades = len(returns)
+	}
+	stake := config.StakePercent / 100
+	ruin := config.RuinPercent / 100
+
+	rng := rand.New(rand.NewPCG(config.Seed, config.Seed^0x9e3779b97f4a7c15))
+	finals := make([]float64, config.Simulations)
+	drawdowns := make([]float64, config.Simulations)
+	var survived, profitable int
+	for i := range finals {
+		bankroll, peak, drawdown := 1.0, 1.0, 0.0
+		ruined := false
+		for range trades {
+			bankroll += bankroll * stake * returns[rng.IntN(len(returns))]
+			peak = max(peak, bankroll)
+			drawdown = max(drawdown, 1-bankroll/peak)
+			if bankroll <= ruin {
+				ruined = true
+				break
+			}
+		}
+		finals[i], drawdowns[i] = bankroll, drawdown
+		if !ruined {
+			survived++
+		}
+		if bankroll > 1 {
+			profitable++
+		}
+	}
+
+	sort.Float64s(finals)
+	sort.Float64s(drawdowns)
+	n := float64(config.Simulations)
+	result.Survival = float64(survived) / n
+	result.ProfitChance = float64(profitable) / n
+	result.FinalP5 = percentile(finals, 5)
+	result.FinalP50 = percentile(finals, 50)
+	result.FinalP95 = percentile(finals, 95)
+	result.DrawdownP50 = percentile(drawdowns, 50)
+	result.DrawdownP95 = percentile(drawdowns, 95)
+	return result
+}
+
+// percentile reads p from already sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*p/100)]
+}
+
+func tradeReturns(trades []BacktestTrade) []float64 {
+	returns := make([]float64, len(trades))
+	for i, trade := range trades {
+		returns[i] = trade.Return
+	}
+	return returns
+}
+
+func printMonteCarlo(r MonteCarloResult) {
+	c := r.Config
+	color.Blue("Monte Carlo (%d paths of %d trades, %.1f%% stake, ruin at %.0f%%):",
+		c.Simulations, c.Trades, c.StakePercent, c.RuinPercent)
+	printRow := color.Green
+	if r.Survival < 0.95 {
+		printRow = color.Red
+	}
+	printRow("  survival %.1f%%, profitable %.1f%%", r.Survival*100, r.ProfitChance*100)
+	color.White("  final bankroll p5 %.2fx  p50 %.2fx  p95 %.2fx", r.FinalP5, r.FinalP50, r.FinalP95)
+	color.White("  max drawdown p50 %.1f%%  p95 %.1f%%", r.DrawdownP50*100, r.DrawdownP95*100)
+}
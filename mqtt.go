@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const mqttDefaultTopic = "moon/{event}"
+
+// mqttPlaceholder matches {field} in a topic template.
+var mqttPlaceholder = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// MQTTSink publishes each payload to an MQTT 3.1.1 broker, on a topic
+// filled in from the record, e.g. moon/{event}/{pairAddress}. Fields that
+// are missing become "_", and characters MQTT reserves in topics are
+// replaced. The URL is mqtt:// or mqtts://, with credentials in its user
+// info and an optional clientId query parameter, which defaults to one
+// unique to the sink and process.
+type MQTTSink struct {
+	url      *url.URL
+	topic    string
+	qos      byte
+	retain   bool
+	clientID string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID uint16
+}
+
+func NewMQTTSink(config SinkConfig) (*MQTTSink, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mqtt url: %v", err)
+	}
+	clientID := u.Query().Get("clientId")
+	if clientID == "" {
+		clientID = fmt.Sprintf("moon-%s-%d", config.Name, os.Getpid())
+	}
+	topic := config.Topic
+	if topic == "" {
+		topic = mqttDefaultTopic
+	}
+	return &MQTTSink{url: u, topic: topic, qos: byte(config.QoS), retain: config.Retain, clientID: clientID}, nil
+}
+
+func (s *MQTTSink) Deliver(ctx context.Context, payload []byte, contentType, key string) error {
+	topic, err := s.topicFor(payload)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.publish(ctx, topic, payload); err != nil {
+		s.close()
+		return err
+	}
+	return nil
+}
+
+func (s *MQTTSink) topicFor(payload []byte) (string, error) {
+	if !strings.Contains(s.topic, "{") {
+		return s.topic, nil
+	}
+	var envelope map[string]any
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return "", fmt.Errorf("mqtt topic placeholders need json payloads: %v", err)
+	}
+	record := envelopePayload(envelope)
+	return mqttPlaceholder.ReplaceAllStringFunc(s.topic, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		value, ok := record[name]
+		if !ok && name != "payload" {
+			// envelope fields such as {chain} and {source}
+			value, ok = envelope[name]
+		}
+		if !ok || value == nil || value == "" {
+			return "_"
+		}
+		return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(fmt.Sprint(value))
+	}), nil
+}
+
+func (s *MQTTSink) publish(ctx context.Context, topic string, payload []byte) error {
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetDeadline(deadline)
+	} else {
+		s.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	}
+
+	var body bytes.Buffer
+	writeMQTTString(&body, topic)
+	var id uint16
+	if s.qos > 0 {
+		s.nextID++
+		if s.nextID == 0 {
+			s.nextID = 1
+		}
+		id = s.nextID
+		binary.Write(&body, binary.BigEndian, id)
+	}
+	body.Write(payload)
+	header := byte(0x30) | s.qos<<1
+	if s.retain {
+		header |= 1
+	}
+	if err := s.write(header, body.Bytes()); err != nil {
+		return err
+	}
+
+	switch s.qos {
+	case 1:
+		return s.expect(0x40, id)
+	case 2:
+		if err := s.expect(0x50, id); err != nil {
+			return err
+		}
+		if err := s.write(0x62, binary.BigEndian.AppendUint16(nil, id)); err != nil {
+			return err
+		}
+		return s.expect(0x70, id)
+	}
+	return nil
+}
+
+func (s *MQTTSink) connect(ctx context.Context) error {
+	addr := s.url.Host
+	if s.url.Port() == "" {
+		port := "1883"
+		if s.url.Scheme == "mqtts" {
+			port = "8883"
+		}
+		addr = net.JoinHostPort(s.url.Hostname(), port)
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if s.url.Scheme == "mqtts" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: s.url.Hostname()}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("mqtt dial: %v", err)
+	}
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	var body bytes.Buffer
+	writeMQTTString(&body, "MQTT")
+	body.WriteByte(4) // protocol level 3.1.1
+	// clean session, and no keep alive: the sink only writes when there
+	// are events, and a dead connection fails the next delivery
+	flags := byte(0x02)
+	user := s.url.User.Username()
+	password, hasPassword := s.url.User.Password()
+	if user != "" {
+		flags |= 0x80
+	}
+	if hasPassword {
+		flags |= 0x40
+	}
+	body.WriteByte(flags)
+	body.Write([]byte{0, 0})
+	writeMQTTString(&body, s.clientID)
+	if user != "" {
+		writeMQTTString(&body, user)
+	}
+	if hasPassword {
+		writeMQTTString(&body, password)
+	}
+	if err := s.write(0x10, body.Bytes()); err != nil {
+		s.close()
+		return err
+	}
+
+	packet, data, err := s.read()
+	if err != nil {
+		s.close()
+		return err
+	}
+	if packet>>4 != 2 || len(data) != 2 {
+		s.close()
+		return fmt.Errorf("mqtt: expected CONNACK, got packet type %d", packet>>4)
+	}
+	if code := data[1]; code != 0 {
+		s.close()
+		return fmt.Errorf("mqtt connection refused: %s", mqttConnackReason(code))
+	}
+	return nil
+}
+
+func mqttConnackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("code %d", code)
+}
+
+// expect reads the acknowledgement of packet type header for id.
+func (s *MQTTSink) expect(header byte, id uint16) error {
+	packet, data, err := s.read()
+	if err != nil {
+		return err
+	}
+	if packet&0xf0 != header&0xf0 || len(data) < 2 || binary.BigEndian.Uint16(data) != id {
+		return fmt.Errorf("mqtt: unexpected packet type %d waiting for the acknowledgement of %d", packet>>4, id)
+	}
+	return nil
+}
+
+func (s *MQTTSink) write(header byte, body []byte) error {
+	packet := []byte{header}
+	// remaining length, 7 bits at a time
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		if n /= 128; n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	if _, err := s.conn.Write(append(packet, body...)); err != nil {
+		return fmt.Errorf("mqtt write: %v", err)
+	}
+	return nil
+}
+
+func (s *MQTTSink) read() (byte, []byte, error) {
+	header, err := s.reader.ReadByte()
+	if err != nil {
+		return 0, nil, fmt.Errorf("mqtt read: %v", err)
+	}
+	var n, shift int
+	for {
+		b, err := s.reader.ReadByte()
+		if err != nil {
+			return 0, nil, fmt.Errorf("mqtt read: %v", err)
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errors.New("mqtt: malformed remaining length")
+		}
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(s.reader, data); err != nil {
+		return 0, nil, fmt.Errorf("mqtt read: %v", err)
+	}
+	return header, data, nil
+}
+
+func (s *MQTTSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn, s.reader = nil, nil
+	}
+}
+
+func writeMQTTString(b *bytes.Buffer, s string) {
+	binary.Write(b, binary.BigEndian, uint16(len(s)))
+	b.WriteString(s)
+}
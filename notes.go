@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// PairNote is what someone wrote down about a pair: free-form tags such as
+// entered, watch or scam, and a note.
+type PairNote struct {
+	Pair      string    `json:"pair"`
+	Tags      []string  `json:"tags,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	By        string    `json:"by,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Notes keeps pair notes and tags, saved to path on every change. They
+// are shown on alerts and in the leaderboards.
+type Notes struct {
+	path string
+
+	mu    sync.Mutex
+	notes map[string]*PairNote
+}
+
+func NewNotes(path string) (*Notes, error) {
+	n := &Notes{path: path, notes: make(map[string]*PairNote)}
+	if path == "" {
+		return n, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return n, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read notes: %v", err)
+	}
+	var notes []*PairNote
+	if err := json.Unmarshal(data, &notes); err != nil {
+		return nil, fmt.Errorf("parse notes %s: %v", path, err)
+	}
+	for _, note := range notes {
+		n.notes[note.Pair] = note
+	}
+	return n, nil
+}
+
+// Filter is an EventBus filter that puts the pair's tags and note on
+// alerts. It never drops events.
+func (n *Notes) Filter(event Event) bool {
+	if alert, ok := event.(*AlertEvent); ok && alert.PairAddress != "" {
+		if note, ok := n.Get(alert.PairAddress); ok {
+			alert.Tags, alert.Note = note.Tags, note.Note
+		}
+	}
+	return true
+}
+
+// Get returns the note for pair. It is safe on a nil Notes.
+func (n *Notes) Get(pair string) (PairNote, bool) {
+	if n == nil {
+		return PairNote{}, false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	note, ok := n.notes[pair]
+	if !ok {
+		return PairNote{}, false
+	}
+	copied := *note
+	copied.Tags = slices.Clone(note.Tags)
+	return copied, true
+}
+
+// All returns every note, most recently updated first.
+func (n *Notes) All() []PairNote {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	notes := make([]PairNote, 0, len(n.notes))
+	for _, note := range n.notes {
+		notes = append(notes, *note)
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].UpdatedAt.After(notes[j].UpdatedAt) })
+	return notes
+}
+
+// Tag adds tags to pair.
+func (n *Notes) Tag(pair, by string, tags ...string) (PairNote, error) {
+	return n.update(pair, by, func(note *PairNote) error {
+		for _, tag := range tags {
+			tag, err := normalizeTag(tag)
+			if err != nil {
+				return err
+			}
+			if !slices.Contains(note.Tags, tag) {
+				note.Tags = append(note.Tags, tag)
+			}
+		}
+		return nil
+	})
+}
+
+// Untag removes tags from pair, or all of them when none are given.
+func (n *Notes) Untag(pair, by string, tags ...string) (PairNote, error) {
+	return n.update(pair, by, func(note *PairNote) error {
+		if len(tags) == 0 {
+			note.Tags = nil
+			return nil
+		}
+		note.Tags = slices.DeleteFunc(note.Tags, func(tag string) bool {
+			return slices.ContainsFunc(tags, func(t string) bool {
+				t, _ = normalizeTag(t)
+				return t == tag
+			})
+		})
+		return nil
+	})
+}
+
+// SetNote replaces the note on pair; an empty text clears it.
+func (n *Notes) SetNote(pair, by, text string) (PairNote, error) {
+	return n.update(pair, by, func(note *PairNote) error {
+		note.Note = strings.TrimSpace(text)
+		return nil
+	})
+}
+
+// update applies fn to the note for pair, dropping the note once it has
+// neither tags nor text.
+func (n *Notes) update(pair, by string, fn func(note *PairNote) error) (PairNote, error) {
+	if _, err := decodeAddress(pair); err != nil {
+		return PairNote{}, fmt.Errorf("invalid pair address: %v", err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	note := PairNote{Pair: pair}
+	if existing, ok := n.notes[pair]; ok {
+		note = *existing
+		note.Tags = slices.Clone(existing.Tags)
+	}
+	if err := fn(&note); err != nil {
+		return PairNote{}, err
+	}
+	note.By, note.UpdatedAt = by, time.Now()
+	if len(note.Tags) == 0 && note.Note == "" {
+		delete(n.notes, pair)
+	} else {
+		n.notes[pair] = &note
+	}
+	return note, n.save()
+}
+
+// normalizeTag lowercases a tag and checks it is a single short word.
+func normalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	if tag == "" || len(tag) > 32 {
+		return "", fmt.Errorf("invalid tag %q: must be 1-32 characters", tag)
+	}
+	for _, r := range tag {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return "", fmt.Errorf("invalid tag %q: use letters, digits, - and _", tag)
+		}
+	}
+	return tag, nil
+}
+
+func (n *Notes) save() error {
+	if n.path == "" {
+		return nil
+	}
+	notes := make([]*PairNote, 0, len(n.notes))
+	for _, note := range n.notes {
+		notes = append(notes, note)
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].Pair < notes[j].Pair })
+	data, err := json.MarshalIndent(notes, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(n.path, data, 0o644)
+}
+
+// RegisterNotes mounts the notes API:
+//
+//	GET    /notes                               every note, ?tag=watch to filter
+//	GET    /notes/{pair}                        one pair's note
+//	POST   /notes/{pair}?tags=a,b&note=..&by=.. add tags and/or set the note
+//	DELETE /notes/{pair}?tags=a,b               remove tags, or tags and note
+func RegisterNotes(server *Server, notes *Notes) {
+	server.HandleJSON("GET /notes", func(r *http.Request) (any, error) {
+		all := notes.All()
+		if tag := r.URL.Query().Get("tag"); tag != "" {
+			all = slices.DeleteFunc(all, func(note PairNote) bool { return !slices.Contains(note.Tags, tag) })
+		}
+		return all, nil
+	})
+	server.HandleJSON("GET /notes/{pair}", func(r *http.Request) (any, error) {
+		note, ok := notes.Get(r.PathValue("pair"))
+		if !ok {
+			return nil, fmt.Errorf("no note for %s", r.PathValue("pair"))
+		}
+		return note, nil
+	})
+	server.HandleJSON("POST /notes/{pair}", func(r *http.Request) (any, error) {
+		pair, query := r.PathValue("pair"), r.URL.Query()
+		note, err := notes.Tag(pair, query.Get("by"), splitList(query.Get("tags"))...)
+		if err != nil {
+			return nil, err
+		}
+		if query.Has("note") {
+			return notes.SetNote(pair, query.Get("by"), query.Get("note"))
+		}
+		return note, nil
+	})
+	server.HandleJSON("DELETE /notes/{pair}", func(r *http.Request) (any, error) {
+		pair, query := r.PathValue("pair"), r.URL.Query()
+		if tags := splitList(query.Get("tags")); len(tags) > 0 {
+			return notes.Untag(pair, query.Get("by"), tags...)
+		}
+		if _, err := notes.Untag(pair, query.Get("by")); err != nil {
+			return nil, err
+		}
+		return notes.SetNote(pair, query.Get("by"), "")
+	})
+}
+
+// formatTags renders tags for console and chat lines, e.g. " [watch,entered]".
+func formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(tags, ",") + "]"
+}
+
+// runTag implements `moon tag`, editing the notes of a running instance.
+func runTag(args []string) error {
+	fs := flag.NewFlagSet("tag", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:8080", "base URL of a running moon instance")
+	token := tokenFlag(fs)
+	text := fs.String("note", "", "set the pair's note")
+	remove := fs.Bool("remove", false, "remove the given tags, or every tag and the note when none are given")
+	by := fs.String("by", os.Getenv("USER"), "name recorded with the change")
+	fs.Parse(args)
+
+	// the pair may come before the flags, where flag stops parsing
+	var pair string
+	var tags []string
+	if fs.NArg() > 0 {
+		pair = fs.Arg(0)
+		rest := fs.Args()[1:]
+		for len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+			tags, rest = append(tags, rest[0]), rest[1:]
+		}
+		fs.Parse(rest)
+		tags = append(tags, fs.Args()...)
+	}
+
+	if pair == "" {
+		resp, err := apiRequest(http.MethodGet, *server+"/notes", *token, nil)
+		if err != nil {
+			return fmt.Errorf("notes request error: %v", err)
+		}
+		defer resp.Body.Close()
+		var notes []PairNote
+		if err := decodeNotesResponse(resp, &notes); err != nil {
+			return err
+		}
+		for _, note := range notes {
+			printNote(note)
+		}
+		return nil
+	}
+
+	query := url.Values{"by": {*by}}
+	if len(tags) > 0 {
+		query.Set("tags", strings.Join(tags, ","))
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "note" {
+			query.Set("note", *text)
+		}
+	})
+	method := http.MethodPost
+	switch {
+	case *remove:
+		method = http.MethodDelete
+	case len(tags) == 0 && !query.Has("note"):
+		return fmt.Errorf("usage: moon tag <pairAddress> [tag...] [-note text] [-remove]")
+	}
+	resp, err := apiRequest(method, *server+"/notes/"+url.PathEscape(pair)+"?"+query.Encode(), *token, nil)
+	if err != nil {
+		return fmt.Errorf("notes request error: %v", err)
+	}
+	defer resp.Body.Close()
+	var note PairNote
+	if err := decodeNotesResponse(resp, &note); err != nil {
+		return err
+	}
+	if len(note.Tags) == 0 && note.Note == "" {
+		color.Green("Cleared %s", pair)
+		return nil
+	}
+	printNote(note)
+	return nil
+}
+
+func decodeNotesResponse(resp *http.Response, v any) error {
+	if resp.StatusCode != http.StatusOK {
+		var result struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return fmt.Errorf("notes request failed: %s %s", resp.Status, result.Error)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("notes decode error: %v", err)
+	}
+	return nil
+}
+
+func printNote(note PairNote) {
+	color.Cyan("%s%s", note.Pair, formatTags(note.Tags))
+	if note.Note != "" {
+		fmt.Fprintf(console, "  %s\n", note.Note)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// ParamGrid lists the values swept for each strategy parameter.
+type ParamGrid struct {
+	MinVolume  []float64
+	EntryDelay []time.Duration
+	TakeProfit []float64
+	StopLoss   []float64
+}
+
+func (g ParamGrid) Combinations() []StrategyParams {
+	var all []StrategyParams
+	for _, v := range g.MinVolume {
+		for _, d := range g.EntryDelay {
+			for _, tp := range g.TakeProfit {
+				for _, sl := range g.StopLoss {
+					all = append(all, StrategyParams{MinVolume: v, EntryDelay: d, TakeProfit: tp, StopLoss: sl})
+				}
+			}
+		}
+	}
+	return all
+}
+
+// WalkForwardFold is one train/test step: Best was chosen on the training
+// window and Test is its result on the unseen window that follows.
+type WalkForwardFold struct {
+	TrainFrom, TestFrom, TestTo time.Time
+	Best                        BacktestResult
+	Test                        BacktestResult
+}
+
+// WalkForward splits pairs by discovery time into folds+1 equal windows,
+// picks the best parameters on each window and validates them on the next.
+// Parameter sets with fewer than minTrades trades are not eligible.
+func WalkForward(histories []PairHistory, grid []StrategyParams, folds, minTrades int) ([]WalkForwardFold, error) {
+	if len(histories) == 0 || len(grid) == 0 {
+		return nil, errors.New("nothing to optimize")
+	}
+	start := histories[0].FirstSeen()
+	end := histories[len(histories)-1].FirstSeen().Add(time.Nanosecond)
+	step := end.Sub(start) / time.Duration(folds+1)
+
+	window := func(i int) []PairHistory {
+		from, to := start.Add(time.Duration(i)*step), start.Add(time.Duration(i+1)*step)
+		if i == folds {
+			to = end
+		}
+		var selected []PairHistory
+		for _, h := range histories {
+			if first := h.FirstSeen(); !first.Before(from) && first.Before(to) {
+				selected = append(selected, h)
+			}
+		}
+		return selected
+	}
+
+	var results []WalkForwardFold
+	for i := 0; i < folds; i++ {
+		train, test := window(i), window(i+1)
+		ranked := rankParams(train, grid, minTrades)
+		if len(ranked) == 0 {
+			continue
+		}
+		results = append(results, WalkForwardFold{
+			TrainFrom: start.Add(time.Duration(i) * step),
+			TestFrom:  start.Add(time.Duration(i+1) * step),
+			TestTo:    start.Add(time.Duration(i+2) * step),
+			Best:      ranked[0],
+			Test:      Backtest(test, ranked[0].Params),
+		})
+	}
+	return results, nil
+}
+
+// rankParams backtests every parameter set, best total return first.
+func rankParams(histories []PairHistory, grid []StrategyParams, minTrades int) []BacktestResult {
+	var ranked []BacktestResult
+	for _, params := range grid {
+		result := Backtest(histories, params)
+		if len(result.Trades) >= minTrades {
+			ranked = append(ranked, result)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].TotalReturn > ranked[j].TotalReturn })
+	return ranked
+}
+
+func parseFloats(s string) ([]float64, error) {
+	var values []float64
+	for _, part := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", part)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func parseDurations(s string) ([]time.Duration, error) {
+	var values []time.Duration
+	for _, part := range strings.Split(s, ",") {
+		v, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q", part)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// runOptimize implements `moon optimize`, a walk-forward sweep of the
+// backtest strategy parameters.
+func runOptimize(args []string) error {
+	fs := flag.NewFlagSet("optimize", flag.ExitOnError)
+	path := fs.String("data", "pairs.jsonl", "recorded pair_updated events (file sink output)")
+	minVolume := fs.String("min-volume", "0,1000,10000", "comma-separated minimum volumes")
+	entryDelay := fs.String("entry-delay", "0s,30s,2m", "comma-separated entry delays")
+	takeProfit := fs.String("take-profit", "50,100,200", "comma-separated take profit percents")
+	stopLoss := fs.String("stop-loss", "25,50", "comma-separated stop loss percents")
+	folds := fs.Int("folds", 4, "walk-forward folds")
+	minTrades := fs.Int("min-trades", 5, "minimum trades for a parameter set to be eligible")
+	top := fs.Int("top", 5, "best full-sample parameter sets to list")
+	fs.Parse(args)
+
+	var grid ParamGrid
+	var err error
+	if grid.MinVolume, err = parseFloats(*minVolume); err != nil {
+		return err
+	}
+	if grid.EntryDelay, err = parseDurations(*entryDelay); err != nil {
+		return err
+	}
+	if grid.TakeProfit, err = parseFloats(*takeProfit); err != nil {
+		return err
+	}
+	if grid.StopLoss, err = parseFloats(*stopLoss); err != nil {
+		return err
+	}
+	if *folds < 1 {
+		return errors.New("need at least one fold")
+	}
+
+	histories, err := LoadHistories(*path)
+	if err != nil {
+		return err
+	}
+	combinations := grid.Combinations()
+	color.Blue("Sweeping %d parameter sets over %d pairs", len(combinations), len(histories))
+
+	results, err := WalkForward(histories, combinations, *folds, *minTrades)
+	if err != nil {
+		return err
+	}
+	var inSample, outOfSample float64
+	for i, fold := range results {
+		color.White("Fold %d: train from %s, test %s to %s", i+1,
+			fold.TrainFrom.Format(time.RFC3339), fold.TestFrom.Format(time.RFC3339), fold.TestTo.Format(time.RFC3339))
+		color.White("  best  %s: trades=%d total=%+.2f", fold.Best.Params, len(fold.Best.Trades), fold.Best.TotalReturn)
+		printRow := color.Green
+		if fold.Test.TotalReturn < 0 {
+			printRow = color.Red
+		}
+		printRow("  test  trades=%d hit=%.1f%% total=%+.2f drawdown=%.2f",
+			len(fold.Test.Trades), fold.Test.HitRate*100, fold.Test.TotalReturn, fold.Test.MaxDrawdown)
+		inSample += fold.Best.TotalReturn
+		outOfSample += fold.Test.TotalReturn
+	}
+	if len(results) > 0 {
+		color.Blue("Walk-forward: in-sample %+.2f, out-of-sample %+.2f units", inSample, outOfSample)
+	}
+
+	color.Blue("Best parameter sets on the full recording:")
+	for i, result := range rankParams(histories, combinations, *minTrades) {
+		if i == *top {
+			break
+		}
+		color.Green("  %d. %s: trades=%d hit=%.1f%% total=%+.2f drawdown=%.2f", i+1, result.Params,
+			len(result.Trades), result.HitRate*100, result.TotalReturn, result.MaxDrawdown)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// OutboxEntry is an encoded delivery a sink could not make.
+type OutboxEntry struct {
+	ID          string    `json:"id"`
+	Event       string    `json:"event"`
+	ContentType string    `json:"contentType"`
+	Payload     []byte    `json:"payload"`
+	At          time.Time `json:"at"`
+}
+
+// Outbox keeps a sink's undelivered payloads in a JSONL file, so events
+// that fail during an outage, overflow the queue or are still queued at
+// shutdown are retried later, including after a restart. Entries are
+// synced to disk before Add returns.
+type Outbox struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	entries []OutboxEntry
+}
+
+func OpenOutbox(path string) (*Outbox, error) {
+	o := &Outbox{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read outbox: %v", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var entry OutboxEntry
+		// a torn last line from a crash is skipped
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			o.entries = append(o.entries, entry)
+		}
+	}
+	if o.file, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err != nil {
+		return nil, fmt.Errorf("open outbox: %v", err)
+	}
+	return o, nil
+}
+
+func (o *Outbox) Add(entry OutboxEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, err := o.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	o.entries = append(o.entries, entry)
+	return o.file.Sync()
+}
+
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+// Flush delivers entries oldest first until one fails, then rewrites the
+// file without the delivered ones. Entries added meanwhile are kept.
+func (o *Outbox) Flush(deliver func(OutboxEntry) error) (int, error) {
+	o.mu.Lock()
+	pending := o.entries
+	o.mu.Unlock()
+
+	sent := 0
+	var deliverErr error
+	for _, entry := range pending {
+		if deliverErr = deliver(entry); deliverErr != nil {
+			break
+		}
+		sent++
+	}
+	if sent == 0 {
+		return 0, deliverErr
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.entries = o.entries[sent:]
+	var buf bytes.Buffer
+	for _, entry := range o.entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return sent, err
+		}
+		buf.Write(append(data, '\n'))
+	}
+	if err := writeFileAtomic(o.path, buf.Bytes(), 0o644); err != nil {
+		return sent, fmt.Errorf("rewrite outbox: %v", err)
+	}
+	// the file was replaced, so appends must go to the new one
+	o.file.Close()
+	var err error
+	if o.file, err = os.OpenFile(o.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err != nil {
+		return sent, fmt.Errorf("open outbox: %v", err)
+	}
+	return sent, deliverErr
+}
+
+func (o *Outbox) Close() error {
+	return o.file.Close()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/piotrostr/moon/protocol"
+	"github.com/piotrostr/moon/store"
+	"github.com/piotrostr/moon/stream"
+)
+
+// The decoder, pair store and stream live in importable packages; these
+// aliases keep the command's code unqualified.
+type (
+	MessageType            = protocol.MessageType
+	PairData               = protocol.PairData
+	PairsMessage           = protocol.PairsMessage
+	LatestBlockHashMessage = protocol.LatestBlockHashMessage
+	PingMessage            = protocol.PingMessage
+
+	PairStore   = store.PairStore
+	TrackedPair = store.TrackedPair
+
+	Stream       = stream.Stream
+	Frame        = stream.Frame
+	Subscription = stream.Subscription
+	Deduplicator = stream.Deduplicator
+)
+
+const (
+	LatestBlockHashMessageType = protocol.LatestBlockHashMessageType
+	PairsMessageType           = protocol.PairsMessageType
+	PingMessageType            = protocol.PingMessageType
+)
+
+var (
+	NewPairStore        = store.NewPairStore
+	NewDeduplicator     = stream.NewDeduplicator
+	DefaultSubscription = stream.DefaultSubscription
+	ErrStreamClosed     = stream.ErrStreamClosed
+	ErrSourceDone       = stream.ErrSourceDone
+)
+
+// parseMessage logs the frame header and decodes it, with the warnings of
+// any decoding heuristic that fired.
+func parseMessage(message []byte) (interface{}, []protocol.Warning, error) {
+	if len(message) > 0 {
+		logMessageInfo(MessageType(message[0]), len(message), message)
+	}
+	return protocol.Inspect(message)
+}
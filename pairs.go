@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/piotrostr/moon/base58"
+)
+
+// HandlePairs serves /pairs, every tracked pair as one JSON record per
+// line, flattened like sink records and marked stale when its price is
+// older than -stale-price, with the pair's tags from notes. It walks the
+// store with Iterate, so a slow client does not stall the stream.
+func HandlePairs(store *PairStore, notes *Notes) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		written := 0
+		now := time.Now()
+		store.Iterate(func(tracked TrackedPair) bool {
+			if err := enc.Encode(pairRecord(tracked, notes, now)); err != nil {
+				return false
+			}
+			if written++; flusher != nil && written%1000 == 0 {
+				flusher.Flush()
+			}
+			return true
+		})
+	}
+}
+
+// pairRecord is a pair as /pairs lists it.
+func pairRecord(tracked TrackedPair, notes *Notes, now time.Time) Record {
+	record := Record{}
+	flatten(record, reflect.ValueOf(tracked))
+	record["stale"] = priceStale(tracked.LastSeen, now)
+	if note, ok := notes.Get(base58.Encode(tracked.PairAddress[:])); ok {
+		record["tags"] = note.Tags
+	}
+	return record
+}
+
+// PairChanges is a page of the change feed. Reset means the cursor given
+// was unknown or too old and Pairs holds every tracked pair, so the
+// consumer should drop what it has; otherwise it holds the pairs added or
+// updated since the cursor, and Removed the pairs evicted since.
+type PairChanges struct {
+	Cursor  string   `json:"cursor"`
+	Reset   bool     `json:"reset"`
+	Pairs   []Record `json:"pairs"`
+	Removed []string `json:"removed"`
+}
+
+// HandlePairChanges serves GET /pairs/changes?since=<cursor>, for
+// consumers that poll instead of holding a connection. Each response
+// carries the cursor for the next poll; without since, or with a cursor
+// from an earlier run, it starts over from every pair.
+func HandlePairChanges(store *PairStore, notes *Notes) func(r *http.Request) (any, error) {
+	// cursors are only good for this run's store
+	epoch := strconv.FormatInt(time.Now().UnixNano(), 36)
+	return func(r *http.Request) (any, error) {
+		var revision uint64
+		known := false
+		if since := r.URL.Query().Get("since"); since != "" {
+			prefix, rev, ok := strings.Cut(since, ".")
+			parsed, err := strconv.ParseUint(rev, 10, 64)
+			if !ok || err != nil {
+				return nil, fmt.Errorf("invalid cursor %q", since)
+			}
+			revision, known = parsed, prefix == epoch
+		}
+
+		changes := PairChanges{Pairs: []Record{}, Removed: []string{}}
+		now := time.Now()
+		var changed []TrackedPair
+		var removed [][32]byte
+		var current uint64
+		if known {
+			changed, removed, current, known = store.ChangedSince(revision)
+		}
+		if !known {
+			changes.Reset = true
+			// taken before the walk, so changes during it are sent again
+			current = store.Revision()
+			changed = store.Snapshot()
+		}
+		for _, tracked := range changed {
+			changes.Pairs = append(changes.Pairs, pairRecord(tracked, notes, now))
+		}
+		for _, addr := range removed {
+			changes.Removed = append(changes.Removed, base58.Encode(addr[:]))
+		}
+		changes.Cursor = epoch + "." + strconv.FormatUint(current, 10)
+		return changes, nil
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/color"
+)
+
+// pairColumn is a decoded pair field the console table can show and sort
+// by. Columns are named like the fields of sink records.
+type pairColumn struct {
+	numeric bool
+	number  func(PairData) float64
+	text    func(PairData) string
+	// truncated columns are cut to -pairs-name-width
+	truncated bool
+}
+
+var pairColumns = map[string]pairColumn{
+	"pairAddress":     {text: func(p PairData) string { return formatAddress(p.PairAddress) }},
+	"tokenName":       {text: func(p PairData) string { return p.TokenName }, truncated: true},
+	"tokenSymbol":     {text: func(p PairData) string { return p.TokenSymbol }, truncated: true},
+	"baseTokenSymbol": {text: func(p PairData) string { return p.BaseTokenSymbol }, truncated: true},
+	"price":           {numeric: true, number: func(p PairData) float64 { return p.Price }},
+	"volume":          {numeric: true, number: func(p PairData) float64 { return p.Volume }},
+}
+
+var pairColumnOrder = []string{"pairAddress", "tokenName", "tokenSymbol", "baseTokenSymbol", "price", "volume"}
+
+// PairTable is how the console prints the pairs of each Pairs message.
+type PairTable struct {
+	// Top is the number of pairs printed; negative follows the verbosity,
+	// defaultPairsTop with -v and none otherwise.
+	Top     int
+	Columns []string
+	// SortBy is a column, or empty for the order of the message.
+	SortBy    string
+	Ascending bool
+	NameWidth int
+}
+
+const defaultPairsTop = 5
+
+var pairTable = PairTable{Top: -1, Columns: pairColumnOrder, NameWidth: 24}
+
+// pairTableFlags registers the -pairs-* flags on fs; call the returned
+// func after parsing to apply them.
+func pairTableFlags(fs *flag.FlagSet) func() error {
+	top := fs.Int("pairs-top", -1, "pairs of each Pairs message to print as a table, 0 for none and -1 for 5 with -v and none otherwise")
+	columns := fs.String("pairs-columns", strings.Join(pairColumnOrder, ","), "comma-separated columns of the pairs table")
+	sortBy := fs.String("pairs-sort", "", "column to sort the pairs table by, numbers descending and text ascending; add :asc or :desc to pick (default the message's order)")
+	nameWidth := fs.Int("pairs-name-width", 24, "terminal columns token names and symbols are truncated to in the pairs table (0 for no limit)")
+	return func() error {
+		if *top < -1 {
+			return fmt.Errorf("-pairs-top must be -1 or more, got %d", *top)
+		}
+		pairTable.Top = *top
+		pairTable.Columns = nil
+		for _, name := range strings.Split(*columns, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := pairColumns[name]; !ok {
+				return fmt.Errorf("unknown -pairs-columns column %q, have %s", name, strings.Join(pairColumnOrder, ", "))
+			}
+			pairTable.Columns = append(pairTable.Columns, name)
+		}
+		if *sortBy != "" {
+			name, order, _ := strings.Cut(*sortBy, ":")
+			column, ok := pairColumns[name]
+			if !ok {
+				return fmt.Errorf("unknown -pairs-sort column %q, have %s", name, strings.Join(pairColumnOrder, ", "))
+			}
+			switch order {
+			case "":
+				pairTable.Ascending = !column.numeric
+			case "asc", "desc":
+				pairTable.Ascending = order == "asc"
+			default:
+				return fmt.Errorf("invalid -pairs-sort order %q, want asc or desc", order)
+			}
+			pairTable.SortBy = name
+		}
+		if *nameWidth < 0 {
+			return fmt.Errorf("-pairs-name-width must not be negative, got %d", *nameWidth)
+		}
+		pairTable.NameWidth = *nameWidth
+		return nil
+	}
+}
+
+// top is the number of pairs to print at the current verbosity.
+func (t PairTable) top() int {
+	if t.Top >= 0 {
+		return t.Top
+	}
+	if verbosity.Load() >= verbosityVerbose {
+		return defaultPairsTop
+	}
+	return 0
+}
+
+// Select returns the first n pairs in the table's order, leaving pairs
+// as they are.
+func (t PairTable) Select(pairs []PairData, n int) []PairData {
+	column, ok := pairColumns[t.SortBy]
+	if !ok {
+		return pairs[:min(n, len(pairs))]
+	}
+	sorted := slices.Clone(pairs)
+	slices.SortStableFunc(sorted, func(a, b PairData) int {
+		var c int
+		if column.numeric {
+			c = cmp.Compare(column.number(a), column.number(b))
+		} else {
+			c = strings.Compare(strings.ToLower(column.text(a)), strings.ToLower(column.text(b)))
+		}
+		if !t.Ascending {
+			c = -c
+		}
+		return c
+	})
+	return sorted[:min(n, len(sorted))]
+}
+
+// cell is pair's value in column, formatted for people.
+func (t PairTable) cell(pair PairData, name string) string {
+	column := pairColumns[name]
+	switch name {
+	case "price":
+		return formatPrice(pair.Price)
+	case "volume":
+		return formatUSD(pair.Volume)
+	}
+	text := strings.Map(func(r rune) rune {
+		// names come from token creators; keep them on one line
+		if !unicode.IsPrint(r) {
+			return ' '
+		}
+		return r
+	}, column.text(pair))
+	if column.truncated {
+		text = truncate(text, t.NameWidth)
+	}
+	return text
+}
+
+// Render lays pairs out in aligned columns under a header, numbers right
+// aligned.
+func (t PairTable) Render(pairs []PairData) []string {
+	rows := make([][]string, len(pairs))
+	for i, pair := range pairs {
+		rows[i] = make([]string, len(t.Columns))
+		for j, name := range t.Columns {
+			rows[i][j] = t.cell(pair, name)
+		}
+	}
+	right := make([]bool, len(t.Columns))
+	for j, name := range t.Columns {
+		right[j] = pairColumns[name].numeric
+	}
+	return renderTable(t.Columns, rows, right)
+}
+
+// renderTable aligns rows under header, separated by a rule. Columns are
+// as wide as their widest cell; right marks columns aligned to the right.
+func renderTable(header []string, rows [][]string, right []bool) []string {
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for j, cell := range row {
+			widths[j] = max(widths[j], displayWidth(cell))
+		}
+	}
+
+	line := func(cells []string) string {
+		var b strings.Builder
+		for j, cell := range cells {
+			if j > 0 {
+				b.WriteString("  ")
+			}
+			pad := strings.Repeat(" ", widths[j]-displayWidth(cell))
+			if right[j] {
+				b.WriteString(pad + cell)
+			} else if j < len(cells)-1 {
+				b.WriteString(cell + pad)
+			} else {
+				b.WriteString(cell)
+			}
+		}
+		return b.String()
+	}
+
+	rule := make([]string, len(header))
+	for j := range rule {
+		rule[j] = strings.Repeat("-", widths[j])
+	}
+	lines := []string{line(header), line(rule)}
+	for _, row := range rows {
+		lines = append(lines, line(row))
+	}
+	return lines
+}
+
+// truncate cuts s to width terminal columns, marking the cut with an
+// ellipsis. Zero width leaves s whole.
+func truncate(s string, width int) string {
+	if width <= 0 || displayWidth(s) <= width {
+		return s
+	}
+	used := 0
+	for i, r := range s {
+		w := runeWidth(r)
+		if used+w > width-1 {
+			return s[:i] + "…"
+		}
+		used += w
+	}
+	return s
+}
+
+// printPairs prints the top pairs as a table, or with colors off as one
+// line per pair for machines, with the selected fields untruncated.
+func printPairs(pairs []PairData) {
+	pairs = pairTable.Select(pairs, pairTable.top())
+	if len(pairs) == 0 {
+		return
+	}
+	if color.NoColor {
+		for i, pair := range pairs {
+			fields := make([]string, len(pairTable.Columns))
+			for j, name := range pairTable.Columns {
+				column := pairColumns[name]
+				if column.numeric {
+					fields[j] = name + "=" + logfmtValue(column.number(pair))
+				} else {
+					fields[j] = name + "=" + logfmtValue(column.text(pair))
+				}
+			}
+			fmt.Fprintf(console, "Pair %d: %s\n", i, strings.Join(fields, " "))
+		}
+		return
+	}
+	for _, line := range pairTable.Render(pairs) {
+		color.Green("  %s", line)
+	}
+}
+
+// displayWidth is the number of terminal columns s takes up.
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// runeWidth is 2 for East Asian wide and fullwidth characters and emoji,
+// 0 for combining marks, zero width joiners and variation selectors, and 1
+// otherwise. wideRanges covers the scripts and emoji token names use rather
+// than all of Unicode's East Asian Width property.
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) || r >= 0xfe00 && r <= 0xfe0f || r >= 0x1f3fb && r <= 0x1f3ff {
+		return 0
+	}
+	_, found := slices.BinarySearchFunc(wideRanges, r, func(span [2]rune, r rune) int {
+		if span[1] < r {
+			return -1
+		}
+		if span[0] > r {
+			return 1
+		}
+		return 0
+	})
+	if found {
+		return 2
+	}
+	return 1
+}
+
+// wideRanges are inclusive and sorted.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f}, // Hangul Jamo
+	{0x231a, 0x231b}, {0x23e9, 0x23ec}, {0x23f0, 0x23f0}, {0x23f3, 0x23f3},
+	{0x25fd, 0x25fe}, {0x2614, 0x2615}, {0x2648, 0x2653}, {0x267f, 0x267f},
+	{0x2693, 0x2693}, {0x26a1, 0x26a1}, {0x26aa, 0x26ab}, {0x26bd, 0x26be},
+	{0x26c4, 0x26c5}, {0x26ce, 0x26ce}, {0x26d4, 0x26d4}, {0x26ea, 0x26ea},
+	{0x26f2, 0x26f3}, {0x26f5, 0x26f5}, {0x26fa, 0x26fa}, {0x26fd, 0x26fd},
+	{0x2705, 0x2705}, {0x270a, 0x270b}, {0x2728, 0x2728}, {0x274c, 0x274c},
+	{0x274e, 0x274e}, {0x2753, 0x2755}, {0x2757, 0x2757}, {0x2795, 0x2797},
+	{0x27b0, 0x27b0}, {0x27bf, 0x27bf}, {0x2b1b, 0x2b1c}, {0x2b50, 0x2b50},
+	{0x2b55, 0x2b55},
+	{0x2e80, 0x303e},                       // CJK radicals, symbols and punctuation
+	{0x3041, 0x33ff},                       // kana and CJK compatibility
+	{0x3400, 0x4dbf},                       // CJK extension A
+	{0x4e00, 0x9fff},                       // CJK unified ideographs
+	{0xa000, 0xa4cf},                       // Yi
+	{0xac00, 0xd7a3},                       // Hangul syllables
+	{0xf900, 0xfaff},                       // CJK compatibility ideographs
+	{0xfe30, 0xfe4f},                       // CJK compatibility forms
+	{0xff00, 0xff60},                       // fullwidth forms
+	{0xffe0, 0xffe6},                       // fullwidth signs
+	{0x1f004, 0x1f004},                     // mahjong tile
+	{0x1f0cf, 0x1f0cf},                     // joker
+	{0x1f18e, 0x1f18e}, {0x1f191, 0x1f19a}, // squared letters
+	{0x1f200, 0x1f251}, // enclosed ideographs
+	{0x1f300, 0x1f64f}, // pictographs and emoticons
+	{0x1f680, 0x1f6ff}, // transport and map symbols
+	{0x1f7e0, 0x1f7eb}, // coloured circles and squares
+	{0x1f900, 0x1f9ff}, // supplemental pictographs
+	{0x1fa70, 0x1faff}, // symbols and pictographs extended
+	{0x20000, 0x3fffd}, // CJK extensions B and on
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// PaperExecutor fills orders instantly at the pair's current stream price
+// without fees or slippage. Stream prices are in USD and there is no SOL
+// price to convert them with, so paper tokens are notional: a buy mints
+// one token per lamport spent, and a sell returns the tokens times the
+// ratio of the current price to the pair's average entry price, in
+// lamports. PnL tracks the price ratio exactly.
+type PaperExecutor struct {
+	store *PairStore
+	bus   *EventBus
+
+	mu       sync.Mutex
+	holdings map[string]paperHolding
+}
+
+// paperHolding is a pair's paper tokens and the average USD price they
+// were bought at.
+type paperHolding struct {
+	tokens uint64
+	price  float64
+}
+
+func NewPaperExecutor(store *PairStore, bus *EventBus) *PaperExecutor {
+	return &PaperExecutor{store: store, bus: bus, holdings: make(map[string]paperHolding)}
+}
+
+func (p *PaperExecutor) Execute(_ context.Context, order Order) (*Execution, error) {
+	addr, err := decodeAddress(order.PairAddress)
+	if err != nil {
+		return nil, err
+	}
+	tracked, ok := p.store.Get(addr)
+	if !ok || tracked.Price <= 0 {
+		return nil, p.fail(order, fmt.Errorf("no price for pair %s", order.PairAddress))
+	}
+
+	now := time.Now()
+	execution := &Execution{
+		Order:       order,
+		Signature:   fmt.Sprintf("paper-%d", now.UnixNano()),
+		SubmittedAt: now,
+		Attempts:    1,
+		Commitment:  "paper",
+		FilledIn:    order.Amount,
+	}
+
+	p.mu.Lock()
+	holding := p.holdings[order.PairAddress]
+	if order.Side == Buy {
+		tokens, carry := bits.Add64(holding.tokens, order.Amount, 0)
+		if carry != 0 {
+			p.mu.Unlock()
+			return nil, p.fail(order, fmt.Errorf("paper holding of %s overflows", order.PairAddress))
+		}
+		holding.price = (holding.price*float64(holding.tokens) + tracked.Price*float64(order.Amount)) / float64(tokens)
+		holding.tokens = tokens
+		execution.FilledOut = order.Amount
+	} else {
+		if order.Amount > holding.tokens {
+			p.mu.Unlock()
+			return nil, p.fail(order, fmt.Errorf("selling %d paper tokens of %s, holding %d", order.Amount, order.PairAddress, holding.tokens))
+		}
+		proceeds := float64(order.Amount) * (tracked.Price / holding.price)
+		if proceeds >= math.MaxUint64 {
+			p.mu.Unlock()
+			return nil, p.fail(order, fmt.Errorf("paper proceeds of %s overflow", order.PairAddress))
+		}
+		holding.tokens -= order.Amount
+		execution.FilledOut = uint64(proceeds)
+	}
+	if holding.tokens == 0 {
+		delete(p.holdings, order.PairAddress)
+	} else {
+		p.holdings[order.PairAddress] = holding
+	}
+	p.mu.Unlock()
+	execution.QuotedIn, execution.QuotedOut = execution.FilledIn, execution.FilledOut
+
+	p.bus.Publish(&ExecutionConfirmedEvent{Execution: *execution})
+	return execution, nil
+}
+
+func (p *PaperExecutor) fail(order Order, err error) error {
+	p.bus.Publish(&ExecutionFailedEvent{Order: order, Reason: err.Error()})
+	return err
+}
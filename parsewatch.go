@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// ParseMonitor watches the share of frames that fail to decode. A spike
+// usually means the server changed its protocol, so it alerts and starts
+// capturing every raw frame to disk for replay once the decoder is fixed.
+type ParseMonitor struct {
+	window      time.Duration
+	threshold   float64
+	minFrames   int
+	capturePath string
+	bus         *EventBus
+
+	results []parseResult
+	spiking bool
+	capture *os.File
+}
+
+type parseResult struct {
+	at     time.Time
+	failed bool
+}
+
+// CapturedFrame is one line of the raw capture file.
+type CapturedFrame struct {
+	At     time.Time `json:"at"`
+	ConnID int       `json:"connId"`
+	Data   []byte    `json:"data"`
+	Error  string    `json:"error,omitempty"`
+}
+
+func NewParseMonitor(window time.Duration, threshold float64, capturePath string, bus *EventBus) *ParseMonitor {
+	return &ParseMonitor{
+		window:      window,
+		threshold:   threshold,
+		minFrames:   20,
+		capturePath: capturePath,
+		bus:         bus,
+	}
+}
+
+func (m *ParseMonitor) Observe(frame Frame, err error, now time.Time) {
+	if m.capture != nil {
+		m.write(frame, err, now)
+	}
+
+	m.results = append(m.results, parseResult{at: now, failed: err != nil})
+	cutoff := now.Add(-m.window)
+	drop := 0
+	for drop < len(m.results) && m.results[drop].at.Before(cutoff) {
+		drop++
+	}
+	m.results = m.results[drop:]
+
+	rate := m.Rate()
+	switch {
+	case !m.spiking && len(m.results) >= m.minFrames && rate >= m.threshold:
+		m.spiking = true
+		m.spike(rate, now)
+		if m.capture != nil {
+			m.write(frame, err, now)
+		}
+	case m.spiking && rate < m.threshold/2:
+		m.spiking = false
+		color.Green("Parse error rate back to %.1f%%", rate*100)
+	}
+}
+
+// Rate is the failed share of frames in the window.
+func (m *ParseMonitor) Rate() float64 {
+	if len(m.results) == 0 {
+		return 0
+	}
+	var failed int
+	for _, r := range m.results {
+		if r.failed {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(m.results))
+}
+
+func (m *ParseMonitor) spike(rate float64, now time.Time) {
+	message := fmt.Sprintf("%.1f%% of frames failed to parse over the last %s; the protocol may have changed",
+		rate*100, m.window)
+
+	if m.capture == nil && m.capturePath != "" {
+		file, err := os.OpenFile(m.capturePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			color.Red("Error opening raw capture: %v", err)
+		} else {
+			m.capture = file
+			message += ", capturing raw frames to " + m.capturePath
+		}
+	}
+
+	m.bus.Publish(&AlertEvent{Kind: "parse_errors", Message: message, At: now})
+}
+
+func (m *ParseMonitor) write(frame Frame, err error, now time.Time) {
+	captured := CapturedFrame{At: now, ConnID: frame.ConnID, Data: frame.Data}
+	if err != nil {
+		captured.Error = err.Error()
+	}
+	data, _ := json.Marshal(captured)
+	if _, err := m.capture.Write(append(data, '\n')); err != nil {
+		color.Red("Error writing raw capture: %v", err)
+	}
+}
+
+func (m *ParseMonitor) Close() error {
+	if m.capture == nil {
+		return nil
+	}
+	return m.capture.Close()
+}
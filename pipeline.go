@@ -0,0 +1,497 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// FilterConfig selects which events reach a sink. Empty means all.
+type FilterConfig struct {
+	Events        []string `json:"events,omitempty"`
+	ExcludeEvents []string `json:"excludeEvents,omitempty"`
+}
+
+func (f FilterConfig) Match(event Event) bool {
+	name := event.EventName()
+	if len(f.Events) > 0 && !slices.Contains(f.Events, name) {
+		return false
+	}
+	return !slices.Contains(f.ExcludeEvents, name)
+}
+
+// TransformConfig reshapes a record: Scale multiplies numeric fields (unit
+// conversion), Fields keeps only the listed fields, Rename maps field names.
+// Fields and Scale use the original names; renaming happens last.
+type TransformConfig struct {
+	Fields []string           `json:"fields,omitempty"`
+	Rename map[string]string  `json:"rename,omitempty"`
+	Scale  map[string]float64 `json:"scale,omitempty"`
+}
+
+func (t TransformConfig) Apply(record Record) Record {
+	for field, factor := range t.Scale {
+		if v, ok := toFloat(record[field]); ok {
+			record[field] = v * factor
+		}
+	}
+
+	if len(t.Fields) > 0 {
+		selected := make(Record, len(t.Fields))
+		for _, field := range t.Fields {
+			if v, ok := record[field]; ok {
+				selected[field] = v
+			}
+		}
+		record = selected
+	}
+
+	for from, to := range t.Rename {
+		if v, ok := record[from]; ok {
+			delete(record, from)
+			record[to] = v
+		}
+	}
+
+	return record
+}
+
+const pipelineQueueSize = 1024
+
+// Pipeline runs filter -> transform -> redact -> encode -> deliver for one
+// sink on its own goroutine with its own queue, so a slow, failing or
+// panicking sink does not stall the stream or the other sinks. With an
+// outbox, events that fail, are dropped or are still queued at shutdown
+// are kept and retried every cooldown and on the next start.
+type Pipeline struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	name      string
+	language  string
+	filter    atomic.Pointer[FilterConfig]
+	transform TransformConfig
+	redact    []RedactionRule
+	encoder   Encoder
+	sink      Sink
+	retry     RetryConfig
+	origin    *Origin
+	envelope  bool
+	clock     *BlockClock
+	tracer    *Tracer
+	queue     chan queuedEvent
+	outbox    *Outbox
+	// events that overflowed the queue, written to the outbox by their own
+	// goroutine so the publisher never waits on the disk
+	overflow chan queuedEvent
+	spilled  chan struct{}
+
+	delivered atomic.Int64
+	failed    atomic.Int64
+	dropped   atomic.Int64
+	panics    atomic.Int64
+	disabled  atomic.Bool
+	// held by Pause; events are handled as when the breaker is open
+	held atomic.Bool
+	// delivered from the outbox, having already counted as failed or dropped
+	redelivered atomic.Int64
+
+	// owned by the run goroutine
+	failures    int
+	pausedUntil time.Time
+}
+
+// queuedEvent is stamped on arrival so a backed up queue does not shift
+// its timing.
+type queuedEvent struct {
+	event       Event
+	source      string
+	receivedAt  time.Time
+	serverBlock uint32
+	trace       SpanContext
+}
+
+// NewPipeline starts a pipeline. Every record it exports is the event's
+// fields as payload, with eventId, a hash of the event's identifying
+// fields that consumers can deduplicate retries on (eventID says which
+// replays keep it), and serverBlock, the last block the feed had announced
+// by then, so analyses can order events by the feed's clock when the local
+// one drifts or the feed lags. With the sink's envelope option the payload is wrapped
+// in an envelope of schemaVersion; source, where the event's data came
+// from; receivedAt, the local time the event was observed; and the chain
+// and dex from origin. Without it receivedAt is in the payload. Filters,
+// transforms and redaction see the payload. Deliveries are traced as children of the
+// frame that produced the event when tracer is set.
+func NewPipeline(ctx context.Context, config SinkConfig, origin *Origin, clock *BlockClock, tracer *Tracer) (*Pipeline, error) {
+	encoder, err := NewEncoder(config.Encoding, renamedFields(config.Transform))
+	if err != nil {
+		return nil, err
+	}
+	sink, err := NewSink(config)
+	if err != nil {
+		return nil, err
+	}
+
+	name := config.sinkName()
+	language := config.Language
+	if config.Template != "" {
+		language = config.templateKey()
+	}
+	config.Retry.setDefaults()
+
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Pipeline{
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		name:      name,
+		language:  language,
+		transform: config.Transform,
+		redact:    config.Redact,
+		encoder:   encoder,
+		sink:      sink,
+		retry:     config.Retry,
+		origin:    origin,
+		envelope:  config.Envelope,
+		clock:     clock,
+		tracer:    tracer,
+		queue:     make(chan queuedEvent, pipelineQueueSize),
+	}
+	p.filter.Store(&config.Filter)
+	if config.Outbox != "" {
+		if p.outbox, err = OpenOutbox(config.Outbox); err != nil {
+			cancel()
+			return nil, err
+		}
+		p.overflow = make(chan queuedEvent, pipelineQueueSize)
+		p.spilled = make(chan struct{})
+		go p.spillOverflow()
+	}
+	go p.run()
+	return p, nil
+}
+
+func (p *Pipeline) Observe(event Event) {
+	if p.disabled.Load() || !p.filter.Load().Match(event) {
+		return
+	}
+	queued := queuedEvent{event: event, source: sourceOf(event), receivedAt: time.Now(), trace: p.tracer.Active()}
+	queued.serverBlock, _ = p.clock.Latest()
+	select {
+	case p.queue <- queued:
+	default:
+		p.dropped.Add(1)
+		color.Red("Sink %s queue full, dropping %s", p.name, event.EventName())
+		if p.overflow != nil {
+			select {
+			case p.overflow <- queued:
+			default:
+				color.Red("Sink %s outbox backlog full, losing %s", p.name, event.EventName())
+			}
+		}
+	}
+}
+
+// spillOverflow moves events that overflowed the queue to the outbox.
+func (p *Pipeline) spillOverflow() {
+	defer close(p.spilled)
+	for {
+		select {
+		case queued := <-p.overflow:
+			p.spill(queued)
+		case <-p.ctx.Done():
+			for len(p.overflow) > 0 {
+				p.spill(<-p.overflow)
+			}
+			return
+		}
+	}
+}
+
+// Replay queues a stored event stamped with its original time and block.
+// Unlike Observe it waits for room in the queue instead of dropping, and
+// reports whether the event passed the filter and was queued. Its source
+// is replay.
+func (p *Pipeline) Replay(event Event, at time.Time, block uint32) bool {
+	if p.disabled.Load() || !p.filter.Load().Match(event) {
+		return false
+	}
+	select {
+	case p.queue <- queuedEvent{event: event, source: SourceReplay, receivedAt: at, serverBlock: block}:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// Settled is the number of events delivered, failed or dropped so far.
+func (p *Pipeline) Settled() int64 {
+	return p.delivered.Load() + p.failed.Load() + p.dropped.Load()
+}
+
+// run restarts the delivery loop after a panic until MaxPanics is reached.
+func (p *Pipeline) run() {
+	defer close(p.done)
+	backoff := time.Duration(p.retry.Backoff)
+	for !p.serve() {
+		if p.panics.Add(1) >= int64(p.retry.MaxPanics) {
+			p.disabled.Store(true)
+			color.Red("Sink %s disabled after %d panics", p.name, p.retry.MaxPanics)
+			return
+		}
+		if !p.sleep(backoff) {
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// serve delivers queued events and reports false if it panicked. The
+// event being handled in a panic counts as failed; it is not spilled, as
+// encoding it may be what panicked.
+func (p *Pipeline) serve() (ok bool) {
+	current := false
+	defer func() {
+		if r := recover(); r != nil {
+			color.Red("Sink %s panicked: %v", p.name, r)
+			if current {
+				p.failed.Add(1)
+			}
+			ok = false
+		}
+	}()
+
+	var retry <-chan time.Time
+	if p.outbox != nil {
+		p.flushOutbox()
+		ticker := time.NewTicker(time.Duration(p.retry.Cooldown))
+		defer ticker.Stop()
+		retry = ticker.C
+	}
+	for {
+		select {
+		case event := <-p.queue:
+			current = true
+			p.handle(event)
+			current = false
+		case <-retry:
+			p.flushOutbox()
+		case <-p.ctx.Done():
+			for len(p.queue) > 0 {
+				p.spill(<-p.queue)
+			}
+			return true
+		}
+	}
+}
+
+func (p *Pipeline) handle(event queuedEvent) {
+	if p.paused() {
+		p.dropped.Add(1)
+		p.spill(event)
+		return
+	}
+
+	span := p.tracer.Start("sink.deliver", event.trace)
+	span.SetAttr("sink", p.name)
+	span.SetAttr("event", event.event.EventName())
+	span.SetAttr("queue.wait_ms", float64(time.Since(event.receivedAt).Microseconds())/1000)
+	defer span.End()
+
+	backoff := time.Duration(p.retry.Backoff)
+	var err error
+	for attempt := 1; attempt <= p.retry.Attempts; attempt++ {
+		span.SetAttr("attempts", attempt)
+		if err = p.deliver(event); err == nil {
+			p.delivered.Add(1)
+			p.failures = 0
+			return
+		}
+		if attempt < p.retry.Attempts && !p.sleep(backoff) {
+			p.spill(event)
+			return
+		}
+		backoff *= 2
+	}
+
+	p.failed.Add(1)
+	span.SetError(err)
+	color.Red("Sink %s error: %v", p.name, err)
+	p.spill(event)
+	if p.failures++; p.failures >= p.retry.BreakAfter {
+		p.failures = 0
+		p.pausedUntil = time.Now().Add(time.Duration(p.retry.Cooldown))
+		color.Red("Sink %s paused for %s after %d failed events", p.name, time.Duration(p.retry.Cooldown), p.retry.BreakAfter)
+	}
+}
+
+// paused reports whether events are held back, by the breaker or Pause.
+func (p *Pipeline) paused() bool {
+	return p.held.Load() || time.Now().Before(p.pausedUntil)
+}
+
+// Pause holds back delivery until Resume. Events meanwhile are kept in
+// the outbox and redelivered on Resume; a sink without an outbox would
+// lose them, so it refuses to pause.
+func (p *Pipeline) Pause() error {
+	if p.outbox == nil {
+		return fmt.Errorf("sink %s has no outbox, pausing it would lose its events", p.name)
+	}
+	p.held.Store(true)
+	return nil
+}
+
+func (p *Pipeline) Resume() { p.held.Store(false) }
+
+func (p *Pipeline) Name() string { return p.name }
+
+func (p *Pipeline) Filter() FilterConfig { return *p.filter.Load() }
+
+// SetFilter replaces the events the sink is sent from now on.
+func (p *Pipeline) SetFilter(filter FilterConfig) { p.filter.Store(&filter) }
+
+// Close stops the pipeline, moving queued events to the outbox, and waits
+// for it to finish.
+func (p *Pipeline) Close() error {
+	p.cancel()
+	<-p.done
+	if p.outbox != nil {
+		<-p.spilled
+		return p.outbox.Close()
+	}
+	return nil
+}
+
+// sleep waits for d and reports false if the pipeline is shutting down.
+func (p *Pipeline) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+func (p *Pipeline) deliver(queued queuedEvent) error {
+	payload, id, err := p.encode(queued)
+	if err != nil {
+		return err
+	}
+	return p.sink.Deliver(p.ctx, payload, p.encoder.ContentType(), id)
+}
+
+func (p *Pipeline) encode(queued queuedEvent) ([]byte, string, error) {
+	record := eventRecord(queued.event)
+	id := eventID(record)
+	record["eventId"] = id
+	record["serverBlock"] = queued.serverBlock
+	if !p.envelope {
+		record["receivedAt"] = queued.receivedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if alert, ok := queued.event.(*AlertEvent); ok && p.language != "" {
+		record["message"] = localizedMessage(alert, p.language)
+	}
+	record = redact(p.transform.Apply(record), p.redact)
+	if p.envelope {
+		record = p.origin.Envelope(queued.source, queued.receivedAt, record)
+	}
+	payload, err := p.encoder.Encode(record)
+	if err != nil {
+		return nil, "", fmt.Errorf("encode: %v", err)
+	}
+	return payload, id, nil
+}
+
+// spill moves an event the sink could not take to the outbox, if any.
+func (p *Pipeline) spill(queued queuedEvent) {
+	if p.outbox == nil {
+		return
+	}
+	payload, id, err := p.encode(queued)
+	if err == nil {
+		err = p.outbox.Add(OutboxEntry{
+			ID:          id,
+			Event:       queued.event.EventName(),
+			ContentType: p.encoder.ContentType(),
+			Payload:     payload,
+			At:          queued.receivedAt,
+		})
+	}
+	if err != nil {
+		color.Red("Sink %s outbox error, dropping %s: %v", p.name, queued.event.EventName(), err)
+	}
+}
+
+// flushOutbox retries the outbox unless the sink is paused.
+func (p *Pipeline) flushOutbox() {
+	if p.paused() || p.outbox.Len() == 0 {
+		return
+	}
+	sent, err := p.outbox.Flush(func(entry OutboxEntry) error {
+		return p.sink.Deliver(p.ctx, entry.Payload, entry.ContentType, entry.ID)
+	})
+	p.redelivered.Add(int64(sent))
+	if sent > 0 {
+		color.Green("Sink %s delivered %d events from its outbox", p.name, sent)
+	}
+	if err != nil {
+		color.Yellow("Sink %s outbox retry failed, %d left: %v", p.name, p.outbox.Len(), err)
+	}
+}
+
+func registerSinkMetrics(metrics *Metrics, pipelines []*Pipeline) {
+	for _, p := range pipelines {
+		label := fmt.Sprintf("{sink=%q}", p.name)
+		metrics.Counter("moon_sink_delivered_total"+label, "Events delivered by the sink.",
+			func() float64 { return float64(p.delivered.Load()) })
+		metrics.Counter("moon_sink_failed_total"+label, "Events the sink failed to deliver after retries.",
+			func() float64 { return float64(p.failed.Load()) })
+		metrics.Counter("moon_sink_dropped_total"+label, "Events dropped on a full queue or while paused.",
+			func() float64 { return float64(p.dropped.Load()) })
+		metrics.Counter("moon_sink_panics_total"+label, "Panics recovered in the sink.",
+			func() float64 { return float64(p.panics.Load()) })
+		metrics.Gauge("moon_sink_queue_length"+label, "Events waiting in the sink queue.",
+			func() float64 { return float64(len(p.queue)) })
+		if p.outbox != nil {
+			metrics.Gauge("moon_sink_outbox_length"+label, "Undelivered events waiting in the sink outbox.",
+				func() float64 { return float64(p.outbox.Len()) })
+			metrics.Counter("moon_sink_outbox_delivered_total"+label, "Events delivered from the sink outbox.",
+				func() float64 { return float64(p.redelivered.Load()) })
+		}
+	}
+}
+
+// renamedFields is the CSV column order after renaming.
+func renamedFields(t TransformConfig) []string {
+	fields := make([]string, len(t.Fields))
+	for i, field := range t.Fields {
+		if to, ok := t.Rename[field]; ok {
+			field = to
+		}
+		fields[i] = field
+	}
+	return fields
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ExitRule closes a position when price crosses a level. Levels are given
+// either as Percent relative to entry (or to the peak for trailing stops)
+// or as an absolute Price.
+type ExitRule struct {
+	Kind    string  `json:"kind"` // stop_loss, take_profit or trailing_stop
+	Percent float64 `json:"percent,omitempty"`
+	Price   float64 `json:"price,omitempty"`
+}
+
+func (r ExitRule) Validate() error {
+	switch r.Kind {
+	case "stop_loss", "take_profit":
+		if r.Percent <= 0 && r.Price <= 0 {
+			return fmt.Errorf("%s needs percent or price", r.Kind)
+		}
+	case "trailing_stop":
+		if r.Percent <= 0 || r.Percent >= 100 {
+			return errors.New("trailing_stop needs percent in (0, 100)")
+		}
+	default:
+		return fmt.Errorf("unknown exit rule: %q", r.Kind)
+	}
+	return nil
+}
+
+// Triggered reports whether the rule fires at price for a position that
+// entered at entry and has peaked at peak since.
+func (r ExitRule) Triggered(price, entry, peak float64) bool {
+	switch r.Kind {
+	case "stop_loss":
+		if r.Price > 0 {
+			return price <= r.Price
+		}
+		return price <= entry*(1-r.Percent/100)
+	case "take_profit":
+		if r.Price > 0 {
+			return price >= r.Price
+		}
+		return price >= entry*(1+r.Percent/100)
+	case "trailing_stop":
+		return price <= peak*(1-r.Percent/100)
+	}
+	return false
+}
+
+func (r ExitRule) String() string {
+	if r.Price > 0 {
+		return fmt.Sprintf("%s at %g", r.Kind, r.Price)
+	}
+	return fmt.Sprintf("%s %g%%", r.Kind, r.Percent)
+}
+
+type PositionStatus string
+
+const (
+	PositionOpening PositionStatus = "opening"
+	PositionOpen    PositionStatus = "open"
+	PositionClosing PositionStatus = "closing"
+	PositionClosed  PositionStatus = "closed"
+)
+
+type Position struct {
+	ID          int            `json:"id"`
+	PairAddress string         `json:"pairAddress"`
+	TokenSymbol string         `json:"tokenSymbol"`
+	Mode        string         `json:"mode"`
+	Status      PositionStatus `json:"status"`
+	Reason      string         `json:"reason"`
+	Exits       []ExitRule     `json:"exits"`
+
+	// CostLamports is what the entry spent and Tokens what it bought.
+	// RequestedLamports is the entry's order size, counted while the
+	// position is opening.
+	CostLamports      uint64    `json:"costLamports"`
+	RequestedLamports uint64    `json:"requestedLamports,omitempty"`
+	Tokens            uint64    `json:"tokens"`
+	EntryPrice        float64   `json:"entryPrice"`
+	EntryAt           time.Time `json:"entryAt"`
+	PeakPrice         float64   `json:"peakPrice"`
+	LastPrice         float64   `json:"lastPrice"`
+	// LastPriceAt is when LastPrice was observed; Stale is set on copies
+	// handed out once it is older than -stale-price.
+	LastPriceAt time.Time `json:"lastPriceAt,omitempty"`
+	Stale       bool      `json:"stale,omitempty"`
+
+	ExitRule         string    `json:"exitRule,omitempty"`
+	ExitPrice        float64   `json:"exitPrice,omitempty"`
+	ExitAt           time.Time `json:"exitAt,omitempty"`
+	ProceedsLamports uint64    `json:"proceedsLamports,omitempty"`
+
+	// Fees are network fees in lamports; slippage is the fraction of the
+	// quoted output lost on the fill.
+	EntryFee      uint64        `json:"entryFee,omitempty"`
+	ExitFee       uint64        `json:"exitFee,omitempty"`
+	EntrySlippage float64       `json:"entrySlippage,omitempty"`
+	ExitSlippage  float64       `json:"exitSlippage,omitempty"`
+	EntryContext  MarketContext `json:"entryContext"`
+}
+
+// committedLamports is what the position ties up: its order size until
+// the entry fills, then the entry's cost.
+// realizedLamports is what a closed position made or lost in lamports,
+// net of the network fees paid on entry and exit.
+func (p *Position) realizedLamports() int64 {
+	return int64(p.ProceedsLamports) - int64(p.CostLamports) - int64(p.EntryFee+p.ExitFee)
+}
+
+func (p *Position) committedLamports() uint64 {
+	if p.Status == PositionOpening {
+		return p.RequestedLamports
+	}
+	return p.CostLamports
+}
+
+// PnL is the return since entry at the last known price, or the realized
+// return net of network fees once closed.
+func (p *Position) PnL() float64 {
+	if p.Status == PositionClosed && p.CostLamports > 0 {
+		return float64(p.realizedLamports()) / float64(p.CostLamports)
+	}
+	if p.EntryPrice <= 0 {
+		return 0
+	}
+	return p.LastPrice/p.EntryPrice - 1
+}
+
+type PositionOpenedEvent struct {
+	Position Position
+}
+
+func (e *PositionOpenedEvent) EventName() string { return "position_opened" }
+
+type PositionClosedEvent struct {
+	Position Position
+	PnL      float64
+}
+
+func (e *PositionClosedEvent) EventName() string { return "position_closed" }
+
+// AlertEvent is a human-facing notification for sinks and the console.
+// ID is assigned by AlertControl when alert controls are enabled.
+type AlertEvent struct {
+	sourced
+	ID          int       `json:"id"`
+	Kind        string    `json:"kind"`
+	PairAddress string    `json:"pairAddress,omitempty"`
+	TokenSymbol string    `json:"tokenSymbol,omitempty"`
+	Message     string    `json:"message"`
+	At          time.Time `json:"at"`
+	// Tags and Note are copied from the pair's notes.
+	Tags []string `json:"tags,omitempty"`
+	Note string   `json:"note,omitempty"`
+	// IconURL is the public URL of the token's icon, when cached.
+	IconURL string `json:"iconUrl,omitempty"`
+	// Fields is the record of the event a rule fired on, and Messages the
+	// alert rendered in the languages in use; both are for localization.
+	Fields   Record            `json:"-"`
+	Messages map[string]string `json:"-"`
+}
+
+func (e *AlertEvent) EventName() string { return "alert" }
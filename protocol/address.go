@@ -0,0 +1,99 @@
+package protocol
+
+import (
+	"errors"
+	"math/big"
+)
+
+// ErrMisaligned is returned by CheckPairs when the address regions of a
+// frame look like they were read from the wrong offsets.
+var ErrMisaligned = errors.New("pair addresses look misaligned")
+
+var (
+	curveP = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	// curveD is -121665/121666 mod p.
+	curveD, _ = new(big.Int).SetString("37095705934669439343138083508754565189542113879843219016388785533085940283555", 10)
+	// legendreExp is (p-1)/2.
+	legendreExp = new(big.Int).Rsh(new(big.Int).Sub(curveP, big.NewInt(1)), 1)
+)
+
+// OnCurve reports whether addr decodes to a point on the ed25519 curve.
+// Wallet addresses are on the curve; program-derived addresses, which
+// most pair accounts are, are off it by construction, so this is a
+// property to record rather than a validity check.
+func OnCurve(addr [32]byte) bool {
+	le := addr
+	le[31] &= 0x7f
+	for i, j := 0, 31; i < j; i, j = i+1, j-1 {
+		le[i], le[j] = le[j], le[i]
+	}
+	y := new(big.Int).SetBytes(le[:])
+	if y.Cmp(curveP) >= 0 {
+		return false
+	}
+
+	// x^2 = (y^2 - 1) / (d*y^2 + 1)
+	y2 := new(big.Int).Mul(y, y)
+	y2.Mod(y2, curveP)
+	u := new(big.Int).Sub(y2, big.NewInt(1))
+	v := new(big.Int).Mul(curveD, y2)
+	v.Add(v, big.NewInt(1))
+	v.ModInverse(v.Mod(v, curveP), curveP)
+	x2 := u.Mul(u, v)
+	x2.Mod(x2, curveP)
+	if x2.Sign() == 0 {
+		return addr[31]&0x80 == 0
+	}
+	return new(big.Int).Exp(x2, legendreExp, curveP).Cmp(big.NewInt(1)) == 0
+}
+
+// SuspectAddress returns why addr does not look like a hash-derived
+// Solana address, or "" if it does. Real addresses are uniformly random
+// bytes; text, zero runs and repeated bytes mean the decoder is reading
+// the wrong region.
+func SuspectAddress(addr [32]byte) string {
+	var printable, zeroRun, longestZeroRun, distinct int
+	var seen [256]bool
+	for _, b := range addr {
+		if b >= 0x20 && b < 0x7f {
+			printable++
+		}
+		if b == 0 {
+			zeroRun++
+			longestZeroRun = max(longestZeroRun, zeroRun)
+		} else {
+			zeroRun = 0
+		}
+		if !seen[b] {
+			seen[b] = true
+			distinct++
+		}
+	}
+
+	switch {
+	case longestZeroRun == 32:
+		return "all zero"
+	case longestZeroRun >= 6:
+		return "zero run"
+	case printable >= 28:
+		return "text"
+	case distinct < 12:
+		return "low variety"
+	}
+	return ""
+}
+
+// CheckPairs returns ErrMisaligned if more than half of the pair addresses
+// in m are suspect.
+func CheckPairs(m *PairsMessage) error {
+	var suspect int
+	for _, pair := range m.Pairs {
+		if SuspectAddress(pair.PairAddress) != "" {
+			suspect++
+		}
+	}
+	if len(m.Pairs) > 0 && suspect*2 > len(m.Pairs) {
+		return ErrMisaligned
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// maxFrameSize bounds length prefixes so a corrupt recording cannot make
+// the decoder allocate gigabytes.
+const maxFrameSize = 64 << 20
+
+// FrameReader yields raw frames one at a time, returning io.EOF when
+// there are no more. Websocket connections, recordings and test fixtures
+// all fit behind it.
+type FrameReader interface {
+	ReadFrame() ([]byte, error)
+}
+
+// Decoder yields decoded messages one at a time from a FrameReader.
+type Decoder struct {
+	frames FrameReader
+	frame  []byte
+}
+
+// NewDecoder reads length-prefixed frames from r, as written by WriteFrame.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{frames: &lengthPrefixed{r: r}}
+}
+
+// NewFrameDecoder decodes frames from any FrameReader.
+func NewFrameDecoder(frames FrameReader) *Decoder {
+	return &Decoder{frames: frames}
+}
+
+// Next returns the next message. Errors from the FrameReader, including
+// io.EOF, end the stream; a frame that fails to parse returns its error
+// but the following call moves on to the next frame.
+func (d *Decoder) Next() (interface{}, error) {
+	frame, err := d.frames.ReadFrame()
+	if err != nil {
+		d.frame = nil
+		return nil, err
+	}
+	d.frame = frame
+	return Parse(frame)
+}
+
+// Frame returns the raw bytes of the message last returned by Next.
+func (d *Decoder) Frame() []byte {
+	return d.frame
+}
+
+// WriteFrame writes frame with a little-endian uint32 length prefix.
+func WriteFrame(w io.Writer, frame []byte) error {
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(frame)))
+	if _, err := w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+type lengthPrefixed struct {
+	r io.Reader
+}
+
+func (l *lengthPrefixed) ReadFrame() ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(l.r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(size[:])
+	if n > maxFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes exceeds limit", n)
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(l.r, frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return frame, nil
+}
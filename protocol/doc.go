@@ -0,0 +1,9 @@
+// Package protocol decodes the binary frames of the dexscreener pairs
+// websocket (wss://io.dexscreener.com/dex/screener/v4/pairs/...).
+//
+// Parse takes one frame and returns a *LatestBlockHashMessage,
+// *PairsMessage or *PingMessage. Inspect does the same and also reports
+// where the decoder had to guess; Fields records how far each decoded
+// field can be trusted. The package has no dependencies beyond
+// the standard library and does no logging.
+package protocol
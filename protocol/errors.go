@@ -0,0 +1,47 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrEmptyFrame        = errors.New("empty frame")
+	ErrTruncatedFrame    = errors.New("truncated frame")
+	ErrMissingTerminator = errors.New("missing string terminator")
+)
+
+// ParseError locates a decoding failure within a frame. It wraps
+// ErrTruncatedFrame or ErrMissingTerminator.
+type ParseError struct {
+	// Struct is the structure being decoded, e.g. "PairData".
+	Struct string
+	// Offset is the byte offset in the frame where decoding failed.
+	Offset int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s at offset %d: %v", e.Struct, e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// ErrUnknownMessageType is returned for frames whose first byte is not a
+// known MessageType.
+type ErrUnknownMessageType struct {
+	Type MessageType
+}
+
+func (e ErrUnknownMessageType) Error() string {
+	return fmt.Sprintf("unknown message type: 0x%02x", byte(e.Type))
+}
+
+// shift moves a ParseError from a sub-slice to frame offsets.
+func shift(err error, by int) error {
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		pe.Offset += by
+	}
+	return err
+}
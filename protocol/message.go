@@ -0,0 +1,254 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	"github.com/piotrostr/moon/base58"
+)
+
+type MessageType byte
+
+const (
+	LatestBlockHashMessageType MessageType = 0x02
+	PairsMessageType           MessageType = 0x00
+	PingMessageType            MessageType = 0x22 // New message type
+)
+
+type LatestBlockHashMessage struct {
+	Version     string
+	Endpoint    string
+	LatestBlock uint32
+	Hash        [32]byte
+}
+
+type PingMessage struct {
+	Content string
+}
+
+func (m *PingMessage) UnmarshalBinary(data []byte) error {
+	m.Content = string(data)
+	return nil
+}
+
+func (m *LatestBlockHashMessage) UnmarshalBinary(data []byte) error {
+	return m.unmarshal(data, nil)
+}
+
+func (m *LatestBlockHashMessage) unmarshal(data []byte, ws *warnings) error {
+	if len(data) < 36 {
+		return &ParseError{Struct: "LatestBlockHashMessage", Offset: len(data), Err: ErrTruncatedFrame}
+	}
+
+	versionEnd := bytes.IndexByte(data[2:], 0)
+	if versionEnd == -1 {
+		return &ParseError{Struct: "LatestBlockHashMessage.Version", Offset: 2, Err: ErrMissingTerminator}
+	}
+	m.Version = intern(data[2 : 2+versionEnd])
+
+	endpointStart := 2 + versionEnd + 1
+	endpointEnd := bytes.IndexByte(data[endpointStart:], 0)
+	if endpointEnd == -1 {
+		m.Endpoint = ""
+	} else {
+		m.Endpoint = string(data[endpointStart : endpointStart+endpointEnd])
+	}
+
+	hashStart := len(data) - 36
+	if ws != nil {
+		ws.checkString("LatestBlockHashMessage.Version", 2, m.Version)
+		stringsEnd := endpointStart
+		if endpointEnd != -1 {
+			ws.checkString("LatestBlockHashMessage.Endpoint", endpointStart, m.Endpoint)
+			stringsEnd = endpointStart + endpointEnd + 1
+		}
+		switch {
+		case hashStart < stringsEnd:
+			ws.add("LatestBlockHashMessage.LatestBlock", hashStart, HeuristicTrailingHash, "trailing 36 bytes overlap the strings ending at %d", stringsEnd)
+		case hashStart > stringsEnd:
+			ws.add("LatestBlockHashMessage.LatestBlock", stringsEnd, HeuristicTrailingHash, "%d unexplained bytes before the trailing 36", hashStart-stringsEnd)
+		}
+	}
+	m.LatestBlock = binary.LittleEndian.Uint32(data[hashStart : hashStart+4])
+	copy(m.Hash[:], data[hashStart+4:])
+
+	return nil
+}
+
+type PairsMessage struct {
+	Version string
+	Pairs   []PairData
+}
+
+type PairData struct {
+	PairAddress     [32]byte
+	UnknownData     [32]byte
+	TokenName       string
+	TokenSymbol     string
+	BaseTokenSymbol string
+	Price           float64
+	Volume          float64
+}
+
+func (m *PairsMessage) UnmarshalBinary(data []byte) error {
+	return m.unmarshal(data, nil)
+}
+
+func (m *PairsMessage) unmarshal(data []byte, ws *warnings) error {
+	if len(data) < 11 {
+		return &ParseError{Struct: "PairsMessage", Offset: len(data), Err: ErrTruncatedFrame}
+	}
+
+	versionEnd := bytes.IndexByte(data[2:], 0)
+	if versionEnd == -1 {
+		return &ParseError{Struct: "PairsMessage.Version", Offset: 2, Err: ErrMissingTerminator}
+	}
+	m.Version = intern(data[2 : 2+versionEnd])
+	if ws != nil {
+		ws.checkString("PairsMessage.Version", 2, m.Version)
+	}
+
+	offset := 2 + versionEnd + 1
+	pairsData := data[offset:]
+	// the frame has no pair count; this bounds it from above
+	m.Pairs = make([]PairData, 0, len(pairsData)/minPairSize)
+
+	for len(pairsData) >= 64 {
+		var from int
+		if ws != nil {
+			from = len(*ws)
+		}
+		// decode in place rather than copying a 128-byte PairData
+		m.Pairs = append(m.Pairs, PairData{})
+		bytesRead, err := m.Pairs[len(m.Pairs)-1].unmarshal(pairsData, ws)
+		if err != nil {
+			m.Pairs = m.Pairs[:len(m.Pairs)-1]
+			return shift(err, offset)
+		}
+		if ws != nil {
+			ws.shift(from, offset)
+		}
+		pairsData = pairsData[bytesRead:]
+		offset += bytesRead
+	}
+
+	if ws != nil && len(pairsData) > 0 {
+		ws.add("PairData", offset, HeuristicTrailingBytes, "%d bytes left over, too short for a pair", len(pairsData))
+	}
+	return nil
+}
+
+// Address is the pair address in base58, as used by explorers and wallets.
+func (p *PairData) Address() string {
+	return base58.Encode(p.PairAddress[:])
+}
+
+func (p *PairData) UnmarshalBinary(data []byte) (int, error) {
+	return p.unmarshal(data, nil)
+}
+
+func (p *PairData) unmarshal(data []byte, ws *warnings) (int, error) {
+	if len(data) < 64 {
+		return 0, &ParseError{Struct: "PairData", Offset: len(data), Err: ErrTruncatedFrame}
+	}
+
+	copy(p.PairAddress[:], data[:32])
+	copy(p.UnknownData[:], data[32:64])
+
+	nameEnd := bytes.IndexByte(data[64:], 0)
+	if nameEnd == -1 {
+		return 0, &ParseError{Struct: "PairData.TokenName", Offset: 64, Err: ErrMissingTerminator}
+	}
+	symbolStart := 64 + nameEnd + 1
+	symbolEnd := bytes.IndexByte(data[symbolStart:], 0)
+	if symbolEnd == -1 {
+		return 0, &ParseError{Struct: "PairData.TokenSymbol", Offset: symbolStart, Err: ErrMissingTerminator}
+	}
+	baseStart := symbolStart + symbolEnd + 1
+	baseEnd := bytes.IndexByte(data[baseStart:], 0)
+	if baseEnd == -1 {
+		return 0, &ParseError{Struct: "PairData.BaseTokenSymbol", Offset: baseStart, Err: ErrMissingTerminator}
+	}
+
+	// one allocation for name and symbol; base symbols repeat, so they
+	// are interned
+	text := string(data[64 : symbolStart+symbolEnd])
+	p.TokenName = text[:nameEnd]
+	p.TokenSymbol = text[nameEnd+1:]
+	p.BaseTokenSymbol = intern(data[baseStart : baseStart+baseEnd])
+	current := baseStart + baseEnd + 1
+
+	if len(data[current:]) < 16 {
+		return 0, &ParseError{Struct: "PairData.Price", Offset: len(data), Err: ErrTruncatedFrame}
+	}
+
+	p.Price = math.Float64frombits(binary.LittleEndian.Uint64(data[current:]))
+	p.Volume = math.Float64frombits(binary.LittleEndian.Uint64(data[current+8:]))
+
+	if ws != nil {
+		if reason := SuspectAddress(p.PairAddress); reason != "" {
+			ws.add("PairData.PairAddress", 0, HeuristicAddress, "looks like %s", reason)
+		}
+		start := 64
+		for _, f := range []struct{ name, value string }{
+			{"PairData.TokenName", p.TokenName},
+			{"PairData.TokenSymbol", p.TokenSymbol},
+			{"PairData.BaseTokenSymbol", p.BaseTokenSymbol},
+		} {
+			ws.checkString(f.name, start, f.value)
+			start += len(f.value) + 1
+		}
+		ws.checkFloat("PairData.Price", current, p.Price)
+		ws.checkFloat("PairData.Volume", current+8, p.Volume)
+	}
+
+	return current + 16, nil
+}
+
+// minPairSize is a pair with empty strings: two addresses, three
+// terminators and two floats.
+const minPairSize = 64 + 3 + 16
+
+// interned holds strings that repeat in almost every frame.
+var interned = map[string]string{
+	"SOL": "SOL", "WSOL": "WSOL", "USDC": "USDC", "USDT": "USDT", "ETH": "ETH", "WETH": "WETH",
+	"v4": "v4", "": "",
+}
+
+// intern returns b as a string without allocating when it is a common one.
+func intern(b []byte) string {
+	if s, ok := interned[string(b)]; ok {
+		return s
+	}
+	return string(b)
+}
+
+// Parse decodes one binary frame into a *LatestBlockHashMessage,
+// *PairsMessage or *PingMessage.
+func Parse(message []byte) (interface{}, error) {
+	return parse(message, nil)
+}
+
+func parse(message []byte, ws *warnings) (interface{}, error) {
+	if len(message) == 0 {
+		return nil, ErrEmptyFrame
+	}
+
+	switch MessageType(message[0]) {
+	case LatestBlockHashMessageType:
+		var lbhm LatestBlockHashMessage
+		err := lbhm.unmarshal(message, ws)
+		return &lbhm, err
+	case PairsMessageType:
+		var pm PairsMessage
+		err := pm.unmarshal(message, ws)
+		return &pm, err
+	case PingMessageType:
+		var ping PingMessage
+		err := ping.UnmarshalBinary(message)
+		return &ping, err
+	default:
+		return nil, ErrUnknownMessageType{Type: MessageType(message[0])}
+	}
+}
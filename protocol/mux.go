@@ -0,0 +1,49 @@
+package protocol
+
+// Mux decodes frames and calls the handlers registered for their message
+// type, so callers need no type switch over Parse results. Register
+// handlers before dispatching; Mux is not safe for concurrent
+// registration.
+type Mux struct {
+	pairs     []func(*PairsMessage)
+	blockHash []func(*LatestBlockHashMessage)
+	ping      []func(*PingMessage)
+	unknown   []func(frame []byte, err error)
+}
+
+func (m *Mux) OnPairs(fn func(*PairsMessage)) { m.pairs = append(m.pairs, fn) }
+
+func (m *Mux) OnBlockHash(fn func(*LatestBlockHashMessage)) { m.blockHash = append(m.blockHash, fn) }
+
+func (m *Mux) OnPing(fn func(*PingMessage)) { m.ping = append(m.ping, fn) }
+
+// OnUnknown receives frames that failed to parse, with the parse error.
+func (m *Mux) OnUnknown(fn func(frame []byte, err error)) { m.unknown = append(m.unknown, fn) }
+
+// Dispatch parses frame and runs its handlers. It returns the parse error,
+// if any, after passing it to the OnUnknown handlers.
+func (m *Mux) Dispatch(frame []byte) error {
+	msg, err := Parse(frame)
+	if err != nil {
+		for _, fn := range m.unknown {
+			fn(frame, err)
+		}
+		return err
+	}
+
+	switch msg := msg.(type) {
+	case *PairsMessage:
+		for _, fn := range m.pairs {
+			fn(msg)
+		}
+	case *LatestBlockHashMessage:
+		for _, fn := range m.blockHash {
+			fn(msg)
+		}
+	case *PingMessage:
+		for _, fn := range m.ping {
+			fn(msg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+// Confidence is how sure the decoder is of a field's meaning. The format
+// is reverse-engineered, so only some fields have been checked against
+// dexscreener's own pages.
+type Confidence int
+
+const (
+	// Confirmed fields match what dexscreener shows for the same pair.
+	Confirmed Confidence = iota
+	// Inferred fields are consistent across recordings but unconfirmed.
+	Inferred
+	// Guessed fields rest on a positional assumption.
+	Guessed
+)
+
+func (c Confidence) String() string {
+	switch c {
+	case Confirmed:
+		return "confirmed"
+	case Inferred:
+		return "inferred"
+	default:
+		return "guessed"
+	}
+}
+
+// Field records where a decoded field comes from and how far to trust it.
+type Field struct {
+	Name       string
+	Confidence Confidence
+	Basis      string
+}
+
+// Fields lists every decoded field, by message, in frame order.
+var Fields = []Field{
+	{"LatestBlockHashMessage.Version", Confirmed, "null-terminated string after the 2-byte header"},
+	{"LatestBlockHashMessage.Endpoint", Inferred, "second null-terminated string, missing in some frames"},
+	{"LatestBlockHashMessage.LatestBlock", Guessed, "little-endian u32 assumed to start 36 bytes before the end of the frame"},
+	{"LatestBlockHashMessage.Hash", Guessed, "assumed to be the last 32 bytes of the frame"},
+	{"PairsMessage.Version", Confirmed, "null-terminated string after the 2-byte header"},
+	{"PairData.PairAddress", Confirmed, "first 32 bytes of a pair, matches dexscreener pair URLs"},
+	{"PairData.UnknownData", Guessed, "32 undecoded bytes, see moon unknown"},
+	{"PairData.TokenName", Inferred, "null-terminated string; the boundary is the first zero byte"},
+	{"PairData.TokenSymbol", Inferred, "null-terminated string; the boundary is the first zero byte"},
+	{"PairData.BaseTokenSymbol", Inferred, "null-terminated string; the boundary is the first zero byte"},
+	{"PairData.Price", Inferred, "little-endian f64 right after the strings"},
+	{"PairData.Volume", Guessed, "little-endian f64 after the price, units unconfirmed"},
+}
+
+// FieldConfidence returns the confidence of a field named like
+// "PairData.Price", or Guessed for fields not in Fields.
+func FieldConfidence(name string) Confidence {
+	for _, f := range Fields {
+		if f.Name == name {
+			return f.Confidence
+		}
+	}
+	return Guessed
+}
+
+// Heuristics whose assumptions a Warning reports as shaky.
+const (
+	HeuristicStringBoundary = "string-boundary"
+	HeuristicTrailingHash   = "trailing-hash"
+	HeuristicTrailingBytes  = "trailing-bytes"
+	HeuristicAddress        = "address"
+)
+
+// maxPlausibleString is longer than any token name seen in the feed; a
+// longer string most likely ran past its real terminator.
+const maxPlausibleString = 64
+
+// Warning reports a heuristic that fired on ambiguous data: the frame
+// decoded, but Field may hold the wrong bytes.
+type Warning struct {
+	Field     string
+	Offset    int
+	Heuristic string
+	Detail    string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s at offset %d (%s, %s): %s", w.Field, w.Offset, w.Heuristic, FieldConfidence(w.Field), w.Detail)
+}
+
+// warnings collects Warnings during decoding. A nil *warnings skips the
+// checks entirely, which is what Parse does.
+type warnings []Warning
+
+func (ws *warnings) add(field string, offset int, heuristic, format string, args ...any) {
+	*ws = append(*ws, Warning{Field: field, Offset: offset, Heuristic: heuristic, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (ws *warnings) checkString(field string, offset int, s string) {
+	switch {
+	case len(s) > maxPlausibleString:
+		ws.add(field, offset, HeuristicStringBoundary, "%d bytes long, terminator probably missed", len(s))
+	case !utf8.ValidString(s):
+		ws.add(field, offset, HeuristicStringBoundary, "invalid UTF-8, likely read from binary data")
+	default:
+		for _, r := range s {
+			if r < 0x20 {
+				ws.add(field, offset, HeuristicStringBoundary, "control byte 0x%02x, likely read from binary data", r)
+				break
+			}
+		}
+	}
+}
+
+func (ws *warnings) checkFloat(field string, offset int, v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) || v < 0 || (v != 0 && math.Abs(v) < 1e-300) {
+		ws.add(field, offset, HeuristicStringBoundary, "implausible value %g, the string boundaries before it are likely off", v)
+	}
+}
+
+// shift moves warnings from a sub-slice to frame offsets.
+func (ws *warnings) shift(from, by int) {
+	for i := from; i < len(*ws); i++ {
+		(*ws)[i].Offset += by
+	}
+}
+
+// Inspect decodes frame like Parse and also returns a Warning for every
+// heuristic that fired on ambiguous data.
+func Inspect(frame []byte) (interface{}, []Warning, error) {
+	ws := warnings{}
+	msg, err := parse(frame, &ws)
+	return msg, ws, err
+}
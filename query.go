@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// duckdbReader picks the DuckDB table function for a data file.
+func duckdbReader(path string) string {
+	switch filepath.Ext(path) {
+	case ".parquet":
+		return "read_parquet"
+	case ".csv":
+		return "read_csv_auto"
+	default:
+		return "read_json_auto"
+	}
+}
+
+// queryView is a view over one of moon's data files.
+type queryView struct {
+	name, path string
+}
+
+// runQuery implements `moon query "SELECT ..."`. It runs the SQL in DuckDB
+// with views over moon's data files: embedded when built with -tags duckdb,
+// which needs cgo, and otherwise through the duckdb CLI.
+func runQuery(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	format := fs.String("format", "table", "output format: table or csv")
+	tombstonePath := fs.String("tombstones", "tombstones.jsonl", "tombstone file exposed as the tombstones view")
+	journalPath := fs.String("journal", "trades.jsonl", "trade journal exposed as the trades view")
+	snapshotDir := fs.String("snapshots", "snapshots", "snapshot directory exposed as the snapshots view")
+	holderPath := fs.String("holders", "holders.jsonl", "holder samples exposed as the holders view")
+	run := queryEngine(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New(`usage: moon query [flags] "SELECT ..."`)
+	}
+	if *format != "table" && *format != "csv" {
+		return fmt.Errorf("unknown format: %q", *format)
+	}
+
+	// views whose backing file does not exist yet are skipped
+	var views []queryView
+	for _, view := range []queryView{
+		{"tombstones", *tombstonePath},
+		{"trades", *journalPath},
+		{"holders", *holderPath},
+	} {
+		if fileExists(view.path) {
+			views = append(views, view)
+		}
+	}
+	if paths, err := snapshotFiles(*snapshotDir); err == nil && len(paths) > 0 {
+		views = append(views, queryView{"snapshots", filepath.Join(*snapshotDir, "*.jsonl")})
+	}
+	return run(createViews(views), fs.Arg(0), *format)
+}
+
+// createViews is the SQL creating views.
+func createViews(views []queryView) string {
+	var script strings.Builder
+	for _, view := range views {
+		quoted := strings.ReplaceAll(view.path, "'", "''")
+		fmt.Fprintf(&script, "CREATE VIEW %s AS SELECT * FROM %s('%s');\n", view.name, duckdbReader(view.path), quoted)
+	}
+	return script.String()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,33 @@
+//go:build !duckdb
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// queryEngine registers the flags of the duckdb CLI engine on fs and
+// returns the func running a query with it. Building with -tags duckdb
+// embeds DuckDB instead.
+func queryEngine(fs *flag.FlagSet) func(views, query, format string) error {
+	duckdbPath := fs.String("duckdb", "duckdb", "path to the duckdb CLI")
+	return func(views, query, format string) error {
+		if _, err := exec.LookPath(*duckdbPath); err != nil {
+			return fmt.Errorf("duckdb CLI not found (install it, pass -duckdb or build with -tags duckdb): %v", err)
+		}
+		modeFlag := "-box"
+		if format == "csv" {
+			modeFlag = "-csv"
+		}
+		cmd := exec.Command(*duckdbPath, modeFlag, "-c", views+query)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("query failed: %v", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,109 @@
+//go:build duckdb
+
+// The duckdb build (CGO_ENABLED=1 go build -tags duckdb) links DuckDB into
+// moon, so `moon query` needs no duckdb CLI.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"reflect"
+	"time"
+
+	_ "github.com/marcboeker/go-duckdb"
+)
+
+// queryEngine returns the func running a query in embedded DuckDB.
+func queryEngine(*flag.FlagSet) func(views, query, format string) error {
+	return func(views, query, format string) error {
+		db, err := sql.Open("duckdb", "")
+		if err != nil {
+			return fmt.Errorf("open duckdb: %v", err)
+		}
+		defer db.Close()
+		// views belong to the connection, so keep to one
+		db.SetMaxOpenConns(1)
+		if views != "" {
+			if _, err := db.Exec(views); err != nil {
+				return fmt.Errorf("create views: %v", err)
+			}
+		}
+
+		rows, err := db.Query(query)
+		if err != nil {
+			return fmt.Errorf("query failed: %v", err)
+		}
+		defer rows.Close()
+		header, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+		var table [][]string
+		values := make([]any, len(header))
+		pointers := make([]any, len(header))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(pointers...); err != nil {
+				return fmt.Errorf("query failed: %v", err)
+			}
+			row := make([]string, len(values))
+			for i, value := range values {
+				row[i] = formatSQLValue(value)
+			}
+			table = append(table, row)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("query failed: %v", err)
+		}
+
+		if format == "csv" {
+			w := csv.NewWriter(console)
+			w.Write(header)
+			w.WriteAll(table)
+			return w.Error()
+		}
+		right := make([]bool, len(types))
+		for i, t := range types {
+			right[i] = isNumeric(t.ScanType())
+		}
+		for _, line := range renderTable(header, table, right) {
+			fmt.Fprintln(console, line)
+		}
+		return nil
+	}
+}
+
+func formatSQLValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func isNumeric(t reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
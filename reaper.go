@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/piotrostr/moon/base58"
+)
+
+// PairDeadEvent is emitted when a pair is evicted from hot state, either
+// because it stopped updating or because its price collapsed (a rug).
+type PairDeadEvent struct {
+	Tombstone Tombstone
+}
+
+func (e *PairDeadEvent) EventName() string {
+	if e.Tombstone.Rugged {
+		return "rug_detected"
+	}
+	return "pair_dead"
+}
+
+type ReaperConfig struct {
+	// StaleAfter evicts pairs that have not updated for this long.
+	StaleAfter time.Duration
+	// RugDrawdown is the fraction below peak price treated as a rug.
+	RugDrawdown float64
+	// MinPrice treats prices at or below it as collapsed to zero.
+	MinPrice float64
+}
+
+func DefaultReaperConfig() ReaperConfig {
+	return ReaperConfig{
+		StaleAfter:  30 * time.Minute,
+		RugDrawdown: 0.9,
+		MinPrice:    1e-12,
+	}
+}
+
+// Reaper sweeps the PairStore for dead pairs, moves them to StateDead,
+// evicts them and records a tombstone.
+type Reaper struct {
+	config     ReaperConfig
+	store      *PairStore
+	lifecycle  *LifecycleTracker
+	tombstones *TombstoneStore
+	bus        *EventBus
+}
+
+func NewReaper(config ReaperConfig, store *PairStore, lifecycle *LifecycleTracker, tombstones *TombstoneStore, bus *EventBus) *Reaper {
+	return &Reaper{
+		config:     config,
+		store:      store,
+		lifecycle:  lifecycle,
+		tombstones: tombstones,
+		bus:        bus,
+	}
+}
+
+func (r *Reaper) Sweep(now time.Time) {
+	for _, tracked := range r.store.Snapshot() {
+		reason, rugged := r.verdict(tracked, now)
+		if reason == "" {
+			continue
+		}
+		r.reap(tracked, reason, rugged, now)
+	}
+}
+
+func (r *Reaper) verdict(tracked TrackedPair, now time.Time) (string, bool) {
+	if tracked.Price <= r.config.MinPrice {
+		return "price collapsed to zero", true
+	}
+	if tracked.PeakPrice > 0 {
+		drawdown := 1 - tracked.Price/tracked.PeakPrice
+		if drawdown >= r.config.RugDrawdown {
+			return fmt.Sprintf("price %.0f%% below peak", drawdown*100), true
+		}
+	}
+	if idle := now.Sub(tracked.LastSeen); idle >= r.config.StaleAfter {
+		return fmt.Sprintf("no updates for %s", idle.Round(time.Second)), false
+	}
+	return "", false
+}
+
+func (r *Reaper) reap(tracked TrackedPair, reason string, rugged bool, now time.Time) {
+	final, ok := r.store.Remove(tracked.PairAddress)
+	if !ok {
+		return
+	}
+
+	r.lifecycle.Transition(final.PairData, StateDead, reason, now)
+	r.lifecycle.Forget(final.PairAddress)
+
+	tombstone := Tombstone{
+		PairAddress:  base58.Encode(final.PairAddress[:]),
+		TokenName:    final.TokenName,
+		TokenSymbol:  final.TokenSymbol,
+		Reason:       reason,
+		Rugged:       rugged,
+		FirstSeen:    final.FirstSeen,
+		LastSeen:     final.LastSeen,
+		DiedAt:       now,
+		Lifetime:     final.LastSeen.Sub(final.FirstSeen),
+		FirstBlock:   final.FirstSeenBlock,
+		LastBlock:    final.LastSeenBlock,
+		InitialPrice: final.InitialPrice,
+		PeakPrice:    final.PeakPrice,
+		FinalPrice:   final.Price,
+		Volume:       final.Volume,
+	}
+	if final.FirstSeenBlock > 0 && final.LastSeenBlock >= final.FirstSeenBlock {
+		tombstone.LifeBlocks = final.LastSeenBlock - final.FirstSeenBlock
+	}
+	if final.PeakPrice > 0 {
+		tombstone.Drawdown = 1 - final.Price/final.PeakPrice
+	}
+
+	// events keep the base58 address subscribers key pairs by; the file
+	// is a record and follows -hex-addresses
+	if r.tombstones != nil {
+		record := tombstone
+		record.PairAddress = formatAddress(final.PairAddress)
+		if err := r.tombstones.Write(record); err != nil {
+			color.Red("Error writing tombstone: %v", err)
+		}
+	}
+
+	r.bus.Publish(&PairDeadEvent{Tombstone: tombstone})
+}
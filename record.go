@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Record is the flat, encoder-friendly form of an event. Addresses are
+// base58, times RFC 3339 and durations seconds.
+type Record map[string]any
+
+// eventRecord also scrubs resolved secrets from text fields, such as
+// errors quoting a URL with an API key, before the record reaches sinks,
+// rules or the console.
+func eventRecord(event Event) Record {
+	record := Record{"event": event.EventName()}
+	flatten(record, reflect.ValueOf(event))
+	for key, value := range record {
+		if s, ok := value.(string); ok {
+			record[key] = redactSecrets(s)
+		}
+	}
+	return record
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	addressType  = reflect.TypeOf([32]byte{})
+)
+
+// flatten adds v's fields to record, recursing into embedded and nested
+// structs. A nested struct's field whose name is taken by another field
+// is prefixed with the struct's name instead, e.g. orderReason.
+func flatten(record Record, v reflect.Value) {
+	if !v.IsValid() {
+		return
+	}
+	counts := make(map[string]int)
+	for name := range record {
+		counts[name]++
+	}
+	countRecordNames(v.Type(), "", make(map[[2]string]bool), counts)
+	var fields []recordField
+	collectFields(&fields, v, "")
+	for _, f := range fields {
+		record[recordKey(f.prefix, f.name, counts)] = f.value
+	}
+}
+
+// countRecordNames counts the record names of t's fields, nested ones
+// included, so that flatten and the schema rename the same ones. A struct
+// nested twice under one name, like an order also inside its execution,
+// counts once.
+func countRecordNames(t reflect.Type, prefix string, seen map[[2]string]bool, counts map[string]int) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := recordFieldName(field)
+		switch {
+		case field.Anonymous:
+			countRecordNames(field.Type, prefix, seen, counts)
+		case isNestedRecord(field):
+			countRecordNames(field.Type, name, seen, counts)
+		case name != "-" && !seen[[2]string{prefix, name}]:
+			seen[[2]string{prefix, name}] = true
+			counts[name]++
+		}
+	}
+}
+
+// isNestedRecord reports whether field's fields are inlined in the record.
+func isNestedRecord(field reflect.StructField) bool {
+	ft := field.Type
+	return field.Anonymous || (ft.Kind() == reflect.Struct && ft != timeType) ||
+		(ft.Kind() == reflect.Pointer && ft.Elem().Kind() == reflect.Struct)
+}
+
+// recordKey is the key of a field named name from the nested struct
+// prefix, prefixed when the name is taken more than once.
+func recordKey(prefix, name string, counts map[string]int) string {
+	if counts[name] > 1 && prefix != "" {
+		return prefix + strings.ToUpper(name[:1]) + name[1:]
+	}
+	return name
+}
+
+// recordField is a field for a record and the name of the nested struct
+// it came from, empty for the event's own fields and embedded ones.
+type recordField struct {
+	prefix, name string
+	value        any
+}
+
+func collectFields(fields *[]recordField, v reflect.Value, prefix string) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		value := v.Field(i)
+
+		if field.Anonymous {
+			collectFields(fields, value, prefix)
+			continue
+		}
+		if isNestedRecord(field) {
+			collectFields(fields, value, recordFieldName(field))
+			continue
+		}
+
+		name := recordFieldName(field)
+		if name == "-" {
+			continue
+		}
+
+		add := func(value any) { *fields = append(*fields, recordField{prefix: prefix, name: name, value: value}) }
+		switch {
+		case value.Type() == timeType:
+			add(value.Interface().(time.Time).UTC().Format(time.RFC3339Nano))
+		case value.Type() == durationType:
+			add(value.Interface().(time.Duration).Seconds())
+		case value.Type() == addressType:
+			add(formatAddress(value.Interface().([32]byte)))
+		case name == "pairAddress" && value.Kind() == reflect.String:
+			add(displayAddress(value.String()))
+		case value.Kind() == reflect.Array:
+			// opaque byte regions are not useful to sinks
+		case value.CanInterface():
+			if s, ok := value.Interface().(interface{ String() string }); ok && value.Kind() == reflect.Int {
+				add(s.String())
+			} else {
+				add(value.Interface())
+			}
+		}
+	}
+}
+
+func recordFieldName(field reflect.StructField) string {
+	if tag := field.Tag.Get("json"); tag != "" {
+		if name := strings.Split(tag, ",")[0]; name != "" {
+			return name
+		}
+	}
+	runes := []rune(field.Name)
+	for i := 0; i < len(runes) && unicode.IsUpper(runes[i]); i++ {
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// eventKeyFields identify an event across retries: its type, subject and
+// time, plus the fields that tell apart events sharing those.
+var eventKeyFields = []string{
+	"event", "pairAddress", "mint", "id", "signature", "rule", "kind", "metric", "age",
+	"from", "to", "at", "diedAt", "detectedAt", "submittedAt", "entryAt",
+}
+
+// eventID is a deterministic ID for the event a record was built from,
+// the same on every delivery attempt. It hashes the event's time, so a
+// replay matches the original only where it keeps the time: snapshot and
+// tombstone replays do, but frame replays run on a simulated clock and
+// get new IDs, the same only between replays of one recording from the
+// same -start.
+func eventID(record Record) string {
+	h := sha256.New()
+	for _, field := range eventKeyFields {
+		if v, ok := record[field]; ok {
+			fmt.Fprintf(h, "%s=%v\n", field, v)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// RedactionRule hides or coarsens one field before a record leaves moon.
+// Fields are matched after transforms, i.e. by their renamed names.
+//
+//	drop      remove the field
+//	mask      keep Keep leading and trailing characters, e.g. "LX3E…c2Jj"
+//	truncate  keep the first Keep characters
+//	round     round numbers to Digits significant digits
+type RedactionRule struct {
+	Field  string `json:"field"`
+	Action string `json:"action"`
+	Keep   int    `json:"keep,omitempty"`
+	Digits int    `json:"digits,omitempty"`
+}
+
+func (r RedactionRule) Validate() error {
+	switch r.Action {
+	case "drop", "mask", "truncate":
+	case "round":
+		if r.Digits < 1 {
+			return fmt.Errorf("round redaction of %s requires digits >= 1", r.Field)
+		}
+	default:
+		return fmt.Errorf("unknown redaction action: %q", r.Action)
+	}
+	if r.Field == "" {
+		return fmt.Errorf("%s redaction requires a field", r.Action)
+	}
+	return nil
+}
+
+func redact(record Record, rules []RedactionRule) Record {
+	for _, rule := range rules {
+		v, ok := record[rule.Field]
+		if !ok {
+			continue
+		}
+
+		switch rule.Action {
+		case "drop":
+			delete(record, rule.Field)
+		case "mask":
+			if s, ok := v.(string); ok {
+				record[rule.Field] = maskString(s, rule.Keep)
+			}
+		case "truncate":
+			if s, ok := v.(string); ok {
+				record[rule.Field] = truncateString(s, rule.Keep)
+			}
+		case "round":
+			if f, ok := toFloat(v); ok {
+				record[rule.Field] = roundSignificant(f, rule.Digits)
+			}
+		}
+	}
+	return record
+}
+
+func maskString(s string, keep int) string {
+	if keep <= 0 {
+		keep = 4
+	}
+	runes := []rune(s)
+	if len(runes) <= keep*2 {
+		return "…"
+	}
+	return string(runes[:keep]) + "…" + string(runes[len(runes)-keep:])
+}
+
+func truncateString(s string, keep int) string {
+	runes := []rune(s)
+	if len(runes) <= keep {
+		return s
+	}
+	return string(runes[:keep])
+}
+
+func roundSignificant(f float64, digits int) float64 {
+	if f == 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return f
+	}
+	magnitude := math.Pow(10, float64(digits)-math.Ceil(math.Log10(math.Abs(f))))
+	return math.Round(f*magnitude) / magnitude
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redisDefaultPrefix = "moon:"
+
+// RedisSink publishes every payload on <prefix><event> and keeps the
+// latest state of each pair in the hash <prefix>pair:<address>, with the
+// addresses in the set <prefix>pairs. Updates write the pair's fields,
+// transitions its state, and a dead pair's hash is deleted. Payloads
+// must be JSON.
+type RedisSink struct {
+	url    *url.URL
+	prefix string
+	ttl    time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func NewRedisSink(config SinkConfig) (*RedisSink, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %v", err)
+	}
+	prefix := config.Prefix
+	if prefix == "" {
+		prefix = redisDefaultPrefix
+	}
+	return &RedisSink{url: u, prefix: prefix, ttl: time.Duration(config.TTL)}, nil
+}
+
+func (s *RedisSink) Deliver(ctx context.Context, payload []byte, contentType, key string) error {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var envelope map[string]any
+	if err := decoder.Decode(&envelope); err != nil {
+		return fmt.Errorf("redis sink needs json payloads: %v", err)
+	}
+	record := envelopePayload(envelope)
+	event, _ := record["event"].(string)
+	commands := [][]string{{"PUBLISH", s.prefix + cmp.Or(event, "event"), string(payload)}}
+
+	if pair, _ := record["pairAddress"].(string); pair != "" {
+		hash := s.prefix + "pair:" + pair
+		switch {
+		case event == "pair_dead":
+			commands = append(commands, []string{"DEL", hash}, []string{"SREM", s.prefix + "pairs", pair})
+		case event == "pair_updated":
+			hset := []string{"HSET", hash}
+			for field, value := range record {
+				hset = append(hset, field, redisValue(value))
+			}
+			commands = append(commands, hset, []string{"SADD", s.prefix + "pairs", pair})
+			if s.ttl > 0 {
+				commands = append(commands, []string{"EXPIRE", hash, strconv.Itoa(int(s.ttl.Seconds()))})
+			}
+		case record["to"] != nil:
+			commands = append(commands, []string{"HSET", hash, "state", redisValue(record["to"])})
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.do(ctx, commands); err != nil {
+		// the connection may be out of step with its replies
+		s.close()
+		return err
+	}
+	return nil
+}
+
+// redisValue renders a record field as a hash value: strings as they are,
+// numbers and booleans in their JSON form, anything else as JSON.
+func redisValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return ""
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// do sends commands as one pipeline and checks every reply.
+func (s *RedisSink) do(ctx context.Context, commands [][]string) error {
+	if s.conn == nil {
+		if err := s.dial(ctx); err != nil {
+			return err
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetDeadline(deadline)
+	} else {
+		s.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	}
+
+	var b bytes.Buffer
+	for _, command := range commands {
+		writeRESP(&b, command)
+	}
+	if _, err := s.conn.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("redis write: %v", err)
+	}
+	var failed error
+	for _, command := range commands {
+		if err := readRESP(s.reader); err != nil {
+			var reply redisError
+			if !errors.As(err, &reply) {
+				return fmt.Errorf("redis read: %v", err)
+			}
+			// keep reading so the connection stays in step
+			if failed == nil {
+				failed = fmt.Errorf("redis %s: %v", command[0], err)
+			}
+		}
+	}
+	return failed
+}
+
+func (s *RedisSink) dial(ctx context.Context) error {
+	addr := s.url.Host
+	if s.url.Port() == "" {
+		addr = net.JoinHostPort(s.url.Hostname(), "6379")
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if s.url.Scheme == "rediss" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: s.url.Hostname()}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("redis dial: %v", err)
+	}
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+
+	var setup [][]string
+	if password, ok := s.url.User.Password(); ok {
+		if user := s.url.User.Username(); user != "" {
+			setup = append(setup, []string{"AUTH", user, password})
+		} else {
+			setup = append(setup, []string{"AUTH", password})
+		}
+	}
+	if db := strings.TrimPrefix(s.url.Path, "/"); db != "" {
+		if _, err := strconv.Atoi(db); err != nil {
+			s.close()
+			return fmt.Errorf("redis database must be a number, got %q", db)
+		}
+		setup = append(setup, []string{"SELECT", db})
+	}
+	if len(setup) > 0 {
+		if err := s.do(ctx, setup); err != nil {
+			s.close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *RedisSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn, s.reader = nil, nil
+	}
+}
+
+// redisError is an error reply, after which the connection is still
+// usable.
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+func writeRESP(b *bytes.Buffer, args []string) {
+	fmt.Fprintf(b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// readRESP reads and discards one reply, returning error replies.
+func readRESP(r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return errors.New("empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil
+		}
+		_, err = io.CopyN(io.Discard, r, int64(n)+2)
+		return err
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("invalid array length %q", line)
+		}
+		var failed error
+		for range max(n, 0) {
+			if err := readRESP(r); err != nil {
+				var reply redisError
+				if !errors.As(err, &reply) {
+					return err
+				}
+				if failed == nil {
+					failed = err
+				}
+			}
+		}
+		return failed
+	default:
+		return fmt.Errorf("unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Attribution summarizes the closed trades of one strategy, where the
+// strategy is the reason the position was opened (rule:<name>, api, ...).
+type Attribution struct {
+	Strategy string        `json:"strategy"`
+	Trades   int           `json:"trades"`
+	Wins     int           `json:"wins"`
+	HitRate  float64       `json:"hitRate"`
+	PnLSOL   float64       `json:"pnlSol"`
+	AvgPnL   float64       `json:"avgPnl"`
+	AvgHold  time.Duration `json:"avgHold"`
+}
+
+// attribute groups entries by strategy, best total PnL first.
+func attribute(entries []JournalEntry) []Attribution {
+	byStrategy := make(map[string]*Attribution)
+	holds := make(map[string]time.Duration)
+	for _, e := range entries {
+		strategy := e.Reason
+		if strategy == "" {
+			strategy = "unknown"
+		}
+		a, ok := byStrategy[strategy]
+		if !ok {
+			a = &Attribution{Strategy: strategy}
+			byStrategy[strategy] = a
+		}
+		a.Trades++
+		if e.PnLSOL > 0 {
+			a.Wins++
+		}
+		a.PnLSOL += e.PnLSOL
+		a.AvgPnL += e.PnL
+		holds[strategy] += e.ExitAt.Sub(e.EntryAt)
+	}
+
+	report := make([]Attribution, 0, len(byStrategy))
+	for strategy, a := range byStrategy {
+		n := float64(a.Trades)
+		a.HitRate = float64(a.Wins) / n
+		a.AvgPnL /= n
+		a.AvgHold = holds[strategy] / time.Duration(a.Trades)
+		report = append(report, *a)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].PnLSOL != report[j].PnLSOL {
+			return report[i].PnLSOL > report[j].PnLSOL
+		}
+		return report[i].Strategy < report[j].Strategy
+	})
+	return report
+}
+
+func printAttribution(report []Attribution) {
+	if len(report) == 0 {
+		color.White("No closed trades.")
+		return
+	}
+	color.Blue("%-24s %6s %7s %12s %9s %10s", "strategy", "trades", "hit", "pnl SOL", "avg pnl", "avg hold")
+	for _, a := range report {
+		printRow := color.Green
+		if a.PnLSOL < 0 {
+			printRow = color.Red
+		}
+		printRow("%-24s %6d %6.1f%% %+12.4f %+8.1f%% %10s", a.Strategy, a.Trades, a.HitRate*100,
+			a.PnLSOL, a.AvgPnL*100, a.AvgHold.Round(time.Second))
+	}
+}
+
+// runReport implements `moon report`, attributing journaled PnL to the
+// rules and strategies that opened each trade.
+func runReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	path := fs.String("journal", "trades.jsonl", "trade journal file")
+	since := fs.String("since", "", "only trades closed on or after this date (YYYY-MM-DD)")
+	until := fs.String("until", "", "only trades closed before this date (YYYY-MM-DD)")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+
+	entries, err := ReadJournal(*path)
+	if err != nil {
+		return err
+	}
+	entries, err = filterJournal(entries, *since, *until)
+	if err != nil {
+		return err
+	}
+
+	report := attribute(entries)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	color.Blue("Performance by strategy (%s):", *path)
+	printAttribution(report)
+	return nil
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/piotrostr/moon/base58"
+	"github.com/piotrostr/moon/protocol"
+)
+
+// runReprocess implements `moon reprocess`, replaying stored history
+// through the sinks of the current config: snapshots become pair_updated
+// events and tombstones pair_dead, both stamped with the time and block
+// they were recorded at. Frames are decoded again from a recording, which
+// picks up decoder fixes; frames run on a simulated clock that starts at
+// -start and follows the recorded blocks. Binary recordings have no
+// timestamps, so -start defaults to replayEpoch there and to the first
+// frame's time in a parse error capture; either way the same recording
+// gives the same events. Rules are not run, so replays never re-alert.
+func runReprocess(args []string) error {
+	fs := flag.NewFlagSet("reprocess", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file with sinks")
+	from := fs.String("from", "snapshots", "history to replay: snapshots, tombstones or frames")
+	path := fs.String("path", "", "snapshot directory, tombstone file or frame recording (defaults per source)")
+	sinkNames := fs.String("sink", "", "comma-separated sink names or types to replay into (default all)")
+	since := fs.String("since", "", "replay events at or after this time (RFC3339 or unix seconds)")
+	until := fs.String("until", "", "replay events before this time (RFC3339 or unix seconds)")
+	start := fs.String("start", "", "simulated time of the first frame of a recording (RFC3339 or unix seconds, default the capture's first timestamp, or the unix epoch for binary recordings)")
+	drainTimeout := fs.Duration("drain-timeout", 5*time.Minute, "how long to wait for queued events to be delivered once the history is read")
+	applyVerbosity := verbosityFlags(fs)
+	applyPairTable := pairTableFlags(fs)
+	fs.Parse(args)
+	applyVerbosity()
+	if err := applyPairTable(); err != nil {
+		return err
+	}
+
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	sinks, err := selectSinks(config.Sinks, *sinkNames)
+	if err != nil {
+		return err
+	}
+
+	var window struct{ from, to time.Time }
+	if *since != "" {
+		if window.from, err = parseImportTime(*since); err != nil {
+			return fmt.Errorf("invalid -since: %v", err)
+		}
+	}
+	if *until != "" {
+		if window.to, err = parseImportTime(*until); err != nil {
+			return fmt.Errorf("invalid -until: %v", err)
+		}
+	}
+	inWindow := func(at time.Time) bool {
+		return (window.from.IsZero() || !at.Before(window.from)) && (window.to.IsZero() || at.Before(window.to))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	clock := NewBlockClock()
+	// the subscription the recorded run had, if it used this config
+	sub := DefaultSubscription()
+	config.Subscription.apply(&sub)
+	origin := NewOrigin(sub)
+	pipelines := make([]*Pipeline, len(sinks))
+	queued := make([]int64, len(sinks))
+	for i, sinkConfig := range sinks {
+		if pipelines[i], err = NewPipeline(ctx, sinkConfig, origin, clock, nil); err != nil {
+			return fmt.Errorf("sink %s: %v", sinkConfig.Name, err)
+		}
+		defer pipelines[i].Close()
+	}
+	replay := func(event Event, at time.Time, block uint32) {
+		for i, p := range pipelines {
+			if p.Replay(event, at, block) {
+				queued[i]++
+			}
+		}
+	}
+
+	var read int
+	switch *from {
+	case "snapshots":
+		read, err = replaySnapshots(cmp.Or(*path, "snapshots"), inWindow, replay)
+	case "tombstones":
+		read, err = replayTombstones(cmp.Or(*path, "tombstones.jsonl"), inWindow, replay)
+	case "frames":
+		recording := cmp.Or(*path, "frames.bin")
+		var startAt time.Time
+		if *start != "" {
+			if startAt, err = parseImportTime(*start); err != nil {
+				return fmt.Errorf("invalid -start: %v", err)
+			}
+		} else if startAt, err = recordingStart(recording); err != nil {
+			return err
+		}
+		sim := NewSimClock(startAt)
+		read, err = replayFrames(recording, sim, clock, func(event Event) {
+			if inWindow(sim.Now()) {
+				block, _ := clock.Latest()
+				replay(event, sim.Now(), block)
+			}
+		})
+	default:
+		return fmt.Errorf("unknown source: %q", *from)
+	}
+	if err != nil {
+		return err
+	}
+
+	// wait for every queued event to be delivered, fail or be dropped;
+	// what is left at the deadline goes to the outbox on Close
+	deadline := time.Now().Add(*drainTimeout)
+	for i, p := range pipelines {
+		for p.Settled() < queued[i] && !p.disabled.Load() && ctx.Err() == nil && time.Now().Before(deadline) {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	color.Blue("Replayed %d %s", read, *from)
+	for i, p := range pipelines {
+		fmt.Fprintf(console, "%-20s queued %d, delivered %d, failed %d, dropped %d\n",
+			p.name, queued[i], p.delivered.Load(), p.failed.Load(), p.dropped.Load())
+		if pending := queued[i] - p.Settled(); pending > 0 {
+			color.Yellow("Sink %s still had %d events pending after -drain-timeout", p.name, pending)
+		}
+	}
+	return ctx.Err()
+}
+
+// selectSinks picks the configured sinks whose name or type is listed.
+func selectSinks(sinks []SinkConfig, names string) ([]SinkConfig, error) {
+	if len(sinks) == 0 {
+		return nil, errors.New("config has no sinks")
+	}
+	if names == "" {
+		return sinks, nil
+	}
+	var selected []SinkConfig
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		n := len(selected)
+		for _, sink := range sinks {
+			if (sink.Name == name || sink.Type == name) && !slices.ContainsFunc(selected, func(s SinkConfig) bool { return s.Name == sink.Name && s.Type == sink.Type }) {
+				selected = append(selected, sink)
+			}
+		}
+		if len(selected) == n {
+			return nil, fmt.Errorf("no sink named %q in config", name)
+		}
+	}
+	return selected, nil
+}
+
+// replaySnapshots replays every tier file in dir as pair_updated events,
+// oldest first. Each file is appended in time order, so the files are
+// merged as they are read rather than loaded and sorted.
+func replaySnapshots(dir string, inWindow func(time.Time) bool, replay func(Event, time.Time, uint32)) (int, error) {
+	paths, err := snapshotFiles(dir)
+	if err != nil {
+		return 0, fmt.Errorf("read snapshots: %v", err)
+	}
+	if len(paths) == 0 {
+		return 0, fmt.Errorf("no snapshots in %s", dir)
+	}
+
+	readers := make([]*snapshotReader, 0, len(paths))
+	defer func() {
+		for _, r := range readers {
+			r.file.Close()
+		}
+	}()
+	for _, path := range paths {
+		r, err := openSnapshotReader(path, inWindow)
+		if err != nil {
+			return 0, err
+		}
+		readers = append(readers, r)
+	}
+
+	read := 0
+	for {
+		var oldest *snapshotReader
+		for _, r := range readers {
+			if r.ok && (oldest == nil || r.next.At.Before(oldest.next.At)) {
+				oldest = r
+			}
+		}
+		if oldest == nil {
+			break
+		}
+		s := oldest.next
+		oldest.advance()
+		read++
+		addr, err := decodeAddress(s.PairAddress)
+		if err != nil {
+			continue
+		}
+		replay(&PairUpdatedEvent{
+			Pair:  PairData{PairAddress: addr, TokenSymbol: s.TokenSymbol, Price: s.Price, Volume: s.Volume},
+			At:    s.At,
+			Block: s.Block,
+		}, s.At, s.Block)
+	}
+	for _, r := range readers {
+		if err := r.scanner.Err(); err != nil {
+			return read, fmt.Errorf("read %s: %v", r.file.Name(), err)
+		}
+	}
+	return read, nil
+}
+
+// snapshotReader holds the next snapshot in the window from one file.
+type snapshotReader struct {
+	file     *os.File
+	scanner  *bufio.Scanner
+	inWindow func(time.Time) bool
+	next     Snapshot
+	ok       bool
+}
+
+func openSnapshotReader(path string, inWindow func(time.Time) bool) (*snapshotReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &snapshotReader{file: file, scanner: newLineScanner(file), inWindow: inWindow}
+	r.advance()
+	return r, nil
+}
+
+func (r *snapshotReader) advance() {
+	for r.scanner.Scan() {
+		var snapshot Snapshot
+		if json.Unmarshal(r.scanner.Bytes(), &snapshot) == nil && r.inWindow(snapshot.At) {
+			r.next, r.ok = snapshot, true
+			return
+		}
+	}
+	r.ok = false
+}
+
+// replayTombstones replays a tombstone file as pair_dead events.
+func replayTombstones(path string, inWindow func(time.Time) bool, replay func(Event, time.Time, uint32)) (int, error) {
+	read := 0
+	err := readJSONLines(path, func(line []byte) {
+		var tombstone Tombstone
+		if json.Unmarshal(line, &tombstone) != nil || !inWindow(tombstone.DiedAt) {
+			return
+		}
+		// a file written with -hex-addresses is read back as base58
+		if addr, err := decodeAddress(tombstone.PairAddress); err == nil {
+			tombstone.PairAddress = base58.Encode(addr[:])
+		}
+		read++
+		replay(&PairDeadEvent{Tombstone: tombstone}, tombstone.DiedAt, tombstone.LastBlock)
+	})
+	return read, err
+}
+
+// replayEpoch is where the simulated clock starts for recordings without
+// timestamps. It is fixed so that replays are repeatable.
+var replayEpoch = time.Unix(0, 0).UTC()
+
+// recordingStart is the time of the first frame of a parse error capture,
+// which records when frames arrived, or replayEpoch.
+func recordingStart(path string) (time.Time, error) {
+	if filepath.Ext(path) != ".jsonl" {
+		return replayEpoch, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+	scanner := newLineScanner(file)
+	var first CapturedFrame
+	if scanner.Scan() && json.Unmarshal(scanner.Bytes(), &first) == nil && !first.At.IsZero() {
+		return first.At, nil
+	}
+	return replayEpoch, scanner.Err()
+}
+
+// replayFrames decodes a recording through a fresh handler, store and
+// lifecycle, so the events are what the current decoder makes of it. sim
+// is moved to its start plus a slot per block past the first announced.
+func replayFrames(path string, sim *SimClock, blocks *BlockClock, publish func(Event)) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	decoder := protocol.NewDecoder(bufio.NewReader(file))
+	if filepath.Ext(path) == ".jsonl" {
+		decoder = protocol.NewFrameDecoder(captureFrames{bufio.NewReader(file)})
+	}
+
+	bus := NewEventBus()
+	bus.Subscribe(publish)
+	store := NewPairStore()
+	lifecycle := NewLifecycleTracker(DefaultLifecycleConfig(), bus, blocks)
+	handler := NewHandler(bus, NewGapDetector(150), sim, blocks, store, lifecycle, nil, nil, nil)
+
+	start := sim.Now()
+	var firstBlock uint32
+	frames := 0
+	for {
+		msg, err := decoder.Next()
+		if err == io.EOF {
+			return frames, nil
+		}
+		if decoder.Frame() == nil {
+			return frames, err
+		}
+		frames++
+		if msg, ok := msg.(*LatestBlockHashMessage); ok && msg.LatestBlock > 0 {
+			if firstBlock == 0 {
+				firstBlock = msg.LatestBlock
+			}
+			if msg.LatestBlock > firstBlock {
+				sim.Set(start.Add(time.Duration(msg.LatestBlock-firstBlock) * defaultSlotDuration))
+			}
+		}
+		if err := handler.HandleFrame(Frame{Data: decoder.Frame()}); err != nil {
+			color.Red("Error handling frame %d: %v", frames, err)
+		}
+	}
+}
+
+func readJSONLines(path string, fn func(line []byte)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := newLineScanner(file)
+	for scanner.Scan() {
+		fn(scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read %s: %v", path, err)
+	}
+	return nil
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	return scanner
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// RetentionConfig bounds how long stored data is kept. Zero keeps data
+// forever; setDefaults fills the snapshot tiers.
+type RetentionConfig struct {
+	Early      Duration `json:"early,omitempty"`
+	Sampled    Duration `json:"sampled,omitempty"`
+	Tombstones Duration `json:"tombstones,omitempty"`
+	// Interval is how often the background pruner runs.
+	Interval Duration `json:"interval,omitempty"`
+}
+
+func (c *RetentionConfig) setDefaults() {
+	if c.Early <= 0 {
+		c.Early = Duration(7 * 24 * time.Hour)
+	}
+	if c.Sampled <= 0 {
+		c.Sampled = Duration(90 * 24 * time.Hour)
+	}
+	if c.Interval <= 0 {
+		c.Interval = Duration(time.Hour)
+	}
+}
+
+// PruneResult counts what a prune removed.
+type PruneResult struct {
+	Files      []string
+	Tombstones int
+}
+
+// pruneSnapshots removes snapshot day files older than their tier's
+// retention. A day is removed once all of it is past the cutoff.
+func pruneSnapshots(dir string, config RetentionConfig, now time.Time, dryRun bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keep := map[string]Duration{TierEarly: config.Early, TierSampled: config.Sampled}
+	var removed []string
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".jsonl")
+		tier, date, ok := strings.Cut(name, "-")
+		retention, known := keep[tier]
+		if !ok || !known || retention <= 0 {
+			continue
+		}
+		day, err := time.Parse(time.DateOnly, date)
+		if err != nil {
+			continue
+		}
+		if day.Add(24 * time.Hour).After(now.Add(-time.Duration(retention))) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return removed, err
+			}
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// pruneJSONL rewrites path without the lines whose timeField is before
+// cutoff. Lines without a readable time are kept.
+func pruneJSONL(path, timeField string, cutoff time.Time, dryRun bool) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var kept bytes.Buffer
+	removed := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var fields map[string]json.RawMessage
+		var at time.Time
+		if json.Unmarshal(line, &fields) == nil && json.Unmarshal(fields[timeField], &at) == nil && at.Before(cutoff) {
+			removed++
+			continue
+		}
+		kept.Write(line)
+		kept.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if removed == 0 || dryRun {
+		return removed, nil
+	}
+	return removed, writeFileAtomic(path, kept.Bytes(), 0o644)
+}
+
+// Pruner applies the retention policy in the background.
+type Pruner struct {
+	clock       Clock
+	config      RetentionConfig
+	snapshotDir string
+	tombstones  *TombstoneStore
+}
+
+func NewPruner(clock Clock, config RetentionConfig, snapshotDir string, tombstones *TombstoneStore) *Pruner {
+	config.setDefaults()
+	return &Pruner{clock: clock, config: config, snapshotDir: snapshotDir, tombstones: tombstones}
+}
+
+func (p *Pruner) Interval() time.Duration {
+	return time.Duration(p.config.Interval)
+}
+
+// Prune removes what is older than the policy allows as of the clock's now.
+func (p *Pruner) Prune() (PruneResult, error) {
+	now := p.clock.Now()
+	var result PruneResult
+	if p.snapshotDir != "" {
+		files, err := pruneSnapshots(p.snapshotDir, p.config, now, false)
+		result.Files = files
+		if err != nil {
+			return result, err
+		}
+	}
+	if p.tombstones != nil && p.config.Tombstones > 0 {
+		n, err := p.tombstones.Prune(now.Add(-time.Duration(p.config.Tombstones)))
+		result.Tombstones = n
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// runPrune implements `moon prune`, applying the config's retention policy
+// once, e.g. from cron while moon is stopped.
+func runPrune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	configPath := fs.String("config", "", "JSON config with a retention section")
+	snapshotDir := fs.String("snapshots", "snapshots", "snapshot directory")
+	tombstonePath := fs.String("tombstones", "tombstones.jsonl", "tombstone file")
+	dryRun := fs.Bool("dry-run", false, "only report what would be removed")
+	fs.Parse(args)
+
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	retention := config.Retention
+	retention.setDefaults()
+	now := time.Now()
+
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+
+	files, err := pruneSnapshots(*snapshotDir, retention, now, *dryRun)
+	for _, file := range files {
+		fmt.Fprintf(console, "%s %s\n", verb, file)
+	}
+	if err != nil {
+		return err
+	}
+
+	if retention.Tombstones > 0 {
+		n, err := pruneJSONL(*tombstonePath, "diedAt", now.Add(-time.Duration(retention.Tombstones)), *dryRun)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(console, "%s %d tombstones\n", verb, n)
+	}
+	color.Green("%s %d snapshot files", verb, len(files))
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// RiskConfig caps the portfolio as a whole. Zero disables a limit.
+type RiskConfig struct {
+	MaxPositions    int     `json:"maxPositions,omitempty"`
+	MaxExposureSOL  float64 `json:"maxExposureSol,omitempty"`
+	MaxDailyLossSOL float64 `json:"maxDailyLossSol,omitempty"`
+}
+
+func (c RiskConfig) Validate() error {
+	if c.MaxPositions < 0 || c.MaxExposureSOL < 0 || c.MaxDailyLossSOL < 0 {
+		return errors.New("risk limits must not be negative")
+	}
+	return nil
+}
+
+var ErrTradingHalted = errors.New("trading halted")
+
+// checkRisk reports whether opening lamports more would breach a limit.
+// Callers hold the trader lock.
+func (t *Trader) checkRisk(lamports uint64, now time.Time) error {
+	limits := t.risk
+	if t.state.HaltedDay == utcDay(now) {
+		return fmt.Errorf("%w: %s", ErrTradingHalted, t.state.HaltReason)
+	}
+
+	var open int
+	var exposure float64
+	for _, position := range t.positions {
+		if position.Status == PositionClosed {
+			continue
+		}
+		open++
+		exposure += float64(position.committedLamports()) / lamportsPerSOL
+	}
+
+	if limits.MaxPositions > 0 && open >= limits.MaxPositions {
+		return fmt.Errorf("max concurrent positions (%d) reached", limits.MaxPositions)
+	}
+	size := float64(lamports) / lamportsPerSOL
+	if limits.MaxExposureSOL > 0 && exposure+size > limits.MaxExposureSOL {
+		return fmt.Errorf("exposure %.3f + %.3f SOL exceeds max %.3f SOL", exposure, size, limits.MaxExposureSOL)
+	}
+	return nil
+}
+
+// checkDailyLoss halts trading for the rest of the UTC day once realized
+// losses today reach the limit. Callers hold the trader lock. It returns
+// the halt reason when a halt was triggered.
+func (t *Trader) checkDailyLoss(now time.Time) string {
+	if t.risk.MaxDailyLossSOL <= 0 || t.state.HaltedDay == utcDay(now) {
+		return ""
+	}
+
+	var today []Position
+	for _, position := range t.positions {
+		if position.Status == PositionClosed && utcDay(position.ExitAt) == utcDay(now) {
+			today = append(today, *position)
+		}
+	}
+	loss := -realizedSOL(today)
+	if loss < t.risk.MaxDailyLossSOL {
+		return ""
+	}
+
+	t.state.HaltedDay = utcDay(now)
+	t.state.HaltReason = fmt.Sprintf("daily loss %.3f SOL reached limit %.3f SOL", loss, t.risk.MaxDailyLossSOL)
+	return t.state.HaltReason
+}
+
+func utcDay(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// traderState is what survives restarts: every position and any halt.
+type traderState struct {
+	NextID     int        `json:"nextId"`
+	Positions  []Position `json:"positions"`
+	HaltedDay  string     `json:"haltedDay,omitempty"`
+	HaltReason string     `json:"haltReason,omitempty"`
+}
+
+func loadTraderState(path string) (*traderState, error) {
+	state := &traderState{}
+	if path == "" {
+		return state, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read trading state: %v", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("parse trading state %s: %v", path, err)
+	}
+	return state, nil
+}
+
+// saveTraderState writes atomically so a crash never leaves a torn file.
+func saveTraderState(path string, state *traderState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0o600)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// RPCClient is a minimal Solana JSON-RPC client.
+type RPCClient struct {
+	url    string
+	client *http.Client
+	nextID atomic.Int64
+}
+
+func NewRPCClient(url string) *RPCClient {
+	return &RPCClient{url: url, client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+func (c *RPCClient) call(ctx context.Context, method string, params []any, result any) error {
+	body, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      c.nextID.Add(1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// the URL often carries an API key
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s request error: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s request failed: %s", method, resp.Status)
+	}
+
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("%s decode error: %v", method, err)
+	}
+	if envelope.Error != nil {
+		return envelope.Error
+	}
+	return json.Unmarshal(envelope.Result, result)
+}
+
+// RecentPrioritizationFees returns per-slot minimum fees (micro-lamports per
+// compute unit) paid by transactions that locked all of accounts.
+func (c *RPCClient) RecentPrioritizationFees(ctx context.Context, accounts []string) ([]uint64, error) {
+	var result []struct {
+		Slot              uint64 `json:"slot"`
+		PrioritizationFee uint64 `json:"prioritizationFee"`
+	}
+	if err := c.call(ctx, "getRecentPrioritizationFees", []any{accounts}, &result); err != nil {
+		return nil, err
+	}
+
+	fees := make([]uint64, len(result))
+	for i, r := range result {
+		fees[i] = r.PrioritizationFee
+	}
+	return fees, nil
+}
+
+// SendTransaction submits a signed wire-format transaction and returns its
+// signature. Preflight is skipped since launch trades race other buyers.
+func (c *RPCClient) SendTransaction(ctx context.Context, tx []byte) (string, error) {
+	var signature string
+	err := c.call(ctx, "sendTransaction", []any{
+		base64Encode(tx),
+		map[string]any{"encoding": "base64", "skipPreflight": true, "maxRetries": 0},
+	}, &signature)
+	return signature, err
+}
+
+type SignatureStatus struct {
+	Slot               uint64 `json:"slot"`
+	ConfirmationStatus string `json:"confirmationStatus"`
+	Err                any    `json:"err"`
+}
+
+// SignatureStatuses returns the status of each signature, nil if unknown.
+func (c *RPCClient) SignatureStatuses(ctx context.Context, signatures []string) ([]*SignatureStatus, error) {
+	var result struct {
+		Value []*SignatureStatus `json:"value"`
+	}
+	err := c.call(ctx, "getSignatureStatuses", []any{signatures, map[string]any{"searchTransactionHistory": false}}, &result)
+	return result.Value, err
+}
+
+func (c *RPCClient) BlockHeight(ctx context.Context) (uint64, error) {
+	var height uint64
+	err := c.call(ctx, "getBlockHeight", []any{map[string]any{"commitment": "confirmed"}}, &height)
+	return height, err
+}
+
+// Token programs whose accounts can hold a mint's tokens.
+var tokenPrograms = []string{
+	"TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA",
+	"TokenzQdBNbLqP5VEhdkAS6EPFLC1PHnBqCXEpPxuEb",
+}
+
+// TokenHolders counts the token accounts of mint with a non-zero balance.
+// Accounts are matched on their mint, the first field of both programs'
+// layouts, and only the amount after mint and owner is fetched.
+func (c *RPCClient) TokenHolders(ctx context.Context, mint string) (int, error) {
+	holders := 0
+	for _, program := range tokenPrograms {
+		var result []struct {
+			Account struct {
+				Data [2]string `json:"data"`
+			} `json:"account"`
+		}
+		err := c.call(ctx, "getProgramAccounts", []any{program, map[string]any{
+			"encoding":   "base64",
+			"commitment": "confirmed",
+			"dataSlice":  map[string]int{"offset": 64, "length": 8},
+			"filters":    []any{map[string]any{"memcmp": map[string]any{"offset": 0, "bytes": mint}}},
+		}}, &result)
+		if err != nil {
+			return 0, err
+		}
+		for _, account := range result {
+			amount, err := base64.StdEncoding.DecodeString(account.Account.Data[0])
+			if err != nil || len(amount) != 8 {
+				return 0, fmt.Errorf("getProgramAccounts: malformed token account data")
+			}
+			if binary.LittleEndian.Uint64(amount) > 0 {
+				holders++
+			}
+		}
+	}
+	return holders, nil
+}
+
+// TokenBalance is owner's balance of mint in base units, summed over its
+// token accounts.
+func (c *RPCClient) TokenBalance(ctx context.Context, owner, mint string) (uint64, error) {
+	var result struct {
+		Value []struct {
+			Account struct {
+				Data struct {
+					Parsed struct {
+						Info struct {
+							TokenAmount struct {
+								Amount string `json:"amount"`
+							} `json:"tokenAmount"`
+						} `json:"info"`
+					} `json:"parsed"`
+				} `json:"data"`
+			} `json:"account"`
+		} `json:"value"`
+	}
+	err := c.call(ctx, "getTokenAccountsByOwner", []any{owner, map[string]any{"mint": mint},
+		map[string]any{"encoding": "jsonParsed", "commitment": "confirmed"}}, &result)
+	if err != nil {
+		return 0, err
+	}
+	var balance uint64
+	for _, account := range result.Value {
+		amount, err := strconv.ParseUint(account.Account.Data.Parsed.Info.TokenAmount.Amount, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("getTokenAccountsByOwner: malformed amount: %v", err)
+		}
+		balance += amount
+	}
+	return balance, nil
+}
+
+type tokenBalance struct {
+	AccountIndex  int    `json:"accountIndex"`
+	Mint          string `json:"mint"`
+	Owner         string `json:"owner"`
+	UITokenAmount struct {
+		Amount string `json:"amount"`
+	} `json:"uiTokenAmount"`
+}
+
+type TransactionMeta struct {
+	Fee               uint64         `json:"fee"`
+	PreBalances       []int64        `json:"preBalances"`
+	PostBalances      []int64        `json:"postBalances"`
+	PreTokenBalances  []tokenBalance `json:"preTokenBalances"`
+	PostTokenBalances []tokenBalance `json:"postTokenBalances"`
+	Err               any            `json:"err"`
+}
+
+// TransactionMeta fetches the execution metadata of a confirmed transaction.
+func (c *RPCClient) TransactionMeta(ctx context.Context, signature string) (*TransactionMeta, error) {
+	var result *struct {
+		Meta *TransactionMeta `json:"meta"`
+	}
+	err := c.call(ctx, "getTransaction", []any{signature, map[string]any{
+		"encoding":                       "json",
+		"commitment":                     "confirmed",
+		"maxSupportedTransactionVersion": 0,
+	}}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil || result.Meta == nil {
+		return nil, fmt.Errorf("transaction %s not found", signature)
+	}
+	return result.Meta, nil
+}
+
+// tokenDelta is the change in owner's balance of mint in base units.
+func (m *TransactionMeta) tokenDelta(owner, mint string) int64 {
+	sum := func(balances []tokenBalance) int64 {
+		var total int64
+		for _, b := range balances {
+			if b.Owner == owner && b.Mint == mint {
+				amount, _ := strconv.ParseInt(b.UITokenAmount.Amount, 10, 64)
+				total += amount
+			}
+		}
+		return total
+	}
+	return sum(m.PostTokenBalances) - sum(m.PreTokenBalances)
+}
+
+// lamportDelta is the fee payer's SOL change excluding the transaction fee.
+func (m *TransactionMeta) lamportDelta() int64 {
+	if len(m.PreBalances) == 0 || len(m.PostBalances) == 0 {
+		return 0
+	}
+	return m.PostBalances[0] - m.PreBalances[0] + int64(m.Fee)
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Condition compares one record field against Value. Numeric fields
+// support > >= < <= == !=, string fields == != and contains.
+type Condition struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value any    `json:"value"`
+}
+
+func (c Condition) Validate() error {
+	switch c.Op {
+	case ">", ">=", "<", "<=", "==", "!=", "contains":
+	default:
+		return fmt.Errorf("unknown operator: %q", c.Op)
+	}
+	if c.Field == "" {
+		return fmt.Errorf("condition %s needs a field", c.Op)
+	}
+	return nil
+}
+
+func (c Condition) Match(record Record) bool {
+	actual, ok := record[c.Field]
+	if !ok {
+		return false
+	}
+
+	if a, ok := toFloat(actual); ok {
+		b, ok := toFloat(c.Value)
+		if !ok {
+			return false
+		}
+		switch c.Op {
+		case ">":
+			return a > b
+		case ">=":
+			return a >= b
+		case "<":
+			return a < b
+		case "<=":
+			return a <= b
+		case "==":
+			return a == b
+		case "!=":
+			return a != b
+		}
+		return false
+	}
+
+	a, b := fmt.Sprint(actual), fmt.Sprint(c.Value)
+	switch c.Op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "contains":
+		return strings.Contains(strings.ToLower(a), strings.ToLower(b))
+	}
+	return false
+}
+
+// Cleared reports whether record fails c by more than band, a fraction of
+// the threshold: a > condition is cleared below Value*(1-band) and a <
+// condition above Value*(1+band). Other operators are cleared when they
+// do not match. A missing field clears nothing.
+func (c Condition) Cleared(record Record, band float64) bool {
+	actual, ok := record[c.Field]
+	if !ok {
+		return false
+	}
+	a, aok := toFloat(actual)
+	b, bok := toFloat(c.Value)
+	if !aok || !bok {
+		return !c.Match(record)
+	}
+	margin := math.Abs(b) * band
+	switch c.Op {
+	case ">", ">=":
+		return a < b-margin
+	case "<", "<=":
+		return a > b+margin
+	}
+	return !c.Match(record)
+}
+
+// RuleConfig fires Action when an event named in On matches every
+// condition in When. Actions are alert and buy. Message is a text/template
+// over the event record with number helpers, e.g.
+// "{{.tokenSymbol}} at {{usd .price}}, 24h volume {{usd .volume}}".
+type RuleConfig struct {
+	Name    string      `json:"name"`
+	On      []string    `json:"on"`
+	When    []Condition `json:"when"`
+	Action  string      `json:"action"`
+	Message string      `json:"message,omitempty"`
+	// Once removes the rule after it first fires, and the rule is removed
+	// at Expires if set; both suit temporary rules added at runtime.
+	Once    bool       `json:"once,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+	// Cooldown is the least time between firings for one pair. After
+	// firing for a pair with Hysteresis set, the rule only fires for it
+	// again once one of its conditions has cleared by that fraction of
+	// its threshold, e.g. 0.05 for a price 5% back below a > threshold.
+	Cooldown   Duration `json:"cooldown,omitempty"`
+	Hysteresis float64  `json:"hysteresis,omitempty"`
+	// Rearm lets the rule fire again within Cooldown once a numeric field
+	// in When has moved by more than this fraction of its value at the
+	// last firing, e.g. 0.5 for a price half again past where it fired.
+	Rearm float64 `json:"rearm,omitempty"`
+}
+
+func (r RuleConfig) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule needs a name")
+	}
+	if len(r.On) == 0 {
+		return fmt.Errorf("rule %s needs at least one event in on", r.Name)
+	}
+	switch r.Action {
+	case "alert", "buy":
+	default:
+		return fmt.Errorf("rule %s: unknown action %q", r.Name, r.Action)
+	}
+	for _, c := range r.When {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("rule %s: %v", r.Name, err)
+		}
+	}
+	if r.Cooldown < 0 {
+		return fmt.Errorf("rule %s: cooldown must not be negative", r.Name)
+	}
+	if r.Hysteresis < 0 || r.Hysteresis >= 1 {
+		return fmt.Errorf("rule %s: hysteresis must be in [0, 1)", r.Name)
+	}
+	if r.Rearm < 0 {
+		return fmt.Errorf("rule %s: rearm must not be negative", r.Name)
+	}
+	if r.Hysteresis > 0 && len(r.When) == 0 {
+		return fmt.Errorf("rule %s: hysteresis needs conditions to clear", r.Name)
+	}
+	if _, err := r.template(numberLocales["en"]); err != nil {
+		return fmt.Errorf("rule %s: %v", r.Name, err)
+	}
+	return nil
+}
+
+func (r RuleConfig) template(locale NumberLocale) (*template.Template, error) {
+	if r.Message == "" {
+		return nil, nil
+	}
+	return template.New(r.Name).Funcs(templateFuncs(locale)).Parse(r.Message)
+}
+
+// BuySignalEvent asks the trader to open a position.
+type BuySignalEvent struct {
+	sourced
+	Rule        string
+	PairAddress string
+	TokenSymbol string
+	Price       float64
+	// Costs are estimated at the size the trader would open, or the
+	// configured size without a trader; nil without either.
+	Costs *CostEstimate
+	At    time.Time
+}
+
+func (e *BuySignalEvent) EventName() string { return "buy_signal" }
+
+// RulesEngine evaluates configured rules, and rules added at runtime,
+// against every event.
+type RulesEngine struct {
+	mu        sync.Mutex
+	rules     []RuleConfig
+	templates map[string]*template.Template
+	firings   map[ruleFiringKey]*ruleFiring
+	clock     Clock
+	locale    NumberLocale
+	costs     *CostModel
+	size      func() uint64
+	bus       *EventBus
+}
+
+type ruleFiringKey struct {
+	rule, pair string
+}
+
+// ruleFiring is what a rule with a cooldown or hysteresis remembers about
+// a pair: when it last fired, and whether it waits for its conditions to
+// clear.
+type ruleFiring struct {
+	at      time.Time
+	latched bool
+	// the numeric condition fields when it fired, for Rearm
+	values map[string]float64
+}
+
+// NewRulesEngine expects validated rules; locale sets the separators in
+// alert messages, costs prices buy signals and clock times cooldowns,
+// expiry and what rules publish.
+func NewRulesEngine(rules []RuleConfig, locale NumberLocale, costs *CostModel, clock Clock, bus *EventBus) *RulesEngine {
+	templates := make(map[string]*template.Template)
+	for _, rule := range rules {
+		if tmpl, err := rule.template(locale); err == nil && tmpl != nil {
+			templates[rule.Name] = tmpl
+		}
+	}
+	return &RulesEngine{rules: slices.Clone(rules), templates: templates, firings: make(map[ruleFiringKey]*ruleFiring), clock: clock, locale: locale, costs: costs, bus: bus}
+}
+
+// SizeBy costs buy signals at the size returned by size, such as the
+// trader's next position, instead of the configured one. It must be called
+// before events are observed.
+func (e *RulesEngine) SizeBy(size func() uint64) { e.size = size }
+
+// Add validates rule and starts evaluating it. Names are unique.
+func (e *RulesEngine) Add(rule RuleConfig) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	tmpl, err := rule.template(e.locale)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range e.rules {
+		if r.Name == rule.Name {
+			return fmt.Errorf("rule %s already exists", rule.Name)
+		}
+	}
+	e.rules = append(e.rules, rule)
+	if tmpl != nil {
+		e.templates[rule.Name] = tmpl
+	}
+	return nil
+}
+
+func (e *RulesEngine) Remove(name string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.remove(name) {
+		return fmt.Errorf("no rule named %s", name)
+	}
+	return nil
+}
+
+func (e *RulesEngine) remove(name string) bool {
+	i := slices.IndexFunc(e.rules, func(r RuleConfig) bool { return r.Name == name })
+	if i == -1 {
+		return false
+	}
+	e.rules = slices.Delete(e.rules, i, i+1)
+	delete(e.templates, name)
+	for key := range e.firings {
+		if key.rule == name {
+			delete(e.firings, key)
+		}
+	}
+	return true
+}
+
+func (e *RulesEngine) Rules() []RuleConfig {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.rules)
+}
+
+func (e *RulesEngine) Observe(event Event) {
+	// rules never react to their own output
+	switch event := event.(type) {
+	case *AlertEvent, *BuySignalEvent:
+		return
+	case *PairDeadEvent:
+		e.forget(event.Tombstone.PairAddress)
+	}
+
+	now := e.clock.Now()
+	var record Record
+	type firing struct {
+		rule RuleConfig
+		tmpl *template.Template
+	}
+	var fired []firing
+	e.mu.Lock()
+	for _, rule := range slices.Clone(e.rules) {
+		if rule.Expires != nil && now.After(*rule.Expires) {
+			e.remove(rule.Name)
+			continue
+		}
+		if !slices.Contains(rule.On, event.EventName()) {
+			continue
+		}
+		if record == nil {
+			record = eventRecord(event)
+		}
+		if !e.armed(rule, record, now) {
+			continue
+		}
+		fired = append(fired, firing{rule, e.templates[rule.Name]})
+		if rule.Once {
+			e.remove(rule.Name)
+		}
+	}
+	e.mu.Unlock()
+
+	// fired rules publish, so they run without the lock
+	for _, f := range fired {
+		e.fire(f.rule, f.tmpl, record, from(event))
+	}
+}
+
+// armed reports whether rule matches record and may fire for its pair
+// now, recording the firing if so. The caller holds e.mu.
+func (e *RulesEngine) armed(rule RuleConfig, record Record, now time.Time) bool {
+	if rule.Cooldown == 0 && rule.Hysteresis == 0 {
+		return !recordStale(record, now) && matchAll(rule.When, record)
+	}
+
+	pair, _ := record["pairAddress"].(string)
+	key := ruleFiringKey{rule: rule.Name, pair: pair}
+	last := e.firings[key]
+	if last != nil && last.latched && slices.ContainsFunc(rule.When, func(c Condition) bool { return c.Cleared(record, rule.Hysteresis) }) {
+		last.latched = false
+	}
+	if recordStale(record, now) || !matchAll(rule.When, record) {
+		return false
+	}
+	if last != nil && (last.latched || now.Sub(last.at) < time.Duration(rule.Cooldown) && !last.moved(record, rule.Rearm)) {
+		return false
+	}
+	firing := &ruleFiring{at: now, latched: rule.Hysteresis > 0, values: make(map[string]float64)}
+	for _, c := range rule.When {
+		if v, ok := toFloat(record[c.Field]); ok {
+			firing.values[c.Field] = v
+		}
+	}
+	e.firings[key] = firing
+	return true
+}
+
+// moved reports whether a field of record is more than fraction away
+// from its value at the firing; a zero fraction never re-arms.
+func (f *ruleFiring) moved(record Record, fraction float64) bool {
+	if fraction == 0 {
+		return false
+	}
+	for field, then := range f.values {
+		if now, ok := toFloat(record[field]); ok && math.Abs(now-then) > math.Abs(then)*fraction {
+			return true
+		}
+	}
+	return false
+}
+
+// forget drops what rules remember about a dead pair.
+func (e *RulesEngine) forget(pair string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key := range e.firings {
+		if key.pair == pair {
+			delete(e.firings, key)
+		}
+	}
+}
+
+func matchAll(conditions []Condition, record Record) bool {
+	for _, c := range conditions {
+		if !c.Match(record) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *RulesEngine) fire(rule RuleConfig, tmpl *template.Template, record Record, source sourced) {
+	pairAddress, _ := record["pairAddress"].(string)
+	symbol, _ := record["tokenSymbol"].(string)
+	price, _ := toFloat(record["price"])
+	now := e.clock.Now()
+
+	switch rule.Action {
+	case "alert":
+		message := fmt.Sprintf("%s matched %s (%s)", rule.Name, symbol, pairAddress)
+		if tmpl != nil {
+			var b strings.Builder
+			if err := tmpl.Execute(&b, record); err != nil {
+				message = fmt.Sprintf("%s (template error: %v)", message, err)
+			} else {
+				message = b.String()
+			}
+		}
+		e.bus.Publish(&AlertEvent{sourced: source, Kind: rule.Name, PairAddress: pairAddress, TokenSymbol: symbol, Message: message, At: now, Fields: record})
+	case "buy":
+		if pairAddress == "" {
+			return
+		}
+		signal := &BuySignalEvent{sourced: source, Rule: rule.Name, PairAddress: pairAddress, TokenSymbol: symbol, Price: price, At: now}
+		var lamports uint64
+		if e.size != nil {
+			lamports = e.size()
+		}
+		if estimate, ok := e.costs.Estimate(lamports); ok {
+			if err := e.costs.Check(estimate); err != nil {
+				color.Yellow("Buy signal %s for %s dropped: %v", rule.Name, symbol, err)
+				return
+			}
+			signal.Costs = &estimate
+		}
+		e.bus.Publish(signal)
+	}
+}
+
+// RegisterRules serves the engine's rules at /rules. Rules added over
+// REST live until removed, fired with once, expired or the process exits.
+// Buy rules spend money, so they can only be added when the server
+// requires tokens, and so an admin token.
+func RegisterRules(server *Server, engine *RulesEngine) {
+	server.HandleJSON("GET /rules", func(r *http.Request) (any, error) {
+		return engine.Rules(), nil
+	})
+	server.HandleJSON("POST /rules", func(r *http.Request) (any, error) {
+		var rule RuleConfig
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			return nil, fmt.Errorf("invalid rule: %v", err)
+		}
+		if rule.Action == "buy" && !server.Authenticated() {
+			return nil, fmt.Errorf("buy rules need http tokens configured; add them to the config instead")
+		}
+		if err := engine.Add(rule); err != nil {
+			return nil, err
+		}
+		return rule, nil
+	})
+	server.HandleJSON("DELETE /rules/{name}", func(r *http.Request) (any, error) {
+		if err := engine.Remove(r.PathValue("name")); err != nil {
+			return nil, err
+		}
+		return engine.Rules(), nil
+	})
+}
+
+// runAlert implements `moon alert <pairAddress> -above 0.001 -below 0.0005`,
+// adding one-shot price alerts to a running instance.
+func runAlert(args []string) error {
+	fs := flag.NewFlagSet("alert", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:8080", "base URL of a running moon instance")
+	token := tokenFlag(fs)
+	above := fs.Float64("above", 0, "alert once the price is at or above this")
+	below := fs.Float64("below", 0, "alert once the price is at or below this")
+	ttl := fs.Duration("ttl", 24*time.Hour, "drop the alert after this long if it has not fired")
+	fs.Parse(args)
+
+	// the pair may come before the flags, where flag stops parsing
+	var pair string
+	if fs.NArg() > 0 {
+		pair = fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+	}
+	if pair == "" || fs.NArg() > 0 {
+		return fmt.Errorf("usage: moon alert <pairAddress> -above price -below price")
+	}
+	if *above <= 0 && *below <= 0 {
+		return fmt.Errorf("alert needs -above or -below")
+	}
+
+	expires := time.Now().Add(*ttl)
+	for _, bound := range []struct {
+		name, op string
+		price    float64
+	}{{"above", ">=", *above}, {"below", "<=", *below}} {
+		if bound.price <= 0 {
+			continue
+		}
+		threshold := strconv.FormatFloat(bound.price, 'g', -1, 64)
+		rule := RuleConfig{
+			Name:    fmt.Sprintf("%s-%s-%s", pair[:min(8, len(pair))], bound.name, threshold),
+			On:      []string{"pair_updated"},
+			When:    []Condition{{Field: "pairAddress", Op: "==", Value: pair}, {Field: "price", Op: bound.op, Value: bound.price}},
+			Action:  "alert",
+			Message: fmt.Sprintf("{{.tokenSymbol}} is %s %s at {{price .price}}", bound.name, threshold),
+			Once:    true,
+			Expires: &expires,
+		}
+		body, err := json.Marshal(rule)
+		if err != nil {
+			return err
+		}
+		resp, err := apiRequest(http.MethodPost, *server+"/rules", *token, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("alert request error: %v", err)
+		}
+		var result struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("alert request failed: %s %s", resp.Status, result.Error)
+		}
+		color.Green("Added %s, expires %s", rule.Name, expires.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/piotrostr/moon/protocol"
+)
+
+func runStream(args []string) error {
+	fs := flag.NewFlagSet("moon", flag.ExitOnError)
+	connections := fs.Int("connections", 1, "number of redundant websocket connections to the stream")
+	compression := fs.Bool("compression", false, "offer permessage-deflate to the feed")
+	throughputWarn := fs.Float64("throughput-warn", 0.5, "alert when a connection's throughput falls below this fraction of its baseline (0 to disable)")
+	dedupWindow := fs.Duration("dedup-window", 10*time.Second, "window in which identical frames from different connections are dropped")
+	strict := fs.Bool("strict", false, "reject frames on which a decoding heuristic fired on ambiguous data, printing why")
+	gapThreshold := fs.Uint("gap-threshold", 150, "block jump between LatestBlockHash messages treated as a gap")
+	backfill := fs.Bool("backfill", false, "refresh known pairs from the REST API when a gap is detected")
+	recoveryTimeout := fs.Duration("recovery-timeout", 30*time.Second, "how long to keep widened filters after a reconnect")
+	maxReconnects := fs.Int("max-reconnects", 0, "consecutive failed reconnects before a connection gives up (0 for unlimited)")
+	graduationMarketCap := fs.Float64("graduation-mcap", 400_000, "market cap in USD at which a moonshot pair graduates")
+	staleAfter := fs.Duration("stale-after", 30*time.Minute, "evict pairs that have not updated for this long")
+	rugDrawdown := fs.Float64("rug-drawdown", 0.9, "drop from peak price treated as a rug (0-1)")
+	tombstonePath := fs.String("tombstones", "tombstones.jsonl", "file recording evicted pairs (empty to disable)")
+	httpAddr := fs.String("http", "", "address for the REST and metrics server, e.g. :8080 (empty to disable)")
+	adminSocket := fs.String("admin-socket", "", "unix socket for the admin API used by moon ctl, e.g. moon.sock (empty to disable)")
+	statsWindow := fs.Duration("stats-window", time.Hour, "window for rolling market stats")
+	statsInterval := fs.Duration("stats-interval", time.Minute, "how often to print market stats (0 to disable)")
+	digestInterval := fs.Duration("digest-interval", 24*time.Hour, "how often to print the digest (0 to disable)")
+	topLimit := fs.Int("top", 10, "entries per leaderboard in the digest")
+	configPath := fs.String("config", "", "path to a JSON config file with sink pipelines")
+	anomalyThreshold := fs.Float64("anomaly-threshold", 4, "z-score at which price or volume moves are flagged (0 to disable)")
+	parseErrorRate := fs.Float64("parse-error-rate", 0.2, "share of undecodable frames that triggers an alert and raw capture (0 to disable)")
+	parseErrorWindow := fs.Duration("parse-error-window", time.Minute, "window over which the parse error rate is measured")
+	recordPath := fs.String("record", "", "append every raw frame, length-prefixed, to this file for replay and analysis")
+	rawCapturePath := fs.String("raw-capture", "raw-frames.jsonl", "file raw frames are captured to during a parse error spike")
+	launchRatesPath := fs.String("launch-rates", "launch-rates.json", "file persisting hourly launch counts per dex and chain (empty to keep in memory)")
+	alertStatePath := fs.String("alert-state", "alerts.json", "file persisting alert mutes and acknowledgements (empty to keep in memory)")
+	notesPath := fs.String("notes", "notes.json", "file persisting pair notes and tags (empty to keep in memory)")
+	watchlistPath := fs.String("watchlist", "", "CSV or JSON watchlist of pairs and mints to follow and tag regardless of the stream filters")
+	watchlistInterval := fs.Duration("watchlist-interval", 30*time.Second, "how often watched pairs are refreshed from the REST API")
+	schemaVersionPath := fs.String("schema-version", "schema-version.json", "file recording the schema version of the state files, which are migrated on startup; state files left at their default paths are kept beside it")
+	iconDir := fs.String("icons", "", "directory to fetch and cache token icons in, served at /icons/{pair} and linked from alerts (empty to disable)")
+	backupDir := fs.String("backups", "backups", "directory the state is copied to before a migration (empty to skip)")
+	var snapshotConfig SnapshotConfig
+	fs.StringVar(&snapshotConfig.Dir, "snapshots", "", "directory to record per-pair snapshots in, e.g. snapshots (empty to disable)")
+	fs.DurationVar(&snapshotConfig.EarlyWindow, "snapshot-window", 10*time.Minute, "keep every update for this long after a pair is discovered")
+	fs.IntVar(&snapshotConfig.EarlyMax, "snapshot-max", 1000, "maximum full-resolution snapshots per pair")
+	fs.DurationVar(&snapshotConfig.SampleEvery, "snapshot-sample", time.Minute, "snapshot resolution after the early window")
+	instance := fs.String("instance", "", "name of this instance when running several against one directory; state files get it as a suffix")
+	otlpEndpoint := fs.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP/HTTP endpoint to export pipeline traces and metrics to, e.g. http://localhost:4318 (empty to disable)")
+	traceSample := fs.Float64("trace-sample", 1.0, "share of frames to trace (0-1)")
+	var chaos ChaosConfig
+	fs.DurationVar(&chaos.Latency, "chaos-latency", 0, "resilience testing: delay every frame by this much")
+	fs.DurationVar(&chaos.Jitter, "chaos-jitter", 0, "resilience testing: add up to this much random delay per frame")
+	fs.Float64Var(&chaos.DropRate, "chaos-drop", 0, "resilience testing: share of frames to drop (0-1)")
+	fs.Float64Var(&chaos.DisconnectRate, "chaos-disconnect", 0, "resilience testing: chance per frame of a simulated disconnect (0-1)")
+	fs.DurationVar(&chaos.Outage, "chaos-outage", 10*time.Second, "resilience testing: how long a simulated disconnect lasts")
+	chaosSeed := fs.Uint64("chaos-seed", 0, "seed for chaos injection (0 for random)")
+	fs.BoolVar(&hexAddresses, "hex-addresses", false, "print and record addresses as hex instead of base58 (debugging)")
+	followEndpoint := fs.Bool("follow-endpoint", false, "move to the endpoint the server advertises, if it is in the configured endpoint's domain")
+	warmUpWindow := fs.Duration("warmup", 0, "after a connection (re)connects, treat its discoveries as pre-existing pairs and hold back the alerts they trigger for this long (0 to disable)")
+	warmUpMessages := fs.Int("warmup-messages", 0, "end a connection's warm-up after this many Pairs messages on it, or after -warmup if that comes first (0 to disable)")
+	fs.DurationVar(&priceStaleAfter, "stale-price", time.Minute, "age at which a pair's last price counts as stale in the API and is ignored by rules and exits (0 to disable)")
+	buildSubscription := subscriptionFlags(fs)
+	applyVerbosity := verbosityFlags(fs)
+	applyPairTable := pairTableFlags(fs)
+	fs.Parse(args)
+	applyVerbosity()
+	if err := applyPairTable(); err != nil {
+		return err
+	}
+	instanceFiles(fs, stateDir(*schemaVersionPath), *instance, "tombstones", "launch-rates", "alert-state", "notes", "snapshots", "raw-capture", "schema-version")
+
+	if *connections < 1 {
+		*connections = 1
+	}
+	if *throughputWarn < 0 || *throughputWarn >= 1 {
+		return fmt.Errorf("-throughput-warn must be in [0, 1), got %g", *throughputWarn)
+	}
+
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	lock, err := AcquireLock(stateDir(*schemaVersionPath), *instance)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	migrator := &Migrator{
+		Files: StateFiles{
+			Tombstones:  *tombstonePath,
+			LaunchRates: *launchRatesPath,
+			AlertState:  *alertStatePath,
+			Notes:       *notesPath,
+			Snapshots:   snapshotConfig.Dir,
+		},
+		VersionPath: *schemaVersionPath,
+		BackupDir:   *backupDir,
+	}
+	if err := migrateState(migrator); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	sub, err := buildSubscription(config)
+	if err != nil {
+		return err
+	}
+
+	store := NewPairStore()
+
+	frameChan := make(chan Frame)
+	errorChan := make(chan error)
+
+	streamFrames := frameChan
+	if chaos.Enabled() {
+		seed := *chaosSeed
+		if seed == 0 {
+			seed = uint64(time.Now().UnixNano())
+		}
+		color.Yellow("Chaos injection enabled (seed %d): %+v", seed, chaos)
+		streamFrames = make(chan Frame)
+		go NewChaos(chaos, seed).Pipe(ctx, streamFrames, frameChan, errorChan)
+	}
+
+	streams := make([]*Stream, *connections)
+	for id := range streams {
+		stream := &Stream{
+			ID:              id,
+			Subscription:    sub,
+			Store:           store,
+			RecoveryTimeout: *recoveryTimeout,
+			MaxReconnects:   *maxReconnects,
+			FollowEndpoint:  *followEndpoint,
+			Solver:          config.Challenge.Solver(),
+			Clearance:       config.Challenge.Clearance(),
+			Compression:     *compression,
+			Logf:            logStream,
+		}
+		streams[id] = stream
+		go stream.Run(ctx, streamFrames, errorChan)
+	}
+
+	bus := NewEventBus()
+	// ahead of the alert control, so alerts dropped here are not counted
+	// as recent
+	warmUp := NewWarmUp(*warmUpWindow, *warmUpMessages)
+	if warmUp != nil {
+		bus.Filter(warmUp.Filter)
+	}
+	alertControl, err := NewAlertControl(*alertStatePath)
+	if err != nil {
+		return err
+	}
+	bus.Filter(alertControl.Filter)
+	notes, err := NewNotes(*notesPath)
+	if err != nil {
+		return err
+	}
+	bus.Filter(notes.Filter)
+	localizer, err := config.Localizer(store)
+	if err != nil {
+		return err
+	}
+	if localizer != nil {
+		bus.Filter(localizer.Filter)
+	}
+	var icons *IconCache
+	if *iconDir != "" {
+		if icons, err = NewIconCache(*iconDir); err != nil {
+			return err
+		}
+		bus.Filter(icons.Filter)
+		bus.Subscribe(icons.Observe)
+		go icons.Run(ctx)
+	}
+	watchlist := NewWatchlist(notes)
+	if *watchlistPath != "" {
+		entries, err := LoadWatchlist(*watchlistPath)
+		if err != nil {
+			return err
+		}
+		if err := watchlist.Add(entries); err != nil {
+			return err
+		}
+		color.Blue("Watching %d pairs and mints from %s", len(entries), *watchlistPath)
+	}
+	bus.Subscribe(printEvent)
+	connMonitor := NewConnMonitor(streams, bus, *throughputWarn)
+	connTicker := time.NewTicker(connStatsInterval)
+	defer connTicker.Stop()
+
+	tracer := NewTracer(*otlpEndpoint, *traceSample)
+	go tracer.Run()
+	// deferred before the pipelines so their last delivery spans are
+	// exported too
+	defer tracer.Close()
+
+	clock := NewBlockClock()
+	origin := NewOrigin(sub)
+	var pipelines []*Pipeline
+	for _, sinkConfig := range config.Sinks {
+		pipeline, err := NewPipeline(ctx, sinkConfig, origin, clock, tracer)
+		if err != nil {
+			return fmt.Errorf("sink %s: %v", sinkConfig.Name, err)
+		}
+		defer pipeline.Close()
+		bus.Subscribe(pipeline.Observe)
+		pipelines = append(pipelines, pipeline)
+	}
+
+	lifecycleConfig := DefaultLifecycleConfig()
+	lifecycleConfig.GraduationMarketCap = *graduationMarketCap
+	lifecycle := NewLifecycleTracker(lifecycleConfig, bus, clock)
+
+	var tombstones *TombstoneStore
+	if *tombstonePath != "" {
+		var err error
+		tombstones, err = OpenTombstoneStore(*tombstonePath)
+		if err != nil {
+			return err
+		}
+		defer tombstones.Close()
+	}
+
+	reaperConfig := DefaultReaperConfig()
+	reaperConfig.StaleAfter = *staleAfter
+	reaperConfig.RugDrawdown = *rugDrawdown
+	reaper := NewReaper(reaperConfig, store, lifecycle, tombstones, bus)
+	sweepTicker := time.NewTicker(30 * time.Second)
+	defer sweepTicker.Stop()
+
+	stats := NewStatsCollector(*statsWindow, lifecycleConfig.TokenSupply, store)
+	bus.Subscribe(stats.Observe)
+
+	launchRates, err := NewLaunchRates(*launchRatesPath, origin)
+	if err != nil {
+		return err
+	}
+	bus.Subscribe(launchRates.Observe)
+	defer launchRates.Save(time.Now())
+
+	if snapshotConfig.Dir != "" {
+		snapshots, err := NewSnapshotRecorder(snapshotConfig, store)
+		if err != nil {
+			return err
+		}
+		defer snapshots.Close()
+		bus.Subscribe(snapshots.Observe)
+	}
+
+	bus.Subscribe(NewAgeMetrics(checkpointAges, store, bus).Observe)
+
+	leaderboard := NewLeaderboard(lifecycleConfig.TokenSupply, store, notes)
+	bus.Subscribe(leaderboard.Observe)
+
+	candles := NewCandleStore(SystemClock)
+	bus.Subscribe(candles.Observe)
+
+	var holders *HolderTracker
+	if config.Holders != nil {
+		if holders, err = NewHolderTracker(*config.Holders, bus); err != nil {
+			return err
+		}
+		defer holders.Close()
+		bus.Subscribe(holders.Observe)
+		go holders.Run(ctx)
+	}
+
+	if *anomalyThreshold > 0 {
+		anomalyConfig := DefaultAnomalyConfig()
+		anomalyConfig.Threshold = *anomalyThreshold
+		bus.Subscribe(NewAnomalyDetector(anomalyConfig, bus).Observe)
+	}
+
+	// always running so alerts can be added over REST
+	rules := NewRulesEngine(config.Rules, config.NumberLocale(), config.CostModel(), SystemClock, bus)
+	bus.Subscribe(rules.Observe)
+
+	var trader *Trader
+	if config.Trading != nil {
+		var executor Executor = NewPaperExecutor(store, bus)
+		if config.Trading.Mode == "live" {
+			executor, err = NewLiveExecutor(*config.Executor, bus)
+			if err != nil {
+				return err
+			}
+		}
+		trader, err = NewTrader(*config.Trading, executor, config.CostModel(), store, bus)
+		if err != nil {
+			return err
+		}
+		defer trader.Close()
+		bus.Subscribe(trader.Observe)
+		rules.SizeBy(trader.NextSize)
+	}
+
+	if config.Telegram != nil {
+		bot, err := NewTelegramBot(*config.Telegram, config.NumberLocale(), store, leaderboard, trader, alertControl, notes)
+		if err != nil {
+			return err
+		}
+		bus.Subscribe(bot.Observe)
+		go bot.Run(ctx)
+	}
+	if trader != nil {
+		trader.Reconcile()
+	}
+
+	decodeWarnings := NewDecodeWarnings(*strict)
+
+	pruner := NewPruner(SystemClock, config.Retention, snapshotConfig.Dir, tombstones)
+	pruneTicker := time.NewTicker(pruner.Interval())
+	defer pruneTicker.Stop()
+
+	var statsTick <-chan time.Time
+	if *statsInterval > 0 {
+		statsTicker := time.NewTicker(*statsInterval)
+		defer statsTicker.Stop()
+		statsTick = statsTicker.C
+	}
+
+	var digestTick <-chan time.Time
+	if *digestInterval > 0 {
+		digestTicker := time.NewTicker(*digestInterval)
+		defer digestTicker.Stop()
+		digestTick = digestTicker.C
+	}
+
+	metrics := NewMetrics()
+	registerStatsMetrics(metrics, stats)
+	registerSinkMetrics(metrics, pipelines)
+	registerLaunchRateMetrics(metrics, launchRates)
+	registerTracerMetrics(metrics, tracer)
+	registerDecodeWarningMetrics(metrics, decodeWarnings)
+	registerConnMetrics(metrics, connMonitor)
+	tracer.ExportMetrics(metrics)
+
+	if *httpAddr != "" {
+		server := NewServer(*httpAddr)
+		if config.HTTP != nil {
+			if err := server.Secure(config.HTTP); err != nil {
+				return fmt.Errorf("http: %v", err)
+			}
+		}
+		server.Handle("/metrics", metrics)
+		server.HandleJSON("/stats", func(r *http.Request) (any, error) {
+			return stats.Compute(time.Now()), nil
+		})
+		server.HandleJSON("/status", connMonitor.HandleStatus)
+		server.HandleJSON("/top", leaderboard.HandleTop)
+		server.Handle("/pairs", HandlePairs(store, notes))
+		server.HandleJSON("GET /pairs/changes", HandlePairChanges(store, notes))
+		server.Handle("/schema", http.HandlerFunc(HandleSchema))
+		RegisterRules(server, rules)
+		server.HandleJSON("/launch-rates", launchRates.HandleLaunchRates)
+		if snapshotConfig.Dir != "" {
+			server.HandleJSON("/compare", HandleCompare(snapshotConfig.Dir, lifecycleConfig.TokenSupply))
+		}
+		RegisterAlertControl(server, alertControl)
+		RegisterNotes(server, notes)
+		RegisterWatchlist(server, watchlist)
+		RegisterUDF(server, candles)
+		if trader != nil {
+			server.HandleJSON("GET /positions", trader.HandlePositions)
+			server.HandleJSON("POST /positions", trader.HandlePositions)
+		}
+		if holders != nil {
+			server.HandleJSON("GET /holders/{pair}", holders.HandleHolders)
+		}
+		if icons != nil {
+			server.Handle("GET /icons/{pair}", http.HandlerFunc(icons.HandleIcon))
+		}
+		RegisterGraphQL(server, NewGraphQL(store, notes, candles, trader, snapshotConfig.Dir))
+		if server.Authenticated() {
+			// only behind admin tokens over TCP
+			RegisterAdmin(server, NewAdmin(pipelines, streams))
+		}
+		if err := server.Start(ctx); err != nil {
+			return err
+		}
+	}
+	if *adminSocket != "" {
+		server := NewUnixServer(*adminSocket)
+		RegisterAdmin(server, NewAdmin(pipelines, streams))
+		if err := server.Start(ctx); err != nil {
+			return err
+		}
+	}
+
+	handler := NewHandler(bus, NewGapDetector(uint32(*gapThreshold)), SystemClock, clock, store, lifecycle, decodeWarnings, tracer, warmUp)
+	if *backfill {
+		backfiller := NewRESTBackfiller(store.Addresses)
+		bus.Subscribe(func(event Event) {
+			if gap, ok := event.(*GapDetectedEvent); ok {
+				go func() {
+					result, err := backfiller.Backfill(ctx, gap)
+					if err != nil {
+						color.Red("Backfill error: %v", err)
+						return
+					}
+					bus.Publish(result)
+				}()
+			}
+		})
+	}
+
+	dedup := NewDeduplicator(*dedupWindow)
+	var recording *bufio.Writer
+	if *recordPath != "" {
+		file, err := os.OpenFile(*recordPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("open recording: %v", err)
+		}
+		defer file.Close()
+		recording = bufio.NewWriter(file)
+		defer recording.Flush()
+	}
+	var parseMonitor *ParseMonitor
+	if *parseErrorRate > 0 {
+		parseMonitor = NewParseMonitor(*parseErrorWindow, *parseErrorRate, *rawCapturePath, bus)
+		defer parseMonitor.Close()
+	}
+	alive := *connections
+
+	// watchlist polls run in the background and hand their pairs back
+	// here, so only this loop touches the handler
+	if *watchlistInterval <= 0 {
+		return errors.New("-watchlist-interval must be positive")
+	}
+	watchlistTicker := time.NewTicker(*watchlistInterval)
+	defer watchlistTicker.Stop()
+	watchlistPairs := make(chan []RESTPair, 1)
+	polling := false
+	pollWatchlist := func() {
+		if polling || watchlist.Len() == 0 {
+			return
+		}
+		polling = true
+		go func() {
+			pairs, err := watchlist.Poll(ctx)
+			if err != nil && ctx.Err() == nil {
+				color.Red("Watchlist poll error: %v", err)
+			}
+			watchlistPairs <- pairs
+		}()
+	}
+	pollWatchlist()
+
+	for {
+		select {
+		case <-ctx.Done():
+			color.Yellow("Shutting down")
+			return nil
+		case frame := <-frameChan:
+			if dedup.IsDuplicate(frame) {
+				frame.Release()
+				continue
+			}
+			if recording != nil {
+				if err := protocol.WriteFrame(recording, frame.Data); err != nil {
+					color.Red("Error recording frame: %v", err)
+				}
+			}
+			span := tracer.StartFrame("frame")
+			span.SetAttr("conn", frame.ConnID)
+			span.SetAttr("bytes", len(frame.Data))
+			deactivate := tracer.Activate(span)
+			err := handler.HandleFrame(frame)
+			deactivate()
+			span.SetError(err)
+			span.End()
+			if err != nil {
+				color.Red("Error handling message: %v", err)
+			}
+			if parseMonitor != nil {
+				parseMonitor.Observe(frame, err, time.Now())
+			}
+			frame.Release()
+		case <-watchlistTicker.C:
+			pollWatchlist()
+		case pairs := <-watchlistPairs:
+			polling = false
+			handler.StoreRESTPairs(pairs)
+		case now := <-connTicker.C:
+			connMonitor.Sample(now)
+		case now := <-sweepTicker.C:
+			reaper.Sweep(now)
+			if err := launchRates.Save(now); err != nil {
+				color.Red("Error saving launch rates: %v", err)
+			}
+		case <-pruneTicker.C:
+			go func() {
+				result, err := pruner.Prune()
+				if err != nil {
+					color.Red("Prune error: %v", err)
+				}
+				if len(result.Files) > 0 || result.Tombstones > 0 {
+					fmt.Fprintf(console, "Pruned %d snapshot files and %d tombstones\n", len(result.Files), result.Tombstones)
+				}
+			}()
+		case now := <-statsTick:
+			if verbosity.Load() > verbosityQuiet {
+				printMarketStats(stats.Compute(now))
+			}
+		case now := <-digestTick:
+			var trades []Attribution
+			if trader != nil {
+				trades = attribute(trader.Closed(now.Add(-*digestInterval)))
+			}
+			printDigest(stats.Compute(now), leaderboard.Compute(*digestInterval, *topLimit, now), trades)
+		case err := <-errorChan:
+			if errors.Is(err, ErrSourceDone) {
+				// a recording played to the end is not a failure
+				color.Yellow("Stream ended: %v", err)
+				if alive--; alive == 0 {
+					return nil
+				}
+				continue
+			}
+			color.Red("Stream error: %v", err)
+			if errors.Is(err, ErrStreamClosed) {
+				alive--
+				if alive == 0 {
+					return errors.New("all connections closed")
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/piotrostr/moon/protocol"
+)
+
+// schemaEvents are the events sinks receive, keyed by the record's event
+// name. Events whose name depends on their content appear once per name.
+func schemaEvents() []struct {
+	name  string
+	event Event
+} {
+	events := []Event{
+		&PairUpdatedEvent{}, &GapDetectedEvent{}, &BackfillCompletedEvent{},
+		&PairDeadEvent{}, &PairDeadEvent{Tombstone: Tombstone{Rugged: true}},
+		&AnomalyDetectedEvent{}, &ExecutionConfirmedEvent{}, &ExecutionFailedEvent{},
+		&PositionOpenedEvent{}, &PositionClosedEvent{}, &BuySignalEvent{}, &AlertEvent{},
+		&AgeCheckpointEvent{}, &HolderSampledEvent{},
+	}
+	for state := StateDiscovered; state <= StateDead; state++ {
+		events = append(events, &PairTransitionEvent{To: state})
+	}
+
+	named := make([]struct {
+		name  string
+		event Event
+	}, len(events))
+	for i, event := range events {
+		named[i].name, named[i].event = event.EventName(), event
+	}
+	return named
+}
+
+var schemaMessages = []any{
+	protocol.LatestBlockHashMessage{}, protocol.PairsMessage{}, protocol.PingMessage{},
+}
+
+// Schema is moon's output as a JSON Schema document: one definition per
+// sink payload, as produced before any sink transform or redaction, and
+// one per decoded message annotated with the confidence of its fields.
+func Schema() map[string]any {
+	defs := make(map[string]any)
+	var records []any
+	for _, e := range schemaEvents() {
+		schema := recordSchema(e.name, reflect.TypeOf(e.event))
+		if prev, ok := defs[e.name]; ok {
+			// the reaper and the lifecycle both emit pair_dead
+			defs[e.name] = map[string]any{"anyOf": []any{prev, schema}}
+			continue
+		}
+		defs[e.name] = schema
+		records = append(records, map[string]string{"$ref": "#/$defs/" + e.name})
+	}
+	for _, msg := range schemaMessages {
+		t := reflect.TypeOf(msg)
+		schema := jsonSchema(t)
+		props := schema["properties"].(map[string]any)
+		for i := 0; i < t.NumField(); i++ {
+			name := t.Name() + "." + t.Field(i).Name
+			annotateField(props[t.Field(i).Name].(map[string]any), name)
+		}
+		if t == reflect.TypeOf(protocol.PairsMessage{}) {
+			pair := props["Pairs"].(map[string]any)["items"].(map[string]any)
+			for name, prop := range pair["properties"].(map[string]any) {
+				annotateField(prop.(map[string]any), "PairData."+name)
+			}
+		}
+		defs[t.Name()] = schema
+	}
+	defs["envelope"] = map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"schemaVersion": map[string]any{"const": EnvelopeVersion},
+			"source":        map[string]any{"enum": []string{SourceWebsocket, SourceREST, SourceReplay, SourceRPC, SourceInternal}},
+			"receivedAt":    map[string]any{"type": "string", "format": "date-time"},
+			"chain":         map[string]any{"type": "string", "description": "the pair's chain, empty when the subscription has several"},
+			"dex":           map[string]any{"type": "string", "description": "the pair's dex, empty when the subscription has several"},
+			"payload":       map[string]any{"oneOf": records},
+		},
+		"required": append(slices.Clone(envelopeFields), "payload"),
+	}
+	return map[string]any{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "moon sink record",
+		"description": "One record as delivered to a sink: an event's payload, or an envelope around it for sinks with the envelope option; decoded message definitions are under $defs.",
+		"oneOf":       append([]any{map[string]string{"$ref": "#/$defs/envelope"}}, records...),
+		"$defs":       defs,
+	}
+}
+
+func annotateField(schema map[string]any, name string) {
+	for _, f := range protocol.Fields {
+		if f.Name == name {
+			schema["description"] = f.Basis
+			schema["x-confidence"] = f.Confidence.String()
+		}
+	}
+}
+
+// recordSchema mirrors flatten: nested structs are inlined and addresses,
+// times and durations take their record forms.
+func recordSchema(event string, t reflect.Type) map[string]any {
+	props := map[string]any{
+		"event":       map[string]any{"const": event},
+		"eventId":     map[string]any{"type": "string", "description": "deterministic event ID for deduplication"},
+		"serverBlock": map[string]any{"type": "integer"},
+		"receivedAt":  map[string]any{"type": "string", "format": "date-time", "description": "without the envelope option"},
+	}
+	recordProperties(props, t, recordNameCounts(t))
+	// fields of nil nested pointers are left out, so only event is certain
+	return map[string]any{"type": "object", "properties": props, "required": []string{"event"}}
+}
+
+// recordNameCounts counts t's record names as flatten does for an event,
+// whose record starts with event.
+func recordNameCounts(t reflect.Type) map[string]int {
+	counts := map[string]int{"event": 1}
+	countRecordNames(t, "", make(map[[2]string]bool), counts)
+	return counts
+}
+
+func recordProperties(props map[string]any, t reflect.Type, counts map[string]int) {
+	recordPropertiesFrom(props, t, counts, "")
+}
+
+func recordPropertiesFrom(props map[string]any, t reflect.Type, counts map[string]int, prefix string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		ft := field.Type
+		if field.Anonymous {
+			recordPropertiesFrom(props, ft, counts, prefix)
+			continue
+		}
+		if isNestedRecord(field) {
+			recordPropertiesFrom(props, ft, counts, recordFieldName(field))
+			continue
+		}
+
+		name := recordFieldName(field)
+		if name != "-" {
+			name = recordKey(prefix, name, counts)
+		}
+		switch {
+		case name == "-":
+		case ft == durationType:
+			props[name] = map[string]any{"type": "number", "description": "seconds"}
+		case ft == addressType:
+			props[name] = map[string]any{"type": "string", "description": "base58 address"}
+		case ft.Kind() == reflect.Array:
+		default:
+			props[name] = jsonSchema(ft)
+		}
+	}
+}
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// jsonSchema describes t as encoding/json writes it.
+func jsonSchema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Int && t.Implements(stringerType):
+		// enums are written by name in records
+		return map[string]any{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Array:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		props := make(map[string]any)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Name
+			if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+			props[name] = jsonSchema(field.Type)
+		}
+		return map[string]any{"type": "object", "properties": props}
+	}
+	return map[string]any{}
+}
+
+// ProtoSchema renders the envelope and the payloads as proto3 messages.
+// Proto sinks send google.protobuf.Struct, whose keys are these field
+// names, so the messages are for converting a Struct into typed code. Field numbers
+// follow declaration order and can shift when fields are added.
+func ProtoSchema() string {
+	var b strings.Builder
+	b.WriteString("syntax = \"proto3\";\n\npackage moon;\n\nimport \"google/protobuf/struct.proto\";\nimport \"google/protobuf/timestamp.proto\";\n")
+	b.WriteString("\n// the record with the envelope option; payload holds one of the messages below\nmessage Envelope {\n" +
+		"  uint32 schemaVersion = 1;\n  string source = 2;\n  google.protobuf.Timestamp receivedAt = 3;\n" +
+		"  string chain = 4;\n  string dex = 5;\n  google.protobuf.Struct payload = 6;\n}\n")
+	seen := make(map[string]bool)
+	for _, e := range schemaEvents() {
+		message := protoMessageName(e.name)
+		if seen[message] {
+			message = strings.TrimSuffix(reflect.TypeOf(e.event).Elem().Name(), "Event") + "Record"
+		}
+		seen[message] = true
+
+		props := map[string]any{}
+		counts := recordNameCounts(reflect.TypeOf(e.event))
+		recordProperties(props, reflect.TypeOf(e.event), counts)
+		var names []string
+		fields := make(map[string]bool)
+		// receivedAt and the nested fields renamed for repeating a name
+		// come last, so adding them kept the other field numbers
+		plain, renamed := recordFieldOrder(reflect.TypeOf(e.event), props, counts, "")
+		order := append([]string{"event", "eventId", "serverBlock"}, plain...)
+		order = append(append(order, "receivedAt"), renamed...)
+		for _, name := range order {
+			if !fields[name] {
+				fields[name] = true
+				names = append(names, name)
+			}
+		}
+
+		fmt.Fprintf(&b, "\n// %s\nmessage %s {\n", e.name, message)
+		for i, name := range names {
+			var typ string
+			switch name {
+			case "event", "eventId":
+				typ = "string"
+			case "serverBlock":
+				typ = "uint32"
+			case "receivedAt":
+				typ = "google.protobuf.Timestamp"
+			default:
+				typ = protoType(props[name].(map[string]any))
+			}
+			fmt.Fprintf(&b, "  %s %s = %d;\n", typ, name, i+1)
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// recordFieldOrder lists the names in props in struct declaration order,
+// and separately those renamed for repeating a name.
+func recordFieldOrder(t reflect.Type, props map[string]any, counts map[string]int, prefix string) (plain, renamed []string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isNestedRecord(field) {
+			nested := prefix
+			if !field.Anonymous {
+				nested = recordFieldName(field)
+			}
+			p, r := recordFieldOrder(field.Type, props, counts, nested)
+			plain, renamed = append(plain, p...), append(renamed, r...)
+			continue
+		}
+		// a renamed field leaves its plain name where it was, as it was
+		// numbered before renaming
+		name := recordFieldName(field)
+		if key := recordKey(prefix, name, counts); key != name && props[key] != nil {
+			renamed = append(renamed, key)
+		}
+		if props[name] != nil {
+			plain = append(plain, name)
+		}
+	}
+	return plain, renamed
+}
+
+func protoType(schema map[string]any) string {
+	switch schema["type"] {
+	case "boolean":
+		return "bool"
+	case "integer":
+		return "int64"
+	case "number":
+		return "double"
+	case "string":
+		if schema["format"] == "date-time" {
+			return "google.protobuf.Timestamp"
+		}
+		return "string"
+	case "array":
+		if item := protoType(schema["items"].(map[string]any)); !strings.HasPrefix(item, "repeated ") {
+			return "repeated " + item
+		}
+	}
+	// nested objects stay JSON
+	return "string"
+}
+
+func protoMessageName(event string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(event, "_") {
+		runes := []rune(part)
+		if len(runes) > 0 {
+			runes[0] = unicode.ToUpper(runes[0])
+		}
+		b.WriteString(string(runes))
+	}
+	return b.String() + "Record"
+}
+
+// HandleSchema serves Schema, or ProtoSchema with ?format=proto.
+func HandleSchema(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("format") == "proto" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, ProtoSchema())
+		return
+	}
+	writeJSON(w, http.StatusOK, Schema())
+}
+
+// runSchema implements `moon schema`.
+func runSchema(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	format := fs.String("format", "jsonschema", "jsonschema or proto")
+	fs.Parse(args)
+
+	switch *format {
+	case "jsonschema", "json":
+		data, err := json.MarshalIndent(Schema(), "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	case "proto":
+		fmt.Fprint(console, ProtoSchema())
+		return nil
+	default:
+		return fmt.Errorf("unknown schema format: %q", *format)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretProvider resolves a reference like "TELEGRAM_TOKEN" or
+// "secret/moon#webhook" to its value.
+type SecretProvider interface {
+	Resolve(ref string) (string, error)
+}
+
+// secretRef matches ${provider:ref} inside config values.
+var secretRef = regexp.MustCompile(`\$\{(\w+):([^}]+)\}`)
+
+// Secrets expands secret references in config values and remembers every
+// resolved value so it can be scrubbed from log output.
+type Secrets struct {
+	providers map[string]SecretProvider
+
+	mu       sync.RWMutex
+	resolved []string
+}
+
+func NewSecrets() *Secrets {
+	return &Secrets{
+		providers: map[string]SecretProvider{
+			"env":   envSecrets{},
+			"file":  fileSecrets{},
+			"vault": newVaultSecrets(),
+			"sops":  sopsSecrets{},
+		},
+	}
+}
+
+// secrets is shared so the console and event records can be scrubbed of
+// resolved values.
+var secrets = NewSecrets()
+
+func (s *Secrets) Expand(value string) (string, error) {
+	var firstErr error
+	expanded := secretRef.ReplaceAllStringFunc(value, func(match string) string {
+		parts := secretRef.FindStringSubmatch(match)
+		provider, ok := s.providers[parts[1]]
+		if !ok {
+			firstErr = errors.Join(firstErr, fmt.Errorf("unknown secret provider: %q", parts[1]))
+			return match
+		}
+		secret, err := provider.Resolve(parts[2])
+		if err != nil {
+			firstErr = errors.Join(firstErr, fmt.Errorf("resolve %s secret %q: %v", parts[1], parts[2], err))
+			return match
+		}
+		s.remember(secret)
+		return secret
+	})
+	return expanded, firstErr
+}
+
+func (s *Secrets) remember(secret string) {
+	if secret == "" {
+		return
+	}
+	s.mu.Lock()
+	s.resolved = append(s.resolved, secret)
+	s.mu.Unlock()
+}
+
+// Redact replaces every resolved secret in text with a placeholder.
+func (s *Secrets) Redact(text string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, secret := range s.resolved {
+		text = strings.ReplaceAll(text, secret, "[REDACTED]")
+	}
+	return text
+}
+
+func redactSecrets(text string) string {
+	return secrets.Redact(text)
+}
+
+// redactingWriter scrubs resolved secrets from everything written to w.
+// main wraps the colored console in it, so no log line needs to redact
+// itself.
+type redactingWriter struct {
+	w io.Writer
+}
+
+// console is standard output for plain console lines, scrubbed like the
+// colored ones; print with fmt.Fprintf(console, ...), not fmt.Printf.
+var console io.Writer = redactingWriter{os.Stdout}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, redactSecrets(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+type envSecrets struct{}
+
+func (envSecrets) Resolve(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", errors.New("environment variable not set")
+	}
+	return value, nil
+}
+
+type fileSecrets struct{}
+
+func (fileSecrets) Resolve(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// vaultSecrets reads a key from a Vault KV v2 secret: ${vault:secret/moon#token}.
+// VAULT_ADDR and VAULT_TOKEN configure the server.
+type vaultSecrets struct {
+	client *http.Client
+}
+
+func newVaultSecrets() *vaultSecrets {
+	return &vaultSecrets{client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (v *vaultSecrets) Resolve(ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok {
+		return "", errors.New("vault reference must be path#key")
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", errors.New("VAULT_ADDR not set")
+	}
+
+	mount, rest, _ := strings.Cut(path, "/")
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+mount+"/data/"+rest, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s", resp.Status)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	value, ok := body.Data.Data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("key %q not found", key)
+	}
+	return value, nil
+}
+
+// sopsSecrets decrypts a SOPS-encrypted JSON or YAML file with the sops CLI
+// and extracts a top-level key: ${sops:secrets.enc.json#telegram_token}.
+type sopsSecrets struct{}
+
+func (sopsSecrets) Resolve(ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok {
+		return "", errors.New("sops reference must be file#key")
+	}
+
+	out, err := exec.Command("sops", "--decrypt", "--extract", fmt.Sprintf(`["%s"]`, key), path).Output()
+	if err != nil {
+		return "", fmt.Errorf("sops: %v", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
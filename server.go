@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Server is the embedded HTTP server for REST endpoints and metrics.
+type Server struct {
+	network string
+	addr    string
+	mux     *http.ServeMux
+	tokens  []APIToken
+	tls     *tls.Config
+	// readOnly are patterns read tokens may call with any method
+	readOnly map[string]bool
+}
+
+// Limits for every request; handlers may cap bodies lower. Nothing
+// streams responses, so a slow client cannot hold a connection past
+// these.
+const (
+	httpMaxBody           = 4 << 20
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = 30 * time.Second
+	httpIdleTimeout       = 2 * time.Minute
+)
+
+func NewServer(addr string) *Server {
+	return &Server{network: "tcp", addr: addr, mux: http.NewServeMux()}
+}
+
+// NewUnixServer serves on a unix socket at path that only the user
+// running moon can connect to. A socket left at path by an instance that
+// did not shut down cleanly is replaced.
+func NewUnixServer(path string) *Server {
+	return &Server{network: "unix", addr: path, mux: http.NewServeMux()}
+}
+
+// Secure requires the config's tokens on every request and serves TLS
+// when it has a tls section. It must be called before Start.
+func (s *Server) Secure(config *HTTPConfig) error {
+	s.tokens = config.Tokens
+	if config.TLS == nil {
+		return nil
+	}
+	var err error
+	s.tls, err = config.TLS.tlsConfig()
+	return err
+}
+
+// Authenticated reports whether requests need a token.
+func (s *Server) Authenticated() bool { return len(s.tokens) > 0 }
+
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleRead registers a handler that changes nothing whatever the
+// request method, so read tokens may call it.
+func (s *Server) HandleRead(pattern string, handler http.Handler) {
+	if s.readOnly == nil {
+		s.readOnly = make(map[string]bool)
+	}
+	s.readOnly[pattern] = true
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleJSON registers fn and writes its result as JSON.
+func (s *Server) HandleJSON(pattern string, fn func(r *http.Request) (any, error)) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		result, err := fn(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+}
+
+// Start serves in the background until ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	listener, err := s.listen()
+	if err != nil {
+		return err
+	}
+	var handler http.Handler = limitBody(s.mux)
+	if s.Authenticated() {
+		handler = s.authorize(handler)
+	}
+	if s.tls != nil {
+		listener = tls.NewListener(listener, s.tls)
+	}
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       httpReadTimeout,
+		IdleTimeout:       httpIdleTimeout,
+	}
+	fmt.Fprintln(console, "HTTP server listening on", s.addr)
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			color.Red("HTTP server error: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+	return nil
+}
+
+// limitBody caps request bodies at httpMaxBody.
+func limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, httpMaxBody)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) listen() (net.Listener, error) {
+	if s.network != "unix" {
+		listener, err := net.Listen(s.network, s.addr)
+		if err != nil {
+			return nil, fmt.Errorf("http listen: %v", err)
+		}
+		return listener, nil
+	}
+
+	if info, err := os.Lstat(s.addr); err == nil {
+		if info.Mode().Type() != os.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", s.addr)
+		}
+		if conn, err := net.Dial("unix", s.addr); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another instance", s.addr)
+		}
+		os.Remove(s.addr)
+	}
+	listener, err := net.Listen("unix", s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("unix listen: %v", err)
+	}
+	if err := os.Chmod(s.addr, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("unix listen: %v", err)
+	}
+	return listener, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink delivers encoded payloads to an external destination. key is the
+// event's ID, for destinations with their own deduplication.
+type Sink interface {
+	Deliver(ctx context.Context, payload []byte, contentType, key string) error
+}
+
+type SinkConfig struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	URL  string `json:"url,omitempty"`
+	Path string `json:"path,omitempty"`
+	// Prefix starts the redis sink's channels and keys, moon: by default;
+	// TTL expires pair hashes that stop updating.
+	Prefix string   `json:"prefix,omitempty"`
+	TTL    Duration `json:"ttl,omitempty"`
+	// Topic is the mqtt sink's topic, with {field} filled in from the
+	// payload or the envelope, moon/{event} by default. QoS is 0, 1 or 2, and Retain keeps
+	// each topic's last message on the broker for new subscribers.
+	Topic  string `json:"topic,omitempty"`
+	QoS    int    `json:"qos,omitempty"`
+	Retain bool   `json:"retain,omitempty"`
+	// Language sends alert messages rendered from that language's
+	// catalog, see Catalog. Template overrides the catalog's templates for
+	// this sink's alerts; it sees the same fields, numbers formatted for
+	// Language.
+	Language  string          `json:"language,omitempty"`
+	Template  string          `json:"template,omitempty"`
+	Filter    FilterConfig    `json:"filter"`
+	Transform TransformConfig `json:"transform"`
+	Redact    []RedactionRule `json:"redact,omitempty"`
+	Encoding  string          `json:"encoding"`
+	// Envelope wraps each record in the versioned envelope described in
+	// VERSIONING.md; without it the sink gets the payload alone.
+	Envelope bool        `json:"envelope,omitempty"`
+	Retry    RetryConfig `json:"retry"`
+	// Outbox is a file that keeps deliveries the sink could not make
+	// until they succeed, across restarts. Without one they are lost.
+	Outbox string `json:"outbox,omitempty"`
+}
+
+// RetryConfig is a sink's restart policy. Failed deliveries are retried
+// with doubling Backoff; after BreakAfter consecutive failed events the
+// sink is paused for Cooldown, and after MaxPanics panics it is disabled.
+type RetryConfig struct {
+	Attempts   int      `json:"attempts,omitempty"`
+	Backoff    Duration `json:"backoff,omitempty"`
+	BreakAfter int      `json:"breakAfter,omitempty"`
+	Cooldown   Duration `json:"cooldown,omitempty"`
+	MaxPanics  int      `json:"maxPanics,omitempty"`
+}
+
+func (c *RetryConfig) setDefaults() {
+	if c.Attempts <= 0 {
+		c.Attempts = 3
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = Duration(time.Second)
+	}
+	if c.BreakAfter <= 0 {
+		c.BreakAfter = 10
+	}
+	if c.Cooldown <= 0 {
+		c.Cooldown = Duration(time.Minute)
+	}
+	if c.MaxPanics <= 0 {
+		c.MaxPanics = 5
+	}
+}
+
+// sinkName is the sink's name, or its type when unnamed.
+func (c SinkConfig) sinkName() string {
+	if c.Name == "" {
+		return c.Type
+	}
+	return c.Name
+}
+
+func (c SinkConfig) Validate() error {
+	switch c.Type {
+	case "stdout":
+	case "file":
+		if c.Path == "" {
+			return errors.New("file sink requires path")
+		}
+	case "webhook":
+		if c.URL == "" {
+			return errors.New("webhook sink requires url")
+		}
+	case "redis":
+		if !strings.HasPrefix(c.URL, "redis://") && !strings.HasPrefix(c.URL, "rediss://") {
+			return errors.New("redis sink requires a redis:// or rediss:// url")
+		}
+		if c.Encoding != "" && c.Encoding != "json" {
+			return errors.New("redis sink requires json encoding")
+		}
+	case "mqtt":
+		if !strings.HasPrefix(c.URL, "mqtt://") && !strings.HasPrefix(c.URL, "mqtts://") {
+			return errors.New("mqtt sink requires a mqtt:// or mqtts:// url")
+		}
+		if c.QoS < 0 || c.QoS > 2 {
+			return errors.New("mqtt qos must be 0, 1 or 2")
+		}
+		if strings.ContainsAny(c.Topic, "+#") {
+			return errors.New("mqtt topic must not contain wildcards")
+		}
+		if strings.Contains(c.Topic, "{") && c.Encoding != "" && c.Encoding != "json" {
+			return errors.New("mqtt topic placeholders require json encoding")
+		}
+	default:
+		return fmt.Errorf("unknown sink type: %q", c.Type)
+	}
+
+	for _, rule := range c.Redact {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := NewEncoder(c.Encoding, c.Transform.Fields); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *SinkConfig) expandSecrets() error {
+	var err error
+	if c.URL, err = secrets.Expand(c.URL); err != nil {
+		return err
+	}
+	c.Path, err = secrets.Expand(c.Path)
+	return err
+}
+
+func NewSink(config SinkConfig) (Sink, error) {
+	switch config.Type {
+	case "stdout":
+		return &WriterSink{file: os.Stdout, delimited: config.Encoding == "proto"}, nil
+	case "file":
+		file, err := os.OpenFile(config.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open sink file: %v", err)
+		}
+		return &WriterSink{file: file, delimited: config.Encoding == "proto"}, nil
+	case "webhook":
+		return &WebhookSink{url: config.URL, client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "redis":
+		return NewRedisSink(config)
+	case "mqtt":
+		return NewMQTTSink(config)
+	default:
+		return nil, fmt.Errorf("unknown sink type: %q", config.Type)
+	}
+}
+
+// WriterSink writes one payload per line. Binary payloads may contain
+// newlines, so with delimited each is instead prefixed with its length as
+// a varint, the framing of protobuf's writeDelimitedTo and parseDelimitedFrom.
+type WriterSink struct {
+	mu        sync.Mutex
+	file      *os.File
+	delimited bool
+}
+
+func (s *WriterSink) Deliver(ctx context.Context, payload []byte, contentType, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var frame []byte
+	if s.delimited {
+		frame = append(binary.AppendUvarint(nil, uint64(len(payload))), payload...)
+	} else {
+		frame = append(payload, '\n')
+	}
+	_, err := s.file.Write(frame)
+	return err
+}
+
+// WebhookSink POSTs each payload to a URL with the event ID as its
+// Idempotency-Key header.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *WebhookSink) Deliver(ctx context.Context, payload []byte, contentType, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Idempotency-Key", key)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook failed: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SizingConfig decides how much SOL a buy signal commits.
+//
+//	fixed    always SOL
+//	percent  Percent of the current bankroll
+//	kelly    KellyFraction of the Kelly-optimal fraction derived from closed
+//	         positions; falls back to SOL until MinTrades have closed
+//
+// The bankroll starts at Bankroll and moves with realized PnL. MinSOL and
+// MaxSOL clamp every strategy.
+type SizingConfig struct {
+	Strategy      string  `json:"strategy"`
+	SOL           float64 `json:"sol"`
+	Percent       float64 `json:"percent,omitempty"`
+	Bankroll      float64 `json:"bankroll,omitempty"`
+	KellyFraction float64 `json:"kellyFraction,omitempty"`
+	MinTrades     int     `json:"minTrades,omitempty"`
+	MinSOL        float64 `json:"minSol,omitempty"`
+	MaxSOL        float64 `json:"maxSol,omitempty"`
+}
+
+func (c SizingConfig) Validate() error {
+	switch c.Strategy {
+	case "":
+		// no sizing: buy signals are skipped
+	case "fixed":
+		if c.SOL <= 0 {
+			return errors.New("fixed sizing needs sol > 0")
+		}
+	case "percent":
+		if c.Percent <= 0 || c.Percent > 100 || c.Bankroll <= 0 {
+			return errors.New("percent sizing needs percent in (0, 100] and bankroll > 0")
+		}
+	case "kelly":
+		if c.Bankroll <= 0 || c.KellyFraction <= 0 || c.KellyFraction > 1 || c.SOL <= 0 {
+			return errors.New("kelly sizing needs bankroll, sol fallback and kellyFraction in (0, 1]")
+		}
+	default:
+		return fmt.Errorf("unknown sizing strategy: %q", c.Strategy)
+	}
+	return nil
+}
+
+// Sizer computes position sizes in lamports from the trade history.
+type Sizer struct {
+	config SizingConfig
+}
+
+func NewSizer(config SizingConfig) *Sizer {
+	if config.MinTrades <= 0 {
+		config.MinTrades = 20
+	}
+	return &Sizer{config: config}
+}
+
+// Size returns lamports to spend given closed positions so far and the SOL
+// currently committed to open ones. Zero means skip the signal.
+func (s *Sizer) Size(closed []Position, committedSOL float64) uint64 {
+	bankroll := s.config.Bankroll + realizedSOL(closed) - committedSOL
+
+	var sol float64
+	switch s.config.Strategy {
+	case "fixed":
+		sol = s.config.SOL
+	case "percent":
+		sol = bankroll * s.config.Percent / 100
+	case "kelly":
+		sol = s.config.SOL
+		if len(closed) >= s.config.MinTrades {
+			sol = bankroll * kellyFraction(closed) * s.config.KellyFraction
+		}
+	}
+
+	if s.config.MaxSOL > 0 {
+		sol = min(sol, s.config.MaxSOL)
+	}
+	if s.config.Bankroll > 0 {
+		sol = min(sol, bankroll)
+	}
+	if sol < s.config.MinSOL || sol <= 0 {
+		return 0
+	}
+	return uint64(sol * lamportsPerSOL)
+}
+
+func realizedSOL(closed []Position) float64 {
+	var total float64
+	for _, p := range closed {
+		total += (float64(p.ProceedsLamports) - float64(p.CostLamports)) / lamportsPerSOL
+	}
+	return total
+}
+
+// kellyFraction is p - (1-p)/b with win rate p and average win/loss ratio b.
+func kellyFraction(closed []Position) float64 {
+	var wins, losses int
+	var winSum, lossSum float64
+	for _, p := range closed {
+		pnl := p.PnL()
+		if pnl > 0 {
+			wins++
+			winSum += pnl
+		} else {
+			losses++
+			lossSum -= pnl
+		}
+	}
+	if wins == 0 {
+		return 0
+	}
+	if losses == 0 || lossSum == 0 {
+		return 1
+	}
+
+	p := float64(wins) / float64(wins+losses)
+	b := (winSum / float64(wins)) / (lossSum / float64(losses))
+	return max(p-(1-p)/b, 0)
+}
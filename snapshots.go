@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Snapshot tiers. Early snapshots are the first moments of a pair at full
+// resolution; sampled ones are the downsampled rest of its life. The tiers
+// live in separate files so they can be retained for different periods.
+const (
+	TierEarly   = "early"
+	TierSampled = "sampled"
+)
+
+type SnapshotConfig struct {
+	Dir string
+	// EarlyWindow after discovery every update is kept, up to EarlyMax.
+	EarlyWindow time.Duration
+	EarlyMax    int
+	// SampleEvery is the resolution after the early window.
+	SampleEvery time.Duration
+}
+
+// Snapshot is one stored pair update.
+type Snapshot struct {
+	PairAddress string    `json:"pairAddress"`
+	TokenSymbol string    `json:"tokenSymbol"`
+	Tier        string    `json:"tier"`
+	Seq         int       `json:"seq"`
+	At          time.Time `json:"at"`
+	// Age is seconds since the pair was discovered.
+	Age    float64 `json:"age"`
+	Block  uint32  `json:"block"`
+	Price  float64 `json:"price"`
+	Volume float64 `json:"volume"`
+}
+
+type snapshotPair struct {
+	seq         int
+	lastSampled time.Time
+}
+
+// SnapshotRecorder stores each pair's early price action at full
+// resolution and downsamples afterwards. Files are per tier and UTC day,
+// <dir>/<tier>-2006-01-02.jsonl, so retention is deleting old days.
+type SnapshotRecorder struct {
+	config SnapshotConfig
+	store  *PairStore
+
+	mu    sync.Mutex
+	pairs map[[32]byte]*snapshotPair
+	files map[string]*os.File
+}
+
+func NewSnapshotRecorder(config SnapshotConfig, store *PairStore) (*SnapshotRecorder, error) {
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create snapshot dir: %v", err)
+	}
+	return &SnapshotRecorder{
+		config: config,
+		store:  store,
+		pairs:  make(map[[32]byte]*snapshotPair),
+		files:  make(map[string]*os.File),
+	}, nil
+}
+
+func (r *SnapshotRecorder) Observe(event Event) {
+	switch e := event.(type) {
+	case *PairUpdatedEvent:
+		r.record(e)
+	case *PairDeadEvent:
+		if addr, err := decodeAddress(e.Tombstone.PairAddress); err == nil {
+			r.mu.Lock()
+			delete(r.pairs, addr)
+			r.mu.Unlock()
+		}
+	}
+}
+
+func (r *SnapshotRecorder) record(e *PairUpdatedEvent) {
+	tracked, ok := r.store.Get(e.Pair.PairAddress)
+	if !ok {
+		return
+	}
+	age := e.At.Sub(tracked.FirstSeen)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.pairs[e.Pair.PairAddress]
+	if !ok {
+		p = &snapshotPair{}
+		r.pairs[e.Pair.PairAddress] = p
+	}
+
+	tier := TierSampled
+	if age <= r.config.EarlyWindow && p.seq < r.config.EarlyMax {
+		tier = TierEarly
+	} else if e.At.Sub(p.lastSampled) < r.config.SampleEvery {
+		return
+	}
+	p.seq++
+	p.lastSampled = e.At
+
+	snapshot := Snapshot{
+		PairAddress: e.Pair.Address(),
+		TokenSymbol: e.Pair.TokenSymbol,
+		Tier:        tier,
+		Seq:         p.seq,
+		At:          e.At,
+		Age:         age.Seconds(),
+		Block:       e.Block,
+		Price:       e.Pair.Price,
+		Volume:      e.Pair.Volume,
+	}
+	if err := r.write(snapshot); err != nil {
+		color.Red("Error writing snapshot: %v", err)
+	}
+}
+
+func (r *SnapshotRecorder) write(snapshot Snapshot) error {
+	name := fmt.Sprintf("%s-%s.jsonl", snapshot.Tier, snapshot.At.UTC().Format(time.DateOnly))
+	file, ok := r.files[name]
+	if !ok {
+		// a new day: earlier files of the tier are done
+		for open, f := range r.files {
+			if strings.HasPrefix(open, snapshot.Tier+"-") {
+				f.Close()
+				delete(r.files, open)
+			}
+		}
+		var err error
+		file, err = os.OpenFile(filepath.Join(r.config.Dir, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		r.files[name] = file
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+func (r *SnapshotRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, file := range r.files {
+		file.Close()
+		delete(r.files, name)
+	}
+	return nil
+}
+
+// snapshotFiles lists the tier files in dir. It reads the directory rather
+// than globbing so a dir with glob metacharacters in its name still works.
+func snapshotFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".jsonl") {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import "time"
+
+// priceStaleAfter is how long a price stays current without an update. Pairs
+// that leave the subscription's filters stop updating, so their last
+// price can be hours old. Set by -stale-price; 0 disables the check.
+var priceStaleAfter = time.Minute
+
+// priceStale reports whether a price last updated at updated is too old
+// to show as current or act on at now.
+func priceStale(updated, now time.Time) bool {
+	return priceStaleAfter > 0 && !updated.IsZero() && now.Sub(updated) > priceStaleAfter
+}
+
+// recordStale reports whether the event behind record happened more than
+// priceStaleAfter before now. Rules skip such events, so a late update never
+// fires an alert or a buy signal.
+func recordStale(record Record, now time.Time) bool {
+	at, ok := record["at"].(string)
+	if !ok {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339Nano, at)
+	return err == nil && priceStale(t, now)
+}
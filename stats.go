@@ -0,0 +1,148 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// MarketStats summarizes launch activity over the stats window.
+// The stream does not carry liquidity, so initial market cap
+// (price * token supply) stands in as the size of a launch.
+type MarketStats struct {
+	Window                 time.Duration `json:"window"`
+	TrackedPairs           int           `json:"trackedPairs"`
+	Launches               int           `json:"launches"`
+	LaunchesPerHour        float64       `json:"launchesPerHour"`
+	Graduations            int           `json:"graduations"`
+	GraduationRate         float64       `json:"graduationRate"`
+	MedianInitialMarketCap float64       `json:"medianInitialMarketCap"`
+	TotalVolume            float64       `json:"totalVolume"`
+	// StalePairs are tracked pairs without an update for -stale-price.
+	StalePairs int `json:"stalePairs"`
+}
+
+type launch struct {
+	at        time.Time
+	marketCap float64
+}
+
+// StatsCollector aggregates lifecycle events and the PairStore into
+// rolling market stats.
+type StatsCollector struct {
+	window time.Duration
+	supply float64
+	store  *PairStore
+
+	mu          sync.Mutex
+	launches    []launch
+	graduations []time.Time
+}
+
+func NewStatsCollector(window time.Duration, supply float64, store *PairStore) *StatsCollector {
+	return &StatsCollector{window: window, supply: supply, store: store}
+}
+
+func (c *StatsCollector) Observe(event Event) {
+	e, ok := event.(*PairTransitionEvent)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch e.To {
+	case StateDiscovered:
+		if e.Preexisting {
+			break
+		}
+		var marketCap float64
+		if tracked, ok := c.store.Get(e.PairAddress); ok {
+			marketCap = tracked.InitialPrice * c.supply
+		}
+		c.launches = append(c.launches, launch{at: e.At, marketCap: marketCap})
+	case StateGraduated:
+		c.graduations = append(c.graduations, e.At)
+	}
+}
+
+func (c *StatsCollector) Compute(now time.Time) MarketStats {
+	cutoff := now.Add(-c.window)
+
+	c.mu.Lock()
+	for len(c.launches) > 0 && c.launches[0].at.Before(cutoff) {
+		c.launches = c.launches[1:]
+	}
+	for len(c.graduations) > 0 && c.graduations[0].Before(cutoff) {
+		c.graduations = c.graduations[1:]
+	}
+	marketCaps := make([]float64, len(c.launches))
+	for i, l := range c.launches {
+		marketCaps[i] = l.marketCap
+	}
+	graduations := len(c.graduations)
+	c.mu.Unlock()
+
+	stats := MarketStats{
+		Window:                 c.window,
+		Launches:               len(marketCaps),
+		LaunchesPerHour:        float64(len(marketCaps)) / c.window.Hours(),
+		Graduations:            graduations,
+		MedianInitialMarketCap: median(marketCaps),
+	}
+	if stats.Launches > 0 {
+		stats.GraduationRate = float64(graduations) / float64(stats.Launches)
+	}
+
+	c.store.Iterate(func(tracked TrackedPair) bool {
+		stats.TrackedPairs++
+		stats.TotalVolume += tracked.Volume
+		if priceStale(tracked.LastSeen, now) {
+			stats.StalePairs++
+		}
+		return true
+	})
+
+	return stats
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func printMarketStats(stats MarketStats) {
+	color.Blue("Market: tracked=%d launches/h=%.1f graduations=%d (%.1f%%) median initial mcap=%s volume=%s",
+		stats.TrackedPairs, stats.LaunchesPerHour, stats.Graduations, stats.GraduationRate*100,
+		formatUSD(stats.MedianInitialMarketCap), formatUSD(stats.TotalVolume))
+}
+
+func registerStatsMetrics(metrics *Metrics, stats *StatsCollector) {
+	current := func(field func(MarketStats) float64) func() float64 {
+		return func() float64 { return field(stats.Compute(time.Now())) }
+	}
+
+	metrics.Gauge("moon_tracked_pairs", "Pairs currently tracked in hot state.",
+		current(func(s MarketStats) float64 { return float64(s.TrackedPairs) }))
+	metrics.Gauge("moon_launches_per_hour", "New pairs per hour over the stats window.",
+		current(func(s MarketStats) float64 { return s.LaunchesPerHour }))
+	metrics.Gauge("moon_graduation_rate", "Graduations per launch over the stats window.",
+		current(func(s MarketStats) float64 { return s.GraduationRate }))
+	metrics.Gauge("moon_median_initial_market_cap", "Median market cap of pairs at discovery.",
+		current(func(s MarketStats) float64 { return s.MedianInitialMarketCap }))
+	metrics.Gauge("moon_total_volume", "Sum of 24h volume over tracked pairs.",
+		current(func(s MarketStats) float64 { return s.TotalVolume }))
+	metrics.Gauge("moon_stale_pairs", "Tracked pairs whose price is older than -stale-price.",
+		current(func(s MarketStats) float64 { return float64(s.StalePairs) }))
+}
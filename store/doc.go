@@ -0,0 +1,6 @@
+// Package store keeps the latest state of every pair seen on the stream,
+// with first/last sighting times, blocks and price extremes. A PairStore
+// is safe for concurrent use; Iterate walks it without holding writers up
+// for the length of the walk, and ChangedSince lists what changed after a
+// revision, for consumers polling for updates.
+package store
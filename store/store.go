@@ -0,0 +1,230 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/piotrostr/moon/protocol"
+)
+
+type TrackedPair struct {
+	protocol.PairData
+	FirstSeen      time.Time
+	LastSeen       time.Time
+	FirstSeenBlock uint32
+	LastSeenBlock  uint32
+	InitialPrice   float64
+	PeakPrice      float64
+
+	// revision is the store's revision at the last change
+	revision uint64
+}
+
+func (t *TrackedPair) update(pair protocol.PairData, now time.Time, block uint32, revision uint64) {
+	t.PairData = pair
+	t.revision = revision
+	t.LastSeen = now
+	t.LastSeenBlock = block
+	if pair.Price > t.PeakPrice {
+		t.PeakPrice = pair.Price
+	}
+}
+
+// maxRemovals bounds the removals kept for ChangedSince.
+const maxRemovals = 10000
+
+type removal struct {
+	addr     [32]byte
+	revision uint64
+}
+
+// PairStore holds the latest known state of every pair seen on the stream.
+// Every change increments its revision, so consumers can ask for what
+// changed since a revision they saw.
+type PairStore struct {
+	mu       sync.RWMutex
+	pairs    map[[32]byte]*TrackedPair
+	revision uint64
+	// removals are in revision order; those before forgotten are dropped
+	removals  []removal
+	forgotten uint64
+}
+
+func NewPairStore() *PairStore {
+	return &PairStore{pairs: make(map[[32]byte]*TrackedPair)}
+}
+
+// Upsert records pair, adding it if unknown. It reports whether the pair is new.
+func (s *PairStore) Upsert(pair protocol.PairData, now time.Time, block uint32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revision++
+	if tracked, ok := s.pairs[pair.PairAddress]; ok {
+		tracked.update(pair, now, block, s.revision)
+		return false
+	}
+
+	s.pairs[pair.PairAddress] = &TrackedPair{
+		revision:       s.revision,
+		PairData:       pair,
+		FirstSeen:      now,
+		LastSeen:       now,
+		FirstSeenBlock: block,
+		LastSeenBlock:  block,
+		InitialPrice:   pair.Price,
+		PeakPrice:      pair.Price,
+	}
+	return true
+}
+
+// Update refreshes pair only if it is already tracked.
+func (s *PairStore) Update(pair protocol.PairData, now time.Time, block uint32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tracked, ok := s.pairs[pair.PairAddress]
+	if !ok {
+		return false
+	}
+	s.revision++
+	tracked.update(pair, now, block, s.revision)
+	return true
+}
+
+// Remove evicts a pair and returns its final state.
+func (s *PairStore) Remove(addr [32]byte) (TrackedPair, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tracked, ok := s.pairs[addr]
+	if !ok {
+		return TrackedPair{}, false
+	}
+	delete(s.pairs, addr)
+	s.revision++
+	s.removals = append(s.removals, removal{addr: addr, revision: s.revision})
+	if len(s.removals) > maxRemovals {
+		s.forgotten = s.removals[0].revision
+		s.removals = s.removals[1:]
+	}
+	return *tracked, true
+}
+
+// Revision is the number of changes the store has seen.
+func (s *PairStore) Revision() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.revision
+}
+
+// ChangedSince returns copies of the pairs added or updated after
+// revision, the addresses of pairs removed after it and not added back,
+// and the current revision. ok is false when removals that old are no
+// longer kept, or revision is ahead of the store; the caller should then
+// start over from every pair.
+func (s *PairStore) ChangedSince(revision uint64) (changed []TrackedPair, removed [][32]byte, current uint64, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if revision < s.forgotten || revision > s.revision {
+		return nil, nil, s.revision, false
+	}
+	for _, tracked := range s.pairs {
+		if tracked.revision > revision {
+			changed = append(changed, *tracked)
+		}
+	}
+	seen := make(map[[32]byte]bool)
+	for _, r := range s.removals {
+		if _, back := s.pairs[r.addr]; r.revision > revision && !back && !seen[r.addr] {
+			seen[r.addr] = true
+			removed = append(removed, r.addr)
+		}
+	}
+	return changed, removed, s.revision, true
+}
+
+// Snapshot returns copies of all tracked pairs.
+func (s *PairStore) Snapshot() []TrackedPair {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pairs := make([]TrackedPair, 0, len(s.pairs))
+	for _, tracked := range s.pairs {
+		pairs = append(pairs, *tracked)
+	}
+	return pairs
+}
+
+// iterateChunk is how many pairs Iterate copies per read lock, so a
+// writer waits for at most one chunk.
+const iterateChunk = 256
+
+// Iterate calls fn with a copy of every pair tracked when it starts,
+// stopping early if fn returns false. No lock is held while fn runs, so
+// slow consumers such as exports do not hold up Upsert. Pairs are copied
+// in chunks, each as it is at that moment, so the whole is not a single
+// point-in-time view; pairs removed meanwhile are skipped and pairs added
+// meanwhile are not visited.
+func (s *PairStore) Iterate(fn func(TrackedPair) bool) {
+	addresses := s.Addresses()
+	chunk := make([]TrackedPair, 0, min(iterateChunk, len(addresses)))
+	for start := 0; start < len(addresses); start += iterateChunk {
+		chunk = chunk[:0]
+		s.mu.RLock()
+		for _, addr := range addresses[start:min(start+iterateChunk, len(addresses))] {
+			if tracked, ok := s.pairs[addr]; ok {
+				chunk = append(chunk, *tracked)
+			}
+		}
+		s.mu.RUnlock()
+
+		for _, tracked := range chunk {
+			if !fn(tracked) {
+				return
+			}
+		}
+	}
+}
+
+func (s *PairStore) Get(addr [32]byte) (TrackedPair, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tracked, ok := s.pairs[addr]
+	if !ok {
+		return TrackedPair{}, false
+	}
+	return *tracked, true
+}
+
+func (s *PairStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.pairs)
+}
+
+func (s *PairStore) Addresses() [][32]byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	addresses := make([][32]byte, 0, len(s.pairs))
+	for addr := range s.pairs {
+		addresses = append(addresses, addr)
+	}
+	return addresses
+}
+
+// AllUpdatedSince reports whether every tracked pair was seen at or after t.
+func (s *PairStore) AllUpdatedSince(t time.Time) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, tracked := range s.pairs {
+		if tracked.LastSeen.Before(t) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// errChallengeSolved ends a connect attempt so the stream redials with the
+// clearance the solver returned.
+var errChallengeSolved = errors.New("challenge solved, reconnecting")
+
+// ChallengeError is a handshake Cloudflare answered with a challenge page
+// or a block instead of upgrading the connection.
+type ChallengeError struct {
+	Status int
+	RayID  string
+	// Challenge is false for a plain block, which no solver can clear.
+	Challenge bool
+}
+
+func (e *ChallengeError) Error() string {
+	ray := ""
+	if e.RayID != "" {
+		ray = ", ray " + e.RayID
+	}
+	if !e.Challenge {
+		return fmt.Sprintf("blocked by cloudflare (%d%s); a solver will not help, try another network", e.Status, ray)
+	}
+	return fmt.Sprintf("cloudflare challenge (%d%s); the feed needs a cf_clearance cookie, configure a challenge solver", e.Status, ray)
+}
+
+// Clearance is what a ChallengeSolver obtained: cookies for the handshake
+// and the user agent they were issued to, which Cloudflare checks.
+type Clearance struct {
+	Cookies   []*http.Cookie
+	UserAgent string
+}
+
+// ChallengeSolver clears a challenge for url, e.g. by asking a headless
+// browser or an external solver service for its cookies.
+type ChallengeSolver interface {
+	Solve(ctx context.Context, url string, challenge *ChallengeError) (*Clearance, error)
+}
+
+// ChallengeSolverFunc adapts a function to ChallengeSolver.
+type ChallengeSolverFunc func(ctx context.Context, url string, challenge *ChallengeError) (*Clearance, error)
+
+func (f ChallengeSolverFunc) Solve(ctx context.Context, url string, challenge *ChallengeError) (*Clearance, error) {
+	return f(ctx, url, challenge)
+}
+
+// detectChallenge inspects the response to a failed handshake. Only
+// Cloudflare responses count; other refusals stay connection errors.
+func detectChallenge(resp *http.Response) *ChallengeError {
+	if resp == nil {
+		return nil
+	}
+	switch resp.StatusCode {
+	case http.StatusForbidden, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+	default:
+		return nil
+	}
+	var body []byte
+	if resp.Body != nil {
+		body, _ = io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	}
+	rayID := resp.Header.Get("Cf-Ray")
+	if rayID == "" && !strings.EqualFold(resp.Header.Get("Server"), "cloudflare") {
+		return nil
+	}
+	challenge := resp.Header.Get("Cf-Mitigated") == "challenge"
+	for _, marker := range []string{"challenge-platform", "cf-chl", "Just a moment"} {
+		challenge = challenge || bytes.Contains(body, []byte(marker))
+	}
+	return &ChallengeError{Status: resp.StatusCode, RayID: rayID, Challenge: challenge}
+}
+
+// solveChallenge asks the solver to clear challenge. It returns
+// errChallengeSolved when the stream should redial with the new clearance.
+func (s *Stream) solveChallenge(ctx context.Context, url string, challenge *ChallengeError) error {
+	if s.Solver == nil || !challenge.Challenge {
+		return fmt.Errorf("[conn %d] %w", s.ID, challenge)
+	}
+	s.logf("[conn %d] Cloudflare challenge (%d), asking the challenge solver", s.ID, challenge.Status)
+	clearance, err := s.Solver.Solve(ctx, url, challenge)
+	if err != nil {
+		return fmt.Errorf("[conn %d] %w: solver failed: %v", s.ID, challenge, err)
+	}
+	if clearance == nil || len(clearance.Cookies) == 0 {
+		return fmt.Errorf("[conn %d] %w: solver returned no cookies", s.ID, challenge)
+	}
+	s.Clearance = clearance
+	s.logf("[conn %d] Challenge solver returned %d cookies", s.ID, len(clearance.Cookies))
+	return errChallengeSolved
+}
+
+// apply adds the clearance cookies and user agent to a handshake.
+func (c *Clearance) apply(header http.Header) {
+	if c == nil {
+		return
+	}
+	if c.UserAgent != "" {
+		header.Set("User-Agent", c.UserAgent)
+	}
+	cookies := make([]string, len(c.Cookies))
+	for i, cookie := range c.Cookies {
+		cookies[i] = (&http.Cookie{Name: cookie.Name, Value: cookie.Value}).String()
+	}
+	header.Set("Cookie", strings.Join(cookies, "; "))
+}
@@ -0,0 +1,69 @@
+package stream
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"time"
+)
+
+// Frame is a raw websocket message tagged with the connection it arrived on.
+// Widened frames come from a recovery subscription and must not introduce
+// pairs the narrow filters would exclude. Seq numbers the frames of each
+// connection from 0, so a frame with Seq 0 is the first after a (re)connect.
+// Data of a frame from a Stream lives in a pooled buffer until Release.
+type Frame struct {
+	ConnID  int
+	Seq     int
+	Data    []byte
+	Widened bool
+
+	buf *bytes.Buffer
+}
+
+type seenFrame struct {
+	connID int
+	at     time.Time
+}
+
+// Deduplicator drops frames that another connection already delivered
+// within the configured window. Repeats on the same connection are kept,
+// since the server legitimately resends identical frames (e.g. pings).
+type Deduplicator struct {
+	window time.Duration
+	seen   map[[32]byte]seenFrame
+	lastGC time.Time
+}
+
+func NewDeduplicator(window time.Duration) *Deduplicator {
+	return &Deduplicator{
+		window: window,
+		seen:   make(map[[32]byte]seenFrame),
+		lastGC: time.Now(),
+	}
+}
+
+func (d *Deduplicator) IsDuplicate(frame Frame) bool {
+	now := time.Now()
+	d.gc(now)
+
+	hash := sha256.Sum256(frame.Data)
+	prev, ok := d.seen[hash]
+	if ok && prev.connID != frame.ConnID && now.Sub(prev.at) < d.window {
+		return true
+	}
+
+	d.seen[hash] = seenFrame{connID: frame.ConnID, at: now}
+	return false
+}
+
+func (d *Deduplicator) gc(now time.Time) {
+	if now.Sub(d.lastGC) < d.window {
+		return
+	}
+	for hash, entry := range d.seen {
+		if now.Sub(entry.at) >= d.window {
+			delete(d.seen, hash)
+		}
+	}
+	d.lastGC = now
+}
@@ -0,0 +1,14 @@
+// Package stream maintains websocket connections to the dexscreener pairs
+// feed. A Stream reconnects with backoff, widens its Subscription after a
+// reconnect until every known pair has been refreshed, and delivers raw
+// Frames; a Deduplicator drops frames repeated across redundant
+// connections. Decoding is left to package protocol. A Cloudflare
+// challenge on the handshake surfaces as a ChallengeError; a
+// ChallengeSolver can clear it with cookies from an external solver.
+//
+// The read loop runs on its own goroutine and reads into pooled buffers,
+// so a warm stream does not allocate per frame. The receiver of a Frame
+// owns it: Data is valid until Frame.Release hands the buffer back, and
+// anything that keeps the bytes longer takes a copy with Frame.Clone.
+// protocol.Parse copies what it decodes, so messages outlive the frame.
+package stream
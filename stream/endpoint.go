@@ -0,0 +1,103 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/piotrostr/moon/protocol"
+)
+
+// errMigrate ends a connection so the stream reconnects to the endpoint
+// the server advertised.
+var errMigrate = errors.New("endpoint migration")
+
+// resolveHint turns the Endpoint of a LatestBlockHashMessage into a stream
+// URL. A hint is either a full ws(s) URL or a bare host that replaces the
+// host of base. Only hosts in base's domain are accepted, so a garbled or
+// forged string never sends the stream somewhere else, and a wss base is
+// never downgraded to ws.
+func resolveHint(hint, base string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	target := *baseURL
+	if strings.Contains(hint, "://") {
+		hinted, err := url.Parse(hint)
+		if err != nil {
+			return "", err
+		}
+		if hinted.Scheme != "ws" && hinted.Scheme != "wss" {
+			return "", fmt.Errorf("scheme %q is not a websocket", hinted.Scheme)
+		}
+		if hinted.User != nil {
+			return "", errors.New("hint carries credentials")
+		}
+		target = *hinted
+		target.RawQuery = ""
+	} else {
+		// a bare host must be only that, not a path or userinfo in disguise
+		host, err := url.Parse("//" + hint)
+		if err != nil || host.User != nil || host.Path != "" || host.RawQuery != "" || host.Fragment != "" {
+			return "", fmt.Errorf("%q is not a host", hint)
+		}
+		target.Host = host.Host
+	}
+	if baseURL.Scheme == "wss" && target.Scheme != "wss" {
+		return "", fmt.Errorf("refusing to downgrade %s to %s", baseURL.Scheme, target.Scheme)
+	}
+	if target.Hostname() == "" {
+		return "", errors.New("no host")
+	}
+	if site(target.Hostname()) != site(baseURL.Hostname()) {
+		return "", fmt.Errorf("%s is outside %s", target.Hostname(), site(baseURL.Hostname()))
+	}
+	return target.String(), nil
+}
+
+// site is the last two labels of a host name, or the whole host for IPs
+// and single-label names like localhost.
+func site(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 {
+		return host
+	}
+	return strings.Join(labels[len(labels)-2:], ".")
+}
+
+// observeHint checks block hash frames for an endpoint hint. It logs each
+// new hint once and reports whether the stream should move to it.
+func (s *Stream) observeHint(frame []byte, base string) bool {
+	if len(frame) == 0 || protocol.MessageType(frame[0]) != protocol.LatestBlockHashMessageType {
+		return false
+	}
+	var msg protocol.LatestBlockHashMessage
+	if msg.UnmarshalBinary(frame) != nil || msg.Endpoint == "" || s.hints[msg.Endpoint] {
+		return false
+	}
+	if s.hints == nil {
+		s.hints = make(map[string]bool)
+	}
+	s.hints[msg.Endpoint] = true
+
+	target, err := resolveHint(msg.Endpoint, base)
+	switch {
+	case err != nil:
+		s.logf("[conn %d] Ignoring endpoint hint %q: %v", s.ID, msg.Endpoint, err)
+		return false
+	case target == base:
+		return false
+	case !s.FollowEndpoint || s.PinEndpoint:
+		s.logf("[conn %d] Server advertises %s, staying on configured %s", s.ID, target, base)
+		return false
+	}
+	s.logf("[conn %d] Server advertises %s, migrating from %s", s.ID, target, base)
+	s.hinted = target
+	return true
+}
@@ -0,0 +1,86 @@
+package stream
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+)
+
+// FileTransport plays a length-prefixed recording, as written by moon
+// -record, from a file:// URL. The query the subscription appends is
+// ignored. Frames are delivered as fast as they are consumed unless
+// Interval is set.
+type FileTransport struct {
+	Interval time.Duration
+}
+
+func (t FileTransport) Dial(ctx context.Context, target Target) (Conn, error) {
+	u, err := url.Parse(target.URL)
+	if err != nil {
+		return nil, err
+	}
+	// file:rel/path is opaque, file:///abs/path has a path
+	path := u.Path
+	if u.Opaque != "" {
+		path = u.Opaque
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileConn{file: file, interval: t.Interval}, nil
+}
+
+type fileConn struct {
+	file     *os.File
+	interval time.Duration
+	frames   int
+}
+
+// NextReader fails with ErrSourceDone on any read error: replaying a
+// recording from the start after a truncated or unreadable frame would
+// only deliver its frames again.
+func (c *fileConn) NextReader() (io.Reader, error) {
+	if c.frames > 0 && c.interval > 0 {
+		time.Sleep(c.interval)
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(c.file, size[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, ErrSourceDone
+		}
+		return nil, fmt.Errorf("%w: frame %d: %v", ErrSourceDone, c.frames+1, err)
+	}
+	n := binary.LittleEndian.Uint32(size[:])
+	if n > 16<<20 {
+		return nil, fmt.Errorf("%w: frame %d is %d bytes, the recording is corrupt", ErrSourceDone, c.frames+1, n)
+	}
+	c.frames++
+	return &frameReader{LimitedReader: io.LimitedReader{R: c.file, N: int64(n)}, frame: c.frames}, nil
+}
+
+// frameReader fails on a frame cut short by the end of the file.
+type frameReader struct {
+	io.LimitedReader
+	frame int
+}
+
+func (r *frameReader) Read(p []byte) (int, error) {
+	n, err := r.LimitedReader.Read(p)
+	if err == io.EOF && r.N > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: frame %d: %v", ErrSourceDone, r.frame, err)
+	}
+	return n, err
+}
+
+func (c *fileConn) Compressed() bool { return false }
+
+func (c *fileConn) Close() error { return c.file.Close() }
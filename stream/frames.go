@@ -0,0 +1,25 @@
+package stream
+
+import (
+	"io"
+
+	"github.com/gorilla/websocket"
+)
+
+// ConnFrames adapts a websocket connection to protocol.FrameReader so it
+// can feed a protocol.Decoder. A normal close reads as io.EOF.
+func ConnFrames(conn *websocket.Conn) *WebsocketFrames {
+	return &WebsocketFrames{conn: conn}
+}
+
+type WebsocketFrames struct {
+	conn *websocket.Conn
+}
+
+func (w *WebsocketFrames) ReadFrame() ([]byte, error) {
+	_, data, err := w.conn.ReadMessage()
+	if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		return nil, io.EOF
+	}
+	return data, err
+}
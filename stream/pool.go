@@ -0,0 +1,46 @@
+package stream
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledFrame keeps an occasional oversized frame from pinning its
+// buffer in the pool.
+const maxPooledFrame = 1 << 20
+
+var framePool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// readFrame reads one message into a pooled buffer.
+func readFrame(r io.Reader) (*bytes.Buffer, error) {
+	buf := framePool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if _, err := buf.ReadFrom(r); err != nil {
+		framePool.Put(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Release returns the frame's buffer for reuse by the read loop. After
+// Release, Data must not be used; a consumer that keeps the bytes longer
+// copies them first with Clone or bytes.Clone. Release is called once, by
+// whoever received the frame last. Frames that are never released are
+// garbage collected as usual, so forgetting costs only the allocation.
+func (f *Frame) Release() {
+	if f.buf == nil {
+		return
+	}
+	if f.buf.Cap() <= maxPooledFrame {
+		framePool.Put(f.buf)
+	}
+	f.buf, f.Data = nil, nil
+}
+
+// Clone returns a copy of the frame whose Data outlives Release.
+func (f Frame) Clone() Frame {
+	f.Data = bytes.Clone(f.Data)
+	f.buf = nil
+	return f
+}
@@ -0,0 +1,99 @@
+package stream
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnStats is a stream's traffic since it started, summed over
+// reconnects.
+type ConnStats struct {
+	ID          int       `json:"id"`
+	Endpoint    string    `json:"endpoint"`
+	Connected   bool      `json:"connected"`
+	ConnectedAt time.Time `json:"connectedAt,omitzero"`
+	// Compressed is whether the current connection negotiated
+	// permessage-deflate.
+	Compressed bool   `json:"compressed"`
+	Connects   uint64 `json:"connects"`
+	Frames     uint64 `json:"frames"`
+	// WireBytes were read off the socket, with TLS and compression still
+	// applied; PayloadBytes are the frames once both are undone.
+	WireBytes    uint64 `json:"wireBytes"`
+	PayloadBytes uint64 `json:"payloadBytes"`
+}
+
+// CompressionRatio is payload bytes per wire byte, above 1 when
+// compression pays for the framing and TLS overhead.
+func (c ConnStats) CompressionRatio() float64 {
+	if c.WireBytes == 0 {
+		return 0
+	}
+	return float64(c.PayloadBytes) / float64(c.WireBytes)
+}
+
+type connCounters struct {
+	connects, frames, wire, payload atomic.Uint64
+
+	mu          sync.Mutex
+	endpoint    string
+	connectedAt time.Time
+	compressed  bool
+}
+
+// Stats returns the stream's traffic so far. It is safe to call while the
+// stream runs.
+func (s *Stream) Stats() ConnStats {
+	c := &s.counters
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ConnStats{
+		ID:           s.ID,
+		Endpoint:     c.endpoint,
+		Connected:    !c.connectedAt.IsZero(),
+		ConnectedAt:  c.connectedAt,
+		Compressed:   c.compressed,
+		Connects:     c.connects.Load(),
+		Frames:       c.frames.Load(),
+		WireBytes:    c.wire.Load(),
+		PayloadBytes: c.payload.Load(),
+	}
+}
+
+func (c *connCounters) connected(endpoint string, compressed bool) {
+	c.connects.Add(1)
+	c.mu.Lock()
+	c.endpoint, c.connectedAt, c.compressed = endpoint, time.Now(), compressed
+	c.mu.Unlock()
+}
+
+func (c *connCounters) disconnected() {
+	c.mu.Lock()
+	c.connectedAt = time.Time{}
+	c.mu.Unlock()
+}
+
+// dial opens the TCP connection under the websocket, counting what is
+// read from it.
+func (c *connCounters) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn, read: &c.wire}, nil
+}
+
+type countingConn struct {
+	net.Conn
+	read *atomic.Uint64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(uint64(n))
+	return n, err
+}
@@ -0,0 +1,321 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/piotrostr/moon/protocol"
+)
+
+var ErrStreamClosed = errors.New("stream closed")
+
+// errReconnect ends a connection dropped by Reconnect.
+var errReconnect = errors.New("reconnect requested")
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// RecoveryStore is the view of the pair store a Stream needs to decide
+// when widened recovery filters can be narrowed again.
+type RecoveryStore interface {
+	Len() int
+	AllUpdatedSince(t time.Time) bool
+}
+
+// Stream keeps one connection to the pairs feed alive, over the websocket
+// transport unless the endpoint or Transport says otherwise. After a
+// reconnect it subscribes with widened filters until every pair in the store
+// has been refreshed (or the recovery timeout passes), then narrows again.
+// When the server advertises a different endpoint in the same domain and
+// FollowEndpoint is set, the stream reconnects there, and falls back to the
+// configured one if that connection fails. A Cloudflare challenge on the
+// handshake is reported as a ChallengeError, or handed to Solver when one
+// is set.
+type Stream struct {
+	ID           int
+	Subscription Subscription
+	// Store may be nil, in which case reconnects never widen.
+	Store           RecoveryStore
+	RecoveryTimeout time.Duration
+	MaxReconnects   int
+	// FollowEndpoint moves the stream to the endpoint the server advertises
+	// in its block hash messages. Hints are unauthenticated, so the stream
+	// stays on the configured endpoint by default.
+	FollowEndpoint bool
+	// PinEndpoint keeps the stream on the configured endpoint.
+	//
+	// Deprecated: the stream stays there unless FollowEndpoint is set.
+	PinEndpoint bool
+	// Solver clears Cloudflare challenges; it may be nil. Clearance is sent
+	// with every handshake and replaced by what the solver returns.
+	Solver    ChallengeSolver
+	Clearance *Clearance
+	// Compression offers permessage-deflate; the server decides whether
+	// to use it.
+	Compression bool
+	// Transport replaces the one TransportFor picks for the endpoint.
+	Transport Transport
+	// Logf receives progress messages (connecting, migrating, challenges),
+	// one line each; nil discards them. Errors go to Run's error channel.
+	Logf func(format string, args ...any)
+
+	mux protocol.Mux
+	// hinted is the advertised endpoint the stream moved to, if any
+	hinted   string
+	hints    map[string]bool
+	counters connCounters
+
+	mu sync.Mutex
+	// drop closes the open connection, if any
+	drop      func()
+	reconnect bool
+}
+
+func (s *Stream) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// OnPairs, OnBlockHash, OnPing and OnUnknown register handlers for Serve.
+func (s *Stream) OnPairs(fn func(*protocol.PairsMessage)) { s.mux.OnPairs(fn) }
+
+func (s *Stream) OnBlockHash(fn func(*protocol.LatestBlockHashMessage)) { s.mux.OnBlockHash(fn) }
+
+func (s *Stream) OnPing(fn func(*protocol.PingMessage)) { s.mux.OnPing(fn) }
+
+func (s *Stream) OnUnknown(fn func(frame []byte, err error)) { s.mux.OnUnknown(fn) }
+
+// Serve runs the stream and dispatches every frame to the registered
+// handlers on the calling goroutine. Decoded messages own their data; the
+// frame passed to OnUnknown is only valid during the call. Connection errors are passed to
+// onError, which may be nil. It returns when ctx is done or the stream
+// gives up.
+func (s *Stream) Serve(ctx context.Context, onError func(error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	frames := make(chan Frame)
+	errs := make(chan error)
+	go s.Run(ctx, frames, errs)
+
+	for {
+		select {
+		case frame := <-frames:
+			s.mux.Dispatch(frame.Data)
+			frame.Release()
+		case err := <-errs:
+			if errors.Is(err, ErrStreamClosed) {
+				return err
+			}
+			if onError != nil {
+				onError(err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Reconnect drops the open connection, and Run dials again at once, with
+// widened filters if the store has pairs. It does nothing while the
+// stream is not connected.
+func (s *Stream) Reconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.drop != nil {
+		s.reconnect = true
+		s.drop()
+	}
+}
+
+// setDrop sets the func dropping the open connection; nil clears it and
+// reports whether Reconnect dropped the connection.
+func (s *Stream) setDrop(drop func()) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drop = drop
+	requested := s.reconnect
+	s.reconnect = false
+	return requested
+}
+
+func (s *Stream) storeLen() int {
+	if s.Store == nil {
+		return 0
+	}
+	return s.Store.Len()
+}
+
+// Run connects and reconnects until ctx is done, MaxReconnects is
+// exceeded or the source is exhausted, delivering frames to frameChan and
+// connection errors to errorChan. The receiver owns each frame and should
+// Release it when done.
+func (s *Stream) Run(ctx context.Context, frameChan chan<- Frame, errorChan chan<- error) {
+	delay := minReconnectDelay
+	failures := 0
+	widen := false
+	// a fresh clearance gets one immediate redial
+	solved := false
+
+	for {
+		sub := s.Subscription
+		if widen {
+			sub = sub.Widened()
+		}
+		if s.hinted != "" {
+			sub.Endpoint = s.hinted
+		}
+
+		received, narrowed, err := s.connect(ctx, sub, widen, frameChan)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errMigrate) || errors.Is(err, errReconnect) {
+			widen = s.storeLen() > 0
+			continue
+		}
+		if errors.Is(err, ErrSourceDone) {
+			select {
+			case errorChan <- fmt.Errorf("%w: %w", err, ErrStreamClosed):
+			case <-ctx.Done():
+			}
+			return
+		}
+		if errors.Is(err, errChallengeSolved) && !solved {
+			solved = true
+			continue
+		}
+		if s.hinted != "" && !received {
+			s.logf("[conn %d] Advertised endpoint %s failed, falling back to %s", s.ID, s.hinted, s.Subscription.BaseURL())
+			s.hinted = ""
+		}
+		if narrowed {
+			widen = false
+			continue
+		}
+		select {
+		case errorChan <- err:
+		case <-ctx.Done():
+			return
+		}
+
+		if received {
+			delay = minReconnectDelay
+			failures = 0
+			solved = false
+		}
+		failures++
+		if s.MaxReconnects > 0 && failures > s.MaxReconnects {
+			select {
+			case errorChan <- fmt.Errorf("[conn %d] giving up after %d reconnects: %w", s.ID, s.MaxReconnects, ErrStreamClosed):
+			case <-ctx.Done():
+			}
+			return
+		}
+
+		widen = s.storeLen() > 0
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// connect runs a single connection until it fails or, in widened mode, until
+// recovery completes. It reports whether any frame was received and whether
+// it returned to narrow the subscription.
+func (s *Stream) connect(ctx context.Context, sub Subscription, widened bool, frameChan chan<- Frame) (bool, bool, error) {
+	url := sub.URL()
+	s.logf("[conn %d] Connecting to: %s", s.ID, url)
+
+	transport := s.Transport
+	if transport == nil {
+		var err error
+		if transport, err = TransportFor(url); err != nil {
+			return false, false, fmt.Errorf("[conn %d] %v", s.ID, err)
+		}
+	}
+
+	header := http.Header{}
+	header.Set("Origin", "https://dexscreener.com")
+	header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36")
+	s.Clearance.apply(header)
+
+	conn, err := transport.Dial(ctx, Target{URL: url, Header: header, Compression: s.Compression, NetDial: s.counters.dial})
+	if err != nil {
+		var challenge *ChallengeError
+		if errors.As(err, &challenge) {
+			return false, false, s.solveChallenge(ctx, url, challenge)
+		}
+		return false, false, fmt.Errorf("[conn %d] Connection error: %v", s.ID, err)
+	}
+	defer conn.Close()
+	s.counters.connected(sub.BaseURL(), conn.Compressed())
+	defer s.counters.disconnected()
+
+	// unblock the read when ctx is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	s.setDrop(func() { conn.Close() })
+	defer s.setDrop(nil)
+
+	if widened {
+		s.logf("[conn %d] Connection opened with widened filters to recover %d pairs", s.ID, s.storeLen())
+	} else {
+		s.logf("[conn %d] Connection opened", s.ID)
+	}
+
+	connectedAt := time.Now()
+	received := false
+	seq := 0
+
+	for {
+		r, err := conn.NextReader()
+		var buf *bytes.Buffer
+		if err == nil {
+			buf, err = readFrame(r)
+		}
+		if errors.Is(err, ErrSourceDone) {
+			return received, false, fmt.Errorf("[conn %d] %w", s.ID, err)
+		}
+		if err != nil {
+			if s.setDrop(nil) {
+				s.logf("[conn %d] Reconnecting on request", s.ID)
+				return received, false, errReconnect
+			}
+			return received, false, fmt.Errorf("[conn %d] Read error: %v", s.ID, err)
+		}
+		received = true
+		s.counters.frames.Add(1)
+		s.counters.payload.Add(uint64(buf.Len()))
+		migrate := s.observeHint(buf.Bytes(), sub.BaseURL())
+		frame := Frame{ConnID: s.ID, Seq: seq, Data: buf.Bytes(), Widened: widened, buf: buf}
+		seq++
+		select {
+		case frameChan <- frame:
+		case <-ctx.Done():
+			frame.Release()
+			return received, false, ctx.Err()
+		}
+		if migrate {
+			return received, false, errMigrate
+		}
+
+		if widened && (time.Since(connectedAt) > s.RecoveryTimeout || s.Store.AllUpdatedSince(connectedAt)) {
+			s.logf("[conn %d] Recovery finished, narrowing filters", s.ID)
+			return received, true, nil
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const dexscreenerStreamURL = "wss://io.dexscreener.com/dex/screener/v4/pairs/h24/1"
+
+// Subscription describes the filters sent to the pairs stream.
+// Zero values for the min and max filters mean "no limit".
+type Subscription struct {
+	RankBy              string
+	RankOrder           string
+	ChainIDs            []string
+	DexIDs              []string
+	ExcludedDexIDs      []string
+	MinMoonshotProgress float64
+	MaxMoonshotProgress float64
+	MaxPairAgeHours     int
+	// Endpoint replaces the dexscreener websocket URL, e.g. to point the
+	// stream at a mock feed. The query is appended unchanged.
+	Endpoint string
+}
+
+func DefaultSubscription() Subscription {
+	return Subscription{
+		RankBy:              "pairAge",
+		RankOrder:           "asc",
+		ChainIDs:            []string{"solana"},
+		DexIDs:              []string{"moonshot"},
+		MaxMoonshotProgress: 99.99,
+	}
+}
+
+// Validate checks the filters before they are sent; the server answers
+// bad ones with an empty stream rather than an error.
+func (s Subscription) Validate() error {
+	if len(s.ChainIDs) == 0 {
+		return errors.New("at least one chain id is required")
+	}
+	for _, ids := range [][]string{s.ChainIDs, s.DexIDs, s.ExcludedDexIDs} {
+		for _, id := range ids {
+			if id == "" || strings.ContainsAny(id, "&=[]# ") {
+				return fmt.Errorf("invalid chain or dex id %q", id)
+			}
+		}
+	}
+	for _, id := range s.ExcludedDexIDs {
+		if slices.Contains(s.DexIDs, id) {
+			return fmt.Errorf("dex %q is both included and excluded", id)
+		}
+	}
+	for _, progress := range []float64{s.MinMoonshotProgress, s.MaxMoonshotProgress} {
+		if progress < 0 || progress > 100 {
+			return fmt.Errorf("moonshot progress %v is outside 0-100", progress)
+		}
+	}
+	if s.MaxMoonshotProgress > 0 && s.MinMoonshotProgress >= s.MaxMoonshotProgress {
+		return fmt.Errorf("min moonshot progress %v is not below max %v", s.MinMoonshotProgress, s.MaxMoonshotProgress)
+	}
+	if s.MaxPairAgeHours < 0 {
+		return fmt.Errorf("max pair age %d is negative", s.MaxPairAgeHours)
+	}
+	return nil
+}
+
+// Widened drops the max progress and age limits so pairs that aged out of
+// the narrow filters while we were disconnected are served again. The min
+// progress stays, since bonding progress only grows.
+func (s Subscription) Widened() Subscription {
+	s.MaxMoonshotProgress = 0
+	s.MaxPairAgeHours = 0
+	return s
+}
+
+func (s Subscription) URL() string {
+	// dexscreener expects the brackets unescaped, so the query is built by hand
+	params := []string{
+		"rankBy[key]=" + s.RankBy,
+		"rankBy[order]=" + s.RankOrder,
+	}
+	for i, chainID := range s.ChainIDs {
+		params = append(params, fmt.Sprintf("filters[chainIds][%d]=%s", i, chainID))
+	}
+	for i, dexID := range s.DexIDs {
+		params = append(params, fmt.Sprintf("filters[dexIds][%d]=%s", i, dexID))
+	}
+	for i, dexID := range s.ExcludedDexIDs {
+		params = append(params, fmt.Sprintf("filters[excludedDexIds][%d]=%s", i, dexID))
+	}
+	if len(s.ExcludedDexIDs) == 0 {
+		params = append(params, "filters[excludedDexIds][]")
+	}
+	if s.MinMoonshotProgress > 0 {
+		params = append(params, "filters[moonshotProgress][min]="+strconv.FormatFloat(s.MinMoonshotProgress, 'f', -1, 64))
+	}
+	if s.MaxMoonshotProgress > 0 {
+		params = append(params, "filters[moonshotProgress][max]="+strconv.FormatFloat(s.MaxMoonshotProgress, 'f', -1, 64))
+	}
+	if s.MaxPairAgeHours > 0 {
+		params = append(params, "filters[pairAge][max]="+strconv.Itoa(s.MaxPairAgeHours))
+	}
+
+	return s.BaseURL() + "?" + strings.Join(params, "&")
+}
+
+// BaseURL is the websocket URL without the filter query.
+func (s Subscription) BaseURL() string {
+	if s.Endpoint == "" {
+		return dexscreenerStreamURL
+	}
+	return s.Endpoint
+}
@@ -0,0 +1,62 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// ErrSourceDone is returned by a Conn whose source has no more frames,
+// such as a recording played to the end or cut short. The stream stops
+// instead of reconnecting.
+var ErrSourceDone = errors.New("source exhausted")
+
+// Target is what a Transport dials.
+type Target struct {
+	URL    string
+	Header http.Header
+	// Compression offers compression where the transport supports it.
+	Compression bool
+	// NetDial opens network connections, so the stream can count the
+	// bytes read; transports that use no network ignore it.
+	NetDial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Transport opens connections to a frame source. Parsing stays with the
+// consumer, so adding a transport touches neither protocol nor the
+// handlers.
+type Transport interface {
+	// Dial returns a *ChallengeError when the source answered with a
+	// Cloudflare challenge.
+	Dial(ctx context.Context, target Target) (Conn, error)
+}
+
+// Conn is one open connection.
+type Conn interface {
+	// NextReader returns the next frame, readable until the next call.
+	NextReader() (io.Reader, error)
+	// Compressed reports whether frames arrive compressed on the wire.
+	Compressed() bool
+	Close() error
+}
+
+// TransportFor picks the transport for a URL by scheme: ws and wss for
+// the live feed or a mock server, file for a recording.
+func TransportFor(rawURL string) (Transport, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+		return WebsocketTransport{}, nil
+	case "file":
+		return FileTransport{}, nil
+	default:
+		return nil, fmt.Errorf("no transport for scheme %q", u.Scheme)
+	}
+}
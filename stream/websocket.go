@@ -0,0 +1,43 @@
+package stream
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebsocketTransport dials the dexscreener feed, or anything speaking its
+// protocol such as a mockfeed server.
+type WebsocketTransport struct{}
+
+func (WebsocketTransport) Dial(ctx context.Context, target Target) (Conn, error) {
+	dialer := websocket.Dialer{
+		EnableCompression: target.Compression,
+		NetDialContext:    target.NetDial,
+	}
+	conn, resp, err := dialer.DialContext(ctx, target.URL, target.Header)
+	if err != nil {
+		if challenge := detectChallenge(resp); challenge != nil {
+			return nil, challenge
+		}
+		return nil, err
+	}
+	compressed := strings.Contains(resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+	return &websocketConn{conn: conn, compressed: compressed}, nil
+}
+
+type websocketConn struct {
+	conn       *websocket.Conn
+	compressed bool
+}
+
+func (c *websocketConn) NextReader() (io.Reader, error) {
+	_, r, err := c.conn.NextReader()
+	return r, err
+}
+
+func (c *websocketConn) Compressed() bool { return c.compressed }
+
+func (c *websocketConn) Close() error { return c.conn.Close() }
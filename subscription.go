@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// SubscriptionConfig sets the stream filters from the config file, for
+// strategies that want early bonding (a low maxProgress) or pairs close
+// to graduation (a high minProgress). Flags given on the command line
+// override it.
+type SubscriptionConfig struct {
+	Chains       []string `json:"chains,omitempty"`
+	Dexes        []string `json:"dexes,omitempty"`
+	ExcludeDexes []string `json:"excludeDexes,omitempty"`
+	MinProgress  float64  `json:"minProgress,omitempty"`
+	// MaxProgress defaults to 99.99; 0 means no limit.
+	MaxProgress *float64 `json:"maxProgress,omitempty"`
+	MaxAgeHours int      `json:"maxAgeHours,omitempty"`
+}
+
+func (c *SubscriptionConfig) apply(sub *Subscription) {
+	if c == nil {
+		return
+	}
+	if len(c.Chains) > 0 {
+		sub.ChainIDs = c.Chains
+	}
+	if len(c.Dexes) > 0 {
+		sub.DexIDs = c.Dexes
+	}
+	sub.ExcludedDexIDs = c.ExcludeDexes
+	sub.MinMoonshotProgress = c.MinProgress
+	if c.MaxProgress != nil {
+		sub.MaxMoonshotProgress = *c.MaxProgress
+	}
+	sub.MaxPairAgeHours = c.MaxAgeHours
+}
+
+func (c *SubscriptionConfig) Validate() error {
+	sub := DefaultSubscription()
+	c.apply(&sub)
+	return sub.Validate()
+}
+
+// subscriptionFlags registers the stream filter flags on fs. The returned
+// function builds the subscription from the defaults, then the config
+// file, then the flags that were set.
+func subscriptionFlags(fs *flag.FlagSet) func(config *Config) (Subscription, error) {
+	chains := fs.String("chains", "solana", "comma-separated chain ids to subscribe to")
+	dexes := fs.String("dexes", "moonshot", "comma-separated dex ids to subscribe to")
+	excludeDexes := fs.String("exclude-dexes", "", "comma-separated dex ids to leave out")
+	minProgress := fs.Float64("min-progress", 0, "minimum moonshot bonding progress to subscribe to (0 for no limit)")
+	maxProgress := fs.Float64("max-progress", 99.99, "maximum moonshot bonding progress to subscribe to (0 for no limit)")
+	maxAge := fs.Int("max-age", 0, "maximum pair age in hours to subscribe to (0 for no limit)")
+	endpoint := fs.String("endpoint", "", "URL to stream from instead of dexscreener, e.g. a moon mock feed (ws://) or a recording (file://)")
+	return func(config *Config) (Subscription, error) {
+		sub := DefaultSubscription()
+		config.Subscription.apply(&sub)
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "chains":
+				sub.ChainIDs = splitList(*chains)
+			case "dexes":
+				sub.DexIDs = splitList(*dexes)
+			case "exclude-dexes":
+				sub.ExcludedDexIDs = splitList(*excludeDexes)
+			case "min-progress":
+				sub.MinMoonshotProgress = *minProgress
+			case "max-progress":
+				sub.MaxMoonshotProgress = *maxProgress
+			case "max-age":
+				sub.MaxPairAgeHours = *maxAge
+			}
+		})
+		sub.Endpoint = *endpoint
+		if err := sub.Validate(); err != nil {
+			return sub, fmt.Errorf("subscription: %v", err)
+		}
+		return sub, nil
+	}
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
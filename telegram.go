@@ -0,0 +1,514 @@
+//go:build !lite
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const telegramAPI = "https://api.telegram.org"
+
+// TelegramConfig connects a bot that forwards alerts to one chat and
+// answers commands from it. Messages from other chats are ignored.
+type TelegramConfig struct {
+	Token  string `json:"token"`
+	ChatID int64  `json:"chatId"`
+	// Language renders alerts from that language's catalog, see Catalog.
+	Language string `json:"language,omitempty"`
+	// Traders are the user IDs allowed to place trades with /buy; anyone
+	// in the chat may use the other commands.
+	Traders []int64 `json:"traders,omitempty"`
+	// Outbox is a file keeping notifications that could not be sent, which
+	// are retried every minute and on the next start; empty drops them.
+	Outbox string `json:"outbox,omitempty"`
+}
+
+const telegramRetryInterval = time.Minute
+
+func (c TelegramConfig) Validate() error {
+	if c.Token == "" {
+		return errors.New("telegram requires token")
+	}
+	if c.ChatID == 0 {
+		return errors.New("telegram requires chatId")
+	}
+	return nil
+}
+
+func (c *TelegramConfig) expandSecrets() error {
+	var err error
+	c.Token, err = secrets.Expand(c.Token)
+	// the token is part of every API URL, so keep it out of logs even
+	// when given in plain text
+	secrets.remember(c.Token)
+	return err
+}
+
+// TelegramBot sends alerts and position changes to the chat and handles
+// /pairs, /top, /positions, /mute, /unmute, /ack, /buy, /tag, /untag and
+// /note. Trader and alerts may be nil when trading or alert controls are
+// off.
+type TelegramBot struct {
+	config      TelegramConfig
+	client      *http.Client
+	store       *PairStore
+	leaderboard *Leaderboard
+	trader      *Trader
+	alerts      *AlertControl
+	notes       *Notes
+	locale      NumberLocale
+	queue       chan string
+	outbox      *Outbox
+}
+
+// NewTelegramBot formats numbers for people with locale whatever the
+// console settings.
+func NewTelegramBot(config TelegramConfig, locale NumberLocale, store *PairStore, leaderboard *Leaderboard, trader *Trader, alerts *AlertControl, notes *Notes) (*TelegramBot, error) {
+	b := &TelegramBot{
+		config:      config,
+		client:      &http.Client{Timeout: 60 * time.Second},
+		store:       store,
+		leaderboard: leaderboard,
+		trader:      trader,
+		alerts:      alerts,
+		notes:       notes,
+		locale:      locale,
+		queue:       make(chan string, 256),
+	}
+	if config.Outbox != "" {
+		var err error
+		if b.outbox, err = OpenOutbox(config.Outbox); err != nil {
+			return nil, fmt.Errorf("telegram: %v", err)
+		}
+	}
+	return b, nil
+}
+
+// Observe queues notifications without blocking the bus.
+func (b *TelegramBot) Observe(event Event) {
+	var text string
+	switch e := event.(type) {
+	case *AlertEvent:
+		text = fmt.Sprintf("🚨 #%d [%s] %s%s", e.ID, e.Kind, localizedMessage(e, b.config.Language), formatTags(e.Tags))
+		if e.Note != "" {
+			text += "\n📝 " + e.Note
+		}
+	case *PositionOpenedEvent:
+		p := e.Position
+		text = fmt.Sprintf("Opened #%d %s at %s for %g SOL", p.ID, p.TokenSymbol, b.locale.USD(p.EntryPrice), float64(p.CostLamports)/lamportsPerSOL)
+	case *PositionClosedEvent:
+		p := e.Position
+		text = fmt.Sprintf("Closed #%d %s %s at %s, PnL %+.1f%%", p.ID, p.TokenSymbol, p.ExitRule, b.locale.USD(p.ExitPrice), e.PnL*100)
+	default:
+		return
+	}
+	select {
+	case b.queue <- text:
+	default:
+		color.Red("Telegram queue full, dropping message")
+	}
+}
+
+// Run sends queued messages and long-polls for commands until ctx is done.
+func (b *TelegramBot) Run(ctx context.Context) {
+	go b.notify(ctx)
+
+	offset := 0
+	for ctx.Err() == nil {
+		updates, err := b.updates(ctx, offset)
+		if err != nil {
+			if ctx.Err() == nil {
+				color.Red("Telegram poll error: %v", err)
+				select {
+				case <-time.After(5 * time.Second):
+				case <-ctx.Done():
+				}
+			}
+			continue
+		}
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			msg := update.Message
+			if msg == nil || msg.Chat.ID != b.config.ChatID || !strings.HasPrefix(msg.Text, "/") {
+				continue
+			}
+			reply := b.command(msg.Text, msg.From.ID, msg.From.Username)
+			if err := b.send(ctx, reply); err != nil {
+				color.Red("Telegram send error: %v", err)
+			}
+		}
+	}
+}
+
+// notify sends queued notifications. With an outbox, unsent ones are kept
+// and retried in order, and those still queued at shutdown are saved.
+func (b *TelegramBot) notify(ctx context.Context) {
+	if b.outbox == nil {
+		for {
+			select {
+			case text := <-b.queue:
+				if err := b.send(ctx, text); err != nil {
+					color.Red("Telegram send error: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	defer b.outbox.Close()
+	ticker := time.NewTicker(telegramRetryInterval)
+	defer ticker.Stop()
+	b.flushOutbox(ctx)
+	for {
+		select {
+		case text := <-b.queue:
+			// behind a backlog, queue it so messages stay in order
+			if b.outbox.Len() == 0 {
+				err := b.send(ctx, text)
+				if err == nil {
+					continue
+				}
+				color.Red("Telegram send error, keeping the message: %v", err)
+			}
+			b.keep(text)
+			b.flushOutbox(ctx)
+		case <-ticker.C:
+			b.flushOutbox(ctx)
+		case <-ctx.Done():
+			for len(b.queue) > 0 {
+				b.keep(<-b.queue)
+			}
+			return
+		}
+	}
+}
+
+func (b *TelegramBot) keep(text string) {
+	err := b.outbox.Add(OutboxEntry{Event: "message", ContentType: "text/plain", Payload: []byte(text), At: time.Now()})
+	if err != nil {
+		color.Red("Telegram outbox error, dropping message: %v", err)
+	}
+}
+
+func (b *TelegramBot) flushOutbox(ctx context.Context) {
+	if b.outbox.Len() == 0 || ctx.Err() != nil {
+		return
+	}
+	sent, err := b.outbox.Flush(func(entry OutboxEntry) error {
+		return b.send(ctx, string(entry.Payload))
+	})
+	if sent > 0 {
+		color.Green("Telegram sent %d messages from its outbox", sent)
+	}
+	if err != nil {
+		color.Yellow("Telegram outbox retry failed, %d left: %v", b.outbox.Len(), err)
+	}
+}
+
+type telegramUpdate struct {
+	UpdateID int `json:"update_id"`
+	Message  *struct {
+		Text string `json:"text"`
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		From struct {
+			ID       int64  `json:"id"`
+			Username string `json:"username"`
+		} `json:"from"`
+	} `json:"message"`
+}
+
+func (b *TelegramBot) updates(ctx context.Context, offset int) ([]telegramUpdate, error) {
+	query := url.Values{"timeout": {"30"}, "offset": {strconv.Itoa(offset)}}
+	var updates []telegramUpdate
+	err := b.call(ctx, http.MethodGet, "getUpdates?"+query.Encode(), nil, &updates)
+	return updates, err
+}
+
+func (b *TelegramBot) send(ctx context.Context, text string) error {
+	body := map[string]any{"chat_id": b.config.ChatID, "text": text, "disable_web_page_preview": true}
+	return b.call(ctx, http.MethodPost, "sendMessage", body, nil)
+}
+
+func (b *TelegramBot) call(ctx context.Context, method, path string, body, result any) error {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, telegramAPI+"/bot"+b.config.Token+"/"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		// the URL carries the bot token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("telegram %s: %s", path, resp.Status)
+	}
+	if !envelope.OK {
+		return fmt.Errorf("telegram %s: %s", path, envelope.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(envelope.Result, result)
+	}
+	return nil
+}
+
+// command runs one chat command and returns the reply.
+func (b *TelegramBot) command(text string, userID int64, from string) string {
+	fields := strings.Fields(text)
+	// commands may be addressed as /top@moon_bot in groups
+	name, _, _ := strings.Cut(fields[0], "@")
+	args := fields[1:]
+
+	switch name {
+	case "/pairs":
+		return b.pairs(args)
+	case "/top":
+		return b.top(args)
+	case "/positions":
+		return b.positions()
+	case "/mute":
+		return b.mute(args)
+	case "/unmute":
+		return b.unmute(args)
+	case "/ack":
+		return b.ack(args, from)
+	case "/buy":
+		return b.buy(args, userID)
+	case "/tag":
+		return b.tag(args, from)
+	case "/untag":
+		return b.untag(args, from)
+	case "/note":
+		return b.note(args, from)
+	default:
+		return "Commands:\n" +
+			"/pairs [n] - newest pairs\n" +
+			"/top [window] - top gainers, e.g. /top 6h\n" +
+			"/positions - open positions\n" +
+			"/mute <pair|rule> <minutes>\n" +
+			"/unmute <pair|rule>\n" +
+			"/ack <alert id>\n" +
+			"/buy <pair> <sol>\n" +
+			"/tag <pair> <tag...> - e.g. /tag <pair> watch\n" +
+			"/untag <pair> [tag...]\n" +
+			"/note <pair> [text] - set or show a note"
+	}
+}
+
+func (b *TelegramBot) pairs(args []string) string {
+	n := 10
+	if len(args) > 0 {
+		if v, err := strconv.Atoi(args[0]); err == nil && v > 0 {
+			n = min(v, 50)
+		}
+	}
+	pairs := b.store.Snapshot()
+	if len(pairs) == 0 {
+		return "No pairs tracked yet."
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].FirstSeen.After(pairs[j].FirstSeen) })
+
+	var lines []string
+	for _, p := range pairs[:min(n, len(pairs))] {
+		lines = append(lines, fmt.Sprintf("%s %s vol %s age %s\n%s", p.TokenSymbol, b.locale.USD(p.Price),
+			b.locale.USD(p.Volume), time.Since(p.FirstSeen).Round(time.Second), formatAddress(p.PairAddress)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b *TelegramBot) top(args []string) string {
+	window := 24 * time.Hour
+	if len(args) > 0 {
+		d, err := time.ParseDuration(args[0])
+		if err != nil {
+			return fmt.Sprintf("Invalid window: %v", err)
+		}
+		window = d
+	}
+	boards := b.leaderboard.Compute(window, 10, time.Now())
+	if len(boards.TopGainers) == 0 {
+		return fmt.Sprintf("No gainers in the last %s.", window)
+	}
+	lines := []string{fmt.Sprintf("Top gainers (%s):", window)}
+	for i, e := range boards.TopGainers {
+		lines = append(lines, fmt.Sprintf("%d. %s %.2fx age %s\n%s", i+1, e.TokenSymbol, e.Multiple, e.Duration.Round(time.Second), e.PairAddress))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b *TelegramBot) positions() string {
+	if b.trader == nil {
+		return "Trading is disabled."
+	}
+	var lines []string
+	for _, p := range b.trader.Positions() {
+		if p.Status == PositionClosed {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("#%d %s %s entry %s last %s PnL %+.1f%%", p.ID, p.TokenSymbol, p.Status,
+			b.locale.USD(p.EntryPrice), b.locale.USD(p.LastPrice), p.PnL()*100))
+	}
+	if len(lines) == 0 {
+		return "No open positions."
+	}
+	return strings.Join(lines, "\n")
+}
+
+// muteTarget reads a pair address or a rule name.
+func muteTarget(arg string) (pair, rule string) {
+	if _, err := decodeAddress(arg); err == nil {
+		return arg, ""
+	}
+	return "", arg
+}
+
+func (b *TelegramBot) mute(args []string) string {
+	if b.alerts == nil {
+		return "Alert controls are disabled."
+	}
+	if len(args) != 2 {
+		return "Usage: /mute <pair|rule> <minutes>"
+	}
+	minutes, err := strconv.Atoi(args[1])
+	if err != nil {
+		return "Minutes must be a number."
+	}
+	pair, rule := muteTarget(args[0])
+	mute, err := b.alerts.Mute(pair, rule, time.Duration(minutes)*time.Minute)
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("Muted %s until %s.", args[0], mute.Until.Format("15:04 MST"))
+}
+
+func (b *TelegramBot) unmute(args []string) string {
+	if b.alerts == nil {
+		return "Alert controls are disabled."
+	}
+	if len(args) != 1 {
+		return "Usage: /unmute <pair|rule>"
+	}
+	pair, rule := muteTarget(args[0])
+	if err := b.alerts.Unmute(pair, rule); err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("Unmuted %s.", args[0])
+}
+
+func (b *TelegramBot) ack(args []string, from string) string {
+	if b.alerts == nil {
+		return "Alert controls are disabled."
+	}
+	if len(args) != 1 {
+		return "Usage: /ack <alert id>"
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+	if err != nil {
+		return "Alert id must be a number."
+	}
+	ack, err := b.alerts.Acknowledge(id, from)
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("Acknowledged #%d; %s will not alert again for this pair.", ack.AlertID, ack.Rule)
+}
+
+func (b *TelegramBot) buy(args []string, userID int64) string {
+	if b.trader == nil {
+		return "Trading is disabled."
+	}
+	if !slices.Contains(b.config.Traders, userID) {
+		return "You are not allowed to trade; add your user ID to telegram.traders."
+	}
+	if len(args) != 2 {
+		return "Usage: /buy <pair> <sol>"
+	}
+	sol, err := strconv.ParseFloat(args[1], 64)
+	if err != nil || !(sol > 0) || math.IsInf(sol, 0) {
+		return "SOL amount must be a positive number."
+	}
+	position, err := b.trader.Open(args[0], uint64(sol*lamportsPerSOL), nil, "telegram")
+	if err != nil {
+		return fmt.Sprintf("Buy failed: %v", err)
+	}
+	return fmt.Sprintf("Opening #%d %s with %g SOL.", position.ID, position.TokenSymbol, sol)
+}
+
+func (b *TelegramBot) tag(args []string, from string) string {
+	if len(args) < 2 {
+		return "Usage: /tag <pair> <tag...>"
+	}
+	note, err := b.notes.Tag(args[0], from, args[1:]...)
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("Tagged %s:%s", args[0], formatTags(note.Tags))
+}
+
+func (b *TelegramBot) untag(args []string, from string) string {
+	if len(args) < 1 {
+		return "Usage: /untag <pair> [tag...]"
+	}
+	note, err := b.notes.Untag(args[0], from, args[1:]...)
+	if err != nil {
+		return err.Error()
+	}
+	if len(note.Tags) == 0 {
+		return fmt.Sprintf("%s has no tags.", args[0])
+	}
+	return fmt.Sprintf("Tags on %s:%s", args[0], formatTags(note.Tags))
+}
+
+func (b *TelegramBot) note(args []string, from string) string {
+	if len(args) < 1 {
+		return "Usage: /note <pair> [text]"
+	}
+	if len(args) == 1 {
+		note, ok := b.notes.Get(args[0])
+		if !ok {
+			return fmt.Sprintf("No note for %s.", args[0])
+		}
+		return fmt.Sprintf("%s%s\n%s", note.Pair, formatTags(note.Tags), note.Note)
+	}
+	if _, err := b.notes.SetNote(args[0], from, strings.Join(args[1:], " ")); err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("Noted %s.", args[0])
+}
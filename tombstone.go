@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Tombstone is the final record kept for a pair evicted from hot state.
+type Tombstone struct {
+	PairAddress  string        `json:"pairAddress"`
+	TokenName    string        `json:"tokenName"`
+	TokenSymbol  string        `json:"tokenSymbol"`
+	Reason       string        `json:"reason"`
+	Rugged       bool          `json:"rugged"`
+	FirstSeen    time.Time     `json:"firstSeen"`
+	LastSeen     time.Time     `json:"lastSeen"`
+	DiedAt       time.Time     `json:"diedAt"`
+	Lifetime     time.Duration `json:"lifetime"`
+	FirstBlock   uint32        `json:"firstSeenBlock"`
+	LastBlock    uint32        `json:"lastSeenBlock"`
+	LifeBlocks   uint32        `json:"lifetimeBlocks"`
+	InitialPrice float64       `json:"initialPrice"`
+	PeakPrice    float64       `json:"peakPrice"`
+	FinalPrice   float64       `json:"finalPrice"`
+	Drawdown     float64       `json:"drawdown"`
+	Volume       float64       `json:"volume"`
+}
+
+// TombstoneStore appends tombstones as JSON lines to a file.
+type TombstoneStore struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+func OpenTombstoneStore(path string) (*TombstoneStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open tombstone store: %v", err)
+	}
+	return &TombstoneStore{path: path, file: file}, nil
+}
+
+func (s *TombstoneStore) Write(tombstone Tombstone) error {
+	data, err := json.Marshal(tombstone)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+// Prune drops tombstones of pairs that died before cutoff.
+func (s *TombstoneStore) Prune(cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed, err := pruneJSONL(s.path, "diedAt", cutoff, false)
+	if err != nil || removed == 0 {
+		return removed, err
+	}
+	// the file was replaced, so appends must go to the new one
+	s.file.Close()
+	s.file, err = os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	return removed, err
+}
+
+func (s *TombstoneStore) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,432 @@
+//go:build !lite
+
+package main
+
+import (
+	"bytes"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// SpanContext identifies a span; the zero value means "not traced".
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+func (c SpanContext) Valid() bool { return c.SpanID != [8]byte{} }
+
+// Span is an in-flight OpenTelemetry span. Methods on a nil Span are
+// no-ops, so untraced code paths need no checks.
+type Span struct {
+	tracer *Tracer
+	ctx    SpanContext
+	parent [8]byte
+	name   string
+	start  time.Time
+	attrs  map[string]any
+	err    string
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.ctx
+}
+
+func (s *Span) SetAttr(key string, value any) {
+	if s != nil {
+		s.attrs[key] = value
+	}
+}
+
+func (s *Span) SetError(err error) {
+	if s != nil && err != nil {
+		s.err = err.Error()
+	}
+}
+
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.tracer.finish(s, time.Now())
+}
+
+// otlpMetricInterval is how often metrics are pushed to the collector.
+const otlpMetricInterval = 15 * time.Second
+
+// Tracer samples frames and exports their spans over OTLP/HTTP with the
+// JSON encoding, which Jaeger, Tempo and the OpenTelemetry collector all
+// accept on /v1/traces. A frame's trace covers receipt, decode, event
+// handling and every sink delivery of the events it produced. It also
+// pushes the metrics registry to /v1/metrics.
+type Tracer struct {
+	endpoint string
+	sample   float64
+	client   *http.Client
+	spans    chan otlpSpan
+	dropped  atomic.Int64
+	metrics  atomic.Pointer[Metrics]
+	started  time.Time
+	stop     chan struct{}
+	done     chan struct{}
+
+	// active is the frame span being handled, so sinks can parent their
+	// delivery spans on it. Only the stream loop sets it; events published
+	// from elsewhere while a frame is handled may be misattributed.
+	active atomic.Pointer[SpanContext]
+}
+
+// NewTracer returns nil when endpoint is empty, which disables tracing.
+func NewTracer(endpoint string, sample float64) *Tracer {
+	if endpoint == "" {
+		return nil
+	}
+	return &Tracer{
+		endpoint: endpoint,
+		sample:   sample,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		spans:    make(chan otlpSpan, 4096),
+		started:  time.Now(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// ExportMetrics pushes metrics to the collector alongside the spans.
+func (t *Tracer) ExportMetrics(metrics *Metrics) {
+	if t != nil {
+		t.metrics.Store(metrics)
+	}
+}
+
+// StartFrame starts a root span for a frame if it is sampled.
+func (t *Tracer) StartFrame(name string) *Span {
+	if t == nil || rand.Float64() >= t.sample {
+		return nil
+	}
+	var ctx SpanContext
+	cryptorand.Read(ctx.TraceID[:])
+	return t.start(name, ctx)
+}
+
+// Start starts a child of parent, or nothing if parent is not traced.
+func (t *Tracer) Start(name string, parent SpanContext) *Span {
+	if t == nil || !parent.Valid() {
+		return nil
+	}
+	span := t.start(name, SpanContext{TraceID: parent.TraceID})
+	span.parent = parent.SpanID
+	return span
+}
+
+func (t *Tracer) start(name string, ctx SpanContext) *Span {
+	cryptorand.Read(ctx.SpanID[:])
+	return &Span{tracer: t, ctx: ctx, name: name, start: time.Now(), attrs: make(map[string]any)}
+}
+
+// Activate marks span as the one being handled until the returned func
+// is called.
+func (t *Tracer) Activate(span *Span) func() {
+	if t == nil || span == nil {
+		return func() {}
+	}
+	ctx := span.Context()
+	t.active.Store(&ctx)
+	return func() { t.active.Store(nil) }
+}
+
+func (t *Tracer) Active() SpanContext {
+	if t == nil {
+		return SpanContext{}
+	}
+	if ctx := t.active.Load(); ctx != nil {
+		return *ctx
+	}
+	return SpanContext{}
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+func otlpAttr(key string, value any) otlpAttribute {
+	var v otlpValue
+	switch x := value.(type) {
+	case string:
+		v.StringValue = &x
+	case int:
+		s := strconv.Itoa(x)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &x
+	case bool:
+		v.BoolValue = &x
+	default:
+		s := fmt.Sprint(x)
+		v.StringValue = &s
+	}
+	return otlpAttribute{Key: key, Value: v}
+}
+
+func (t *Tracer) finish(s *Span, end time.Time) {
+	span := otlpSpan{
+		TraceID: hex.EncodeToString(s.ctx.TraceID[:]),
+		SpanID:  hex.EncodeToString(s.ctx.SpanID[:]),
+		Name:    s.name,
+		Kind:    1, // internal
+		Start:   strconv.FormatInt(s.start.UnixNano(), 10),
+		End:     strconv.FormatInt(end.UnixNano(), 10),
+	}
+	if s.parent != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	for key, value := range s.attrs {
+		span.Attributes = append(span.Attributes, otlpAttr(key, value))
+	}
+	if s.err != "" {
+		span.Status.Code = 2
+		span.Status.Message = s.err
+	}
+	select {
+	case t.spans <- span:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// Run exports finished spans in batches, and metrics every
+// otlpMetricInterval, until Close is called.
+func (t *Tracer) Run() {
+	if t == nil {
+		return
+	}
+	defer close(t.done)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	metricTicker := time.NewTicker(otlpMetricInterval)
+	defer metricTicker.Stop()
+
+	var batch []otlpSpan
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exportSpans(batch); err != nil {
+			color.Red("Trace export error: %v", err)
+		}
+		batch = nil
+	}
+	exportMetrics := func() {
+		if err := t.exportMetrics(time.Now()); err != nil {
+			color.Red("Metric export error: %v", err)
+		}
+	}
+	for {
+		select {
+		case span := <-t.spans:
+			if batch = append(batch, span); len(batch) >= 512 {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-metricTicker.C:
+			exportMetrics()
+		case <-t.stop:
+		drain:
+			for {
+				select {
+				case span := <-t.spans:
+					if batch = append(batch, span); len(batch) >= 512 {
+						flush()
+					}
+				default:
+					break drain
+				}
+			}
+			flush()
+			exportMetrics()
+			return
+		}
+	}
+}
+
+// Close exports the spans still queued and a last round of metrics, so the
+// final interval before shutdown is not lost. Spans ended after Close are
+// dropped.
+func (t *Tracer) Close() {
+	if t == nil {
+		return
+	}
+	close(t.stop)
+	<-t.done
+}
+
+func (t *Tracer) resource() map[string]any {
+	service := "moon"
+	return map[string]any{
+		"attributes": []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: &service}}},
+	}
+}
+
+func (t *Tracer) exportSpans(spans []otlpSpan) error {
+	return t.post("/v1/traces", map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": t.resource(),
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": "github.com/piotrostr/moon"},
+				"spans": spans,
+			}},
+		}},
+	})
+}
+
+type otlpDataPoint struct {
+	Attributes []otlpAttribute `json:"attributes,omitempty"`
+	Start      string          `json:"startTimeUnixNano,omitempty"`
+	Time       string          `json:"timeUnixNano"`
+	Value      float64         `json:"asDouble"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+}
+
+// otlpLabels turns a Prometheus label set such as sink="x",conn="1" into
+// attributes.
+func otlpLabels(labels string) []otlpAttribute {
+	var attrs []otlpAttribute
+	for labels != "" {
+		key, rest, ok := strings.Cut(labels, "=")
+		if !ok {
+			break
+		}
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			break
+		}
+		value, _ := strconv.Unquote(quoted)
+		attrs = append(attrs, otlpAttr(key, value))
+		labels = strings.TrimPrefix(rest[len(quoted):], ",")
+	}
+	return attrs
+}
+
+// exportMetrics sends every registered series: counters as cumulative
+// monotonic sums starting when the tracer was created, the rest as gauges.
+func (t *Tracer) exportMetrics(now time.Time) error {
+	registry := t.metrics.Load()
+	if registry == nil {
+		return nil
+	}
+	var metrics []*otlpMetric
+	for _, s := range registry.snapshot() {
+		point := otlpDataPoint{
+			Attributes: otlpLabels(s.labels),
+			Time:       strconv.FormatInt(now.UnixNano(), 10),
+			Value:      s.value(),
+		}
+		var metric *otlpMetric
+		if n := len(metrics); n > 0 && metrics[n-1].Name == s.base {
+			metric = metrics[n-1]
+		} else {
+			metric = &otlpMetric{Name: s.base, Description: s.help}
+			if s.kind == "counter" {
+				metric.Sum = &otlpSum{AggregationTemporality: 2, IsMonotonic: true} // cumulative
+			} else {
+				metric.Gauge = &otlpGauge{}
+			}
+			metrics = append(metrics, metric)
+		}
+		if metric.Sum != nil {
+			point.Start = strconv.FormatInt(t.started.UnixNano(), 10)
+			metric.Sum.DataPoints = append(metric.Sum.DataPoints, point)
+		} else {
+			metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, point)
+		}
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+	return t.post("/v1/metrics", map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource": t.resource(),
+			"scopeMetrics": []any{map[string]any{
+				"scope":   map[string]string{"name": "github.com/piotrostr/moon"},
+				"metrics": metrics,
+			}},
+		}},
+	})
+}
+
+func (t *Tracer) post(path string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Post(t.endpoint+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp export failed: %s", resp.Status)
+	}
+	return nil
+}
+
+func registerTracerMetrics(metrics *Metrics, tracer *Tracer) {
+	if tracer == nil {
+		return
+	}
+	metrics.Counter("moon_trace_spans_dropped_total", "Spans dropped because the export queue was full.",
+		func() float64 { return float64(tracer.dropped.Load()) })
+}
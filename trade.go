@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+)
+
+const lamportsPerSOL = 1_000_000_000
+
+// solToLamports converts an amount of SOL given by a user, refusing ones
+// that are negative or too large for a uint64 of lamports.
+func solToLamports(sol float64) (uint64, error) {
+	lamports := sol * lamportsPerSOL
+	if !(lamports >= 0 && lamports < math.MaxUint64) {
+		return 0, fmt.Errorf("invalid SOL amount %g", sol)
+	}
+	return uint64(lamports), nil
+}
+
+// runTrade implements `moon trade buy|sell`, a one-off live swap using the
+// executor section of the config file.
+func runTrade(args []string) error {
+	if len(args) == 0 || (args[0] != "buy" && args[0] != "sell") {
+		return errors.New("usage: moon trade buy|sell -pair <address> [flags]")
+	}
+	side := Buy
+	if args[0] == "sell" {
+		side = Sell
+	}
+
+	fs := flag.NewFlagSet("trade "+args[0], flag.ExitOnError)
+	configPath := fs.String("config", "moon.json", "config file with an executor section")
+	pair := fs.String("pair", "", "base58 pair address")
+	sol := fs.Float64("sol", 0, "SOL to spend (buy)")
+	amount := fs.Uint64("amount", 0, "token base units to sell (sell)")
+	fs.Parse(args[1:])
+
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if config.Executor == nil {
+		return fmt.Errorf("%s has no executor section", *configPath)
+	}
+	if _, err := decodeAddress(*pair); err != nil {
+		return fmt.Errorf("invalid pair address: %v", err)
+	}
+
+	order := Order{PairAddress: *pair, Side: side, Amount: *amount, Reason: "manual"}
+	if side == Buy {
+		if order.Amount, err = solToLamports(*sol); err != nil {
+			return err
+		}
+	}
+	if order.Amount == 0 {
+		return errors.New("order amount must be positive")
+	}
+
+	bus := NewEventBus()
+	bus.Subscribe(printEvent)
+
+	executor, err := NewLiveExecutor(*config.Executor, bus)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	_, err = executor.Execute(ctx, order)
+	return err
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/piotrostr/moon/base58"
+)
+
+// TradingConfig enables position management in the stream process.
+type TradingConfig struct {
+	// Mode is paper (default) or live; live uses the executor section.
+	Mode string `json:"mode"`
+	// Exits apply to positions opened without their own exit rules.
+	Exits []ExitRule `json:"exits"`
+	// Sizing decides the size of positions opened by buy signals.
+	Sizing SizingConfig `json:"sizing"`
+	Risk   RiskConfig   `json:"risk"`
+	// StateFile persists positions and halts across restarts.
+	StateFile string `json:"stateFile,omitempty"`
+	// Journal records every closed trade as JSON lines.
+	Journal string `json:"journal,omitempty"`
+}
+
+func (c TradingConfig) Validate() error {
+	switch c.Mode {
+	case "", "paper", "live":
+	default:
+		return fmt.Errorf("unknown trading mode: %q", c.Mode)
+	}
+	for _, exit := range c.Exits {
+		if err := exit.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := c.Risk.Validate(); err != nil {
+		return err
+	}
+	return c.Sizing.Validate()
+}
+
+// Trader opens positions through an executor and closes them when one of
+// their exit rules triggers on the live stream.
+type Trader struct {
+	executor Executor
+	mode     string
+	exits    []ExitRule
+	sizer    *Sizer
+	risk     RiskConfig
+	costs    *CostModel
+	store    *PairStore
+	bus      *EventBus
+
+	stateFile string
+	saveMu    sync.Mutex
+	journal   *TradeJournal
+	// swaps counts entries and exits in flight, which Close waits for
+	swaps sync.WaitGroup
+
+	mu        sync.Mutex
+	state     *traderState
+	positions map[int]*Position
+}
+
+func NewTrader(config TradingConfig, executor Executor, costs *CostModel, store *PairStore, bus *EventBus) (*Trader, error) {
+	mode := config.Mode
+	if mode == "" {
+		mode = "paper"
+	}
+
+	state, err := loadTraderState(config.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Trader{
+		executor:  executor,
+		mode:      mode,
+		exits:     config.Exits,
+		sizer:     NewSizer(config.Sizing),
+		risk:      config.Risk,
+		costs:     costs,
+		store:     store,
+		bus:       bus,
+		stateFile: config.StateFile,
+		state:     state,
+		positions: make(map[int]*Position),
+	}
+	if config.Journal != "" {
+		if t.journal, err = OpenTradeJournal(config.Journal); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range state.Positions {
+		position := state.Positions[i]
+		switch position.Status {
+		case PositionOpening:
+			// the entry may have landed before shutdown; see Reconcile
+		case PositionClosing:
+			position.Status = PositionOpen
+		}
+		t.positions[position.ID] = &position
+	}
+	return t, nil
+}
+
+// Reconcile settles, in the background, positions whose entry was in
+// flight when moon last stopped: with the tokens in the wallet they are
+// opened, at the price seen when the entry was placed, and otherwise
+// dropped. Paper entries never landed anywhere and are dropped. Call it
+// once subscribers are in place, so the alerts it raises are delivered.
+func (t *Trader) Reconcile() {
+	t.mu.Lock()
+	var opening []int
+	for id, position := range t.positions {
+		if position.Status == PositionOpening {
+			opening = append(opening, id)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, id := range opening {
+		t.swaps.Add(1)
+		go t.reconcile(id)
+	}
+}
+
+func (t *Trader) reconcile(id int) {
+	defer t.swaps.Done()
+	t.mu.Lock()
+	position := t.positions[id]
+	pairAddress := position.PairAddress
+	t.mu.Unlock()
+
+	balances, ok := t.executor.(TokenBalancer)
+	if !ok {
+		t.mu.Lock()
+		delete(t.positions, id)
+		t.mu.Unlock()
+		t.persist()
+		color.Yellow("Dropped position #%d in %s: its paper entry did not finish before shutdown", id, position.TokenSymbol)
+		return
+	}
+
+	var balance uint64
+	var err error
+	delay := fillRetryDelay
+	for attempt := 1; attempt <= fillAttempts; attempt++ {
+		if balance, err = balances.TokenBalance(context.Background(), pairAddress); err == nil {
+			break
+		}
+		if attempt < fillAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	if err != nil {
+		// kept as opening, so it still counts towards exposure
+		t.alert("entry_unknown", position, fmt.Sprintf("Entry into %s may have landed before shutdown and the wallet could not be checked: %v", position.TokenSymbol, err))
+		return
+	}
+
+	t.mu.Lock()
+	var held uint64
+	for _, other := range t.positions {
+		if other.ID != id && other.PairAddress == pairAddress && other.Status != PositionClosed {
+			held += other.Tokens
+		}
+	}
+	if balance <= held {
+		delete(t.positions, id)
+		t.mu.Unlock()
+		t.persist()
+		color.Yellow("Dropped position #%d in %s: its entry did not land before shutdown", id, position.TokenSymbol)
+		return
+	}
+	price := position.EntryContext.Price
+	position.Status = PositionOpen
+	position.CostLamports = position.RequestedLamports
+	position.Tokens = balance - held
+	position.EntryPrice = price
+	position.PeakPrice = price
+	position.LastPrice = price
+	position.EntryAt = time.Now()
+	position.LastPriceAt = position.EntryAt
+	opened := *position
+	t.mu.Unlock()
+	t.persist()
+
+	t.bus.Publish(&PositionOpenedEvent{Position: opened})
+	t.alert("entry_reconciled", position, fmt.Sprintf("Entry into %s landed before shutdown; opened with %d tokens at the order size", position.TokenSymbol, opened.Tokens))
+}
+
+// swapDrainTimeout bounds how long Close waits for swaps in flight; it
+// covers a confirmation timeout and the fill lookup after it.
+const swapDrainTimeout = 3 * time.Minute
+
+// Close waits for swaps in flight, so their fills reach the state file and
+// the journal, then closes the journal.
+func (t *Trader) Close() error {
+	done := make(chan struct{})
+	go func() {
+		t.swaps.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(swapDrainTimeout):
+		color.Red("Swaps still in flight after %s; check open positions on chain", swapDrainTimeout)
+	}
+	t.persist()
+	if t.journal == nil {
+		return nil
+	}
+	return t.journal.Close()
+}
+
+// persist saves the current state if a state file is configured.
+func (t *Trader) persist() {
+	if t.stateFile == "" {
+		return
+	}
+
+	t.saveMu.Lock()
+	defer t.saveMu.Unlock()
+
+	t.mu.Lock()
+	state := *t.state
+	state.Positions = make([]Position, 0, len(t.positions))
+	for _, position := range t.positions {
+		state.Positions = append(state.Positions, *position)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(state.Positions, func(i, j int) bool { return state.Positions[i].ID < state.Positions[j].ID })
+	if err := saveTraderState(t.stateFile, &state); err != nil {
+		color.Red("Error saving trading state: %v", err)
+	}
+}
+
+// Open buys lamports worth of the pair in the background and returns the
+// position in its opening state.
+func (t *Trader) Open(pairAddress string, lamports uint64, exits []ExitRule, reason string) (Position, error) {
+	addr, err := decodeAddress(pairAddress)
+	if err != nil {
+		return Position{}, fmt.Errorf("invalid pair address: %v", err)
+	}
+	tracked, ok := t.store.Get(addr)
+	if !ok {
+		return Position{}, fmt.Errorf("pair %s is not tracked", pairAddress)
+	}
+	if lamports == 0 {
+		return Position{}, errors.New("position size must be positive")
+	}
+	if maxSOL := t.sizer.config.MaxSOL; maxSOL > 0 && float64(lamports)/lamportsPerSOL > maxSOL {
+		return Position{}, fmt.Errorf("position size %g SOL exceeds the max of %g SOL", float64(lamports)/lamportsPerSOL, maxSOL)
+	}
+	if len(exits) == 0 {
+		exits = t.exits
+	}
+	for _, exit := range exits {
+		if err := exit.Validate(); err != nil {
+			return Position{}, err
+		}
+	}
+
+	t.mu.Lock()
+	if err := t.checkRisk(lamports, time.Now()); err != nil {
+		t.mu.Unlock()
+		return Position{}, err
+	}
+	t.state.NextID++
+	position := &Position{
+		ID:                t.state.NextID,
+		PairAddress:       pairAddress,
+		TokenSymbol:       tracked.TokenSymbol,
+		Mode:              t.mode,
+		Status:            PositionOpening,
+		Reason:            reason,
+		RequestedLamports: lamports,
+		Exits:             exits,
+		EntryContext: MarketContext{
+			Price:   tracked.Price,
+			Volume:  tracked.Volume,
+			PairAge: time.Since(tracked.FirstSeen).Seconds(),
+			Block:   tracked.LastSeenBlock,
+		},
+	}
+	t.positions[position.ID] = position
+	opening := *position
+	t.mu.Unlock()
+	t.persist()
+
+	order := Order{
+		PairAddress: pairAddress,
+		Side:        Buy,
+		Amount:      lamports,
+		PairAge:     time.Since(tracked.FirstSeen),
+		Reason:      reason,
+	}
+	t.swaps.Add(1)
+	go t.enter(position.ID, order)
+
+	return opening, nil
+}
+
+// enter runs the entry swap. Swaps are not tied to the process context:
+// abandoning a confirmation on shutdown could leave a filled swap untracked.
+func (t *Trader) enter(id int, order Order) {
+	defer t.swaps.Done()
+	execution, err := t.executor.Execute(context.Background(), order)
+
+	t.mu.Lock()
+	position := t.positions[id]
+	if err != nil {
+		delete(t.positions, id)
+		t.mu.Unlock()
+		t.persist()
+		t.alert("entry_failed", position, fmt.Sprintf("Entry into %s failed: %v", position.TokenSymbol, err))
+		return
+	}
+
+	price := t.price(position.PairAddress)
+	position.Status = PositionOpen
+	position.CostLamports = execution.FilledIn
+	position.Tokens = execution.FilledOut
+	position.EntryPrice = price
+	position.PeakPrice = price
+	position.LastPrice = price
+	position.EntryAt = time.Now()
+	position.LastPriceAt = position.EntryAt
+	position.EntryFee = execution.Fee
+	position.EntrySlippage = slippage(execution)
+	opened := *position
+	t.mu.Unlock()
+	t.persist()
+
+	t.bus.Publish(&PositionOpenedEvent{Position: opened})
+}
+
+func (t *Trader) Observe(event Event) {
+	switch e := event.(type) {
+	case *PairUpdatedEvent:
+		t.mark(e)
+	case *BuySignalEvent:
+		t.signal(e)
+	}
+}
+
+// NextSize is what the next buy signal would be opened with.
+func (t *Trader) NextSize() uint64 {
+	t.mu.Lock()
+	var closed []Position
+	var committed float64
+	for _, position := range t.positions {
+		if position.Status == PositionClosed {
+			closed = append(closed, *position)
+		} else {
+			committed += float64(position.committedLamports()) / lamportsPerSOL
+		}
+	}
+	t.mu.Unlock()
+	return t.sizer.Size(closed, committed)
+}
+
+// signal sizes and opens a position unless the pair is already held.
+func (t *Trader) signal(e *BuySignalEvent) {
+	t.mu.Lock()
+	var closed []Position
+	var committed float64
+	for _, position := range t.positions {
+		if position.Status == PositionClosed {
+			closed = append(closed, *position)
+			continue
+		}
+		if position.PairAddress == e.PairAddress {
+			t.mu.Unlock()
+			return
+		}
+		committed += float64(position.committedLamports()) / lamportsPerSOL
+	}
+	t.mu.Unlock()
+
+	lamports := t.sizer.Size(closed, committed)
+	if lamports == 0 {
+		color.Yellow("Buy signal %s for %s skipped: sizing returned zero", e.Rule, e.TokenSymbol)
+		return
+	}
+	// positions may have changed since the signal was costed
+	if estimate, ok := t.costs.Estimate(lamports); ok {
+		if err := t.costs.Check(estimate); err != nil {
+			color.Yellow("Buy signal %s for %s skipped: %v", e.Rule, e.TokenSymbol, err)
+			return
+		}
+	}
+	if _, err := t.Open(e.PairAddress, lamports, nil, "rule:"+e.Rule); err != nil {
+		color.Red("Buy signal %s for %s: %v", e.Rule, e.TokenSymbol, err)
+	}
+}
+
+func (t *Trader) mark(e *PairUpdatedEvent) {
+	pairAddress := base58.Encode(e.Pair.PairAddress[:])
+	// an update that arrives late must not trigger stop-loss or take-profit
+	if priceStale(e.At, time.Now()) {
+		return
+	}
+
+	t.mu.Lock()
+	var exiting []*Position
+	var rules []ExitRule
+	for _, position := range t.positions {
+		if position.PairAddress != pairAddress || position.Status != PositionOpen {
+			continue
+		}
+		position.LastPrice = e.Pair.Price
+		position.LastPriceAt = e.At
+		position.PeakPrice = max(position.PeakPrice, e.Pair.Price)
+
+		for _, rule := range position.Exits {
+			if rule.Triggered(e.Pair.Price, position.EntryPrice, position.PeakPrice) {
+				position.Status = PositionClosing
+				exiting = append(exiting, position)
+				rules = append(rules, rule)
+				break
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	for i, position := range exiting {
+		t.alert(rules[i].Kind, position, fmt.Sprintf("%s triggered for %s at %g (entry %g)",
+			rules[i], position.TokenSymbol, e.Pair.Price, position.EntryPrice))
+		t.swaps.Add(1)
+		go t.exit(position.ID, rules[i])
+	}
+}
+
+func (t *Trader) exit(id int, rule ExitRule) {
+	defer t.swaps.Done()
+	t.mu.Lock()
+	position := t.positions[id]
+	order := Order{PairAddress: position.PairAddress, Side: Sell, Amount: position.Tokens, Reason: rule.String()}
+	t.mu.Unlock()
+
+	execution, err := t.executor.Execute(context.Background(), order)
+
+	t.mu.Lock()
+	if err != nil {
+		// reopen so the rule is evaluated again on the next update
+		position.Status = PositionOpen
+		t.mu.Unlock()
+		t.alert("exit_failed", position, fmt.Sprintf("Exit from %s failed: %v", position.TokenSymbol, err))
+		return
+	}
+
+	position.Status = PositionClosed
+	position.ExitRule = rule.String()
+	position.ExitPrice = position.LastPrice
+	position.ExitAt = time.Now()
+	position.ProceedsLamports = execution.FilledOut
+	position.ExitFee = execution.Fee
+	position.ExitSlippage = slippage(execution)
+	closed := *position
+	halt := t.checkDailyLoss(closed.ExitAt)
+	t.mu.Unlock()
+	t.persist()
+
+	if t.journal != nil {
+		if err := t.journal.Write(journalEntry(closed)); err != nil {
+			color.Red("Error writing trade journal: %v", err)
+		}
+	}
+	t.bus.Publish(&PositionClosedEvent{Position: closed, PnL: closed.PnL()})
+	if halt != "" {
+		t.alert("trading_halted", position, "Trading halted for the day: "+halt)
+	}
+}
+
+func (t *Trader) Positions() []Position {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	positions := make([]Position, 0, len(t.positions))
+	for _, position := range t.positions {
+		p := *position
+		p.Stale = p.Status != PositionClosed && priceStale(p.LastPriceAt, now)
+		positions = append(positions, p)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].ID < positions[j].ID })
+	return positions
+}
+
+// Closed returns journal entries for positions closed since the given time.
+func (t *Trader) Closed(since time.Time) []JournalEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var entries []JournalEntry
+	for _, position := range t.positions {
+		if position.Status == PositionClosed && !position.ExitAt.Before(since) {
+			entries = append(entries, journalEntry(*position))
+		}
+	}
+	return entries
+}
+
+func (t *Trader) price(pairAddress string) float64 {
+	addr, err := decodeAddress(pairAddress)
+	if err != nil {
+		return 0
+	}
+	tracked, _ := t.store.Get(addr)
+	return tracked.Price
+}
+
+func (t *Trader) alert(kind string, position *Position, message string) {
+	t.bus.Publish(&AlertEvent{
+		Kind:        kind,
+		PairAddress: position.PairAddress,
+		TokenSymbol: position.TokenSymbol,
+		Message:     message,
+		At:          time.Now(),
+	})
+}
+
+// HandlePositions serves GET /positions and POST /positions with
+// {"pair": "...", "sol": 0.1, "exits": [...]}.
+func (t *Trader) HandlePositions(r *http.Request) (any, error) {
+	if r.Method != http.MethodPost {
+		return t.Positions(), nil
+	}
+
+	var body struct {
+		Pair  string     `json:"pair"`
+		SOL   float64    `json:"sol"`
+		Exits []ExitRule `json:"exits"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid body: %v", err)
+	}
+	lamports, err := solToLamports(body.SOL)
+	if err != nil {
+		return nil, err
+	}
+	return t.Open(body.Pair, lamports, body.Exits, "api")
+}
+
+func printPositionEvent(event Event) {
+	switch e := event.(type) {
+	case *PositionOpenedEvent:
+		p := e.Position
+		color.Green("Position %d opened (%s): %s at %s, cost %d lamports", p.ID, p.Mode, p.TokenSymbol, formatPrice(p.EntryPrice), p.CostLamports)
+	case *PositionClosedEvent:
+		p := e.Position
+		color.Green("Position %d closed (%s): %s %s at %s, PnL %+.1f%%", p.ID, p.Mode, p.TokenSymbol, p.ExitRule, formatPrice(p.ExitPrice), e.PnL*100)
+	}
+}
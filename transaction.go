@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+
+	"github.com/piotrostr/moon/base58"
+)
+
+const computeBudgetProgram = "ComputeBudget111111111111111111111111111111"
+
+// compute budget instruction discriminators
+const (
+	setComputeUnitLimit = 2
+	setComputeUnitPrice = 3
+)
+
+func base64Encode(data []byte) string {
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// readCompactU16 decodes Solana's shortvec length prefix.
+func readCompactU16(data []byte) (int, int, error) {
+	var value, size int
+	for size < 3 {
+		if size >= len(data) {
+			return 0, 0, errors.New("truncated compact-u16")
+		}
+		b := data[size]
+		value |= int(b&0x7f) << (7 * size)
+		size++
+		if b&0x80 == 0 {
+			return value, size, nil
+		}
+	}
+	return 0, 0, errors.New("compact-u16 too long")
+}
+
+// signTransaction fills the first signature slot of a wire-format
+// transaction with the fee payer's signature over the message.
+func signTransaction(tx []byte, key ed25519.PrivateKey) error {
+	count, n, err := readCompactU16(tx)
+	if err != nil {
+		return err
+	}
+	if count < 1 {
+		return errors.New("transaction has no signature slots")
+	}
+	messageStart := n + count*ed25519.SignatureSize
+	if messageStart > len(tx) {
+		return errors.New("truncated transaction")
+	}
+
+	signature := ed25519.Sign(key, tx[messageStart:])
+	copy(tx[n:], signature)
+	return nil
+}
+
+// transactionMessage returns the message portion of a wire-format transaction.
+func transactionMessage(tx []byte) ([]byte, error) {
+	count, n, err := readCompactU16(tx)
+	if err != nil {
+		return nil, err
+	}
+	start := n + count*ed25519.SignatureSize
+	if start > len(tx) {
+		return nil, errors.New("truncated transaction")
+	}
+	return tx[start:], nil
+}
+
+// patchComputeBudget rewrites the compute unit limit and price of existing
+// ComputeBudget instructions in place. Zero leaves a value unchanged. It
+// reports whether a limit instruction was found.
+func patchComputeBudget(tx []byte, unitLimit uint32, unitPrice uint64) (bool, error) {
+	msg, err := transactionMessage(tx)
+	if err != nil {
+		return false, err
+	}
+
+	pos := 0
+	if len(msg) > 0 && msg[0]&0x80 != 0 {
+		pos++ // versioned message prefix
+	}
+	pos += 3 // header
+	if pos > len(msg) {
+		return false, errors.New("truncated message header")
+	}
+
+	keyCount, n, err := readCompactU16(msg[pos:])
+	if err != nil {
+		return false, err
+	}
+	pos += n
+	if pos+keyCount*32+32 > len(msg) {
+		return false, errors.New("truncated account keys")
+	}
+
+	budgetIndex := -1
+	for i := 0; i < keyCount; i++ {
+		if base58.Encode(msg[pos+i*32:pos+(i+1)*32]) == computeBudgetProgram {
+			budgetIndex = i
+		}
+	}
+	pos += keyCount*32 + 32 // keys and recent blockhash
+
+	ixCount, n, err := readCompactU16(msg[pos:])
+	if err != nil {
+		return false, err
+	}
+	pos += n
+
+	foundLimit := false
+	for i := 0; i < ixCount; i++ {
+		if pos >= len(msg) {
+			return false, errors.New("truncated instructions")
+		}
+		programIndex := int(msg[pos])
+		pos++
+
+		accounts, n, err := readCompactU16(msg[pos:])
+		if err != nil {
+			return false, err
+		}
+		pos += n
+		if pos+accounts > len(msg) {
+			return false, errors.New("truncated instruction accounts")
+		}
+		pos += accounts
+
+		dataLen, n, err := readCompactU16(msg[pos:])
+		if err != nil {
+			return false, err
+		}
+		pos += n
+		if pos+dataLen > len(msg) {
+			return false, errors.New("truncated instruction data")
+		}
+		data := msg[pos : pos+dataLen]
+		pos += dataLen
+
+		if programIndex != budgetIndex || len(data) == 0 {
+			continue
+		}
+		switch {
+		case data[0] == setComputeUnitLimit && len(data) == 5:
+			foundLimit = true
+			if unitLimit > 0 {
+				binary.LittleEndian.PutUint32(data[1:], unitLimit)
+			}
+		case data[0] == setComputeUnitPrice && len(data) == 9:
+			if unitPrice > 0 {
+				binary.LittleEndian.PutUint64(data[1:], unitPrice)
+			}
+		}
+	}
+
+	return foundLimit, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// udfResolutions maps TradingView resolution strings to candle sizes.
+var udfResolutions = map[string]time.Duration{
+	"1":   time.Minute,
+	"5":   5 * time.Minute,
+	"15":  15 * time.Minute,
+	"60":  time.Hour,
+	"240": 4 * time.Hour,
+	"1D":  24 * time.Hour,
+}
+
+// RegisterUDF mounts a TradingView UDF datafeed under /udf and a
+// lightweight-charts friendly CSV export at /candles.csv. Symbols are
+// pair addresses, in base58 or with -hex-addresses in hex.
+func RegisterUDF(server *Server, candles *CandleStore) {
+	server.HandleJSON("/udf/config", func(r *http.Request) (any, error) {
+		return map[string]any{
+			"supported_resolutions":    []string{"1", "5", "15", "60", "240", "1D"},
+			"supports_search":          true,
+			"supports_group_request":   false,
+			"supports_marks":           false,
+			"supports_timescale_marks": false,
+			"supports_time":            true,
+		}, nil
+	})
+
+	server.HandleJSON("/udf/time", func(r *http.Request) (any, error) {
+		return time.Now().Unix(), nil
+	})
+
+	server.HandleJSON("/udf/symbols", func(r *http.Request) (any, error) {
+		symbol := r.URL.Query().Get("symbol")
+		addr, err := decodeAddress(symbol)
+		if err != nil {
+			return nil, fmt.Errorf("invalid symbol: %v", err)
+		}
+		return map[string]any{
+			"name":                  symbol,
+			"ticker":                symbol,
+			"description":           candles.Symbols()[addr],
+			"type":                  "crypto",
+			"session":               "24x7",
+			"timezone":              "Etc/UTC",
+			"exchange":              "moonshot",
+			"minmov":                1,
+			"pricescale":            int64(1_000_000_000_000),
+			"has_intraday":          true,
+			"supported_resolutions": []string{"1", "5", "15", "60", "240", "1D"},
+			"volume_precision":      2,
+			"data_status":           "streaming",
+		}, nil
+	})
+
+	server.HandleJSON("/udf/search", func(r *http.Request) (any, error) {
+		query := strings.ToLower(r.URL.Query().Get("query"))
+		var results []map[string]string
+		for addr, symbol := range candles.Symbols() {
+			if query != "" && !strings.Contains(strings.ToLower(symbol), query) {
+				continue
+			}
+			address := formatAddress(addr)
+			results = append(results, map[string]string{
+				"symbol":      address,
+				"full_name":   address,
+				"description": symbol,
+				"exchange":    "moonshot",
+				"type":        "crypto",
+			})
+		}
+		return results, nil
+	})
+
+	server.HandleJSON("/udf/history", func(r *http.Request) (any, error) {
+		addr, resolution, from, to, err := parseCandleQuery(r, candles.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		bars := candles.Range(addr, resolution, from, to)
+		if len(bars) == 0 {
+			return map[string]string{"s": "no_data"}, nil
+		}
+
+		history := struct {
+			S string    `json:"s"`
+			T []int64   `json:"t"`
+			O []float64 `json:"o"`
+			H []float64 `json:"h"`
+			L []float64 `json:"l"`
+			C []float64 `json:"c"`
+			V []float64 `json:"v"`
+		}{S: "ok"}
+		for _, c := range bars {
+			history.T = append(history.T, c.Time.Unix())
+			history.O = append(history.O, c.Open)
+			history.H = append(history.H, c.High)
+			history.L = append(history.L, c.Low)
+			history.C = append(history.C, c.Close)
+			history.V = append(history.V, c.Volume)
+		}
+		return history, nil
+	})
+
+	server.Handle("/candles.csv", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, resolution, from, to, err := parseCandleQuery(r, candles.Now())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"time", "open", "high", "low", "close", "volume"})
+		for _, c := range candles.Range(addr, resolution, from, to) {
+			writer.Write([]string{
+				strconv.FormatInt(c.Time.Unix(), 10),
+				strconv.FormatFloat(c.Open, 'g', -1, 64),
+				strconv.FormatFloat(c.High, 'g', -1, 64),
+				strconv.FormatFloat(c.Low, 'g', -1, 64),
+				strconv.FormatFloat(c.Close, 'g', -1, 64),
+				strconv.FormatFloat(c.Volume, 'g', -1, 64),
+			})
+		}
+		writer.Flush()
+	}))
+}
+
+// parseCandleQuery reads symbol, resolution, from and to (unix seconds).
+// Missing bounds default to the whole retained range.
+func parseCandleQuery(r *http.Request, now time.Time) ([32]byte, time.Duration, time.Time, time.Time, error) {
+	query := r.URL.Query()
+
+	addr, err := decodeAddress(query.Get("symbol"))
+	if err != nil {
+		return addr, 0, time.Time{}, time.Time{}, fmt.Errorf("invalid symbol: %v", err)
+	}
+
+	resolution := time.Minute
+	if v := query.Get("resolution"); v != "" {
+		d, ok := udfResolutions[v]
+		if !ok {
+			return addr, 0, time.Time{}, time.Time{}, fmt.Errorf("unsupported resolution: %q", v)
+		}
+		resolution = d
+	}
+
+	from := time.Unix(0, 0)
+	to := now.Add(candleInterval)
+	if v := query.Get("from"); v != "" {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return addr, 0, time.Time{}, time.Time{}, fmt.Errorf("invalid from: %q", v)
+		}
+		from = time.Unix(sec, 0)
+	}
+	if v := query.Get("to"); v != "" {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return addr, 0, time.Time{}, time.Time{}, fmt.Errorf("invalid to: %q", v)
+		}
+		to = time.Unix(sec, 0)
+	}
+
+	return addr, resolution, from, to, nil
+}
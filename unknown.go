@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fatih/color"
+	"github.com/piotrostr/moon/protocol"
+)
+
+// ByteStats describes one offset of UnknownData across pairs.
+type ByteStats struct {
+	Offset   int
+	Distinct int
+	Mode     byte
+	ModeFreq float64
+	Entropy  float64
+}
+
+// WordStats interprets the bytes at Offset as a little-endian number.
+type WordStats struct {
+	Offset int
+	Kind   string // u32, f32 or f64
+	// Plausible is the share of samples that are finite and within a range
+	// a real quantity would take.
+	Plausible float64
+	Min       float64
+	Median    float64
+	Max       float64
+	// PriceRatio and PriceRatioCV are the median and coefficient of
+	// variation of value/price; a stable ratio suggests a derived field.
+	PriceRatio   float64
+	PriceRatioCV float64
+}
+
+type unknownSample struct {
+	data    [32]byte
+	price   float64
+	onCurve bool
+}
+
+// runUnknown implements `moon unknown`, summarizing the undecoded 32 bytes
+// of every pair in a recording to guide reverse engineering.
+func runUnknown(args []string) error {
+	fs := flag.NewFlagSet("unknown", flag.ExitOnError)
+	path := fs.String("frames", "frames.bin", "recorded frames: length-prefixed (-record) or a raw capture .jsonl")
+	fs.Parse(args)
+
+	samples, err := collectUnknown(*path)
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return errors.New("no pairs found in recording")
+	}
+
+	var onCurve int
+	for _, s := range samples {
+		if s.onCurve {
+			onCurve++
+		}
+	}
+	// random bytes land on the curve half the time; PDAs never do
+	color.Blue("UnknownData across %d pairs (%.1f%% of pair addresses on the ed25519 curve)",
+		len(samples), float64(onCurve)/float64(len(samples))*100)
+	color.Blue("%6s %8s %6s %7s %8s", "offset", "distinct", "mode", "mode%", "entropy")
+	for _, s := range unknownByteStats(samples) {
+		printRow := color.White
+		switch {
+		case s.Distinct == 1:
+			printRow = color.Cyan
+		case s.Entropy > 7:
+			printRow = color.Magenta
+		}
+		printRow("%6d %8d %6s %6.1f%% %8.2f", s.Offset, s.Distinct, fmt.Sprintf("%02x", s.Mode), s.ModeFreq*100, s.Entropy)
+	}
+
+	color.Blue("%6s %4s %10s %12s %12s %12s %12s %8s", "offset", "kind", "plausible", "min", "median", "max", "/price", "cv")
+	for _, w := range unknownWordStats(samples) {
+		printRow := color.White
+		if w.Plausible > 0.95 {
+			printRow = color.Green
+		}
+		printRow("%6d %4s %9.1f%% %12.4g %12.4g %12.4g %12.4g %8.3f", w.Offset, w.Kind, w.Plausible*100,
+			w.Min, w.Median, w.Max, w.PriceRatio, w.PriceRatioCV)
+	}
+	return nil
+}
+
+// collectUnknown keeps the latest UnknownData of each pair in the recording.
+func collectUnknown(path string) ([]unknownSample, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder := protocol.NewDecoder(bufio.NewReader(file))
+	if filepath.Ext(path) == ".jsonl" {
+		decoder = protocol.NewFrameDecoder(captureFrames{bufio.NewReader(file)})
+	}
+
+	latest := make(map[[32]byte]unknownSample)
+	for {
+		msg, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// read errors end the recording, parse errors skip a frame
+			if decoder.Frame() == nil {
+				return nil, err
+			}
+			continue
+		}
+		if pairs, ok := msg.(*protocol.PairsMessage); ok {
+			for _, pair := range pairs.Pairs {
+				latest[pair.PairAddress] = unknownSample{
+					data:    pair.UnknownData,
+					price:   pair.Price,
+					onCurve: protocol.OnCurve(pair.PairAddress),
+				}
+			}
+		}
+	}
+
+	samples := make([]unknownSample, 0, len(latest))
+	for _, s := range latest {
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+// captureFrames reads the JSON lines written by the parse error monitor.
+type captureFrames struct {
+	r *bufio.Reader
+}
+
+func (c captureFrames) ReadFrame() ([]byte, error) {
+	line, err := c.r.ReadBytes('\n')
+	if len(line) == 0 && err != nil {
+		return nil, err
+	}
+	var captured CapturedFrame
+	if err := json.Unmarshal(line, &captured); err != nil {
+		return nil, err
+	}
+	return captured.Data, nil
+}
+
+func unknownByteStats(samples []unknownSample) []ByteStats {
+	stats := make([]ByteStats, 32)
+	for offset := range stats {
+		var counts [256]int
+		for _, s := range samples {
+			counts[s.data[offset]]++
+		}
+
+		st := ByteStats{Offset: offset}
+		n := float64(len(samples))
+		for value, count := range counts {
+			if count == 0 {
+				continue
+			}
+			st.Distinct++
+			if float64(count)/n > st.ModeFreq {
+				st.Mode, st.ModeFreq = byte(value), float64(count)/n
+			}
+			p := float64(count) / n
+			st.Entropy -= p * math.Log2(p)
+		}
+		stats[offset] = st
+	}
+	return stats
+}
+
+func unknownWordStats(samples []unknownSample) []WordStats {
+	var stats []WordStats
+	for offset := 0; offset < 32; offset += 4 {
+		stats = append(stats, wordStats(samples, offset, "u32", func(b []byte) float64 {
+			return float64(binary.LittleEndian.Uint32(b))
+		}))
+		stats = append(stats, wordStats(samples, offset, "f32", func(b []byte) float64 {
+			return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		}))
+		if offset%8 == 0 {
+			stats = append(stats, wordStats(samples, offset, "f64", func(b []byte) float64 {
+				return math.Float64frombits(binary.LittleEndian.Uint64(b))
+			}))
+		}
+	}
+	return stats
+}
+
+func wordStats(samples []unknownSample, offset int, kind string, read func([]byte) float64) WordStats {
+	w := WordStats{Offset: offset, Kind: kind}
+	var values, ratios []float64
+	for _, s := range samples {
+		v := read(s.data[offset:])
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		values = append(values, v)
+		if plausibleQuantity(kind, v) {
+			w.Plausible++
+		}
+		if s.price > 0 {
+			ratios = append(ratios, v/s.price)
+		}
+	}
+	w.Plausible /= float64(len(samples))
+	if len(values) == 0 {
+		return w
+	}
+
+	sort.Float64s(values)
+	w.Min, w.Median, w.Max = values[0], median(values), values[len(values)-1]
+	if len(ratios) > 0 {
+		w.PriceRatio = median(ratios)
+		var mean, variance float64
+		for _, r := range ratios {
+			mean += r
+		}
+		mean /= float64(len(ratios))
+		for _, r := range ratios {
+			variance += (r - mean) * (r - mean)
+		}
+		if mean != 0 {
+			w.PriceRatioCV = math.Sqrt(variance/float64(len(ratios))) / math.Abs(mean)
+		}
+	}
+	return w
+}
+
+// plausibleQuantity rejects values that are almost certainly bytes of
+// something else reinterpreted: denormals, huge exponents, zero.
+func plausibleQuantity(kind string, v float64) bool {
+	if kind == "u32" {
+		return v > 0 && v < 1<<31
+	}
+	a := math.Abs(v)
+	return a > 1e-12 && a < 1e15
+}
@@ -3,18 +3,21 @@ package main
 import (
 	"encoding/hex"
 	"fmt"
+	"os"
 
 	"github.com/fatih/color"
 )
 
-func min(a, b int) int {
-	if a < b {
-		return a
+func logMessageInfo(msgType MessageType, msgSize int, message []byte) {
+	if verbosity.Load() < verbosityDebug {
+		return
+	}
+	dump := hex.EncodeToString(message[:min(20, len(message))])
+	if color.NoColor {
+		fmt.Fprintf(console, "Message type=0x%02x size=%d first20=%s\n", msgType, msgSize, dump)
+		return
 	}
-	return b
-}
 
-func logMessageInfo(msgType MessageType, msgSize int, message []byte) {
 	switch msgType {
 	case LatestBlockHashMessageType:
 		color.Cyan("Message type: LatestBlockHash (0x%02x), Size: %d bytes", msgType, msgSize)
@@ -26,28 +29,46 @@ func logMessageInfo(msgType MessageType, msgSize int, message []byte) {
 		color.Red("Unknown message type: 0x%02x, Size: %d bytes", msgType, msgSize)
 	}
 
-	fmt.Printf("First 20 bytes: %s\n", hex.EncodeToString(message[:min(20, len(message))]))
+	fmt.Fprintf(console, "First 20 bytes: %s\n", dump)
+}
+
+// logStream prints a stream's progress messages at normal verbosity.
+func logStream(format string, args ...any) {
+	if verbosity.Load() < verbosityNormal {
+		return
+	}
+	fmt.Fprintf(console, format+"\n", args...)
 }
 
 func printLatestBlockHashMessage(msg *LatestBlockHashMessage) {
+	if verbosity.Load() < verbosityNormal {
+		return
+	}
 	color.Cyan("Received latest block hash: Version=%s, Endpoint=%s, LatestBlock=%d, Hash=%s",
-		msg.Version, msg.Endpoint, msg.LatestBlock, hex.EncodeToString(msg.Hash[:]))
+		msg.Version, msg.Endpoint, msg.LatestBlock, formatAddress(msg.Hash))
 }
 
 func printPairsMessage(msg *PairsMessage) {
-	color.Green("Received pairs message: Version=%s, Number of pairs=%d", msg.Version, len(msg.Pairs))
-
-	for i, pair := range msg.Pairs[:min(5, len(msg.Pairs))] {
-		color.Green("Pair %d:", i)
-		color.Green("  PairAddress: %s", hex.EncodeToString(pair.PairAddress[:]))
-		color.Green("  TokenName: %s", pair.TokenName)
-		color.Green("  TokenSymbol: %s", pair.TokenSymbol)
-		color.Green("  BaseTokenSymbol: %s", pair.BaseTokenSymbol)
-		color.Green("  Price: %f", pair.Price)
-		color.Green("  Volume: %f", pair.Volume)
+	if verbosity.Load() < verbosityNormal {
+		return
 	}
+	color.Green("Received pairs message: Version=%s, Number of pairs=%d", msg.Version, len(msg.Pairs))
+	printPairs(msg.Pairs)
 }
 
 func printPingMessage(msg *PingMessage) {
+	if verbosity.Load() < verbosityNormal {
+		return
+	}
 	color.Yellow("Received ping message: %s", msg.Content)
 }
+
+// writeFileAtomic writes via a temporary file and rename so a crash never
+// leaves a torn file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+
+	"github.com/fatih/color"
+	"github.com/piotrostr/moon/protocol"
+)
+
+var heuristics = []string{
+	protocol.HeuristicStringBoundary,
+	protocol.HeuristicTrailingHash,
+	protocol.HeuristicTrailingBytes,
+	protocol.HeuristicAddress,
+}
+
+// DecodeWarnings counts decoder heuristics that fired on ambiguous data.
+// In strict mode a frame with any warning is rejected instead of handled.
+type DecodeWarnings struct {
+	strict bool
+	counts map[string]*atomic.Int64
+}
+
+func NewDecodeWarnings(strict bool) *DecodeWarnings {
+	d := &DecodeWarnings{strict: strict, counts: make(map[string]*atomic.Int64)}
+	for _, h := range heuristics {
+		d.counts[h] = new(atomic.Int64)
+	}
+	return d
+}
+
+// Check records the warnings of one frame, returning an error for them in
+// strict mode.
+func (d *DecodeWarnings) Check(warnings []protocol.Warning) error {
+	if d == nil || len(warnings) == 0 {
+		return nil
+	}
+	for _, w := range warnings {
+		d.counts[w.Heuristic].Add(1)
+		if d.strict || verbosity.Load() >= verbosityVerbose {
+			color.Yellow("Decode warning: %s", w)
+		}
+	}
+	if d.strict {
+		return fmt.Errorf("strict: rejecting frame with %d decode warnings", len(warnings))
+	}
+	return nil
+}
+
+func registerDecodeWarningMetrics(metrics *Metrics, d *DecodeWarnings) {
+	for _, h := range heuristics {
+		count := d.counts[h]
+		metrics.Counter(fmt.Sprintf("moon_decode_warnings_total{heuristic=%q}", h), "Decoder heuristics that fired on ambiguous data.",
+			func() float64 { return float64(count.Load()) })
+	}
+}
+
+// runValidate implements `moon validate`, decoding a recording with every
+// heuristic check on and reporting where the decoder had to guess.
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	path := fs.String("frames", "frames.bin", "recorded frames: length-prefixed (-record) or a raw capture .jsonl")
+	examples := fs.Int("examples", 3, "example warnings to print per field")
+	strict := fs.Bool("strict", false, "exit non-zero if any warning fires")
+	fs.Parse(args)
+
+	file, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := protocol.NewDecoder(bufio.NewReader(file))
+	if filepath.Ext(*path) == ".jsonl" {
+		decoder = protocol.NewFrameDecoder(captureFrames{bufio.NewReader(file)})
+	}
+
+	type key struct{ field, heuristic string }
+	counts := make(map[key]int)
+	samples := make(map[key][]protocol.Warning)
+	var frames, failed, warned int
+	for {
+		_, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && decoder.Frame() == nil {
+			return err
+		}
+		frames++
+		if err != nil {
+			failed++
+			continue
+		}
+
+		_, warnings, _ := protocol.Inspect(decoder.Frame())
+		if len(warnings) > 0 {
+			warned++
+		}
+		for _, w := range warnings {
+			k := key{w.Field, w.Heuristic}
+			counts[k]++
+			if len(samples[k]) < *examples {
+				samples[k] = append(samples[k], w)
+			}
+		}
+	}
+
+	color.Blue("%-36s %-10s %s", "field", "confidence", "basis")
+	for _, f := range protocol.Fields {
+		printRow := color.White
+		if f.Confidence == protocol.Guessed {
+			printRow = color.Yellow
+		}
+		printRow("%-36s %-10s %s", f.Name, f.Confidence, f.Basis)
+	}
+	fmt.Fprintln(console)
+
+	color.Blue("%d frames, %d failed to parse, %d decoded with warnings", frames, failed, warned)
+	keys := make([]key, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return counts[keys[i]] > counts[keys[j]] })
+	for _, k := range keys {
+		color.Yellow("%6d %s (%s)", counts[k], k.field, k.heuristic)
+		for _, w := range samples[k] {
+			fmt.Fprintf(console, "       %s\n", w)
+		}
+	}
+
+	if *strict && (warned > 0 || failed > 0) {
+		return fmt.Errorf("validate: %d frames with warnings, %d failed", warned, failed)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync/atomic"
+)
+
+// Console verbosity levels. Events and errors are always printed.
+const (
+	verbosityQuiet   = -1 // events and errors only
+	verbosityNormal  = 0  // one line per message
+	verbosityVerbose = 1  // plus decoded pairs, see -pairs-top
+	verbosityDebug   = 2  // plus message headers and hex dumps
+)
+
+// verbosity is atomic so the admin API can change it while running.
+var verbosity atomic.Int32
+
+var verbosityNames = []string{"quiet", "normal", "verbose", "debug"}
+
+// verbosityFlags registers -q, -v and -vv on fs; call the returned func
+// after parsing to apply them.
+func verbosityFlags(fs *flag.FlagSet) func() {
+	quiet := fs.Bool("q", false, "print only events and errors")
+	verbose := fs.Bool("v", false, "also print decoded pairs")
+	debug := fs.Bool("vv", false, "also print message headers and hex dumps")
+	return func() {
+		switch {
+		case *debug:
+			verbosity.Store(verbosityDebug)
+		case *verbose:
+			verbosity.Store(verbosityVerbose)
+		case *quiet:
+			verbosity.Store(verbosityQuiet)
+		}
+	}
+}
+
+func verbosityName() string {
+	return verbosityNames[verbosity.Load()-verbosityQuiet]
+}
+
+// setVerbosity sets the level by name: quiet, normal, verbose or debug.
+func setVerbosity(name string) error {
+	for i, n := range verbosityNames {
+		if n == name {
+			verbosity.Store(int32(i + verbosityQuiet))
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log level %q, have quiet, normal, verbose and debug", name)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// WarmUp covers the first moments of each connection, whose first Pairs
+// messages are the page of pairs that already existed. While a
+// connection warms up, discoveries from its frames are marked
+// pre-existing and the alerts and buy signals they trigger are dropped.
+// It ends after Window or after Messages Pairs messages on that
+// connection, whichever comes first; with neither set it is disabled.
+//
+// Stream events are published synchronously while the handler handles a
+// frame, so the connection being handled is the one they came from.
+// Events published outside a frame, like REST backfills, are not part of
+// any warm-up.
+type WarmUp struct {
+	window   time.Duration
+	messages int
+
+	mu      sync.Mutex
+	conns   map[int]*connWarmUp
+	current *connWarmUp
+}
+
+type connWarmUp struct {
+	active    bool
+	until     time.Time
+	remaining int
+}
+
+// NewWarmUp returns nil, a disabled warm-up, when window and messages are
+// both zero.
+func NewWarmUp(window time.Duration, messages int) *WarmUp {
+	if window <= 0 && messages <= 0 {
+		return nil
+	}
+	return &WarmUp{window: window, messages: messages, conns: make(map[int]*connWarmUp)}
+}
+
+// Handling marks the start of a frame from connection conn, starting its
+// warm-up over on the first frame after a (re)connect.
+func (w *WarmUp) Handling(conn int, first bool, now time.Time) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	c, ok := w.conns[conn]
+	if !ok {
+		c = &connWarmUp{}
+		w.conns[conn] = c
+	}
+	if first {
+		c.active = true
+		c.until = now.Add(w.window)
+		c.remaining = w.messages
+	}
+	w.current = c
+}
+
+// Handled marks the end of the frame passed to Handling.
+func (w *WarmUp) Handled() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.current = nil
+}
+
+// Pairs counts a Pairs message handled on the current connection.
+func (w *WarmUp) Pairs() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	c := w.current
+	if c == nil {
+		return
+	}
+	if c.remaining--; w.messages > 0 && c.remaining <= 0 {
+		c.active = false
+	}
+}
+
+// Active reports whether the connection of the frame being handled is
+// still warming up at now.
+func (w *WarmUp) Active(now time.Time) bool {
+	if w == nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	c := w.current
+	if c == nil {
+		return false
+	}
+	if c.active && w.window > 0 && !now.Before(c.until) {
+		c.active = false
+	}
+	return c.active
+}
+
+// Filter is an EventBus filter.
+func (w *WarmUp) Filter(event Event) bool {
+	switch e := event.(type) {
+	case *PairTransitionEvent:
+		if e.To == StateDiscovered && w.Active(e.At) {
+			e.Preexisting = true
+		}
+	case *AlertEvent:
+		return !w.Active(e.At)
+	case *BuySignalEvent:
+		return !w.Active(e.At)
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+//go:build js && wasm
+
+// Command wasm exposes the protocol decoder to JavaScript as
+// globalThis.moonDecode(Uint8Array). Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o moon.wasm ./wasm
+//
+// and load it with moon.js next to Go's wasm_exec.js.
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/piotrostr/moon/base58"
+	"github.com/piotrostr/moon/protocol"
+)
+
+func main() {
+	js.Global().Set("moonDecode", js.FuncOf(decode))
+	select {}
+}
+
+// decode returns {type, ...fields} for a frame or {error} if it fails.
+func decode(this js.Value, args []js.Value) any {
+	if len(args) != 1 {
+		return map[string]any{"error": "moonDecode expects one Uint8Array"}
+	}
+	frame := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(frame, args[0])
+
+	msg, err := protocol.Parse(frame)
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+
+	switch m := msg.(type) {
+	case *protocol.LatestBlockHashMessage:
+		return map[string]any{
+			"type":        "latestBlockHash",
+			"version":     m.Version,
+			"endpoint":    m.Endpoint,
+			"latestBlock": int(m.LatestBlock),
+			"hash":        base58.Encode(m.Hash[:]),
+		}
+	case *protocol.PairsMessage:
+		pairs := make([]any, len(m.Pairs))
+		for i, pair := range m.Pairs {
+			pairs[i] = map[string]any{
+				"pairAddress":     pair.Address(),
+				"tokenName":       pair.TokenName,
+				"tokenSymbol":     pair.TokenSymbol,
+				"baseTokenSymbol": pair.BaseTokenSymbol,
+				"price":           pair.Price,
+				"volume":          pair.Volume,
+			}
+		}
+		return map[string]any{"type": "pairs", "version": m.Version, "pairs": pairs}
+	case *protocol.PingMessage:
+		return map[string]any{"type": "ping", "content": m.Content}
+	}
+	return map[string]any{"error": "unsupported message"}
+}
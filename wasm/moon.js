@@ -0,0 +1,21 @@
+// Loads moon.wasm and resolves to a decode(frame) function. Requires Go's
+// wasm_exec.js (from `go env GOROOT`/lib/wasm or misc/wasm) to be loaded
+// first so that globalThis.Go exists.
+//
+//   const decode = await loadMoon("moon.wasm");
+//   ws.binaryType = "arraybuffer";
+//   ws.onmessage = (e) => console.log(decode(new Uint8Array(e.data)));
+export async function loadMoon(url = "moon.wasm") {
+  const go = new globalThis.Go();
+  const response = await fetch(url);
+  const { instance } = await WebAssembly.instantiateStreaming(response, go.importObject);
+  go.run(instance);
+
+  return (frame) => {
+    const result = globalThis.moonDecode(frame);
+    if (result.error) {
+      throw new Error(result.error);
+    }
+    return result;
+  };
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// pairSet remembers the last capacity pair addresses, so memory stays
+// flat however long the watcher runs.
+type pairSet struct {
+	index map[[32]byte]struct{}
+	ring  [][32]byte
+	next  int
+}
+
+func newPairSet(capacity int) *pairSet {
+	return &pairSet{index: make(map[[32]byte]struct{}, capacity), ring: make([][32]byte, 0, capacity)}
+}
+
+// Add reports whether addr was not already in the set.
+func (s *pairSet) Add(addr [32]byte) bool {
+	if _, ok := s.index[addr]; ok {
+		return false
+	}
+	if len(s.ring) < cap(s.ring) {
+		s.ring = append(s.ring, addr)
+	} else {
+		delete(s.index, s.ring[s.next])
+		s.ring[s.next] = addr
+		s.next = (s.next + 1) % len(s.ring)
+	}
+	s.index[addr] = struct{}{}
+	return true
+}
+
+// runWatch implements `moon watch`, a watch-only alerter for small
+// machines. It decodes frames but keeps no pair store, candles, stats or
+// snapshots; the only state is the set of pairs already seen. Every new
+// pair is published as pair_discovered to the configured rules and sinks.
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file with sinks and rules")
+	capacity := fs.Int("capacity", 50_000, "pair addresses remembered to tell new pairs from known ones")
+	alertExisting := fs.Bool("alert-existing", false, "also report the pairs in the first snapshot after connecting")
+	memoryLimit := fs.Int("memory-limit", 0, "soft memory limit in MiB for the Go runtime (0 for none)")
+	followEndpoint := fs.Bool("follow-endpoint", false, "move to the endpoint the server advertises, if it is in the configured endpoint's domain")
+	fs.DurationVar(&priceStaleAfter, "stale-price", time.Minute, "age at which a pair's last price counts as stale in the API and is ignored by rules and exits (0 to disable)")
+	buildSubscription := subscriptionFlags(fs)
+	applyVerbosity := verbosityFlags(fs)
+	fs.Parse(args)
+	applyVerbosity()
+
+	if *memoryLimit > 0 {
+		debug.SetMemoryLimit(int64(*memoryLimit) << 20)
+	}
+
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	bus := NewEventBus()
+	localizer, err := config.Localizer(nil)
+	if err != nil {
+		return err
+	}
+	if localizer != nil {
+		bus.Filter(localizer.Filter)
+	}
+	sub, err := buildSubscription(config)
+	if err != nil {
+		return err
+	}
+
+	bus.Subscribe(printEvent)
+	clock := NewBlockClock()
+	origin := NewOrigin(sub)
+	for _, sinkConfig := range config.Sinks {
+		pipeline, err := NewPipeline(ctx, sinkConfig, origin, clock, nil)
+		if err != nil {
+			return fmt.Errorf("sink %s: %v", sinkConfig.Name, err)
+		}
+		defer pipeline.Close()
+		bus.Subscribe(pipeline.Observe)
+	}
+	bus.Subscribe(NewRulesEngine(config.Rules, config.NumberLocale(), config.CostModel(), SystemClock, bus).Observe)
+
+	seen := newPairSet(*capacity)
+	baseline := !*alertExisting
+	stream := &Stream{
+		Subscription:   sub,
+		FollowEndpoint: *followEndpoint,
+		Solver:         config.Challenge.Solver(),
+		Clearance:      config.Challenge.Clearance(),
+		Logf:           logStream,
+	}
+	stream.OnBlockHash(func(msg *LatestBlockHashMessage) {
+		clock.Observe(msg.LatestBlock, time.Now())
+	})
+	stream.OnPairs(func(msg *PairsMessage) {
+		now := time.Now()
+		for _, pair := range msg.Pairs {
+			if !seen.Add(pair.PairAddress) || baseline {
+				continue
+			}
+			bus.Publish(&PairTransitionEvent{
+				sourced:     sourced{SourceWebsocket},
+				PairAddress: pair.PairAddress,
+				TokenSymbol: pair.TokenSymbol,
+				From:        StateDiscovered,
+				To:          StateDiscovered,
+				Reason:      "first seen on stream",
+				At:          now,
+				Block:       clock.BlockAt(now),
+			})
+		}
+		baseline = false
+	})
+	stream.OnUnknown(func(frame []byte, err error) {
+		color.Red("Error handling message: %v", err)
+	})
+
+	color.Blue("Watching %s on %s for new pairs", strings.Join(sub.DexIDs, ","), strings.Join(sub.ChainIDs, ","))
+	err = stream.Serve(ctx, func(err error) {
+		color.Red("WebSocket error: %v", err)
+	})
+	if ctx.Err() != nil {
+		color.Yellow("Shutting down")
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// WatchlistEntry is one row of an imported watchlist. Either Pair or Mint
+// is set; a mint stands for every Solana pair of the token.
+type WatchlistEntry struct {
+	Pair string   `json:"pair,omitempty"`
+	Mint string   `json:"mint,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+	Note string   `json:"note,omitempty"`
+}
+
+// defaultWatchTag is given to entries imported without tags.
+const defaultWatchTag = "watch"
+
+// LoadWatchlist reads a watchlist file, CSV for .csv and JSON otherwise.
+func LoadWatchlist(path string) ([]WatchlistEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	format := "json"
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		format = "csv"
+	}
+	entries, err := ParseWatchlist(file, format)
+	if err != nil {
+		return nil, fmt.Errorf("watchlist %s: %v", path, err)
+	}
+	return entries, nil
+}
+
+// ParseWatchlist reads a watchlist in format csv or json.
+//
+// CSVs need a header naming a pair column (pair, pairAddress, pair_address)
+// and/or a mint column (mint, token, tokenAddress, address); tags and note
+// columns are optional, with tags separated by spaces, semicolons or pipes
+// since commas already split cells. JSON is an array of WatchlistEntry.
+func ParseWatchlist(r io.Reader, format string) ([]WatchlistEntry, error) {
+	var entries []WatchlistEntry
+	switch format {
+	case "json":
+		if err := json.NewDecoder(r).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("parse json: %v", err)
+		}
+	case "csv":
+		var err error
+		if entries, err = parseWatchlistCSV(r); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown watchlist format: %q", format)
+	}
+
+	for i, entry := range entries {
+		if entry.Pair == "" && entry.Mint == "" {
+			return nil, fmt.Errorf("entry %d has neither pair nor mint", i+1)
+		}
+		for _, addr := range []string{entry.Pair, entry.Mint} {
+			if _, err := decodeAddress(addr); addr != "" && err != nil {
+				return nil, fmt.Errorf("entry %d: invalid address %q: %v", i+1, addr, err)
+			}
+		}
+	}
+	return entries, nil
+}
+
+func parseWatchlistCSV(r io.Reader) ([]WatchlistEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %v", err)
+	}
+	column := func(names ...string) int {
+		for i, h := range header {
+			for _, name := range names {
+				if strings.EqualFold(strings.TrimSpace(h), name) {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+	pairCol := column("pair", "pairAddress", "pair_address")
+	mintCol := column("mint", "token", "tokenAddress", "token_address", "address")
+	tagsCol := column("tags", "tag")
+	noteCol := column("note", "notes")
+	if pairCol < 0 && mintCol < 0 {
+		return nil, fmt.Errorf("need a pair or mint column, got %v", header)
+	}
+	cell := func(record []string, col int) string {
+		if col < 0 || col >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[col])
+	}
+
+	var entries []WatchlistEntry
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		entry := WatchlistEntry{
+			Pair: cell(record, pairCol),
+			Mint: cell(record, mintCol),
+			Tags: strings.FieldsFunc(cell(record, tagsCol), func(r rune) bool { return r == ' ' || r == ';' || r == '|' }),
+			Note: cell(record, noteCol),
+		}
+		// spreadsheets often end in blank rows
+		if entry.Pair == "" && entry.Mint == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// Watchlist follows imported pairs whatever the stream's filters, by
+// polling the REST API for them, and tags them in notes. Mints are
+// resolved to their Solana pairs on the next poll.
+type Watchlist struct {
+	notes  *Notes
+	client *http.Client
+
+	mu    sync.Mutex
+	pairs map[string]bool
+	// mints waiting to be resolved, with the entry to tag their pairs from
+	mints map[string]WatchlistEntry
+}
+
+func NewWatchlist(notes *Notes) *Watchlist {
+	return &Watchlist{
+		notes:  notes,
+		client: &http.Client{Timeout: 15 * time.Second},
+		pairs:  make(map[string]bool),
+		mints:  make(map[string]WatchlistEntry),
+	}
+}
+
+// WatchlistStatus is what the watchlist follows.
+type WatchlistStatus struct {
+	Pairs        []string `json:"pairs"`
+	PendingMints []string `json:"pendingMints"`
+}
+
+// Add watches entries, tagging pairs right away and mints once resolved.
+func (w *Watchlist) Add(entries []WatchlistEntry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, entry := range entries {
+		if len(entry.Tags) == 0 {
+			entry.Tags = []string{defaultWatchTag}
+		}
+		if entry.Pair == "" {
+			w.mints[entry.Mint] = entry
+			continue
+		}
+		w.pairs[entry.Pair] = true
+		if err := w.tag(entry.Pair, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Watchlist) tag(pair string, entry WatchlistEntry) error {
+	if _, err := w.notes.Tag(pair, "watchlist", entry.Tags...); err != nil {
+		return fmt.Errorf("tag %s: %v", pair, err)
+	}
+	if entry.Note != "" {
+		if _, err := w.notes.SetNote(pair, "watchlist", entry.Note); err != nil {
+			return fmt.Errorf("note %s: %v", pair, err)
+		}
+	}
+	return nil
+}
+
+func (w *Watchlist) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pairs) + len(w.mints)
+}
+
+func (w *Watchlist) Status() WatchlistStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := WatchlistStatus{Pairs: []string{}, PendingMints: []string{}}
+	for pair := range w.pairs {
+		status.Pairs = append(status.Pairs, pair)
+	}
+	for mint := range w.mints {
+		status.PendingMints = append(status.PendingMints, mint)
+	}
+	sort.Strings(status.Pairs)
+	sort.Strings(status.PendingMints)
+	return status
+}
+
+// Poll resolves pending mints and fetches the current state of every
+// watched pair. Mints the API does not know yet stay pending, and a
+// failed lookup of mints still polls the pairs already known.
+func (w *Watchlist) Poll(ctx context.Context) ([]RESTPair, error) {
+	status := w.Status()
+	var fetched []RESTPair
+	var resolveErr error
+	seen := make(map[string]bool)
+
+	for start := 0; start < len(status.PendingMints); start += restPairsBatchSize {
+		batch := status.PendingMints[start:min(start+restPairsBatchSize, len(status.PendingMints))]
+		pairs, err := fetchRESTTokenPairs(ctx, w.client, batch)
+		if err != nil {
+			resolveErr = fmt.Errorf("resolve mints: %v", err)
+			break
+		}
+		for _, pair := range pairs {
+			if pair.ChainID != "solana" || !slices.Contains(batch, pair.BaseToken.Address) || seen[pair.PairAddress] {
+				continue
+			}
+			if err := w.resolve(pair); err != nil {
+				color.Red("Watchlist: %v", err)
+			}
+			seen[pair.PairAddress] = true
+			fetched = append(fetched, pair)
+		}
+	}
+	w.mu.Lock()
+	for _, pair := range fetched {
+		delete(w.mints, pair.BaseToken.Address)
+	}
+	w.mu.Unlock()
+
+	var watched []string
+	for _, pair := range status.Pairs {
+		if !seen[pair] {
+			watched = append(watched, pair)
+		}
+	}
+	for start := 0; start < len(watched); start += restPairsBatchSize {
+		pairs, err := fetchRESTPairs(ctx, w.client, watched[start:min(start+restPairsBatchSize, len(watched))])
+		if err != nil {
+			return fetched, err
+		}
+		fetched = append(fetched, pairs...)
+	}
+	return fetched, resolveErr
+}
+
+// resolve watches a pair of a pending mint. The mint stays pending until
+// all of its pairs in the response are resolved.
+func (w *Watchlist) resolve(pair RESTPair) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	entry := w.mints[pair.BaseToken.Address]
+	if w.pairs[pair.PairAddress] {
+		return nil
+	}
+	w.pairs[pair.PairAddress] = true
+	fmt.Fprintf(console, "Watchlist: %s (%s) resolved to pair %s\n", pair.BaseToken.Address, pair.BaseToken.Symbol, pair.PairAddress)
+	return w.tag(pair.PairAddress, entry)
+}
+
+// RegisterWatchlist mounts the watchlist API:
+//
+//	GET  /watchlist                 watched pairs and pending mints
+//	POST /watchlist                 import a CSV (text/csv or ?format=csv) or JSON body
+//
+// Imports last until restart; list them in -watchlist to keep them.
+func RegisterWatchlist(server *Server, watchlist *Watchlist) {
+	server.HandleJSON("GET /watchlist", func(r *http.Request) (any, error) {
+		return watchlist.Status(), nil
+	})
+	server.HandleJSON("POST /watchlist", func(r *http.Request) (any, error) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "json"
+			if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); strings.HasSuffix(mediaType, "csv") {
+				format = "csv"
+			}
+		}
+		entries, err := ParseWatchlist(r.Body, format)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return nil, errors.New("watchlist is empty")
+		}
+		if err := watchlist.Add(entries); err != nil {
+			return nil, err
+		}
+		return map[string]any{"added": len(entries), "status": watchlist.Status()}, nil
+	})
+}